@@ -12,6 +12,7 @@ import (
 	"otp-auth/config"
 	"otp-auth/controller"
 	_ "otp-auth/docs" // Import for swagger
+	"otp-auth/entity"
 	"otp-auth/handler"
 	"otp-auth/migrations"
 	"otp-auth/pkg/logger"
@@ -105,30 +106,113 @@ func main() {
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db)
 	otpRepo := repository.NewOTPRepository(db)
-	rateLimitRepo := repository.NewRedisRateLimitRepository(redisClient, cfg, log)
+	outboxRepo := repository.NewOutboxRepository(db)
+	receiptRepo := repository.NewDeliveryReceiptRepository(db)
+	templateRepo := repository.NewMessageTemplateRepository(db)
+	destinationRuleRepo := repository.NewDestinationRuleRepository(db)
+	lockoutRepo := repository.NewLockoutRepository(db)
+	txManager := repository.NewTxManager(db)
+
+	var rateLimitRepo repository.RateLimitRepository
+	switch cfg.RateLimit.Store {
+	case config.RateLimitStorePostgres:
+		rateLimitRepo = repository.NewPostgresRateLimitRepository(db)
+	case config.RateLimitStoreMemory:
+		rateLimitRepo = repository.NewMemoryRateLimitRepository()
+		log.Warnw("Rate limits kept in process memory; they are not shared between instances and reset on restart")
+	default:
+		rateLimitRepo = repository.NewRedisRateLimitRepository(redisClient, cfg, log)
+	}
+
+	// Initialize OTP delivery providers; the dev inbox keeps messages in memory in their place
+	// for local development and end-to-end tests
+	var senders map[string]service.Sender
+	var devInboxController *controller.DevInboxController
+	if cfg.DevInbox.Enabled {
+		devInbox := service.NewDevInbox(cfg.DevInbox.Size)
+		senders = service.NewDevInboxSenders(cfg.Delivery.Channels, devInbox)
+		devInboxController = controller.NewDevInboxController(devInbox, log)
+
+		log.Warnw("Dev inbox enabled; messages are not delivered and are readable without authentication", "environment", cfg.Application.Environment, "channels", cfg.Delivery.Channels)
+	} else {
+		senders, err = service.NewSenders(cfg, log)
+		if err != nil {
+			log.Fatalw("Failed to initialize OTP delivery providers", "error", err)
+		}
+
+		log.Infow("OTP delivery providers initialized", "provider", cfg.Delivery.Provider, "channels", cfg.Delivery.Channels)
+	}
+
+	// Load and validate OTP message templates
+	templates, err := service.LoadMessageTemplates(cfg, templateRepo)
+	if err != nil {
+		log.Fatalw("Failed to load message templates", "error", err)
+	}
+
+	renderer, err := service.NewMessageRenderer(templates, cfg.Messages.DefaultLocale, entity.Purposes)
+	if err != nil {
+		log.Fatalw("Invalid message templates", "error", err)
+	}
+
+	log.Infow("Message templates loaded", "source", cfg.Messages.Source, "locales", renderer.Locales())
+
+	// Messages that outgrow the SMS Retriever limit are sent without autofill lines
+	for _, problem := range service.CheckAutofillFormats(renderer, cfg) {
+		log.Warnw("OTP message too long for autofill", "error", problem)
+	}
+
+	// Load the allow and deny rules for OTP destinations; they are reloaded in the background
+	destinations, err := service.NewDestinationPolicy(cfg.Destinations, destinationRuleRepo, log)
+	if err != nil {
+		log.Fatalw("Failed to load destination rules", "error", err)
+	}
+
+	// Watch send-to-verify conversion for SMS pumping
+	anomalies := service.NewAnomalyDetector(otpRepo, cfg.Anomaly, log)
 
 	// Initialize services
 	userService := service.NewUserService(userRepo, log)
 	tokenService := service.NewTokenService(redisClient, log)
 	jwtService := service.NewJWTService(cfg, log, tokenService)
-	otpService := service.NewOTPService(otpRepo, userRepo, rateLimitRepo, cfg, log)
+	otpService := service.NewOTPService(otpRepo, userRepo, rateLimitRepo, lockoutRepo, outboxRepo, receiptRepo, txManager, renderer, destinations, anomalies, cfg, log)
+	receiptService := service.NewDeliveryReceiptService(otpRepo, receiptRepo, outboxRepo, cfg, log)
+	outboxWorker := service.NewOutboxWorker(outboxRepo, otpRepo, senders, cfg, log)
 
 	// Initialize controllers
 	userController := controller.NewUserController(userService, log)
-	otpController := controller.NewOTPController(otpService, jwtService, v, log)
+	otpController := controller.NewOTPController(otpService, jwtService, v, log, cfg.MagicLink.RedirectURL)
 	authController := controller.NewAuthController(jwtService, log)
 	healthController := controller.NewHealthController()
+	receiptController := controller.NewDeliveryReceiptController(receiptService, v, log)
+
+	// Rate limit admin API for support staff, only when admins are configured
+	var rateLimitAdminController *controller.RateLimitAdminController
+	if cfg.Admin.Enabled() {
+		auditRepo := repository.NewRateLimitAuditRepository(db)
+		rateLimitAdminService := service.NewRateLimitAdminService(rateLimitRepo, auditRepo, txManager, cfg, log)
+		rateLimitAdminController = controller.NewRateLimitAdminController(rateLimitAdminService, v, log)
+	}
 
 	// Initialize Echo server
 	e := echo.New()
 	e.HideBanner = true
 
 	// Register routes
-	handler.RegisterRoutes(e, otpController, userController, authController, healthController, jwtService, cfg, log)
+	handler.RegisterRoutes(e, otpController, userController, authController, healthController, receiptController, devInboxController, rateLimitAdminController, jwtService, cfg, log)
 
 	// Start cleanup routine in background
 	go startCleanupRoutine(otpService, log)
 
+	// Start outbox workers delivering queued OTPs
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	workersDone := make(chan struct{})
+	go destinations.Start(workerCtx)
+	go anomalies.Start(workerCtx)
+	go func() {
+		outboxWorker.Start(workerCtx)
+		close(workersDone)
+	}()
+
 	// Start server in a goroutine
 	serverAddr := fmt.Sprintf(":%d", cfg.HTTPServer.Port)
 	go func() {
@@ -155,6 +239,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Stop outbox workers after in-flight requests are done
+	stopWorkers()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		log.Warnw("Outbox workers did not stop before shutdown timeout")
+	}
+
 	log.Infow("Server shutdown completed successfully")
 }
 
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// adminPhoneNumberPattern matches an E.164 phone number
+var adminPhoneNumberPattern = regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
+
+// Admin configures who may use the admin API
+type Admin struct {
+	PhoneNumbers []string // signed in users with these phone numbers are admins; the admin API is disabled when empty
+}
+
+// Enabled reports whether the admin API is available
+func (a Admin) Enabled() bool {
+	return len(a.PhoneNumbers) > 0
+}
+
+// IsAdmin reports whether a signed in phone number is an admin
+func (a Admin) IsAdmin(phoneNumber string) bool {
+	for _, number := range a.PhoneNumbers {
+		if number == phoneNumber {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAdmin checks the admin phone numbers; test numbers get a known code, so they
+// cannot be admins
+func validateAdmin(cfg *Config) error {
+	for _, number := range cfg.Admin.PhoneNumbers {
+		if !adminPhoneNumberPattern.MatchString(number) {
+			return fmt.Errorf("invalid admin phone number %q", number)
+		}
+		if cfg.TestNumbers.Matches(number) {
+			return fmt.Errorf("admin phone number %s is a test phone number", number)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Anomaly actions
+const (
+	AnomalyActionAlert    = "alert"    // log and notify only
+	AnomalyActionThrottle = "throttle" // also apply the throttle limit to the prefix or IP
+	AnomalyActionBlock    = "block"    // also refuse every send to the prefix or from the IP
+)
+
+// Anomaly configures detection of SMS pumping from collapsing send-to-verify conversion
+type Anomaly struct {
+	Enabled             bool
+	Window              time.Duration // rolling window sessions are counted over
+	CheckInterval       time.Duration // how often conversion is evaluated
+	MinSends            int           // sessions a prefix or IP needs in the window before it is judged
+	MinConversionRate   float64       // share of sessions verified below which a prefix or IP is flagged
+	Action              string        // alert, throttle or block
+	ThrottleMaxRequests int           // sends allowed per throttle window to a flagged prefix or IP
+	ThrottleWindow      time.Duration
+	WebhookURL          string // alerts are posted here when set
+	WebhookAuthToken    string
+}
+
+// ThrottlePolicy returns the limit applied to flagged prefixes and IPs when throttling
+func (a Anomaly) ThrottlePolicy(algorithm string) RateLimitPolicy {
+	return RateLimitPolicy{Algorithm: algorithm, Limit: a.ThrottleMaxRequests, Window: a.ThrottleWindow}
+}
+
+// validateAnomaly checks the detection settings when detection is enabled
+func validateAnomaly(a Anomaly) error {
+	if !a.Enabled {
+		return nil
+	}
+
+	if a.Window <= 0 || a.CheckInterval <= 0 {
+		return fmt.Errorf("ANOMALY_WINDOW and ANOMALY_CHECK_INTERVAL must be positive")
+	}
+	// Conversion stats are kept for a day
+	if a.Window > 24*time.Hour {
+		return fmt.Errorf("ANOMALY_WINDOW must be at most 24h")
+	}
+	if a.MinSends < 1 {
+		return fmt.Errorf("ANOMALY_MIN_SENDS must be at least 1")
+	}
+	if a.MinConversionRate <= 0 || a.MinConversionRate > 1 {
+		return fmt.Errorf("ANOMALY_MIN_CONVERSION_RATE must be greater than 0 and at most 1")
+	}
+
+	switch a.Action {
+	case AnomalyActionAlert, AnomalyActionBlock:
+	case AnomalyActionThrottle:
+		if a.ThrottleMaxRequests < 1 || a.ThrottleWindow <= 0 {
+			return fmt.Errorf("ANOMALY_THROTTLE_MAX_REQUESTS and ANOMALY_THROTTLE_WINDOW_DURATION must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown ANOMALY_ACTION %q (use alert, throttle or block)", a.Action)
+	}
+
+	if a.WebhookURL != "" {
+		if u, err := url.Parse(a.WebhookURL); err != nil || !u.IsAbs() {
+			return fmt.Errorf("ANOMALY_WEBHOOK_URL must be an absolute URL")
+		}
+	}
+
+	return nil
+}
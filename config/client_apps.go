@@ -0,0 +1,69 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// androidAppHashPattern matches the 11-character SMS Retriever app signature hash
+var androidAppHashPattern = regexp.MustCompile(`^[A-Za-z0-9+/]{11}$`)
+
+// Verification modes of a client app
+const (
+	VerifyModeSessionToken = "session_token"
+	VerifyModePhoneNumber  = "phone_number"
+)
+
+// ClientApp is a registered client application with its message formatting options
+type ClientApp struct {
+	ID             string `json:"id"`
+	AndroidAppHash string `json:"android_app_hash,omitempty"` // SMS Retriever app signature hash
+	WebOTPDomain   string `json:"webotp_domain,omitempty"`    // origin host for the WebOTP "@domain #code" line
+	VerifyMode     string `json:"verify_mode,omitempty"`      // session_token (default) or phone_number
+}
+
+// loadClientApps reads the registered client apps from a JSON array file
+func loadClientApps(path string) (map[string]ClientApp, error) {
+	apps := make(map[string]ClientApp)
+	if path == "" {
+		return apps, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client apps file: %w", err)
+	}
+
+	var list []ClientApp
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse client apps file: %w", err)
+	}
+
+	for _, app := range list {
+		if app.ID == "" {
+			return nil, fmt.Errorf("client app without id in %s", path)
+		}
+		if _, exists := apps[app.ID]; exists {
+			return nil, fmt.Errorf("duplicate client app %s", app.ID)
+		}
+		if app.AndroidAppHash != "" && !androidAppHashPattern.MatchString(app.AndroidAppHash) {
+			return nil, fmt.Errorf("client app %s: android_app_hash must be 11 base64 characters", app.ID)
+		}
+		if strings.ContainsAny(app.WebOTPDomain, " /:#@") {
+			return nil, fmt.Errorf("client app %s: webotp_domain must be a bare host name", app.ID)
+		}
+		switch app.VerifyMode {
+		case "":
+			app.VerifyMode = VerifyModeSessionToken
+		case VerifyModeSessionToken, VerifyModePhoneNumber:
+		default:
+			return nil, fmt.Errorf("client app %s: verify_mode must be session_token or phone_number", app.ID)
+		}
+		apps[app.ID] = app
+	}
+
+	return apps, nil
+}
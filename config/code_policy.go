@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"otp-auth/entity"
+)
+
+// OTP code alphabets
+const (
+	CodeAlphabetNumeric      = "numeric"
+	CodeAlphabetAlphanumeric = "alphanumeric"
+)
+
+// codeAlphabetCharacters maps each alphabet to its characters. The alphanumeric alphabet is
+// upper case and leaves out characters that are easily confused (0/O, 1/I/L).
+var codeAlphabetCharacters = map[string]string{
+	CodeAlphabetNumeric:      "0123456789",
+	CodeAlphabetAlphanumeric: "23456789ABCDEFGHJKMNPQRSTUVWXYZ",
+}
+
+// Allowed OTP code lengths
+const (
+	minCodeLength = 4
+	maxCodeLength = 16
+)
+
+// CodePolicy describes the codes issued for a purpose
+type CodePolicy struct {
+	Length   int
+	Alphabet string // numeric or alphanumeric
+}
+
+// Characters returns the characters codes are drawn from
+func (p CodePolicy) Characters() string {
+	return codeAlphabetCharacters[p.Alphabet]
+}
+
+// CodePolicy returns the code policy for a purpose, falling back to OTP_LENGTH and OTP_ALPHABET
+func (o OTP) CodePolicy(purpose string) CodePolicy {
+	if policy, ok := o.CodePolicies[purpose]; ok {
+		return policy
+	}
+	return CodePolicy{Length: o.Length, Alphabet: o.Alphabet}
+}
+
+// loadCodePolicies reads the per-purpose overrides OTP_<PURPOSE>_LENGTH and OTP_<PURPOSE>_ALPHABET
+// and validates every resulting policy
+func loadCodePolicies(otp OTP) (map[string]CodePolicy, error) {
+	policies := make(map[string]CodePolicy, len(entity.Purposes))
+	for _, purpose := range entity.Purposes {
+		prefix := "OTP_" + strings.ToUpper(purpose)
+		policy := CodePolicy{
+			Length:   parseIntWithDefault(prefix+"_LENGTH", otp.Length),
+			Alphabet: getEnvWithDefault(prefix+"_ALPHABET", otp.Alphabet),
+		}
+
+		if _, ok := codeAlphabetCharacters[policy.Alphabet]; !ok {
+			return nil, fmt.Errorf("purpose %s: unknown OTP alphabet %q (use numeric or alphanumeric)", purpose, policy.Alphabet)
+		}
+		if policy.Length < minCodeLength || policy.Length > maxCodeLength {
+			return nil, fmt.Errorf("purpose %s: OTP length must be between %d and %d", purpose, minCodeLength, maxCodeLength)
+		}
+		policies[purpose] = policy
+	}
+
+	return policies, nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"testing"
+
+	"otp-auth/entity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadCodePolicies_DefaultsAndOverrides(t *testing.T) {
+	t.Setenv("OTP_PAYMENT_CONFIRMATION_LENGTH", "8")
+	t.Setenv("OTP_ACCOUNT_DELETION_ALPHABET", CodeAlphabetAlphanumeric)
+
+	otp := OTP{Length: 6, Alphabet: CodeAlphabetNumeric}
+	policies, err := loadCodePolicies(otp)
+	require.NoError(t, err)
+	otp.CodePolicies = policies
+
+	assert.Equal(t, CodePolicy{Length: 6, Alphabet: CodeAlphabetNumeric}, otp.CodePolicy(entity.PurposeLogin))
+	assert.Equal(t, CodePolicy{Length: 8, Alphabet: CodeAlphabetNumeric}, otp.CodePolicy(entity.PurposePaymentConfirmation))
+	assert.Equal(t, CodePolicy{Length: 6, Alphabet: CodeAlphabetAlphanumeric}, otp.CodePolicy(entity.PurposeAccountDeletion))
+}
+
+func TestLoadCodePolicies_LengthBounds(t *testing.T) {
+	for length, valid := range map[int]bool{
+		minCodeLength - 1: false,
+		minCodeLength:     true,
+		maxCodeLength:     true,
+		maxCodeLength + 1: false,
+	} {
+		_, err := loadCodePolicies(OTP{Length: length, Alphabet: CodeAlphabetNumeric})
+		if valid {
+			assert.NoError(t, err, "length %d", length)
+		} else {
+			assert.Error(t, err, "length %d", length)
+		}
+	}
+}
+
+func TestLoadCodePolicies_RejectsUnknownAlphabet(t *testing.T) {
+	t.Setenv("OTP_LOGIN_ALPHABET", "hex")
+
+	_, err := loadCodePolicies(OTP{Length: 6, Alphabet: CodeAlphabetNumeric})
+	assert.ErrorContains(t, err, "unknown OTP alphabet")
+}
+
+func TestCodePolicy_AlphanumericLeavesOutAmbiguousCharacters(t *testing.T) {
+	characters := CodePolicy{Alphabet: CodeAlphabetAlphanumeric}.Characters()
+
+	assert.NotContains(t, characters, "0")
+	assert.NotContains(t, characters, "O")
+	assert.NotContains(t, characters, "1")
+	assert.NotContains(t, characters, "I")
+	assert.NotContains(t, characters, "L")
+}
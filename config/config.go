@@ -1,15 +1,26 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// defaultOTPHashPepper is the placeholder pepper, refused in production
+const defaultOTPHashPepper = "your-otp-pepper-change-in-production"
+
 type Application struct {
+	Environment             string // development, staging or production
 	GracefulShutdownTimeout time.Duration
 }
 
+// IsProduction reports whether the service runs in production
+func (a Application) IsProduction() bool {
+	return a.Environment == "production"
+}
+
 type HTTPServer struct {
 	Port int
 }
@@ -35,40 +46,140 @@ type Logger struct {
 	Mode  string // development or production
 }
 
+type Metrics struct {
+	Enabled bool
+}
+
+type DevInbox struct {
+	Enabled bool // non-production only
+	Size    int  // messages kept per phone number
+}
+
 type Swagger struct {
 	Enabled bool `json:"enabled"`
 }
 
 type JWT struct {
-	Secret         string
-	ExpirationTime time.Duration
+	Secret                     string
+	ExpirationTime             time.Duration
+	ConfirmationExpirationTime time.Duration
 }
 
 type OTP struct {
 	Length         int
+	Alphabet       string                // default alphabet: numeric or alphanumeric
+	CodePolicies   map[string]CodePolicy // per purpose, see CodePolicy
 	ExpirationTime time.Duration
+	HashPepper     string // HMAC key for stored codes and session tokens
+
+	MaxVerifyAttempts int           // attempts per session before it is burned
+	LockoutThreshold  int           // burned sessions within LockoutWindow that lock the phone number
+	LockoutWindow     time.Duration // window in which burned sessions are counted
+	LockoutDuration   time.Duration // how long the phone number stays locked
+
+	ResendCooldown time.Duration // minimum time between two sends on a session
+	MaxResends     int           // resends allowed per session
+}
+
+type Messages struct {
+	Source        string // file or db
+	Dir           string // <dir>/<locale>/<purpose>.tmpl, used by the file source
+	DefaultLocale string
+	AppName       string
 }
 
 type RateLimit struct {
 	MaxRequests    int
 	WindowDuration time.Duration
+	Algorithm      string // fixed_window, sliding_log, sliding_window or token_bucket
+	Store          string // redis, postgres or memory
+
+	// Optional limits on sends and resends, checked together with the phone number limit
+	IP      RateLimitPolicy // per client IP
+	Device  RateLimitPolicy // per X-Device-ID header
+	Country RateLimitPolicy // per country calling code of the phone number
+	Global  RateLimitPolicy // across all requests
+}
+
+type Delivery struct {
+	Provider            string // SMS provider: console, webhook or smpp
+	Timeout             time.Duration
+	Channels            []string // ordered fallback chain: sms, voice, email, messaging_app
+	ConfirmationTimeout time.Duration
+	Webhook             WebhookGateway
+	SMPP                SMPP
+	Voice               WebhookGateway
+	MessagingApp        WebhookGateway
+	Email               SMTP
+}
+
+type DeliveryReceipts struct {
+	Secret  string        // shared secret for HMAC-SHA256 signatures; endpoint disabled when empty
+	MaxSkew time.Duration // maximum age of a signed receipt
+}
+
+type Outbox struct {
+	Workers       int
+	PollInterval  time.Duration
+	BatchSize     int
+	LeaseDuration time.Duration
+	MaxAttempts   int
+	BaseBackoff   time.Duration
+	MaxBackoff    time.Duration
+}
+
+type WebhookGateway struct {
+	URL       string
+	AuthToken string
+	SenderID  string
+}
+
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	Subject  string
+}
+
+type SMPP struct {
+	Host       string
+	Port       int
+	SystemID   string
+	Password   string
+	SystemType string
+	SourceAddr string
 }
 
 type Config struct {
-	Application Application
-	HTTPServer  HTTPServer
-	Database    Database
-	Redis       Redis
-	Logger      Logger
-	Swagger     Swagger
-	JWT         JWT
-	OTP         OTP
-	RateLimit   RateLimit
+	Application      Application
+	HTTPServer       HTTPServer
+	Database         Database
+	Redis            Redis
+	Logger           Logger
+	Swagger          Swagger
+	JWT              JWT
+	OTP              OTP
+	RateLimit        RateLimit
+	Messages         Messages
+	Delivery         Delivery
+	Outbox           Outbox
+	DeliveryReceipts DeliveryReceipts
+	Metrics          Metrics
+	ClientApps       map[string]ClientApp // keyed by client app ID
+	TestNumbers      TestNumbers
+	DevInbox         DevInbox
+	MagicLink        MagicLink
+	Admin            Admin
+	Destinations     DestinationPolicy
+	Anomaly          Anomaly
 }
 
 func Load() (*Config, error) {
 	cfg := &Config{
 		Application: Application{
+			Environment:             getEnvWithDefault("APP_ENV", "production"),
 			GracefulShutdownTimeout: parseDurationWithDefault("APPLICATION_GRACEFUL_SHUTDOWN_TIMEOUT", 30*time.Second),
 		},
 		HTTPServer: HTTPServer{
@@ -90,12 +201,23 @@ func Load() (*Config, error) {
 			Enabled: getEnvBoolWithDefault("SWAGGER_ENABLED", true),
 		},
 		JWT: JWT{
-			Secret:         getEnvWithDefault("JWT_SECRET", "your-super-secret-key-change-in-production"),
-			ExpirationTime: parseDurationWithDefault("JWT_EXPIRATION_TIME", 24*time.Hour),
+			Secret:                     getEnvWithDefault("JWT_SECRET", "your-super-secret-key-change-in-production"),
+			ExpirationTime:             parseDurationWithDefault("JWT_EXPIRATION_TIME", 24*time.Hour),
+			ConfirmationExpirationTime: parseDurationWithDefault("JWT_CONFIRMATION_EXPIRATION_TIME", 5*time.Minute),
 		},
 		OTP: OTP{
 			Length:         parseIntWithDefault("OTP_LENGTH", 6),
+			Alphabet:       getEnvWithDefault("OTP_ALPHABET", CodeAlphabetNumeric),
 			ExpirationTime: parseDurationWithDefault("OTP_EXPIRATION_TIME", 2*time.Minute),
+			HashPepper:     getEnvWithDefault("OTP_HASH_PEPPER", defaultOTPHashPepper),
+
+			MaxVerifyAttempts: parseIntWithDefault("OTP_MAX_VERIFY_ATTEMPTS", 5),
+			LockoutThreshold:  parseIntWithDefault("OTP_LOCKOUT_THRESHOLD", 3),
+			LockoutWindow:     parseDurationWithDefault("OTP_LOCKOUT_WINDOW", time.Hour),
+			LockoutDuration:   parseDurationWithDefault("OTP_LOCKOUT_DURATION", time.Hour),
+
+			ResendCooldown: parseDurationWithDefault("OTP_RESEND_COOLDOWN", 30*time.Second),
+			MaxResends:     parseIntWithDefault("OTP_MAX_RESENDS", 3),
 		},
 		Redis: Redis{
 			Host:     getEnvWithDefault("REDIS_HOST", "redis"),
@@ -106,9 +228,160 @@ func Load() (*Config, error) {
 		RateLimit: RateLimit{
 			MaxRequests:    parseIntWithDefault("RATE_LIMIT_MAX_REQUESTS", 3),
 			WindowDuration: parseDurationWithDefault("RATE_LIMIT_WINDOW_DURATION", 10*time.Minute),
+			Algorithm:      getEnvWithDefault("RATE_LIMIT_ALGORITHM", RateLimitFixedWindow),
+			Store:          getEnvWithDefault("RATE_LIMIT_STORE", RateLimitStoreRedis),
+		},
+		Messages: Messages{
+			Source:        getEnvWithDefault("MESSAGE_TEMPLATE_SOURCE", "file"),
+			Dir:           getEnvWithDefault("MESSAGE_TEMPLATE_DIR", "./templates/messages"),
+			DefaultLocale: getEnvWithDefault("MESSAGE_DEFAULT_LOCALE", "en"),
+			AppName:       getEnvWithDefault("APP_NAME", "OTP Auth"),
+		},
+		Delivery: Delivery{
+			Provider:            getEnvWithDefault("DELIVERY_PROVIDER", "console"),
+			Timeout:             parseDurationWithDefault("DELIVERY_TIMEOUT", 10*time.Second),
+			Channels:            parseListWithDefault("DELIVERY_CHANNELS", []string{"sms"}),
+			ConfirmationTimeout: parseDurationWithDefault("DELIVERY_CONFIRMATION_TIMEOUT", 30*time.Second),
+			Webhook: WebhookGateway{
+				URL:       getEnvWithDefault("SMS_WEBHOOK_URL", ""),
+				AuthToken: getEnvWithDefault("SMS_WEBHOOK_AUTH_TOKEN", ""),
+				SenderID:  getEnvWithDefault("SMS_WEBHOOK_SENDER_ID", ""),
+			},
+			SMPP: SMPP{
+				Host:       getEnvWithDefault("SMPP_HOST", ""),
+				Port:       parseIntWithDefault("SMPP_PORT", 2775),
+				SystemID:   getEnvWithDefault("SMPP_SYSTEM_ID", ""),
+				Password:   getEnvWithDefault("SMPP_PASSWORD", ""),
+				SystemType: getEnvWithDefault("SMPP_SYSTEM_TYPE", ""),
+				SourceAddr: getEnvWithDefault("SMPP_SOURCE_ADDR", ""),
+			},
+			Voice: WebhookGateway{
+				URL:       getEnvWithDefault("VOICE_WEBHOOK_URL", ""),
+				AuthToken: getEnvWithDefault("VOICE_WEBHOOK_AUTH_TOKEN", ""),
+				SenderID:  getEnvWithDefault("VOICE_WEBHOOK_SENDER_ID", ""),
+			},
+			MessagingApp: WebhookGateway{
+				URL:       getEnvWithDefault("MESSAGING_APP_WEBHOOK_URL", ""),
+				AuthToken: getEnvWithDefault("MESSAGING_APP_WEBHOOK_AUTH_TOKEN", ""),
+				SenderID:  getEnvWithDefault("MESSAGING_APP_WEBHOOK_SENDER_ID", ""),
+			},
+			Email: SMTP{
+				Host:     getEnvWithDefault("SMTP_HOST", ""),
+				Port:     parseIntWithDefault("SMTP_PORT", 587),
+				Username: getEnvWithDefault("SMTP_USERNAME", ""),
+				Password: getEnvWithDefault("SMTP_PASSWORD", ""),
+				From:     getEnvWithDefault("SMTP_FROM", ""),
+				Subject:  getEnvWithDefault("SMTP_SUBJECT", "Your verification code"),
+			},
+		},
+		DeliveryReceipts: DeliveryReceipts{
+			Secret:  getEnvWithDefault("DLR_SECRET", ""),
+			MaxSkew: parseDurationWithDefault("DLR_MAX_SKEW", 5*time.Minute),
+		},
+		Metrics: Metrics{
+			Enabled: getEnvBoolWithDefault("METRICS_ENABLED", true),
+		},
+		TestNumbers: TestNumbers{
+			Numbers:           parseListWithDefault("TEST_PHONE_NUMBERS", nil),
+			Code:              getEnvWithDefault("TEST_PHONE_CODE", ""),
+			AllowInProduction: getEnvBoolWithDefault("TEST_PHONE_NUMBERS_ALLOW_IN_PRODUCTION", false),
+		},
+		MagicLink: MagicLink{
+			BaseURL:     strings.TrimSuffix(getEnvWithDefault("MAGIC_LINK_BASE_URL", ""), "/"),
+			RedirectURL: getEnvWithDefault("MAGIC_LINK_REDIRECT_URL", ""),
+		},
+		Admin: Admin{
+			PhoneNumbers: parseListWithDefault("ADMIN_PHONE_NUMBERS", nil),
+		},
+		Anomaly: Anomaly{
+			Enabled:             getEnvBoolWithDefault("ANOMALY_DETECTION_ENABLED", false),
+			Window:              parseDurationWithDefault("ANOMALY_WINDOW", time.Hour),
+			CheckInterval:       parseDurationWithDefault("ANOMALY_CHECK_INTERVAL", time.Minute),
+			MinSends:            parseIntWithDefault("ANOMALY_MIN_SENDS", 20),
+			MinConversionRate:   parseFloatWithDefault("ANOMALY_MIN_CONVERSION_RATE", 0.2),
+			Action:              getEnvWithDefault("ANOMALY_ACTION", AnomalyActionThrottle),
+			ThrottleMaxRequests: parseIntWithDefault("ANOMALY_THROTTLE_MAX_REQUESTS", 5),
+			ThrottleWindow:      parseDurationWithDefault("ANOMALY_THROTTLE_WINDOW_DURATION", 10*time.Minute),
+			WebhookURL:          getEnvWithDefault("ANOMALY_WEBHOOK_URL", ""),
+			WebhookAuthToken:    getEnvWithDefault("ANOMALY_WEBHOOK_AUTH_TOKEN", ""),
+		},
+		Destinations: DestinationPolicy{
+			Source:         getEnvWithDefault("DESTINATION_POLICY_SOURCE", DestinationPolicySourceNone),
+			File:           getEnvWithDefault("DESTINATION_POLICY_FILE", ""),
+			ReloadInterval: parseDurationWithDefault("DESTINATION_POLICY_RELOAD_INTERVAL", 30*time.Second),
 		},
+		DevInbox: DevInbox{
+			Enabled: getEnvBoolWithDefault("DEV_INBOX_ENABLED", false),
+			Size:    parseIntWithDefault("DEV_INBOX_SIZE", 10),
+		},
+		Outbox: Outbox{
+			Workers:       parseIntWithDefault("OUTBOX_WORKERS", 4),
+			PollInterval:  parseDurationWithDefault("OUTBOX_POLL_INTERVAL", 500*time.Millisecond),
+			BatchSize:     parseIntWithDefault("OUTBOX_BATCH_SIZE", 10),
+			LeaseDuration: parseDurationWithDefault("OUTBOX_LEASE_DURATION", 30*time.Second),
+			MaxAttempts:   parseIntWithDefault("OUTBOX_MAX_ATTEMPTS", 5),
+			BaseBackoff:   parseDurationWithDefault("OUTBOX_BASE_BACKOFF", 2*time.Second),
+			MaxBackoff:    parseDurationWithDefault("OUTBOX_MAX_BACKOFF", time.Minute),
+		},
+	}
+
+	cfg.RateLimit.IP = loadRateLimitPolicy("RATE_LIMIT_IP", cfg.RateLimit.Policy())
+	cfg.RateLimit.Device = loadRateLimitPolicy("RATE_LIMIT_DEVICE", cfg.RateLimit.Policy())
+	cfg.RateLimit.Country = loadRateLimitPolicy("RATE_LIMIT_COUNTRY", cfg.RateLimit.Policy())
+	cfg.RateLimit.Global = loadRateLimitPolicy("RATE_LIMIT_GLOBAL", cfg.RateLimit.Policy())
+	if err := validateRateLimit(cfg.RateLimit); err != nil {
+		return nil, err
+	}
+
+	if err := validateVerifyLimits(cfg.OTP); err != nil {
+		return nil, err
+	}
+
+	codePolicies, err := loadCodePolicies(cfg.OTP)
+	if err != nil {
+		return nil, err
+	}
+	cfg.OTP.CodePolicies = codePolicies
+
+	if err := validateTestNumbers(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := validateAdmin(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := validateMagicLink(cfg.MagicLink); err != nil {
+		return nil, err
+	}
+
+	if err := validateDestinationPolicy(cfg.Destinations); err != nil {
+		return nil, err
+	}
+
+	if err := validateAnomaly(cfg.Anomaly); err != nil {
+		return nil, err
+	}
+
+	// A known pepper lets anyone holding a database dump brute-force codes and open queued messages
+	if cfg.Application.IsProduction() && (cfg.OTP.HashPepper == "" || cfg.OTP.HashPepper == defaultOTPHashPepper) {
+		return nil, fmt.Errorf("OTP_HASH_PEPPER must be set to a secret value in production")
 	}
 
+	// The dev inbox exposes codes without authentication
+	if cfg.DevInbox.Enabled && cfg.Application.IsProduction() {
+		return nil, fmt.Errorf("DEV_INBOX_ENABLED cannot be used in production; set APP_ENV to development or staging")
+	}
+	if cfg.DevInbox.Size < 1 {
+		return nil, fmt.Errorf("DEV_INBOX_SIZE must be at least 1")
+	}
+
+	clientApps, err := loadClientApps(getEnvWithDefault("CLIENT_APPS_FILE", ""))
+	if err != nil {
+		return nil, err
+	}
+	cfg.ClientApps = clientApps
+
 	// Support legacy environment variables for backwards compatibility
 	if port := os.Getenv("APP_PORT"); port != "" {
 		if p, err := strconv.Atoi(port); err == nil {
@@ -144,6 +417,33 @@ func parseDurationWithDefault(key string, defaultValue time.Duration) time.Durat
 	return defaultValue
 }
 
+func parseFloatWithDefault(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func parseListWithDefault(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return defaultValue
+	}
+	return items
+}
+
 func getEnvBoolWithDefault(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if parsed, err := strconv.ParseBool(value); err == nil {
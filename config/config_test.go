@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_HashPepperRequiredInProduction(t *testing.T) {
+	t.Setenv("APP_ENV", "production")
+
+	_, err := Load()
+	assert.ErrorContains(t, err, "OTP_HASH_PEPPER")
+
+	t.Setenv("OTP_HASH_PEPPER", defaultOTPHashPepper)
+	_, err = Load()
+	assert.ErrorContains(t, err, "OTP_HASH_PEPPER")
+
+	t.Setenv("OTP_HASH_PEPPER", "3f9c1e0a7b")
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "3f9c1e0a7b", cfg.OTP.HashPepper)
+}
+
+func TestLoad_DefaultHashPepperOutsideProduction(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, defaultOTPHashPepper, cfg.OTP.HashPepper)
+}
+
+func TestLoad_DevInboxRefusedInProduction(t *testing.T) {
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("OTP_HASH_PEPPER", "3f9c1e0a7b")
+	t.Setenv("DEV_INBOX_ENABLED", "true")
+
+	_, err := Load()
+	assert.ErrorContains(t, err, "DEV_INBOX_ENABLED")
+
+	t.Setenv("APP_ENV", "staging")
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.True(t, cfg.DevInbox.Enabled)
+}
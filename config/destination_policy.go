@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Destination policy sources
+const (
+	DestinationPolicySourceNone = "none"
+	DestinationPolicySourceFile = "file"
+	DestinationPolicySourceDB   = "db"
+)
+
+// DestinationPolicy configures where allow and deny rules for OTP destinations come from
+type DestinationPolicy struct {
+	Source         string        // none, file or db
+	File           string        // JSON array of rules, used by the file source
+	ReloadInterval time.Duration // how often the rules are read again
+}
+
+// Enabled reports whether sends are checked against destination rules
+func (d DestinationPolicy) Enabled() bool {
+	return d.Source != DestinationPolicySourceNone
+}
+
+// validateDestinationPolicy checks the source and that the file source has a file
+func validateDestinationPolicy(d DestinationPolicy) error {
+	switch d.Source {
+	case DestinationPolicySourceNone, DestinationPolicySourceDB:
+	case DestinationPolicySourceFile:
+		if d.File == "" {
+			return fmt.Errorf("DESTINATION_POLICY_FILE is required when DESTINATION_POLICY_SOURCE is file")
+		}
+	default:
+		return fmt.Errorf("unknown DESTINATION_POLICY_SOURCE %q (use none, file or db)", d.Source)
+	}
+
+	if d.ReloadInterval <= 0 {
+		return fmt.Errorf("DESTINATION_POLICY_RELOAD_INTERVAL must be positive")
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// MagicLink configures sign-in links sent alongside login codes
+type MagicLink struct {
+	BaseURL     string // public URL of this service the links point to; magic links are disabled when empty
+	RedirectURL string // client URL the link redirects to with the result in the fragment
+}
+
+// Enabled reports whether magic links can be requested
+func (m MagicLink) Enabled() bool {
+	return m.BaseURL != ""
+}
+
+// validateMagicLink checks that both URLs are absolute and that the redirect URL can carry a fragment
+func validateMagicLink(m MagicLink) error {
+	if !m.Enabled() {
+		return nil
+	}
+
+	base, err := url.Parse(m.BaseURL)
+	if err != nil || !base.IsAbs() || base.Host == "" {
+		return fmt.Errorf("MAGIC_LINK_BASE_URL must be an absolute URL")
+	}
+
+	redirect, err := url.Parse(m.RedirectURL)
+	if err != nil || !redirect.IsAbs() {
+		return fmt.Errorf("MAGIC_LINK_REDIRECT_URL must be an absolute URL when MAGIC_LINK_BASE_URL is set")
+	}
+	if redirect.Fragment != "" {
+		return fmt.Errorf("MAGIC_LINK_REDIRECT_URL must not have a fragment; the result is passed in it")
+	}
+
+	return nil
+}
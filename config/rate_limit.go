@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rate limit algorithms
+const (
+	RateLimitFixedWindow   = "fixed_window"   // counter reset one window after the first request
+	RateLimitSlidingLog    = "sliding_log"    // exact, one timestamp per request in the window
+	RateLimitSlidingWindow = "sliding_window" // approximate, weighs the previous window's count
+	RateLimitTokenBucket   = "token_bucket"   // GCRA, Limit tokens refilled evenly over Window
+)
+
+// Rate limit stores
+const (
+	RateLimitStoreRedis    = "redis"
+	RateLimitStorePostgres = "postgres"
+	RateLimitStoreMemory   = "memory" // per process; not shared between instances
+)
+
+// RateLimitAlgorithms lists every supported rate limit algorithm
+var RateLimitAlgorithms = []string{RateLimitFixedWindow, RateLimitSlidingLog, RateLimitSlidingWindow, RateLimitTokenBucket}
+
+// RateLimitPolicy describes a single limit: at most Limit requests per Window, enforced with Algorithm
+type RateLimitPolicy struct {
+	Algorithm string
+	Limit     int
+	Window    time.Duration
+}
+
+// Enabled reports whether the limit is enforced; optional limits are disabled with a limit of 0
+func (p RateLimitPolicy) Enabled() bool {
+	return p.Limit > 0
+}
+
+// Policy returns the per phone number send limit
+func (r RateLimit) Policy() RateLimitPolicy {
+	return RateLimitPolicy{
+		Algorithm: r.Algorithm,
+		Limit:     r.MaxRequests,
+		Window:    r.WindowDuration,
+	}
+}
+
+// loadRateLimitPolicy reads an optional limit from <prefix>_MAX_REQUESTS, <prefix>_WINDOW_DURATION
+// and <prefix>_ALGORITHM. The window and algorithm default to those of defaults; the limit
+// defaults to 0, which disables it.
+func loadRateLimitPolicy(prefix string, defaults RateLimitPolicy) RateLimitPolicy {
+	return RateLimitPolicy{
+		Algorithm: getEnvWithDefault(prefix+"_ALGORITHM", defaults.Algorithm),
+		Limit:     parseIntWithDefault(prefix+"_MAX_REQUESTS", 0),
+		Window:    parseDurationWithDefault(prefix+"_WINDOW_DURATION", defaults.Window),
+	}
+}
+
+// validateRateLimit checks the store, the phone number limit and every enabled optional limit
+func validateRateLimit(r RateLimit) error {
+	switch r.Store {
+	case RateLimitStoreRedis, RateLimitStorePostgres, RateLimitStoreMemory:
+	default:
+		return fmt.Errorf("unknown RATE_LIMIT_STORE %q (use redis, postgres or memory)", r.Store)
+	}
+
+	if err := validateRateLimitPolicy("RATE_LIMIT", r.Policy()); err != nil {
+		return err
+	}
+
+	optional := []struct {
+		name   string
+		policy RateLimitPolicy
+	}{
+		{"RATE_LIMIT_IP", r.IP},
+		{"RATE_LIMIT_DEVICE", r.Device},
+		{"RATE_LIMIT_COUNTRY", r.Country},
+		{"RATE_LIMIT_GLOBAL", r.Global},
+	}
+	for _, o := range optional {
+		if o.policy.Limit < 0 {
+			return fmt.Errorf("%s_MAX_REQUESTS must not be negative", o.name)
+		}
+		if !o.policy.Enabled() {
+			continue
+		}
+		if err := validateRateLimitPolicy(o.name, o.policy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateRateLimitPolicy checks that a limit can be enforced
+func validateRateLimitPolicy(name string, p RateLimitPolicy) error {
+	known := false
+	for _, algorithm := range RateLimitAlgorithms {
+		if p.Algorithm == algorithm {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("%s: unknown rate limit algorithm %q (use fixed_window, sliding_log, sliding_window or token_bucket)", name, p.Algorithm)
+	}
+	if p.Limit < 1 {
+		return fmt.Errorf("%s: rate limit must allow at least 1 request", name)
+	}
+	if p.Window < time.Millisecond {
+		return fmt.Errorf("%s: rate limit window must be at least 1ms", name)
+	}
+
+	return nil
+}
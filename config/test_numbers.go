@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// testNumberPattern matches a test phone number or a prefix ending in *
+var testNumberPattern = regexp.MustCompile(`^\+[1-9]\d{0,14}\*?$`)
+
+// TestNumbers configures phone numbers that get a known code without delivery, for QA
+// and app store reviewers
+type TestNumbers struct {
+	Numbers           []string // exact numbers, or prefixes ending in *
+	Code              string   // fixed code; when empty the code is the last digits of the number
+	AllowInProduction bool
+}
+
+// Matches reports whether a phone number is a test number
+func (t TestNumbers) Matches(phoneNumber string) bool {
+	for _, number := range t.Numbers {
+		if prefix, ok := strings.CutSuffix(number, "*"); ok {
+			if strings.HasPrefix(phoneNumber, prefix) {
+				return true
+			}
+		} else if phoneNumber == number {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTestNumbers refuses test numbers in production unless explicitly allowed, and
+// checks that every purpose can issue the test code
+func validateTestNumbers(cfg *Config) error {
+	t := cfg.TestNumbers
+	if len(t.Numbers) == 0 {
+		return nil
+	}
+
+	if cfg.Application.IsProduction() && !t.AllowInProduction {
+		return fmt.Errorf("TEST_PHONE_NUMBERS is set in production; set TEST_PHONE_NUMBERS_ALLOW_IN_PRODUCTION=true to allow it")
+	}
+
+	for _, number := range t.Numbers {
+		if !testNumberPattern.MatchString(number) {
+			return fmt.Errorf("invalid test phone number %q", number)
+		}
+	}
+
+	for purpose, policy := range cfg.OTP.CodePolicies {
+		if t.Code == "" {
+			if policy.Alphabet != CodeAlphabetNumeric {
+				return fmt.Errorf("purpose %s: codes derived from test phone numbers must be numeric; set TEST_PHONE_CODE", purpose)
+			}
+			continue
+		}
+
+		if len(t.Code) != policy.Length || strings.Trim(t.Code, policy.Characters()) != "" {
+			return fmt.Errorf("purpose %s: TEST_PHONE_CODE must be %d %s characters", purpose, policy.Length, policy.Alphabet)
+		}
+	}
+
+	return nil
+}
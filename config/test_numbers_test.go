@@ -0,0 +1,65 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_TestNumbersRefusedInProduction(t *testing.T) {
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("OTP_HASH_PEPPER", "3f9c1e0a7b")
+	t.Setenv("TEST_PHONE_NUMBERS", "+15005550006")
+
+	_, err := Load()
+	assert.ErrorContains(t, err, "TEST_PHONE_NUMBERS_ALLOW_IN_PRODUCTION")
+
+	t.Setenv("TEST_PHONE_NUMBERS_ALLOW_IN_PRODUCTION", "true")
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.True(t, cfg.TestNumbers.Matches("+15005550006"))
+}
+
+func TestLoad_TestNumbersOutsideProduction(t *testing.T) {
+	t.Setenv("APP_ENV", "staging")
+	t.Setenv("TEST_PHONE_NUMBERS", "+15005550006,+1500555*")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.True(t, cfg.TestNumbers.Matches("+15005550006"))
+	assert.True(t, cfg.TestNumbers.Matches("+15005559999"))
+	assert.False(t, cfg.TestNumbers.Matches("+15005560000"))
+}
+
+func TestLoad_TestPhoneCodeMustFitEveryPurpose(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("TEST_PHONE_NUMBERS", "+15005550006")
+
+	t.Setenv("TEST_PHONE_CODE", "23456")
+	_, err := Load()
+	assert.ErrorContains(t, err, "TEST_PHONE_CODE")
+
+	t.Setenv("TEST_PHONE_CODE", "234567")
+	t.Setenv("OTP_ACCOUNT_DELETION_ALPHABET", CodeAlphabetAlphanumeric)
+	_, err = Load()
+	assert.NoError(t, err)
+
+	t.Setenv("TEST_PHONE_CODE", "")
+	_, err = Load()
+	assert.ErrorContains(t, err, "must be numeric")
+}
+
+func TestLoad_TestNumberCannotBeAdmin(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("TEST_PHONE_NUMBERS", "+1500555*")
+
+	t.Setenv("ADMIN_PHONE_NUMBERS", "+447700900001,+15005550006")
+	_, err := Load()
+	assert.ErrorContains(t, err, "+15005550006 is a test phone number")
+
+	t.Setenv("ADMIN_PHONE_NUMBERS", "+447700900001")
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.True(t, cfg.Admin.IsAdmin("+447700900001"))
+}
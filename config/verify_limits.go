@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+)
+
+// Bounds of the per-session verification attempts and resends
+const (
+	maxVerifyAttempts = 10 // more attempts make guessing a code practical
+	maxResends        = 10
+)
+
+// validateVerifyLimits checks the attempts, resends and lockout settings. With no attempts
+// every session would be burned before its first verification.
+func validateVerifyLimits(o OTP) error {
+	if o.MaxVerifyAttempts < 1 || o.MaxVerifyAttempts > maxVerifyAttempts {
+		return fmt.Errorf("OTP_MAX_VERIFY_ATTEMPTS must be between 1 and %d", maxVerifyAttempts)
+	}
+	if o.MaxResends < 0 || o.MaxResends > maxResends {
+		return fmt.Errorf("OTP_MAX_RESENDS must be between 0 and %d", maxResends)
+	}
+	if o.ResendCooldown < 0 {
+		return fmt.Errorf("OTP_RESEND_COOLDOWN must not be negative")
+	}
+
+	if o.LockoutThreshold < 1 {
+		return fmt.Errorf("OTP_LOCKOUT_THRESHOLD must be at least 1")
+	}
+	if o.LockoutWindow <= 0 || o.LockoutDuration <= 0 {
+		return fmt.Errorf("OTP_LOCKOUT_WINDOW and OTP_LOCKOUT_DURATION must be positive")
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// verifyLimitsTestOTP returns valid attempts, resends and lockout settings
+func verifyLimitsTestOTP() OTP {
+	return OTP{
+		MaxVerifyAttempts: 5,
+		MaxResends:        3,
+		ResendCooldown:    30 * time.Second,
+		LockoutThreshold:  3,
+		LockoutWindow:     time.Hour,
+		LockoutDuration:   time.Hour,
+	}
+}
+
+func TestValidateVerifyLimits(t *testing.T) {
+	require.NoError(t, validateVerifyLimits(verifyLimitsTestOTP()))
+
+	cases := []struct {
+		setting string
+		change  func(o *OTP)
+	}{
+		{"OTP_MAX_VERIFY_ATTEMPTS", func(o *OTP) { o.MaxVerifyAttempts = 0 }},
+		{"OTP_MAX_VERIFY_ATTEMPTS", func(o *OTP) { o.MaxVerifyAttempts = -1 }},
+		{"OTP_MAX_VERIFY_ATTEMPTS", func(o *OTP) { o.MaxVerifyAttempts = maxVerifyAttempts + 1 }},
+		{"OTP_MAX_RESENDS", func(o *OTP) { o.MaxResends = -1 }},
+		{"OTP_MAX_RESENDS", func(o *OTP) { o.MaxResends = maxResends + 1 }},
+		{"OTP_RESEND_COOLDOWN", func(o *OTP) { o.ResendCooldown = -time.Second }},
+		{"OTP_LOCKOUT_THRESHOLD", func(o *OTP) { o.LockoutThreshold = 0 }},
+		{"OTP_LOCKOUT_WINDOW", func(o *OTP) { o.LockoutWindow = 0 }},
+		{"OTP_LOCKOUT_DURATION", func(o *OTP) { o.LockoutDuration = 0 }},
+	}
+	for _, c := range cases {
+		o := verifyLimitsTestOTP()
+		c.change(&o)
+		assert.ErrorContains(t, validateVerifyLimits(o), c.setting)
+	}
+}
+
+func TestValidateVerifyLimits_Bounds(t *testing.T) {
+	o := verifyLimitsTestOTP()
+	o.MaxVerifyAttempts = 1
+	o.MaxResends = 0
+	assert.NoError(t, validateVerifyLimits(o), "a single attempt and no resends are allowed")
+
+	o.MaxVerifyAttempts = maxVerifyAttempts
+	o.MaxResends = maxResends
+	assert.NoError(t, validateVerifyLimits(o))
+}
+
+func TestLoad_RefusesZeroVerifyAttempts(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("OTP_MAX_VERIFY_ATTEMPTS", "0")
+
+	_, err := Load()
+	assert.ErrorContains(t, err, "OTP_MAX_VERIFY_ATTEMPTS")
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"otp-auth/entity"
+	"otp-auth/pkg/logger"
+	"otp-auth/service"
+	"otp-auth/validator"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxReceiptBodySize caps the size of a delivery receipt payload
+const maxReceiptBodySize = 64 << 10
+
+// DeliveryReceiptController handles delivery receipt callbacks
+type DeliveryReceiptController struct {
+	receiptService service.DeliveryReceiptService
+	validator      *validator.Validator
+	logger         *logger.Logger
+}
+
+// NewDeliveryReceiptController creates a new delivery receipt controller instance
+func NewDeliveryReceiptController(receiptService service.DeliveryReceiptService, validator *validator.Validator, logger *logger.Logger) *DeliveryReceiptController {
+	return &DeliveryReceiptController{
+		receiptService: receiptService,
+		validator:      validator,
+		logger:         logger,
+	}
+}
+
+// ReceiveDeliveryReceipt handles delivery receipt callbacks from SMS gateways
+// @Summary Receive delivery receipt
+// @Description Accept a delivery receipt from an SMS gateway. The request must carry X-Timestamp (unix seconds) and X-Signature (hex HMAC-SHA256 of "<timestamp>.<raw body>" with the shared secret).
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param X-Timestamp header string true "Unix timestamp of the callback"
+// @Param X-Signature header string true "Hex HMAC-SHA256 signature"
+// @Param request body entity.DeliveryReceiptRequest true "Delivery receipt"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /webhooks/delivery-receipts [post]
+func (c *DeliveryReceiptController) ReceiveDeliveryReceipt(ctx echo.Context) error {
+	body, err := io.ReadAll(io.LimitReader(ctx.Request().Body, maxReceiptBodySize))
+	if err != nil {
+		c.logger.Errorw("Failed to read delivery receipt body", "error", err)
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+	}
+
+	// The signature covers the raw body, so verify before decoding
+	timestamp := ctx.Request().Header.Get("X-Timestamp")
+	signature := ctx.Request().Header.Get("X-Signature")
+	if err := c.receiptService.VerifySignature(timestamp, signature, body); err != nil {
+		c.logger.Warnw("Rejected delivery receipt", "remote_ip", ctx.RealIP(), "error", err)
+		return ctx.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error":   "Unauthorized",
+			"details": "Invalid or missing signature",
+		})
+	}
+
+	var req entity.DeliveryReceiptRequest
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&req); err != nil {
+		c.logger.Errorw("Failed to decode delivery receipt", "error", err)
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+	}
+
+	if err := c.validator.ValidateStruct(&req); err != nil {
+		c.logger.Warnw("Validation failed", "request", req, "error", err)
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Validation failed",
+			"details": err.Error(),
+		})
+	}
+
+	if err := c.receiptService.HandleReceipt(&req); err != nil {
+		if errors.Is(err, service.ErrUnknownMessage) {
+			return ctx.JSON(http.StatusNotFound, map[string]interface{}{
+				"error":   "Unknown message",
+				"details": "No OTP matches the provided message ID",
+			})
+		}
+
+		return ctx.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error":   "Failed to process delivery receipt",
+			"details": "Internal server error",
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Delivery receipt accepted",
+	})
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"net/http"
+	"net/url"
+
+	"otp-auth/entity"
+	"otp-auth/pkg/logger"
+	"otp-auth/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DevInboxController serves the messages captured by the dev inbox
+type DevInboxController struct {
+	inbox  service.DevInbox
+	logger *logger.Logger
+}
+
+// NewDevInboxController creates a new dev inbox controller instance
+func NewDevInboxController(inbox service.DevInbox, logger *logger.Logger) *DevInboxController {
+	return &DevInboxController{
+		inbox:  inbox,
+		logger: logger,
+	}
+}
+
+// GetInbox handles dev inbox requests
+// @Summary Get dev inbox
+// @Description Return the most recent OTP messages delivered to a phone number, newest first. Only available outside production when DEV_INBOX_ENABLED is set.
+// @Tags Development
+// @Produce json
+// @Param phone path string true "Phone number in E.164 format (URL-encode the leading +)"
+// @Success 200 {object} entity.DevInboxResponse
+// @Failure 400 {object} map[string]interface{}
+// @Router /dev/inbox/{phone} [get]
+func (c *DevInboxController) GetInbox(ctx echo.Context) error {
+	phoneNumber, err := url.PathUnescape(ctx.Param("phone"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, entity.DevInboxResponse{
+		PhoneNumber: phoneNumber,
+		Messages:    c.inbox.Messages(phoneNumber),
+	})
+}
@@ -1,8 +1,13 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
-	"strings"
+	"net/url"
+	"strconv"
+	"time"
 
 	"otp-auth/entity"
 	"otp-auth/pkg/logger"
@@ -12,35 +17,57 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// DeviceIDHeader carries the client's device identifier, used for per device rate limits
+const DeviceIDHeader = "X-Device-ID"
+
+// rateLimitScopes describes each rate limit dimension in the 429 response
+var rateLimitScopes = map[string]string{
+	entity.RateLimitDimensionPhoneNumber: "per phone number",
+	entity.RateLimitDimensionIP:          "per IP address",
+	entity.RateLimitDimensionDevice:      "per device",
+	entity.RateLimitDimensionCountry:     "per country",
+	entity.RateLimitDimensionGlobal:      "in total",
+}
+
 // OTPController handles OTP-related HTTP requests
 type OTPController struct {
-	otpService service.OTPService
-	jwtService service.JWTService
-	validator  *validator.Validator
-	logger     *logger.Logger
+	otpService           service.OTPService
+	jwtService           service.JWTService
+	validator            *validator.Validator
+	logger               *logger.Logger
+	magicLinkRedirectURL string
 }
 
-// NewOTPController creates a new OTP controller instance
-func NewOTPController(otpService service.OTPService, jwtService service.JWTService, validator *validator.Validator, logger *logger.Logger) *OTPController {
+// NewOTPController creates a new OTP controller instance; magic links redirect to magicLinkRedirectURL
+func NewOTPController(otpService service.OTPService, jwtService service.JWTService, validator *validator.Validator, logger *logger.Logger, magicLinkRedirectURL string) *OTPController {
 	return &OTPController{
-		otpService: otpService,
-		jwtService: jwtService,
-		validator:  validator,
-		logger:     logger,
+		otpService:           otpService,
+		jwtService:           jwtService,
+		validator:            validator,
+		logger:               logger,
+		magicLinkRedirectURL: magicLinkRedirectURL,
 	}
 }
 
 // SendOTP handles OTP generation and sending
 // @Summary Send OTP
-// @Description Generate and send OTP to the provided phone number
+// @Description Generate and send OTP to the provided phone number over the preferred channel, falling back to the configured channel chain. The code is scoped to a purpose (default login) and, when a payload is given, bound to it; payment_confirmation requires a payload. Login codes can also carry a single-use sign-in link (magic_link).
 // @Tags OTP
 // @Accept json
 // @Produce json
 // @Param request body entity.SendOTPRequest true "Send OTP Request"
+// @Param Accept-Language header string false "Message language when the request has no locale"
+// @Param X-Device-ID header string false "Device identifier for per device rate limits"
 // @Success 200 {object} entity.OTPResponse
 // @Failure 400 {object} map[string]interface{}
-// @Failure 429 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{} "Destination not allowed"
+// @Failure 423 {object} map[string]interface{} "Phone number locked"
+// @Failure 429 {object} map[string]interface{} "Rate limit exceeded (dimension names the limit) or sending suspended"
 // @Failure 500 {object} map[string]interface{}
+// @Header all {integer} RateLimit-Limit "Limit of the most constrained rate limit"
+// @Header all {integer} RateLimit-Remaining "Requests left under that limit"
+// @Header all {integer} RateLimit-Reset "Seconds until that limit's full quota is available again"
+// @Header 429 {integer} Retry-After "Seconds until a send can succeed"
 // @Router /otp/send [post]
 func (c *OTPController) SendOTP(ctx echo.Context) error {
 	var req entity.SendOTPRequest
@@ -48,6 +75,7 @@ func (c *OTPController) SendOTP(ctx echo.Context) error {
 	// Bind request body
 	if err := ctx.Bind(&req); err != nil {
 		c.logger.Errorw("Failed to bind request", "error", err)
+		c.setSendRateLimitHeaders(ctx, "", nil)
 		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
 			"error":   "Invalid request format",
 			"details": err.Error(),
@@ -57,25 +85,84 @@ func (c *OTPController) SendOTP(ctx echo.Context) error {
 	// Validate request
 	if err := c.validator.ValidateStruct(&req); err != nil {
 		c.logger.Warnw("Validation failed", "request", req, "error", err)
+		c.setSendRateLimitHeaders(ctx, "", nil)
 		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
 			"error":   "Validation failed",
 			"details": err.Error(),
 		})
 	}
 
+	// Fall back to the client's language preferences
+	if req.Locale == "" {
+		req.Locale = ctx.Request().Header.Get("Accept-Language")
+	}
+
+	req.ClientIP = ctx.RealIP()
+	req.DeviceID = ctx.Request().Header.Get(DeviceIDHeader)
+
 	// Send OTP
-	response, err := c.otpService.SendOTP(req.PhoneNumber)
+	response, err := c.otpService.SendOTP(&req)
+
+	// Every response reports the limits: as counted by this send, otherwise as they stand
+	var counted *entity.RateLimitResult
+	if response != nil {
+		counted = response.RateLimit
+	}
+	c.setSendRateLimitHeaders(ctx, req.PhoneNumber, counted)
+
 	if err != nil {
 		c.logger.Errorw("Failed to send OTP", "phone_number", req.PhoneNumber, "error", err)
 
-		// Check if it's a rate limiting error
-		if strings.Contains(err.Error(), "rate limit exceeded") {
-			return ctx.JSON(http.StatusTooManyRequests, map[string]interface{}{
-				"error":   "Rate limit exceeded",
-				"details": "Maximum 3 OTP requests per phone number within 10 minutes. Please try again later.",
+		if errors.Is(err, service.ErrChannelUnavailable) {
+			return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error":   "Delivery channel unavailable",
+				"details": err.Error(),
+			})
+		}
+
+		if errors.Is(err, service.ErrUnknownClientApp) {
+			return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error":   "Unknown client app",
+				"details": err.Error(),
+			})
+		}
+
+		if errors.Is(err, service.ErrPayloadRequired) {
+			return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error":   "Payload required",
+				"details": err.Error(),
+			})
+		}
+
+		if errors.Is(err, service.ErrMagicLinkUnavailable) {
+			return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error":   "Magic link not available",
+				"details": "Magic links are only sent with login codes when enabled",
+			})
+		}
+
+		if errors.Is(err, service.ErrDestinationNotAllowed) {
+			return destinationNotAllowed(ctx)
+		}
+
+		var lockoutErr *service.LockoutError
+		if errors.As(err, &lockoutErr) {
+			return ctx.JSON(http.StatusLocked, map[string]interface{}{
+				"error":        "Phone number locked",
+				"details":      "Too many failed verification attempts. Please try again later.",
+				"locked_until": lockoutErr.LockedUntil,
 			})
 		}
 
+		if errors.Is(err, service.ErrSendingSuspended) {
+			return sendingSuspended(ctx)
+		}
+
+		// Check if it's a rate limiting error
+		if errors.Is(err, service.ErrRateLimited) {
+			return c.rateLimitExceeded(ctx, err)
+		}
+
 		return ctx.JSON(http.StatusInternalServerError, map[string]interface{}{
 			"error":   "Failed to send OTP",
 			"details": "Internal server error",
@@ -86,16 +173,198 @@ func (c *OTPController) SendOTP(ctx echo.Context) error {
 	return ctx.JSON(http.StatusOK, response)
 }
 
+// ResendOTP handles issuing a new code on an existing OTP session
+// @Summary Resend OTP
+// @Description Issue a new code on an existing session, invalidating the previous one. The session token stays the same. Resends are subject to a per-session cooldown and cap as well as the same rate limits as sends.
+// @Tags OTP
+// @Accept json
+// @Produce json
+// @Param request body entity.ResendOTPRequest true "Resend OTP Request (token from send response)"
+// @Param X-Device-ID header string false "Device identifier for per device rate limits"
+// @Success 200 {object} entity.OTPResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{} "Destination not allowed"
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{} "Session already verified or cancelled"
+// @Failure 423 {object} map[string]interface{} "Session burned or phone number locked"
+// @Failure 429 {object} map[string]interface{} "Cooldown, resend cap, rate limit or sending suspended"
+// @Failure 500 {object} map[string]interface{}
+// @Header 200,429 {integer} RateLimit-Limit "Limit of the most constrained rate limit"
+// @Header 200,429 {integer} RateLimit-Remaining "Requests left under that limit"
+// @Header 200,429 {integer} RateLimit-Reset "Seconds until that limit's full quota is available again"
+// @Header 429 {integer} Retry-After "Seconds until a resend can succeed"
+// @Router /otp/resend [post]
+func (c *OTPController) ResendOTP(ctx echo.Context) error {
+	var req entity.ResendOTPRequest
+
+	// Bind request body
+	if err := ctx.Bind(&req); err != nil {
+		c.logger.Errorw("Failed to bind request", "error", err)
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+	}
+
+	// Validate request
+	if err := c.validator.ValidateStruct(&req); err != nil {
+		c.logger.Warnw("Validation failed", "token", service.MaskToken(req.Token), "error", err)
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Validation failed",
+			"details": err.Error(),
+		})
+	}
+
+	req.ClientIP = ctx.RealIP()
+	req.DeviceID = ctx.Request().Header.Get(DeviceIDHeader)
+
+	response, err := c.otpService.ResendOTP(&req)
+	if err != nil {
+		c.logger.Warnw("Failed to resend OTP", "error", err)
+
+		var cooldownErr *service.CooldownError
+		var lockoutErr *service.LockoutError
+		switch {
+		case errors.As(err, &cooldownErr):
+			ctx.Response().Header().Set("Retry-After", secondsUntil(cooldownErr.AvailableAt))
+			return ctx.JSON(http.StatusTooManyRequests, map[string]interface{}{
+				"error":               "Resend not available yet",
+				"details":             "Please wait before requesting another code",
+				"resend_available_at": cooldownErr.AvailableAt,
+			})
+		case errors.Is(err, service.ErrResendLimitReached):
+			return ctx.JSON(http.StatusTooManyRequests, map[string]interface{}{
+				"error":   "Resend limit reached",
+				"details": "Please request a new OTP",
+			})
+		case errors.Is(err, service.ErrSessionNotFound):
+			return ctx.JSON(http.StatusNotFound, map[string]interface{}{
+				"error":   "Session not found",
+				"details": "Please request a new OTP",
+			})
+		case errors.Is(err, service.ErrSessionUsed):
+			return ctx.JSON(http.StatusConflict, map[string]interface{}{
+				"error":   "Session already verified",
+				"details": "Please request a new OTP",
+			})
+		case errors.Is(err, service.ErrSessionCancelled):
+			return ctx.JSON(http.StatusConflict, map[string]interface{}{
+				"error":   "Session cancelled",
+				"details": "Please request a new OTP",
+			})
+		case errors.Is(err, service.ErrSessionLocked):
+			return ctx.JSON(http.StatusLocked, map[string]interface{}{
+				"error":   "OTP session locked",
+				"details": "Too many failed attempts. Please request a new OTP",
+			})
+		case errors.Is(err, service.ErrDestinationNotAllowed):
+			return destinationNotAllowed(ctx)
+		case errors.As(err, &lockoutErr):
+			return ctx.JSON(http.StatusLocked, map[string]interface{}{
+				"error":        "Phone number locked",
+				"details":      "Too many failed verification attempts. Please try again later.",
+				"locked_until": lockoutErr.LockedUntil,
+			})
+		case errors.Is(err, service.ErrChannelUnavailable):
+			return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error":   "Delivery channel unavailable",
+				"details": err.Error(),
+			})
+		case errors.Is(err, service.ErrSendingSuspended):
+			return sendingSuspended(ctx)
+		case errors.Is(err, service.ErrRateLimited):
+			return c.rateLimitExceeded(ctx, err)
+		}
+
+		return ctx.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error":   "Failed to resend OTP",
+			"details": "Internal server error",
+		})
+	}
+
+	c.setSendRateLimitHeaders(ctx, response.PhoneNumber, response.RateLimit)
+
+	c.logger.Infow("OTP resent successfully", "phone_number", response.PhoneNumber)
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// GetSession handles OTP session status requests
+// @Summary Get OTP session
+// @Description Get the state of an OTP session: expiry, remaining attempts, resend availability and delivery state. The code is never returned.
+// @Tags OTP
+// @Produce json
+// @Param token path string true "Session token from the send response"
+// @Success 200 {object} entity.SessionStatusResponse
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /otp/sessions/{token} [get]
+func (c *OTPController) GetSession(ctx echo.Context) error {
+	response, err := c.otpService.GetSession(ctx.Param("token"))
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]interface{}{
+				"error":   "Session not found",
+				"details": "No OTP session matches the provided token",
+			})
+		}
+
+		return ctx.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error":   "Failed to get OTP session",
+			"details": "Internal server error",
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// CancelSession handles OTP session cancellation
+// @Summary Cancel OTP session
+// @Description Cancel a pending OTP session so its code can no longer be verified or resent. Cancelling an already cancelled session succeeds.
+// @Tags OTP
+// @Produce json
+// @Param token path string true "Session token from the send response"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{} "Session already verified"
+// @Failure 500 {object} map[string]interface{}
+// @Router /otp/sessions/{token} [delete]
+func (c *OTPController) CancelSession(ctx echo.Context) error {
+	if err := c.otpService.CancelSession(ctx.Param("token")); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]interface{}{
+				"error":   "Session not found",
+				"details": "No OTP session matches the provided token",
+			})
+		}
+
+		if errors.Is(err, service.ErrSessionUsed) {
+			return ctx.JSON(http.StatusConflict, map[string]interface{}{
+				"error":   "Session already verified",
+				"details": "A verified session cannot be cancelled",
+			})
+		}
+
+		return ctx.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error":   "Failed to cancel OTP session",
+			"details": "Internal server error",
+		})
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
 // VerifyOTP handles OTP verification and authentication
 // @Summary Verify OTP
-// @Description Verify OTP and authenticate user
+// @Description Verify OTP and authenticate user. The session is identified by token or, for client apps in phone_number verify mode, by phone_number and client_id (the latest session sent to the number). Purpose and payload must match the send request. Login returns a JWT (entity.AuthResponse); other purposes return a signed confirmation (entity.ConfirmationResponse) instead.
 // @Tags OTP
 // @Accept json
 // @Produce json
-// @Param request body entity.VerifyOTPRequest true "Verify OTP Request (token from send response)"
+// @Param request body entity.VerifyOTPRequest true "Verify OTP Request (token from send response, or phone_number and client_id)"
 // @Success 200 {object} entity.AuthResponse
 // @Failure 400 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{} "Invalid or expired OTP, with remaining_attempts"
+// @Failure 403 {object} map[string]interface{} "Account disabled"
+// @Failure 423 {object} map[string]interface{} "Session burned or phone number locked"
 // @Failure 500 {object} map[string]interface{}
 // @Router /otp/verify [post]
 func (c *OTPController) VerifyOTP(ctx echo.Context) error {
@@ -112,7 +381,7 @@ func (c *OTPController) VerifyOTP(ctx echo.Context) error {
 
 	// Validate request
 	if err := c.validator.ValidateStruct(&req); err != nil {
-		c.logger.Warnw("Validation failed", "request", req, "error", err)
+		c.logger.Warnw("Validation failed", "token", service.MaskToken(req.Token), "phone_number", req.PhoneNumber, "error", err)
 		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
 			"error":   "Validation failed",
 			"details": err.Error(),
@@ -120,33 +389,275 @@ func (c *OTPController) VerifyOTP(ctx echo.Context) error {
 	}
 
 	// Verify OTP
-	user, err := c.otpService.VerifyOTP(req.Token, req.Code)
+	result, err := c.otpService.VerifyOTP(&req)
 	if err != nil {
-		c.logger.Warnw("OTP verification failed", "token", req.Token, "error", err)
+		c.logger.Warnw("OTP verification failed", "token", service.MaskToken(req.Token), "phone_number", req.PhoneNumber, "error", err)
+
+		if errors.Is(err, service.ErrInvalidCodeFormat) {
+			return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error":   "Validation failed",
+				"details": err.Error(),
+			})
+		}
 
-		if err.Error() == "invalid or expired OTP" {
+		if errors.Is(err, service.ErrVerifyModeNotAllowed) {
+			return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error":   "Verification mode not allowed",
+				"details": "Verifying by phone number requires a client_id in phone_number verify mode",
+			})
+		}
+
+		var lockoutErr *service.LockoutError
+		if errors.As(err, &lockoutErr) {
+			return ctx.JSON(http.StatusLocked, map[string]interface{}{
+				"error":        "Phone number locked",
+				"details":      "Too many failed verification attempts. Please try again later.",
+				"locked_until": lockoutErr.LockedUntil,
+			})
+		}
+
+		if errors.Is(err, service.ErrSessionLocked) {
+			return ctx.JSON(http.StatusLocked, map[string]interface{}{
+				"error":              "OTP session locked",
+				"details":            "Too many failed attempts. Please request a new OTP",
+				"remaining_attempts": 0,
+			})
+		}
+
+		var attemptErr *service.AttemptError
+		if errors.As(err, &attemptErr) {
+			return ctx.JSON(http.StatusUnauthorized, map[string]interface{}{
+				"error":              "Invalid or expired OTP",
+				"details":            "The code is incorrect",
+				"remaining_attempts": attemptErr.RemainingAttempts,
+			})
+		}
+
+		if errors.Is(err, service.ErrInvalidOTP) {
 			return ctx.JSON(http.StatusUnauthorized, map[string]interface{}{
 				"error":   "Invalid or expired OTP",
 				"details": "Please request a new OTP",
 			})
 		}
 
+		if errors.Is(err, service.ErrUserInactive) {
+			return ctx.JSON(http.StatusForbidden, map[string]interface{}{
+				"error":   "Account disabled",
+				"details": "This account is not active",
+			})
+		}
+
 		return ctx.JSON(http.StatusInternalServerError, map[string]interface{}{
 			"error":   "Failed to verify OTP",
 			"details": "Internal server error",
 		})
 	}
 
-	// Generate JWT token
-	authResponse, err := c.jwtService.GenerateToken(user)
+	response, err := c.issueToken(result)
 	if err != nil {
-		c.logger.Errorw("Failed to generate JWT token", "user_id", user.ID, "error", err)
+		failure := "Failed to generate authentication token"
+		if result.Confirmation != nil {
+			failure = "Failed to generate confirmation token"
+		}
 		return ctx.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error":   "Failed to generate authentication token",
+			"error":   failure,
 			"details": "Internal server error",
 		})
 	}
 
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// magicLinkPage asks the user to confirm the sign-in, so that link previews and mail scanners
+// opening the link do not consume it; the form posts back to the same URL
+const magicLinkPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Continue signing in</title>
+</head>
+<body>
+<form method="post">
+<p>Continue to sign in on this device.</p>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`
+
+// ShowMagicLink handles magic links opened from an OTP message
+// @Summary Open magic link
+// @Description Serve a page that asks the user to continue; continuing posts to the same URL, which verifies the link. Opening the link does not consume it, so link previews and mail scanners cannot spend it. Only available when MAGIC_LINK_BASE_URL is set.
+// @Tags OTP
+// @Produce html
+// @Param token path string true "Magic link token"
+// @Success 200 {string} string "Confirmation page"
+// @Router /otp/magic-link/{token} [get]
+func (c *OTPController) ShowMagicLink(ctx echo.Context) error {
+	// The URL carries the link token; keep it out of caches and referrers, and the page out of frames
+	ctx.Response().Header().Set("Cache-Control", "no-store")
+	ctx.Response().Header().Set("Referrer-Policy", "no-referrer")
+	ctx.Response().Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	return ctx.HTML(http.StatusOK, magicLinkPage)
+}
+
+// VerifyMagicLink handles the confirmation of a magic link
+// @Summary Verify magic link
+// @Description Verify the session of a magic link sent with a login code and redirect to the configured client URL. The result is passed in the URL fragment: token and expires_at on success, or error (invalid_or_expired, session_locked, phone_locked, account_disabled, server_error). Links are single-use and expire with the code. Only available when MAGIC_LINK_BASE_URL is set.
+// @Tags OTP
+// @Param token path string true "Magic link token"
+// @Success 303 "Redirect to the client URL"
+// @Router /otp/magic-link/{token} [post]
+func (c *OTPController) VerifyMagicLink(ctx echo.Context) error {
+	result, err := c.otpService.VerifyMagicLink(ctx.Param("token"))
+	if err != nil {
+		c.logger.Warnw("Magic link verification failed", "error", err)
+		return c.redirectMagicLink(ctx, url.Values{"error": {magicLinkError(err)}})
+	}
+
+	response, err := c.issueToken(result)
+	if err != nil {
+		return c.redirectMagicLink(ctx, url.Values{"error": {"server_error"}})
+	}
+
+	fragment := url.Values{}
+	switch r := response.(type) {
+	case *entity.AuthResponse:
+		fragment.Set("token", r.Token)
+		fragment.Set("expires_at", r.ExpiresAt.Format(time.RFC3339))
+	case *entity.ConfirmationResponse:
+		fragment.Set("confirmation_token", r.ConfirmationToken)
+		fragment.Set("purpose", r.Purpose)
+		fragment.Set("expires_at", r.ExpiresAt.Format(time.RFC3339))
+	}
+
+	return c.redirectMagicLink(ctx, fragment)
+}
+
+// issueToken signs the outcome of a verification: a JWT for a login, or a confirmation
+// for any other purpose
+func (c *OTPController) issueToken(result *service.VerificationResult) (interface{}, error) {
+	// Non-login purposes get a signed confirmation rather than a session
+	if result.Confirmation != nil {
+		confirmation, err := c.jwtService.GenerateConfirmationToken(result.Confirmation)
+		if err != nil {
+			c.logger.Errorw("Failed to generate confirmation token", "purpose", result.Confirmation.Purpose, "error", err)
+			return nil, err
+		}
+
+		c.logger.Infow("OTP confirmed successfully", "purpose", confirmation.Purpose, "phone_number", confirmation.PhoneNumber)
+		return confirmation, nil
+	}
+
+	// Generate JWT token
+	user := result.User
+	authResponse, err := c.jwtService.GenerateToken(user, result.TestNumber)
+	if err != nil {
+		c.logger.Errorw("Failed to generate JWT token", "user_id", user.ID, "error", err)
+		return nil, err
+	}
+
 	c.logger.Infow("OTP verified successfully", "user_id", user.ID, "phone_number", user.PhoneNumber)
-	return ctx.JSON(http.StatusOK, authResponse)
+	return authResponse, nil
+}
+
+// redirectMagicLink redirects to the client URL with the result in the fragment, which
+// browsers do not send to servers
+func (c *OTPController) redirectMagicLink(ctx echo.Context, fragment url.Values) error {
+	// The fragment carries a bearer token; keep it out of caches and referrers
+	ctx.Response().Header().Set("Cache-Control", "no-store")
+	ctx.Response().Header().Set("Referrer-Policy", "no-referrer")
+	return ctx.Redirect(http.StatusSeeOther, c.magicLinkRedirectURL+"#"+fragment.Encode())
+}
+
+// destinationNotAllowed responds with 403 without revealing which rule refused the phone number
+func destinationNotAllowed(ctx echo.Context) error {
+	return ctx.JSON(http.StatusForbidden, map[string]interface{}{
+		"error":   "Destination not allowed",
+		"details": "OTPs cannot be sent to this phone number",
+	})
+}
+
+// sendingSuspended responds with 429 when anomaly detection blocks sends to a prefix or from an IP
+func sendingSuspended(ctx echo.Context) error {
+	return ctx.JSON(http.StatusTooManyRequests, map[string]interface{}{
+		"error":   "Sending temporarily suspended",
+		"details": "OTPs to this destination or from this network are temporarily suspended. Please try again later.",
+	})
+}
+
+// rateLimitExceeded responds with 429 and the retry time of the rate limit dimension that refused the send
+func (c *OTPController) rateLimitExceeded(ctx echo.Context, err error) error {
+	var rateLimitErr *service.RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		return ctx.JSON(http.StatusTooManyRequests, map[string]interface{}{
+			"error":   "Rate limit exceeded",
+			"details": "Too many OTP requests. Please try again later.",
+		})
+	}
+
+	setRateLimitHeaders(ctx, rateLimitErr.Limit, 0, rateLimitErr.ResetAt)
+	ctx.Response().Header().Set("Retry-After", secondsUntil(rateLimitErr.RetryAt))
+
+	return ctx.JSON(http.StatusTooManyRequests, map[string]interface{}{
+		"error":     "Rate limit exceeded",
+		"details":   fmt.Sprintf("Maximum %d OTP requests %s within %v. Please try again later.", rateLimitErr.Limit, rateLimitScopes[rateLimitErr.Dimension], rateLimitErr.Window),
+		"dimension": rateLimitErr.Dimension,
+		"limit":     rateLimitErr.Limit,
+		"retry_at":  rateLimitErr.RetryAt,
+	})
+}
+
+// setSendRateLimitHeaders sets the RateLimit-* headers of a send or resend from the state the
+// request was counted with, or from the current state of its limits when it was not counted
+// (test numbers, refused and failed requests)
+func (c *OTPController) setSendRateLimitHeaders(ctx echo.Context, phoneNumber string, counted *entity.RateLimitResult) {
+	state := counted
+	if state == nil {
+		var err error
+		state, err = c.otpService.RateLimitState(phoneNumber, ctx.RealIP(), ctx.Request().Header.Get(DeviceIDHeader))
+		if err != nil {
+			c.logger.Warnw("Failed to get rate limit state", "phone_number", phoneNumber, "error", err)
+			return
+		}
+		if state == nil {
+			return
+		}
+	}
+
+	setRateLimitHeaders(ctx, state.Limit, state.Remaining, state.ResetAt)
+}
+
+// setRateLimitHeaders sets the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers
+func setRateLimitHeaders(ctx echo.Context, limit, remaining int, resetAt time.Time) {
+	header := ctx.Response().Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	header.Set("RateLimit-Reset", secondsUntil(resetAt))
+}
+
+// secondsUntil returns the whole seconds until t, rounded up, as a header value
+func secondsUntil(t time.Time) string {
+	seconds := math.Ceil(time.Until(t).Seconds())
+	if seconds < 0 {
+		seconds = 0
+	}
+	return strconv.Itoa(int(seconds))
+}
+
+// magicLinkError maps a verification error to the error code passed to the client
+func magicLinkError(err error) string {
+	switch {
+	case errors.Is(err, service.ErrPhoneLocked):
+		return "phone_locked"
+	case errors.Is(err, service.ErrSessionLocked):
+		return "session_locked"
+	case errors.Is(err, service.ErrInvalidOTP):
+		return "invalid_or_expired"
+	case errors.Is(err, service.ErrUserInactive):
+		return "account_disabled"
+	default:
+		return "server_error"
+	}
 }
@@ -0,0 +1,375 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"otp-auth/entity"
+	"otp-auth/service"
+	"otp-auth/test"
+	"otp-auth/validator"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubOTPService answers sends with a fixed response or error and reports a fixed rate limit state
+type stubOTPService struct {
+	service.OTPService
+	response *entity.OTPResponse
+	err      error
+	state    *entity.RateLimitResult
+	sent     *entity.SendOTPRequest
+	verified *entity.VerifyOTPRequest
+	result   *service.VerificationResult
+	links    int // magic links verified
+}
+
+// stubJWTService signs every login with a fixed token
+type stubJWTService struct {
+	service.JWTService
+	expiresAt time.Time
+}
+
+// GenerateToken returns a fixed token
+func (s *stubJWTService) GenerateToken(user *entity.User, testNumber bool) (*entity.AuthResponse, error) {
+	return &entity.AuthResponse{Token: "signed-jwt", ExpiresAt: s.expiresAt}, nil
+}
+
+// SendOTP records the request and returns the stubbed response and error
+func (s *stubOTPService) SendOTP(req *entity.SendOTPRequest) (*entity.OTPResponse, error) {
+	s.sent = req
+	return s.response, s.err
+}
+
+// ResendOTP returns the stubbed response and error
+func (s *stubOTPService) ResendOTP(req *entity.ResendOTPRequest) (*entity.OTPResponse, error) {
+	return s.response, s.err
+}
+
+// VerifyOTP records the request and returns the stubbed error
+func (s *stubOTPService) VerifyOTP(req *entity.VerifyOTPRequest) (*service.VerificationResult, error) {
+	s.verified = req
+	return nil, s.err
+}
+
+// VerifyMagicLink counts the verification and returns the stubbed result and error
+func (s *stubOTPService) VerifyMagicLink(linkToken string) (*service.VerificationResult, error) {
+	s.links++
+	return s.result, s.err
+}
+
+// GetSession returns the stubbed session as a pending session, or the stubbed error
+func (s *stubOTPService) GetSession(sessionToken string) (*entity.SessionStatusResponse, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &entity.SessionStatusResponse{Status: entity.SessionStatusPending}, nil
+}
+
+// CancelSession returns the stubbed error
+func (s *stubOTPService) CancelSession(sessionToken string) error {
+	return s.err
+}
+
+// RateLimitState returns the stubbed state
+func (s *stubOTPService) RateLimitState(phoneNumber, clientIP, deviceID string) (*entity.RateLimitResult, error) {
+	return s.state, nil
+}
+
+// sendTestRequest posts body to the send handler backed by svc
+func sendTestRequest(svc service.OTPService, body string) *httptest.ResponseRecorder {
+	return sendTestRequestWithHeaders(svc, body, nil)
+}
+
+// sendTestRequestWithHeaders posts body with extra headers to the send handler backed by svc
+func sendTestRequestWithHeaders(svc service.OTPService, body string, headers map[string]string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/otp/send", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+
+	controller := NewOTPController(svc, nil, validator.New(), test.GetTestLogger(), "")
+	_ = controller.SendOTP(e.NewContext(req, rec))
+
+	return rec
+}
+
+func TestSendOTP_RateLimitHeadersOnEveryResponse(t *testing.T) {
+	state := &entity.RateLimitResult{Allowed: true, Limit: 3, Remaining: 2, ResetAt: time.Now().Add(time.Minute)}
+	valid := `{"phone_number": "+447700900123"}`
+
+	cases := []struct {
+		name   string
+		svc    *stubOTPService
+		body   string
+		status int
+	}{
+		{"test number", &stubOTPService{response: &entity.OTPResponse{Token: "token"}, state: state}, valid, http.StatusOK},
+		{"validation failure", &stubOTPService{state: state}, `{"phone_number": "not a number"}`, http.StatusBadRequest},
+		{"channel unavailable", &stubOTPService{err: service.ErrChannelUnavailable, state: state}, valid, http.StatusBadRequest},
+		{"destination denied", &stubOTPService{err: &service.DestinationError{Prefix: "+44"}, state: state}, valid, http.StatusForbidden},
+		{"phone number locked", &stubOTPService{err: &service.LockoutError{LockedUntil: time.Now().Add(time.Hour)}, state: state}, valid, http.StatusLocked},
+		{"internal error", &stubOTPService{err: assert.AnError, state: state}, valid, http.StatusInternalServerError},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rec := sendTestRequest(c.svc, c.body)
+
+			assert.Equal(t, c.status, rec.Code)
+			assert.Equal(t, "3", rec.Header().Get("RateLimit-Limit"))
+			assert.Equal(t, "2", rec.Header().Get("RateLimit-Remaining"))
+			assert.Equal(t, "60", rec.Header().Get("RateLimit-Reset"))
+		})
+	}
+}
+
+func TestSendOTP_RateLimitHeadersFromCountedSend(t *testing.T) {
+	svc := &stubOTPService{
+		response: &entity.OTPResponse{
+			Token:     "token",
+			RateLimit: &entity.RateLimitResult{Allowed: true, Limit: 3, Remaining: 0, ResetAt: time.Now().Add(10 * time.Minute)},
+		},
+		state: &entity.RateLimitResult{Allowed: false, Limit: 3, Remaining: 0},
+	}
+
+	rec := sendTestRequest(svc, `{"phone_number": "+447700900123"}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "3", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "600", rec.Header().Get("RateLimit-Reset"))
+}
+
+func TestSendOTP_RateLimitedResponse(t *testing.T) {
+	retryAt := time.Now().Add(30 * time.Second)
+	svc := &stubOTPService{
+		err: &service.RateLimitError{
+			Dimension: entity.RateLimitDimensionIP,
+			Limit:     20,
+			Window:    time.Hour,
+			RetryAt:   retryAt,
+			ResetAt:   time.Now().Add(time.Hour),
+		},
+		state: &entity.RateLimitResult{Allowed: true, Limit: 3, Remaining: 2, ResetAt: time.Now().Add(time.Minute)},
+	}
+
+	rec := sendTestRequest(svc, `{"phone_number": "+447700900123"}`)
+
+	// The exhausted limit is reported rather than the most constrained remaining one
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "20", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "3600", rec.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+}
+
+func TestSendOTP_NoRateLimitHeadersWithoutLimits(t *testing.T) {
+	rec := sendTestRequest(&stubOTPService{err: assert.AnError}, `{"phone_number": "+447700900123"}`)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Empty(t, rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestSendOTP_LocaleFallsBackToAcceptLanguage(t *testing.T) {
+	headers := map[string]string{"Accept-Language": "fa-IR,fa;q=0.9,en;q=0.5"}
+
+	svc := &stubOTPService{response: &entity.OTPResponse{Token: "token"}}
+	rec := sendTestRequestWithHeaders(svc, `{"phone_number": "+989121234567"}`, headers)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "fa-IR,fa;q=0.9,en;q=0.5", svc.sent.Locale)
+
+	// An explicit locale wins over the header
+	svc = &stubOTPService{response: &entity.OTPResponse{Token: "token"}}
+	rec = sendTestRequestWithHeaders(svc, `{"phone_number": "+989121234567", "locale": "ar"}`, headers)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ar", svc.sent.Locale)
+}
+
+// sessionTestRequest sends method to the session route for token, handled by svc
+func sessionTestRequest(svc service.OTPService, method, token string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(method, "/api/v1/otp/sessions/"+token, nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetParamNames("token")
+	ctx.SetParamValues(token)
+
+	controller := NewOTPController(svc, nil, validator.New(), test.GetTestLogger(), "")
+	if method == http.MethodDelete {
+		_ = controller.CancelSession(ctx)
+	} else {
+		_ = controller.GetSession(ctx)
+	}
+
+	return rec
+}
+
+func TestSessionRoutes_StatusCodes(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		err    error
+		status int
+	}{
+		{"get", http.MethodGet, nil, http.StatusOK},
+		{"get unknown", http.MethodGet, service.ErrSessionNotFound, http.StatusNotFound},
+		{"get failure", http.MethodGet, assert.AnError, http.StatusInternalServerError},
+		{"cancel", http.MethodDelete, nil, http.StatusNoContent},
+		{"cancel unknown", http.MethodDelete, service.ErrSessionNotFound, http.StatusNotFound},
+		{"cancel verified", http.MethodDelete, service.ErrSessionUsed, http.StatusConflict},
+		{"cancel failure", http.MethodDelete, assert.AnError, http.StatusInternalServerError},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rec := sessionTestRequest(&stubOTPService{err: c.err}, c.method, "token")
+			assert.Equal(t, c.status, rec.Code)
+		})
+	}
+}
+
+func TestResendOTP_ErrorResponses(t *testing.T) {
+	availableAt := time.Now().Add(20 * time.Second)
+
+	cases := []struct {
+		name       string
+		err        error
+		status     int
+		error      string
+		retryAfter string
+	}{
+		{"cooldown", &service.CooldownError{AvailableAt: availableAt}, http.StatusTooManyRequests, "Resend not available yet", "20"},
+		{"cap reached", service.ErrResendLimitReached, http.StatusTooManyRequests, "Resend limit reached", ""},
+		{"unknown session", service.ErrSessionNotFound, http.StatusNotFound, "Session not found", ""},
+		{"verified session", service.ErrSessionUsed, http.StatusConflict, "Session already verified", ""},
+		{"cancelled session", service.ErrSessionCancelled, http.StatusConflict, "Session cancelled", ""},
+		{"locked session", &service.AttemptError{Err: service.ErrSessionLocked}, http.StatusLocked, "OTP session locked", ""},
+		{"internal error", assert.AnError, http.StatusInternalServerError, "Failed to resend OTP", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/otp/resend", strings.NewReader(`{"token": "session-token"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			controller := NewOTPController(&stubOTPService{err: c.err}, nil, validator.New(), test.GetTestLogger(), "")
+			_ = controller.ResendOTP(e.NewContext(req, rec))
+
+			assert.Equal(t, c.status, rec.Code)
+			assert.Contains(t, rec.Body.String(), c.error)
+			assert.Equal(t, c.retryAfter, rec.Header().Get("Retry-After"))
+		})
+	}
+}
+
+// verifyTestRequest posts body to the verify handler backed by svc
+func verifyTestRequest(svc service.OTPService, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/otp/verify", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	controller := NewOTPController(svc, nil, validator.New(), test.GetTestLogger(), "")
+	_ = controller.VerifyOTP(e.NewContext(req, rec))
+
+	return rec
+}
+
+func TestVerifyOTP_PhoneNumberMode(t *testing.T) {
+	// Token and phone number are mutually exclusive; neither reaches the service
+	for _, body := range []string{
+		`{"code": "123456"}`,
+		`{"token": "session-token", "phone_number": "+447700900123", "client_id": "kiosk", "code": "123456"}`,
+	} {
+		svc := &stubOTPService{}
+		rec := verifyTestRequest(svc, body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		assert.Contains(t, rec.Body.String(), "Validation failed", body)
+		assert.Nil(t, svc.verified, body)
+	}
+
+	// A client app not in phone_number verify mode is refused by the service
+	svc := &stubOTPService{err: service.ErrVerifyModeNotAllowed}
+	rec := verifyTestRequest(svc, `{"phone_number": "+447700900123", "client_id": "mobile", "code": "123456"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Verification mode not allowed")
+	if assert.NotNil(t, svc.verified) {
+		assert.Equal(t, "mobile", svc.verified.ClientID)
+		assert.Empty(t, svc.verified.Token)
+	}
+}
+
+// magicLinkTestRequest sends method to a magic link handled by svc and returns the response
+func magicLinkTestRequest(svc service.OTPService, jwtService service.JWTService, method string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(method, "/api/v1/otp/magic-link/link-token", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetParamNames("token")
+	ctx.SetParamValues("link-token")
+
+	controller := NewOTPController(svc, jwtService, validator.New(), test.GetTestLogger(), "https://app.example.com/signed-in")
+	if method == http.MethodGet {
+		_ = controller.ShowMagicLink(ctx)
+	} else {
+		_ = controller.VerifyMagicLink(ctx)
+	}
+
+	return rec
+}
+
+func TestShowMagicLink_DoesNotVerify(t *testing.T) {
+	svc := &stubOTPService{result: &service.VerificationResult{User: &entity.User{ID: 1, PhoneNumber: "+447700900123"}}}
+
+	rec := magicLinkTestRequest(svc, &stubJWTService{}, http.MethodGet)
+
+	// Opening the link only serves the page that posts back to it
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Zero(t, svc.links)
+	assert.Contains(t, rec.Body.String(), `<form method="post">`)
+	assert.Empty(t, rec.Header().Get("Location"))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "no-referrer", rec.Header().Get("Referrer-Policy"))
+	assert.Contains(t, rec.Header().Get("Content-Security-Policy"), "frame-ancestors 'none'")
+}
+
+func TestVerifyMagicLink_RedirectsWithToken(t *testing.T) {
+	expiresAt := time.Date(2024, 1, 15, 13, 0, 0, 0, time.UTC)
+	svc := &stubOTPService{result: &service.VerificationResult{User: &entity.User{ID: 1, PhoneNumber: "+447700900123"}}}
+
+	rec := magicLinkTestRequest(svc, &stubJWTService{expiresAt: expiresAt}, http.MethodPost)
+
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, 1, svc.links)
+	assert.Equal(t, "https://app.example.com/signed-in#expires_at=2024-01-15T13%3A00%3A00Z&token=signed-jwt", rec.Header().Get("Location"))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "no-referrer", rec.Header().Get("Referrer-Policy"))
+}
+
+func TestVerifyMagicLink_RedirectsWithError(t *testing.T) {
+	cases := map[string]error{
+		"invalid_or_expired": service.ErrInvalidOTP,
+		"session_locked":     &service.AttemptError{Err: service.ErrSessionLocked},
+		"phone_locked":       &service.LockoutError{LockedUntil: time.Now().Add(time.Hour)},
+		"account_disabled":   service.ErrUserInactive,
+		"server_error":       assert.AnError,
+	}
+
+	for code, err := range cases {
+		rec := magicLinkTestRequest(&stubOTPService{err: err}, nil, http.MethodPost)
+
+		assert.Equal(t, http.StatusSeeOther, rec.Code, code)
+		assert.Equal(t, "https://app.example.com/signed-in#error="+code, rec.Header().Get("Location"))
+		assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"), code)
+	}
+}
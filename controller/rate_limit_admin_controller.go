@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"otp-auth/entity"
+	"otp-auth/pkg/logger"
+	"otp-auth/service"
+	"otp-auth/validator"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimitAdminController handles the admin endpoints for rate limit state
+type RateLimitAdminController struct {
+	adminService service.RateLimitAdminService
+	validator    *validator.Validator
+	logger       *logger.Logger
+}
+
+// NewRateLimitAdminController creates a new rate limit admin controller instance
+func NewRateLimitAdminController(adminService service.RateLimitAdminService, validator *validator.Validator, logger *logger.Logger) *RateLimitAdminController {
+	return &RateLimitAdminController{
+		adminService: adminService,
+		validator:    validator,
+		logger:       logger,
+	}
+}
+
+// GetRateLimit handles rate limit status requests
+// @Summary Get rate limit status
+// @Description Return the current state of one rate limit without counting a request. Admin only.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param dimension path string true "phone_number, ip, device, country or global"
+// @Param value path string true "Phone number (URL-encode the leading +), IP, device ID or calling code; ignored for global"
+// @Success 200 {object} entity.RateLimitStatusResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Dimension not enabled"
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/rate-limits/{dimension}/{value} [get]
+func (c *RateLimitAdminController) GetRateLimit(ctx echo.Context) error {
+	value, err := url.PathUnescape(ctx.Param("value"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+	}
+
+	status, err := c.adminService.GetStatus(ctx.Param("dimension"), value)
+	if err != nil {
+		return c.rateLimitAdminError(ctx, err, "Failed to get rate limit")
+	}
+
+	return ctx.JSON(http.StatusOK, status)
+}
+
+// ResetRateLimit handles rate limit reset requests
+// @Summary Reset rate limit
+// @Description Forget the requests counted against one rate limit, e.g. to unblock a customer. Recorded in the audit trail. Admin only.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param dimension path string true "phone_number, ip, device, country or global"
+// @Param value path string true "Phone number (URL-encode the leading +), IP, device ID or calling code; ignored for global"
+// @Success 200 {object} entity.RateLimitStatusResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Dimension not enabled"
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/rate-limits/{dimension}/{value} [delete]
+func (c *RateLimitAdminController) ResetRateLimit(ctx echo.Context) error {
+	value, err := url.PathUnescape(ctx.Param("value"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+	}
+
+	dimension := ctx.Param("dimension")
+	if err := c.adminService.Reset(adminUser(ctx), dimension, value); err != nil {
+		return c.rateLimitAdminError(ctx, err, "Failed to reset rate limit")
+	}
+
+	status, err := c.adminService.GetStatus(dimension, value)
+	if err != nil {
+		return c.rateLimitAdminError(ctx, err, "Failed to get rate limit")
+	}
+
+	return ctx.JSON(http.StatusOK, status)
+}
+
+// SetRateLimitOverride handles rate limit override requests
+// @Summary Override rate limit
+// @Description Temporarily replace the limit of one rate limit, e.g. to raise a customer's quota. The window and algorithm stay as configured. Recorded in the audit trail. Admin only.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param dimension path string true "phone_number, ip, device, country or global"
+// @Param value path string true "Phone number (URL-encode the leading +), IP, device ID or calling code; ignored for global"
+// @Param request body entity.RateLimitOverrideRequest true "Override"
+// @Success 200 {object} entity.RateLimitStatusResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Dimension not enabled"
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/rate-limits/{dimension}/{value}/override [put]
+func (c *RateLimitAdminController) SetRateLimitOverride(ctx echo.Context) error {
+	value, err := url.PathUnescape(ctx.Param("value"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+	}
+
+	var req entity.RateLimitOverrideRequest
+	if err := ctx.Bind(&req); err != nil {
+		c.logger.Errorw("Failed to bind request", "error", err)
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+	}
+
+	if err := c.validator.ValidateStruct(&req); err != nil {
+		c.logger.Warnw("Validation failed", "request", req, "error", err)
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Validation failed",
+			"details": err.Error(),
+		})
+	}
+
+	status, err := c.adminService.SetOverride(adminUser(ctx), ctx.Param("dimension"), value, &req)
+	if err != nil {
+		return c.rateLimitAdminError(ctx, err, "Failed to override rate limit")
+	}
+
+	return ctx.JSON(http.StatusOK, status)
+}
+
+// ClearRateLimitOverride handles requests to remove a rate limit override
+// @Summary Remove rate limit override
+// @Description Restore the configured limit of one rate limit. Recorded in the audit trail. Admin only.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param dimension path string true "phone_number, ip, device, country or global"
+// @Param value path string true "Phone number (URL-encode the leading +), IP, device ID or calling code; ignored for global"
+// @Success 200 {object} entity.RateLimitStatusResponse
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Dimension not enabled"
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/rate-limits/{dimension}/{value}/override [delete]
+func (c *RateLimitAdminController) ClearRateLimitOverride(ctx echo.Context) error {
+	value, err := url.PathUnescape(ctx.Param("value"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+	}
+
+	dimension := ctx.Param("dimension")
+	if err := c.adminService.ClearOverride(adminUser(ctx), dimension, value); err != nil {
+		return c.rateLimitAdminError(ctx, err, "Failed to remove rate limit override")
+	}
+
+	status, err := c.adminService.GetStatus(dimension, value)
+	if err != nil {
+		return c.rateLimitAdminError(ctx, err, "Failed to get rate limit")
+	}
+
+	return ctx.JSON(http.StatusOK, status)
+}
+
+// ListRateLimitAudit handles rate limit audit trail requests
+// @Summary List rate limit audit trail
+// @Description Return the most recent changes made through the rate limit admin API, newest first. Admin only.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param dimension query string false "Only changes to this dimension"
+// @Param value query string false "Only changes to this value (with dimension)"
+// @Param limit query int false "Maximum entries (default 50, max 500)"
+// @Success 200 {array} entity.RateLimitAuditEntry
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/rate-limits/audit [get]
+func (c *RateLimitAdminController) ListRateLimitAudit(ctx echo.Context) error {
+	limit := 50
+	if limitParam := ctx.QueryParam("limit"); limitParam != "" {
+		if l, err := strconv.Atoi(limitParam); err == nil && l > 0 && l <= 500 {
+			limit = l
+		}
+	}
+
+	entries, err := c.adminService.ListAudit(ctx.QueryParam("dimension"), ctx.QueryParam("value"), limit)
+	if err != nil {
+		return c.rateLimitAdminError(ctx, err, "Failed to list rate limit audit trail")
+	}
+
+	return ctx.JSON(http.StatusOK, entries)
+}
+
+// rateLimitAdminError maps a rate limit admin error to its response
+func (c *RateLimitAdminController) rateLimitAdminError(ctx echo.Context, err error, message string) error {
+	switch {
+	case errors.Is(err, service.ErrUnknownRateLimitDimension):
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Unknown rate limit dimension",
+			"details": "Use phone_number, ip, device, country or global",
+		})
+	case errors.Is(err, service.ErrRateLimitDimensionDisabled):
+		return ctx.JSON(http.StatusNotFound, map[string]interface{}{
+			"error":   "Rate limit dimension not enabled",
+			"details": err.Error(),
+		})
+	case errors.Is(err, service.ErrInvalidRateLimitOverride):
+		return ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Invalid override",
+			"details": err.Error(),
+		})
+	}
+
+	c.logger.Errorw(message, "error", err)
+	return ctx.JSON(http.StatusInternalServerError, map[string]interface{}{
+		"error":   message,
+		"details": "Internal server error",
+	})
+}
+
+// adminUser returns the signed in admin; AdminMiddleware guarantees it is set
+func adminUser(ctx echo.Context) *entity.User {
+	user, _ := ctx.Get("user").(*entity.User)
+	return user
+}
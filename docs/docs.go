@@ -41,41 +41,48 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/logout": {
-            "post": {
+        "/admin/rate-limits/audit": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Logout user and revoke JWT token from Redis session store",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Return the most recent changes made through the rate limit admin API, newest first. Admin only.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Authentication"
+                    "Admin"
                 ],
-                "summary": "Logout user",
+                "summary": "List rate limit audit trail",
                 "parameters": [
                     {
-                        "description": "Logout options",
-                        "name": "request",
-                        "in": "body",
-                        "schema": {
-                            "$ref": "#/definitions/controller.LogoutRequest"
-                        }
+                        "type": "string",
+                        "description": "Only changes to this dimension",
+                        "name": "dimension",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only changes to this value (with dimension)",
+                        "name": "value",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum entries (default 50, max 500)",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/entity.RateLimitAuditEntry"
                             }
                         }
                     },
@@ -93,6 +100,13 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -103,58 +117,116 @@ const docTemplate = `{
                 }
             }
         },
-        "/health": {
+        "/admin/rate-limits/{dimension}/{value}": {
             "get": {
-                "description": "Returns the health status of the service",
-                "consumes": [
-                    "application/json"
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Return the current state of one rate limit without counting a request. Admin only.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "System"
+                    "Admin"
+                ],
+                "summary": "Get rate limit status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "phone_number, ip, device, country or global",
+                        "name": "dimension",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Phone number (URL-encode the leading +), IP, device ID or calling code; ignored for global",
+                        "name": "value",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Health check endpoint",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/controller.HealthResponse"
+                            "$ref": "#/definitions/entity.RateLimitStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Dimension not enabled",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
                         }
                     }
                 }
-            }
-        },
-        "/otp/send": {
-            "post": {
-                "description": "Generate and send OTP to the provided phone number",
-                "consumes": [
-                    "application/json"
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Forget the requests counted against one rate limit, e.g. to unblock a customer. Recorded in the audit trail. Admin only.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "OTP"
+                    "Admin"
                 ],
-                "summary": "Send OTP",
+                "summary": "Reset rate limit",
                 "parameters": [
                     {
-                        "description": "Send OTP Request",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/entity.SendOTPRequest"
-                        }
+                        "type": "string",
+                        "description": "phone_number, ip, device, country or global",
+                        "name": "dimension",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Phone number (URL-encode the leading +), IP, device ID or calling code; ignored for global",
+                        "name": "value",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/entity.OTPResponse"
+                            "$ref": "#/definitions/entity.RateLimitStatusResponse"
                         }
                     },
                     "400": {
@@ -164,8 +236,22 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
-                    "429": {
-                        "description": "Too Many Requests",
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Dimension not enabled",
                         "schema": {
                             "type": "object",
                             "additionalProperties": true
@@ -181,9 +267,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/otp/verify": {
-            "post": {
-                "description": "Verify OTP and authenticate user",
+        "/admin/rate-limits/{dimension}/{value}/override": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Temporarily replace the limit of one rate limit, e.g. to raise a customer's quota. The window and algorithm stay as configured. Recorded in the audit trail. Admin only.",
                 "consumes": [
                     "application/json"
                 ],
@@ -191,17 +282,31 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "OTP"
+                    "Admin"
                 ],
-                "summary": "Verify OTP",
+                "summary": "Override rate limit",
                 "parameters": [
                     {
-                        "description": "Verify OTP Request (token from send response)",
+                        "type": "string",
+                        "description": "phone_number, ip, device, country or global",
+                        "name": "dimension",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Phone number (URL-encode the leading +), IP, device ID or calling code; ignored for global",
+                        "name": "value",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Override",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/entity.VerifyOTPRequest"
+                            "$ref": "#/definitions/entity.RateLimitOverrideRequest"
                         }
                     }
                 ],
@@ -209,7 +314,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/entity.AuthResponse"
+                            "$ref": "#/definitions/entity.RateLimitStatusResponse"
                         }
                     },
                     "400": {
@@ -226,6 +331,20 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Dimension not enabled",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -234,53 +353,42 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/users": {
-            "get": {
+            },
+            "delete": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Get paginated list of users with optional search",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Restore the configured limit of one rate limit. Recorded in the audit trail. Admin only.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Admin"
                 ],
-                "summary": "List Users",
+                "summary": "Remove rate limit override",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "default": 1,
-                        "description": "Page number",
-                        "name": "page",
-                        "in": "query"
-                    },
-                    {
-                        "type": "integer",
-                        "default": 20,
-                        "description": "Page size",
-                        "name": "page_size",
-                        "in": "query"
+                        "type": "string",
+                        "description": "phone_number, ip, device, country or global",
+                        "name": "dimension",
+                        "in": "path",
+                        "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Search by phone number",
-                        "name": "search",
-                        "in": "query"
+                        "description": "Phone number (URL-encode the leading +), IP, device ID or calling code; ignored for global",
+                        "name": "value",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/entity.UsersListResponse"
+                            "$ref": "#/definitions/entity.RateLimitStatusResponse"
                         }
                     },
                     "400": {
@@ -297,6 +405,20 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Dimension not enabled",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -307,14 +429,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/{id}": {
-            "get": {
+        "/auth/logout": {
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Get user details by ID",
+                "description": "Logout user and revoke JWT token from Redis session store",
                 "consumes": [
                     "application/json"
                 ],
@@ -322,23 +444,27 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Authentication"
                 ],
-                "summary": "Get User",
+                "summary": "Logout user",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Logout options",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/controller.LogoutRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/entity.UserResponse"
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     },
                     "400": {
@@ -355,13 +481,6 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": true
-                        }
-                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -371,25 +490,794 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "controller.HealthResponse": {
-            "type": "object",
-            "properties": {
-                "service": {
-                    "type": "string",
-                    "example": "otp-auth-service"
-                },
-                "status": {
-                    "type": "string",
-                    "example": "healthy"
-                },
-                "version": {
-                    "type": "string",
-                    "example": "1.0.0"
-                }
-            }
+        },
+        "/dev/inbox/{phone}": {
+            "get": {
+                "description": "Return the most recent OTP messages delivered to a phone number, newest first. Only available outside production when DEV_INBOX_ENABLED is set.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Development"
+                ],
+                "summary": "Get dev inbox",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Phone number in E.164 format (URL-encode the leading +)",
+                        "name": "phone",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/entity.DevInboxResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Returns the health status of the service",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "System"
+                ],
+                "summary": "Health check endpoint",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/controller.HealthResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/otp/magic-link/{token}": {
+            "get": {
+                "description": "Serve a page that asks the user to continue; continuing posts to the same URL, which verifies the link. Opening the link does not consume it, so link previews and mail scanners cannot spend it. Only available when MAGIC_LINK_BASE_URL is set.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "OTP"
+                ],
+                "summary": "Open magic link",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Magic link token",
+                        "name": "token",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Confirmation page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Verify the session of a magic link sent with a login code and redirect to the configured client URL. The result is passed in the URL fragment: token and expires_at on success, or error (invalid_or_expired, session_locked, phone_locked, account_disabled, server_error). Links are single-use and expire with the code. Only available when MAGIC_LINK_BASE_URL is set.",
+                "tags": [
+                    "OTP"
+                ],
+                "summary": "Verify magic link",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Magic link token",
+                        "name": "token",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "303": {
+                        "description": "Redirect to the client URL"
+                    }
+                }
+            }
+        },
+        "/otp/resend": {
+            "post": {
+                "description": "Issue a new code on an existing session, invalidating the previous one. The session token stays the same. Resends are subject to a per-session cooldown and cap as well as the same rate limits as sends.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OTP"
+                ],
+                "summary": "Resend OTP",
+                "parameters": [
+                    {
+                        "description": "Resend OTP Request (token from send response)",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/entity.ResendOTPRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Device identifier for per device rate limits",
+                        "name": "X-Device-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/entity.OTPResponse"
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Limit of the most constrained rate limit"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Requests left under that limit"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until that limit's full quota is available again"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "403": {
+                        "description": "Destination not allowed",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Session already verified or cancelled",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "423": {
+                        "description": "Session burned or phone number locked",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "429": {
+                        "description": "Cooldown, resend cap, rate limit or sending suspended",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Limit of the most constrained rate limit"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Requests left under that limit"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until that limit's full quota is available again"
+                            },
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds until a resend can succeed"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/otp/send": {
+            "post": {
+                "description": "Generate and send OTP to the provided phone number over the preferred channel, falling back to the configured channel chain. The code is scoped to a purpose (default login) and, when a payload is given, bound to it; payment_confirmation requires a payload. Login codes can also carry a single-use sign-in link (magic_link).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OTP"
+                ],
+                "summary": "Send OTP",
+                "parameters": [
+                    {
+                        "description": "Send OTP Request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/entity.SendOTPRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message language when the request has no locale",
+                        "name": "Accept-Language",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Device identifier for per device rate limits",
+                        "name": "X-Device-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/entity.OTPResponse"
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Limit of the most constrained rate limit"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Requests left under that limit"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until that limit's full quota is available again"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Limit of the most constrained rate limit"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Requests left under that limit"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until that limit's full quota is available again"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Destination not allowed",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Limit of the most constrained rate limit"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Requests left under that limit"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until that limit's full quota is available again"
+                            }
+                        }
+                    },
+                    "423": {
+                        "description": "Phone number locked",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Limit of the most constrained rate limit"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Requests left under that limit"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until that limit's full quota is available again"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit exceeded (dimension names the limit) or sending suspended",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Limit of the most constrained rate limit"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Requests left under that limit"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until that limit's full quota is available again"
+                            },
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds until a send can succeed"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Limit of the most constrained rate limit"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Requests left under that limit"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until that limit's full quota is available again"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/otp/sessions/{token}": {
+            "get": {
+                "description": "Get the state of an OTP session: expiry, remaining attempts, resend availability and delivery state. The code is never returned.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OTP"
+                ],
+                "summary": "Get OTP session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Session token from the send response",
+                        "name": "token",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/entity.SessionStatusResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Cancel a pending OTP session so its code can no longer be verified or resent. Cancelling an already cancelled session succeeds.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OTP"
+                ],
+                "summary": "Cancel OTP session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Session token from the send response",
+                        "name": "token",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Session already verified",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/otp/verify": {
+            "post": {
+                "description": "Verify OTP and authenticate user. The session is identified by token or, for client apps in phone_number verify mode, by phone_number and client_id (the latest session sent to the number). Purpose and payload must match the send request. Login returns a JWT (entity.AuthResponse); other purposes return a signed confirmation (entity.ConfirmationResponse) instead.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "OTP"
+                ],
+                "summary": "Verify OTP",
+                "parameters": [
+                    {
+                        "description": "Verify OTP Request (token from send response, or phone_number and client_id)",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/entity.VerifyOTPRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/entity.AuthResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or expired OTP, with remaining_attempts",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "403": {
+                        "description": "Account disabled",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "423": {
+                        "description": "Session burned or phone number locked",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/users": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get paginated list of users with optional search",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "List Users",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 1,
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Page size",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Search by phone number",
+                        "name": "search",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/entity.UsersListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get user details by ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get User",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/entity.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/delivery-receipts": {
+            "post": {
+                "description": "Accept a delivery receipt from an SMS gateway. The request must carry X-Timestamp (unix seconds) and X-Signature (hex HMAC-SHA256 of \"\u003ctimestamp\u003e.\u003craw body\u003e\" with the shared secret).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Receive delivery receipt",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Unix timestamp of the callback",
+                        "name": "X-Timestamp",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Hex HMAC-SHA256 signature",
+                        "name": "X-Signature",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Delivery receipt",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/entity.DeliveryReceiptRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "controller.HealthResponse": {
+            "type": "object",
+            "properties": {
+                "service": {
+                    "type": "string",
+                    "example": "otp-auth-service"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "healthy"
+                },
+                "version": {
+                    "type": "string",
+                    "example": "1.0.0"
+                }
+            }
         },
         "controller.LogoutRequest": {
             "type": "object",
@@ -434,9 +1322,120 @@ const docTemplate = `{
                 }
             }
         },
+        "entity.DeliveryReceiptRequest": {
+            "type": "object",
+            "required": [
+                "message_id",
+                "status"
+            ],
+            "properties": {
+                "error_code": {
+                    "type": "string"
+                },
+                "message_id": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "e.g. delivered, DELIVRD, failed, UNDELIV",
+                    "type": "string"
+                },
+                "timestamp": {
+                    "description": "When the gateway observed the status",
+                    "type": "string"
+                }
+            }
+        },
+        "entity.DeliveryReceiptStatus": {
+            "type": "object",
+            "properties": {
+                "error_code": {
+                    "type": "string"
+                },
+                "received_at": {
+                    "type": "string"
+                },
+                "reported_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "entity.DeliveryStatusResponse": {
+            "type": "object",
+            "properties": {
+                "channel": {
+                    "type": "string"
+                },
+                "delivered_at": {
+                    "type": "string"
+                },
+                "receipts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/entity.DeliveryReceiptStatus"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "entity.DevInboxMessage": {
+            "type": "object",
+            "properties": {
+                "body": {
+                    "type": "string"
+                },
+                "channel": {
+                    "type": "string"
+                },
+                "code": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "received_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "entity.DevInboxResponse": {
+            "type": "object",
+            "properties": {
+                "messages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/entity.DevInboxMessage"
+                    }
+                },
+                "phone_number": {
+                    "type": "string"
+                }
+            }
+        },
         "entity.OTPResponse": {
             "type": "object",
             "properties": {
+                "available_channels": {
+                    "description": "Remaining fallback channels, in order",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "channel": {
+                    "description": "Channel used for the first delivery",
+                    "type": "string"
+                },
                 "expires_at": {
                     "type": "string"
                 },
@@ -446,19 +1445,227 @@ const docTemplate = `{
                 "phone_number": {
                     "type": "string"
                 },
+                "purpose": {
+                    "type": "string"
+                },
+                "resend_available_at": {
+                    "type": "string"
+                },
                 "token": {
                     "description": "Session token for verification",
                     "type": "string"
                 }
             }
         },
+        "entity.RateLimitAuditEntry": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "description": "reset, override or clear_override",
+                    "type": "string"
+                },
+                "actor_phone_number": {
+                    "type": "string"
+                },
+                "actor_user_id": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "dimension": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "override_expires_at": {
+                    "type": "string"
+                },
+                "override_limit": {
+                    "type": "integer"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "entity.RateLimitOverride": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "limit": {
+                    "type": "integer"
+                }
+            }
+        },
+        "entity.RateLimitOverrideRequest": {
+            "type": "object",
+            "required": [
+                "duration",
+                "limit"
+            ],
+            "properties": {
+                "duration": {
+                    "description": "How long the override lasts, e.g. 1h; at most 168h",
+                    "type": "string"
+                },
+                "limit": {
+                    "type": "integer",
+                    "maximum": 100000,
+                    "minimum": 1
+                }
+            }
+        },
+        "entity.RateLimitStatusResponse": {
+            "type": "object",
+            "properties": {
+                "algorithm": {
+                    "type": "string"
+                },
+                "dimension": {
+                    "type": "string"
+                },
+                "limit": {
+                    "description": "Effective limit, including an override",
+                    "type": "integer"
+                },
+                "limited": {
+                    "description": "The next request would be refused",
+                    "type": "boolean"
+                },
+                "override": {
+                    "description": "null when the configured limit applies",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/entity.RateLimitOverride"
+                        }
+                    ]
+                },
+                "remaining": {
+                    "type": "integer"
+                },
+                "reset_at": {
+                    "type": "string"
+                },
+                "retry_at": {
+                    "description": "null unless limited",
+                    "type": "string"
+                },
+                "value": {
+                    "description": "Phone number, IP, device ID or calling code; empty for global",
+                    "type": "string"
+                },
+                "window": {
+                    "type": "string"
+                }
+            }
+        },
+        "entity.ResendOTPRequest": {
+            "type": "object",
+            "required": [
+                "token"
+            ],
+            "properties": {
+                "channel": {
+                    "description": "Preferred delivery channel for the new code",
+                    "type": "string",
+                    "enum": [
+                        "sms",
+                        "voice",
+                        "email",
+                        "messaging_app"
+                    ]
+                },
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
         "entity.SendOTPRequest": {
             "type": "object",
             "required": [
                 "phone_number"
             ],
             "properties": {
+                "channel": {
+                    "description": "Preferred delivery channel",
+                    "type": "string",
+                    "enum": [
+                        "sms",
+                        "voice",
+                        "email",
+                        "messaging_app"
+                    ]
+                },
+                "client_id": {
+                    "description": "Registered client app, enables SMS autofill formatting",
+                    "type": "string",
+                    "maxLength": 64
+                },
+                "email": {
+                    "description": "Required for the email channel",
+                    "type": "string"
+                },
+                "locale": {
+                    "description": "e.g. en, fa-IR; defaults to Accept-Language",
+                    "type": "string",
+                    "maxLength": 35
+                },
+                "magic_link": {
+                    "description": "Also send a sign-in link (login only)",
+                    "type": "boolean"
+                },
+                "payload": {
+                    "description": "Action details the code is bound to, e.g. amount and payee",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "phone_number": {
+                    "type": "string"
+                },
+                "purpose": {
+                    "description": "Defaults to login",
+                    "type": "string",
+                    "enum": [
+                        "login",
+                        "phone_change",
+                        "account_deletion",
+                        "payment_confirmation"
+                    ]
+                }
+            }
+        },
+        "entity.SessionStatusResponse": {
+            "type": "object",
+            "properties": {
+                "delivery": {
+                    "$ref": "#/definitions/entity.DeliveryStatusResponse"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
                 "phone_number": {
+                    "description": "Masked, e.g. +98912*****67",
+                    "type": "string"
+                },
+                "purpose": {
+                    "type": "string"
+                },
+                "remaining_attempts": {
+                    "type": "integer"
+                },
+                "remaining_resends": {
+                    "type": "integer"
+                },
+                "resend_available_at": {
+                    "description": "null when the session cannot be resent",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "pending, verified, expired, locked or cancelled",
                     "type": "string"
                 }
             }
@@ -509,13 +1716,38 @@ const docTemplate = `{
         "entity.VerifyOTPRequest": {
             "type": "object",
             "required": [
-                "code",
-                "token"
+                "code"
             ],
             "properties": {
+                "client_id": {
+                    "description": "Required with phone_number",
+                    "type": "string",
+                    "maxLength": 64
+                },
                 "code": {
+                    "description": "Length and alphabet follow the purpose's code policy",
+                    "type": "string",
+                    "maxLength": 32
+                },
+                "payload": {
+                    "description": "Must match the payload of the send request",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "phone_number": {
+                    "description": "Instead of token, for client apps in phone_number verify mode",
                     "type": "string"
                 },
+                "purpose": {
+                    "description": "Must match the send request; defaults to login",
+                    "type": "string",
+                    "enum": [
+                        "login",
+                        "phone_change",
+                        "account_deletion",
+                        "payment_confirmation"
+                    ]
+                },
                 "token": {
                     "type": "string"
                 }
@@ -0,0 +1,49 @@
+package entity
+
+import (
+	"time"
+)
+
+// Anomaly alert events
+const (
+	AnomalyEventDetected = "anomaly_detected"
+	AnomalyEventResolved = "anomaly_resolved"
+)
+
+// ConversionStat counts the sessions started for one country calling code or IP and how many were verified
+type ConversionStat struct {
+	Key      string `db:"key" json:"key"`
+	Sent     int    `db:"sent" json:"sent"`
+	Verified int    `db:"verified" json:"verified"`
+}
+
+// ConversionRate returns the share of sessions that were verified
+func (c ConversionStat) ConversionRate() float64 {
+	if c.Sent == 0 {
+		return 0
+	}
+	return float64(c.Verified) / float64(c.Sent)
+}
+
+// AnomalyRestriction is the action taken against a country calling code or IP with collapsed conversion
+type AnomalyRestriction struct {
+	Dimension  string         `json:"dimension"` // country or ip
+	Value      string         `json:"value"`
+	Action     string         `json:"action"` // alert, throttle or block
+	Stat       ConversionStat `json:"-"`
+	DetectedAt time.Time      `json:"detected_at"`
+}
+
+// AnomalyAlert is the JSON body posted to the anomaly webhook
+type AnomalyAlert struct {
+	Event          string    `json:"event"`
+	Dimension      string    `json:"dimension"`
+	Value          string    `json:"value"`
+	Action         string    `json:"action"`
+	Sent           int       `json:"sent"`
+	Verified       int       `json:"verified"`
+	ConversionRate float64   `json:"conversion_rate"`
+	Threshold      float64   `json:"threshold"`
+	Window         string    `json:"window"`
+	At             time.Time `json:"at"`
+}
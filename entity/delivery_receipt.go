@@ -0,0 +1,47 @@
+package entity
+
+import (
+	"time"
+)
+
+// DeliveryReceipt represents a delivery report received from a gateway
+type DeliveryReceipt struct {
+	ID                int        `db:"id" json:"id"`
+	OTPID             *int       `db:"otp_id" json:"otp_id"`
+	ProviderMessageID string     `db:"provider_message_id" json:"provider_message_id"`
+	Status            string     `db:"status" json:"status"`
+	ProviderStatus    string     `db:"provider_status" json:"provider_status"`
+	ErrorCode         *string    `db:"error_code" json:"error_code"`
+	ReportedAt        *time.Time `db:"reported_at" json:"reported_at"`
+	ReceivedAt        time.Time  `db:"received_at" json:"received_at"`
+}
+
+// TableName returns the table name for the DeliveryReceipt entity
+func (DeliveryReceipt) TableName() string {
+	return "otp_delivery_receipts"
+}
+
+// DeliveryReceiptRequest represents a delivery receipt posted by a gateway
+type DeliveryReceiptRequest struct {
+	MessageID string     `json:"message_id" validate:"required"`
+	Status    string     `json:"status" validate:"required"` // e.g. delivered, DELIVRD, failed, UNDELIV
+	ErrorCode string     `json:"error_code,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"` // When the gateway observed the status
+}
+
+// DeliveryStatusResponse represents the delivery state of an OTP session
+type DeliveryStatusResponse struct {
+	Status      string                  `json:"status"`
+	Channel     string                  `json:"channel,omitempty"`
+	UpdatedAt   *time.Time              `json:"updated_at,omitempty"`
+	DeliveredAt *time.Time              `json:"delivered_at,omitempty"`
+	Receipts    []DeliveryReceiptStatus `json:"receipts"`
+}
+
+// DeliveryReceiptStatus represents a single receipt in the delivery status response
+type DeliveryReceiptStatus struct {
+	Status     string     `json:"status"`
+	ErrorCode  *string    `json:"error_code,omitempty"`
+	ReportedAt *time.Time `json:"reported_at,omitempty"`
+	ReceivedAt time.Time  `json:"received_at"`
+}
@@ -0,0 +1,27 @@
+package entity
+
+import (
+	"time"
+)
+
+// Destination rule actions
+const (
+	DestinationRuleAllow = "allow"
+	DestinationRuleDeny  = "deny"
+)
+
+// DestinationRule allows or denies OTPs to phone numbers starting with a prefix: a country
+// calling code such as +44 or a number range such as +44909
+type DestinationRule struct {
+	ID        int       `db:"id" json:"-"`
+	Prefix    string    `db:"prefix" json:"prefix"`
+	Action    string    `db:"action" json:"action"`
+	Note      *string   `db:"note" json:"note,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"-"`
+	UpdatedAt time.Time `db:"updated_at" json:"-"`
+}
+
+// TableName returns the table name for the DestinationRule entity
+func (DestinationRule) TableName() string {
+	return "otp_destination_rules"
+}
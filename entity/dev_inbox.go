@@ -0,0 +1,21 @@
+package entity
+
+import (
+	"time"
+)
+
+// DevInboxMessage represents an OTP message captured by the dev inbox
+type DevInboxMessage struct {
+	Channel    string    `json:"channel"`
+	Email      string    `json:"email,omitempty"`
+	Code       string    `json:"code"`
+	Body       string    `json:"body"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// DevInboxResponse represents the recent messages sent to a phone number, newest first
+type DevInboxResponse struct {
+	PhoneNumber string            `json:"phone_number"`
+	Messages    []DevInboxMessage `json:"messages"`
+}
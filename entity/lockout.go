@@ -0,0 +1,25 @@
+package entity
+
+import (
+	"time"
+)
+
+// Lockout represents the burned OTP sessions of a phone number and its verification lockout
+type Lockout struct {
+	PhoneNumber    string     `db:"phone_number" json:"phone_number"`
+	BurnedSessions int        `db:"burned_sessions" json:"burned_sessions"`
+	WindowStartAt  time.Time  `db:"window_start_at" json:"window_start_at"`
+	LockedUntil    *time.Time `db:"locked_until" json:"locked_until"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// IsLocked reports whether the lockout is in effect at the given time
+func (l *Lockout) IsLocked(now time.Time) bool {
+	return l != nil && l.LockedUntil != nil && l.LockedUntil.After(now)
+}
+
+// TableName returns the table name for the Lockout entity
+func (Lockout) TableName() string {
+	return "otp_lockouts"
+}
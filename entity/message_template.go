@@ -0,0 +1,20 @@
+package entity
+
+import (
+	"time"
+)
+
+// MessageTemplate represents an OTP message template for a locale and purpose
+type MessageTemplate struct {
+	ID        int       `db:"id" json:"id"`
+	Locale    string    `db:"locale" json:"locale"`
+	Purpose   string    `db:"purpose" json:"purpose"`
+	Body      string    `db:"body" json:"body"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// TableName returns the table name for the MessageTemplate entity
+func (MessageTemplate) TableName() string {
+	return "otp_message_templates"
+}
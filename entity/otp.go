@@ -4,16 +4,70 @@ import (
 	"time"
 )
 
+// OTP delivery statuses
+const (
+	DeliveryStatusQueued    = "queued"
+	DeliveryStatusSent      = "sent"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusFailed    = "failed"
+)
+
+// OTP purposes
+const (
+	PurposeLogin               = "login"
+	PurposePhoneChange         = "phone_change"
+	PurposeAccountDeletion     = "account_deletion"
+	PurposePaymentConfirmation = "payment_confirmation"
+)
+
+// Purposes lists every supported OTP purpose
+var Purposes = []string{PurposeLogin, PurposePhoneChange, PurposeAccountDeletion, PurposePaymentConfirmation}
+
+// OTP session statuses
+const (
+	SessionStatusPending   = "pending"
+	SessionStatusVerified  = "verified"
+	SessionStatusExpired   = "expired"
+	SessionStatusLocked    = "locked"
+	SessionStatusCancelled = "cancelled"
+)
+
 // OTP represents an OTP code in the system
 type OTP struct {
-	ID           int        `db:"id" json:"id"`
-	PhoneNumber  string     `db:"phone_number" json:"phone_number" validate:"required,phone_number"`
-	Code         string     `db:"code" json:"code"`
-	SessionToken string     `db:"session_token" json:"session_token"`
-	ExpiresAt    time.Time  `db:"expires_at" json:"expires_at"`
-	IsUsed       bool       `db:"is_used" json:"is_used"`
-	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
-	UsedAt       *time.Time `db:"used_at" json:"used_at"`
+	ID                int        `db:"id" json:"id"`
+	PhoneNumber       string     `db:"phone_number" json:"phone_number" validate:"required,phone_number"`
+	Code              string     `db:"code" json:"-"`          // HMAC-SHA256 of the code
+	SessionToken      string     `db:"session_token" json:"-"` // HMAC-SHA256 of the session token
+	ExpiresAt         time.Time  `db:"expires_at" json:"expires_at"`
+	IsUsed            bool       `db:"is_used" json:"is_used"`
+	CreatedAt         time.Time  `db:"created_at" json:"created_at"`
+	UsedAt            *time.Time `db:"used_at" json:"used_at"`
+	DeliveryChannel   *string    `db:"delivery_channel" json:"delivery_channel"`
+	ProviderMessageID *string    `db:"provider_message_id" json:"provider_message_id"`
+	DeliveryStatus    string     `db:"delivery_status" json:"delivery_status"`
+	DeliveryUpdatedAt *time.Time `db:"delivery_updated_at" json:"delivery_updated_at"`
+	DeliveredAt       *time.Time `db:"delivered_at" json:"delivered_at"`
+	ClientID          *string    `db:"client_id" json:"client_id"`
+	Attempts          int        `db:"attempts" json:"attempts"`
+	MaxAttempts       int        `db:"max_attempts" json:"max_attempts"`
+	ResendCount       int        `db:"resend_count" json:"resend_count"`
+	LastSentAt        time.Time  `db:"last_sent_at" json:"last_sent_at"`
+	Locale            *string    `db:"locale" json:"locale"`
+	CancelledAt       *time.Time `db:"cancelled_at" json:"cancelled_at"`
+	Purpose           string     `db:"purpose" json:"purpose"`
+	PayloadHash       *string    `db:"payload_hash" json:"-"`  // SHA-256 of the canonical payload the code is bound to
+	IsTest            bool       `db:"is_test" json:"is_test"` // Issued to a configured test phone number
+	LinkToken         *string    `db:"link_token" json:"-"`    // HMAC-SHA256 of the magic link token
+	ClientIP          *string    `db:"client_ip" json:"-"`     // IP the session was requested from
+	CallingCode       *string    `db:"calling_code" json:"-"`  // country calling code of the phone number
+}
+
+// RemainingAttempts returns how many verification attempts are left on the session
+func (o *OTP) RemainingAttempts() int {
+	if o.Attempts >= o.MaxAttempts {
+		return 0
+	}
+	return o.MaxAttempts - o.Attempts
 }
 
 // TableName returns the table name for the OTP entity
@@ -23,21 +77,79 @@ func (OTP) TableName() string {
 
 // SendOTPRequest represents the request to send an OTP
 type SendOTPRequest struct {
-	PhoneNumber string `json:"phone_number" validate:"required,phone_number"`
+	PhoneNumber string                 `json:"phone_number" validate:"required,phone_number"`
+	Channel     string                 `json:"channel,omitempty" validate:"omitempty,oneof=sms voice email messaging_app"`                            // Preferred delivery channel
+	Email       string                 `json:"email,omitempty" validate:"omitempty,email"`                                                            // Required for the email channel
+	Locale      string                 `json:"locale,omitempty" validate:"omitempty,max=35"`                                                          // e.g. en, fa-IR; defaults to Accept-Language
+	ClientID    string                 `json:"client_id,omitempty" validate:"omitempty,max=64"`                                                       // Registered client app, enables SMS autofill formatting
+	Purpose     string                 `json:"purpose,omitempty" validate:"omitempty,oneof=login phone_change account_deletion payment_confirmation"` // Defaults to login
+	Payload     map[string]interface{} `json:"payload,omitempty" validate:"omitempty,max=32"`                                                         // Action details the code is bound to, e.g. amount and payee
+	MagicLink   bool                   `json:"magic_link,omitempty"`                                                                                  // Also send a sign-in link (login only)
+	ClientIP    string                 `json:"-"`                                                                                                     // Set from the HTTP request for rate limiting
+	DeviceID    string                 `json:"-"`                                                                                                     // Set from the X-Device-ID header for rate limiting
+}
+
+// ResendOTPRequest represents the request to resend an OTP on an existing session
+type ResendOTPRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Channel  string `json:"channel,omitempty" validate:"omitempty,oneof=sms voice email messaging_app"` // Preferred delivery channel for the new code
+	ClientIP string `json:"-"`                                                                          // Set from the HTTP request for rate limiting
+	DeviceID string `json:"-"`                                                                          // Set from the X-Device-ID header for rate limiting
 }
 
 // VerifyOTPRequest represents the request to verify an OTP
 type VerifyOTPRequest struct {
-	Token string `json:"token" validate:"required"`
-	Code  string `json:"code" validate:"required,len=6"`
+	Token       string                 `json:"token,omitempty" validate:"required_without=PhoneNumber,excluded_with=PhoneNumber"`
+	PhoneNumber string                 `json:"phone_number,omitempty" validate:"omitempty,phone_number"`                                              // Instead of token, for client apps in phone_number verify mode
+	ClientID    string                 `json:"client_id,omitempty" validate:"omitempty,max=64"`                                                       // Required with phone_number
+	Code        string                 `json:"code" validate:"required,max=32"`                                                                       // Length and alphabet follow the purpose's code policy
+	Purpose     string                 `json:"purpose,omitempty" validate:"omitempty,oneof=login phone_change account_deletion payment_confirmation"` // Must match the send request; defaults to login
+	Payload     map[string]interface{} `json:"payload,omitempty" validate:"omitempty,max=32"`                                                         // Must match the payload of the send request
 }
 
 // OTPResponse represents the OTP response
 type OTPResponse struct {
-	Message     string    `json:"message"`
-	Token       string    `json:"token"` // Session token for verification
-	PhoneNumber string    `json:"phone_number"`
-	ExpiresAt   time.Time `json:"expires_at"`
+	Message           string    `json:"message"`
+	Token             string    `json:"token"` // Session token for verification
+	PhoneNumber       string    `json:"phone_number"`
+	Purpose           string    `json:"purpose"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	Channel           string    `json:"channel"`            // Channel used for the first delivery
+	AvailableChannels []string  `json:"available_channels"` // Remaining fallback channels, in order
+	ResendAvailableAt time.Time `json:"resend_available_at"`
+
+	RateLimit *RateLimitResult `json:"-"` // Most constrained rate limit after this send, for response headers; nil for test numbers
+}
+
+// SessionStatusResponse represents the state of an OTP session; it never includes the code
+type SessionStatusResponse struct {
+	Status            string                  `json:"status"`       // pending, verified, expired, locked or cancelled
+	PhoneNumber       string                  `json:"phone_number"` // Masked, e.g. +98912*****67
+	Purpose           string                  `json:"purpose"`
+	ExpiresAt         time.Time               `json:"expires_at"`
+	RemainingAttempts int                     `json:"remaining_attempts"`
+	RemainingResends  int                     `json:"remaining_resends"`
+	ResendAvailableAt *time.Time              `json:"resend_available_at"` // null when the session cannot be resent
+	Delivery          *DeliveryStatusResponse `json:"delivery"`
+}
+
+// Confirmation describes a verified OTP for a purpose other than login
+type Confirmation struct {
+	SessionID   int
+	Purpose     string
+	PhoneNumber string
+	PayloadHash string
+	TestNumber  bool
+}
+
+// ConfirmationResponse represents the signed confirmation returned for non-login purposes
+type ConfirmationResponse struct {
+	ConfirmationToken string    `json:"confirmation_token"` // JWT with purpose, phone_number and payload_hash claims
+	Purpose           string    `json:"purpose"`
+	PhoneNumber       string    `json:"phone_number"`
+	PayloadHash       string    `json:"payload_hash,omitempty"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	Message           string    `json:"message"`
 }
 
 // AuthResponse represents the authentication response with JWT token
@@ -48,18 +160,20 @@ type AuthResponse struct {
 	Message   string       `json:"message"`
 }
 
-// RateLimitInfo represents rate limiting information for OTP requests
-type RateLimitInfo struct {
-	PhoneNumber   string    `db:"phone_number" bson:"phone_number" json:"phone_number"`
-	RequestCount  int       `db:"request_count" bson:"request_count" json:"request_count"`
-	LastRequestAt time.Time `db:"last_request_at" bson:"last_request_at" json:"last_request_at"`
-	WindowStartAt time.Time `db:"window_start_at" bson:"window_start_at" json:"window_start_at"`
-	CreatedAt     time.Time `bson:"created_at" json:"created_at"`
-	UpdatedAt     time.Time `bson:"updated_at" json:"updated_at"`
-	ExpiresAt     time.Time `bson:"expires_at" json:"expires_at"`
-}
+// Rate limit dimensions sends are counted against
+const (
+	RateLimitDimensionPhoneNumber = "phone_number"
+	RateLimitDimensionIP          = "ip"
+	RateLimitDimensionDevice      = "device"
+	RateLimitDimensionCountry     = "country"
+	RateLimitDimensionGlobal      = "global"
+)
 
-// TableName returns the table name for the RateLimitInfo entity
-func (RateLimitInfo) TableName() string {
-	return "otp_rate_limits"
+// RateLimitResult is the outcome of an atomic rate limit check-and-increment
+type RateLimitResult struct {
+	Allowed   bool      `json:"allowed"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"` // Requests left in the window after this one
+	ResetAt   time.Time `json:"reset_at"`  // When the full quota is available again
+	RetryAt   time.Time `json:"retry_at"`  // When a denied request could next succeed; zero when allowed
 }
@@ -0,0 +1,54 @@
+package entity
+
+import (
+	"strings"
+	"time"
+)
+
+// Outbox message statuses
+const (
+	OutboxStatusPending    = "pending"
+	OutboxStatusProcessing = "processing"
+	OutboxStatusSent       = "sent"
+	OutboxStatusDead       = "dead"
+	OutboxStatusSkipped    = "skipped"
+)
+
+// OutboxMessage represents a pending OTP delivery written alongside the OTP row
+type OutboxMessage struct {
+	ID                int        `db:"id" json:"id"`
+	OTPID             *int       `db:"otp_id" json:"otp_id"`
+	ClientID          *string    `db:"client_id" json:"client_id"`
+	Channel           string     `db:"channel" json:"channel"`
+	FallbackChannels  string     `db:"fallback_channels" json:"fallback_channels"`
+	PhoneNumber       string     `db:"phone_number" json:"phone_number"`
+	Email             *string    `db:"email" json:"-"`
+	Code              string     `db:"code" json:"-"`
+	Body              string     `db:"body" json:"-"`
+	ResendCount       int        `db:"resend_count" json:"resend_count"` // resend of the OTP whose code the message carries
+	ExpiresAt         time.Time  `db:"expires_at" json:"expires_at"`
+	Status            string     `db:"status" json:"status"`
+	Attempts          int        `db:"attempts" json:"attempts"`
+	MaxAttempts       int        `db:"max_attempts" json:"max_attempts"`
+	NextAttemptAt     time.Time  `db:"next_attempt_at" json:"next_attempt_at"`
+	LockedUntil       *time.Time `db:"locked_until" json:"locked_until"`
+	LastError         *string    `db:"last_error" json:"last_error"`
+	Provider          *string    `db:"provider" json:"provider"`
+	ProviderMessageID *string    `db:"provider_message_id" json:"provider_message_id"`
+	CreatedAt         time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt         time.Time  `db:"updated_at" json:"updated_at"`
+	SentAt            *time.Time `db:"sent_at" json:"sent_at"`
+}
+
+// Fallbacks returns the remaining channels in fallback order
+func (m OutboxMessage) Fallbacks() []string {
+	if m.FallbackChannels == "" {
+		return nil
+	}
+	return strings.Split(m.FallbackChannels, ",")
+}
+
+// TableName returns the table name for the OutboxMessage entity
+func (OutboxMessage) TableName() string {
+	return "otp_outbox"
+}
@@ -0,0 +1,56 @@
+package entity
+
+import (
+	"time"
+)
+
+// Rate limit admin actions recorded in the audit trail
+const (
+	RateLimitActionReset         = "reset"
+	RateLimitActionOverride      = "override"
+	RateLimitActionClearOverride = "clear_override"
+)
+
+// RateLimitOverride temporarily replaces the configured limit of one rate limit key
+type RateLimitOverride struct {
+	Limit     int       `json:"limit"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RateLimitOverrideRequest represents the request to temporarily change a quota
+type RateLimitOverrideRequest struct {
+	Limit    int    `json:"limit" validate:"required,min=1,max=100000"`
+	Duration string `json:"duration" validate:"required"` // How long the override lasts, e.g. 1h; at most 168h
+}
+
+// RateLimitStatusResponse represents the current state of one rate limit key
+type RateLimitStatusResponse struct {
+	Dimension string             `json:"dimension"`
+	Value     string             `json:"value"` // Phone number, IP, device ID or calling code; empty for global
+	Algorithm string             `json:"algorithm"`
+	Limit     int                `json:"limit"` // Effective limit, including an override
+	Window    string             `json:"window"`
+	Remaining int                `json:"remaining"`
+	Limited   bool               `json:"limited"` // The next request would be refused
+	ResetAt   time.Time          `json:"reset_at"`
+	RetryAt   *time.Time         `json:"retry_at"` // null unless limited
+	Override  *RateLimitOverride `json:"override"` // null when the configured limit applies
+}
+
+// RateLimitAuditEntry records a change made to rate limit state through the admin API
+type RateLimitAuditEntry struct {
+	ID                int        `db:"id" json:"id"`
+	ActorUserID       int        `db:"actor_user_id" json:"actor_user_id"`
+	ActorPhoneNumber  string     `db:"actor_phone_number" json:"actor_phone_number"`
+	Action            string     `db:"action" json:"action"` // reset, override or clear_override
+	Dimension         string     `db:"dimension" json:"dimension"`
+	Value             string     `db:"value" json:"value"`
+	OverrideLimit     *int       `db:"override_limit" json:"override_limit,omitempty"`
+	OverrideExpiresAt *time.Time `db:"override_expires_at" json:"override_expires_at,omitempty"`
+	CreatedAt         time.Time  `db:"created_at" json:"created_at"`
+}
+
+// TableName returns the table name for the RateLimitAuditEntry entity
+func (RateLimitAuditEntry) TableName() string {
+	return "rate_limit_audit_log"
+}
@@ -5,6 +5,7 @@ import (
 	"otp-auth/controller"
 	_ "otp-auth/docs" // Import for swagger docs
 	"otp-auth/pkg/logger"
+	"otp-auth/pkg/metrics"
 	"otp-auth/service"
 
 	"github.com/labstack/echo/v4"
@@ -19,6 +20,9 @@ func RegisterRoutes(
 	userController *controller.UserController,
 	authController *controller.AuthController,
 	healthController *controller.HealthController,
+	receiptController *controller.DeliveryReceiptController,
+	devInboxController *controller.DevInboxController,
+	rateLimitAdminController *controller.RateLimitAdminController,
 	jwtService service.JWTService,
 	cfg *config.Config,
 	logger *logger.Logger,
@@ -39,13 +43,36 @@ func RegisterRoutes(
 		e.GET("/docs/*", echoSwagger.WrapHandler)
 	}
 
+	// Delivery and delivery receipt counters
+	if cfg.Metrics.Enabled {
+		e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+	}
+
+	// Dev inbox (non-production only, nil when disabled)
+	if devInboxController != nil {
+		e.GET("/dev/inbox/:phone", devInboxController.GetInbox)
+	}
+
 	// API v1 group
 	v1 := e.Group("/api/v1")
 
 	// OTP routes (public)
 	otpGroup := v1.Group("/otp")
 	otpGroup.POST("/send", otpController.SendOTP)
+	otpGroup.POST("/resend", otpController.ResendOTP)
 	otpGroup.POST("/verify", otpController.VerifyOTP)
+	otpGroup.GET("/sessions/:token", otpController.GetSession)
+	otpGroup.DELETE("/sessions/:token", otpController.CancelSession)
+	if cfg.MagicLink.Enabled() {
+		otpGroup.GET("/magic-link/:token", otpController.ShowMagicLink)
+		otpGroup.POST("/magic-link/:token", otpController.VerifyMagicLink)
+	}
+
+	// Gateway callbacks (public, authenticated by signature)
+	if cfg.DeliveryReceipts.Secret != "" {
+		webhookGroup := v1.Group("/webhooks")
+		webhookGroup.POST("/delivery-receipts", receiptController.ReceiveDeliveryReceipt)
+	}
 
 	// User routes (protected)
 	userGroup := v1.Group("/users")
@@ -55,4 +82,14 @@ func RegisterRoutes(
 	// Auth routes (protected)
 	authGroup := v1.Group("/auth")
 	authGroup.POST("/logout", authController.Logout)
+
+	// Admin routes (protected, admins only; nil when no admins are configured)
+	if rateLimitAdminController != nil {
+		adminGroup := v1.Group("/admin", AdminMiddleware(cfg.Admin, logger))
+		adminGroup.GET("/rate-limits/audit", rateLimitAdminController.ListRateLimitAudit)
+		adminGroup.GET("/rate-limits/:dimension/:value", rateLimitAdminController.GetRateLimit)
+		adminGroup.DELETE("/rate-limits/:dimension/:value", rateLimitAdminController.ResetRateLimit)
+		adminGroup.PUT("/rate-limits/:dimension/:value/override", rateLimitAdminController.SetRateLimitOverride)
+		adminGroup.DELETE("/rate-limits/:dimension/:value/override", rateLimitAdminController.ClearRateLimitOverride)
+	}
 }
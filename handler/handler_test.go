@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/controller"
+	"otp-auth/entity"
+	"otp-auth/service"
+	"otp-auth/test"
+	"otp-auth/validator"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRoutesTestConfig returns a configuration with one admin and the optional routes disabled
+func newRoutesTestConfig() *config.Config {
+	return &config.Config{
+		JWT:   config.JWT{Secret: "handler-test-secret", ExpirationTime: time.Hour, ConfirmationExpirationTime: time.Minute},
+		Admin: config.Admin{PhoneNumbers: []string{"+447700900001"}},
+	}
+}
+
+// newRoutesTestServer registers the routes with only the controllers given; the others are never called
+func newRoutesTestServer(cfg *config.Config, devInbox *controller.DevInboxController, rateLimitAdmin *controller.RateLimitAdminController) (*echo.Echo, service.JWTService) {
+	return newRoutesTestServerWithOTP(cfg, nil, devInbox, rateLimitAdmin)
+}
+
+// newRoutesTestServerWithOTP registers the routes with OTP requests handled by otpService
+func newRoutesTestServerWithOTP(cfg *config.Config, otpService service.OTPService, devInbox *controller.DevInboxController, rateLimitAdmin *controller.RateLimitAdminController) (*echo.Echo, service.JWTService) {
+	e := echo.New()
+	jwtService := service.NewJWTService(cfg, test.GetTestLogger(), nil)
+	var otpController *controller.OTPController
+	if otpService != nil {
+		otpController = controller.NewOTPController(otpService, jwtService, validator.New(), test.GetTestLogger(), cfg.MagicLink.RedirectURL)
+	}
+	RegisterRoutes(e, otpController, nil, nil, nil, nil, devInbox, rateLimitAdmin, jwtService, cfg, test.GetTestLogger())
+	return e, jwtService
+}
+
+// serve sends a request with an optional bearer token and returns the recorded response
+func serve(e *echo.Echo, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDevInboxRoutes(t *testing.T) {
+	inbox := service.NewDevInbox(10)
+	inbox.Record(&service.Message{Channel: "sms", PhoneNumber: "+447700900123", Code: "123456", Body: "Your code is 123456", ExpiresAt: time.Now().Add(time.Minute)})
+	e, _ := newRoutesTestServer(newRoutesTestConfig(), controller.NewDevInboxController(inbox, test.GetTestLogger()), nil)
+
+	rec := serve(e, http.MethodGet, "/dev/inbox/%2B447700900123", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response entity.DevInboxResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "+447700900123", response.PhoneNumber)
+	require.Len(t, response.Messages, 1)
+	assert.Equal(t, "Your code is 123456", response.Messages[0].Body)
+}
+
+func TestDevInboxRoutes_NotRegisteredWhenDisabled(t *testing.T) {
+	e, _ := newRoutesTestServer(newRoutesTestConfig(), nil, nil)
+
+	rec := serve(e, http.MethodGet, "/dev/inbox/%2B447700900123", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+// linkOTPService signs in every magic link it verifies and counts the verifications
+type linkOTPService struct {
+	service.OTPService
+	verified int
+}
+
+// VerifyMagicLink consumes the link
+func (s *linkOTPService) VerifyMagicLink(linkToken string) (*service.VerificationResult, error) {
+	s.verified++
+	return &service.VerificationResult{User: &entity.User{ID: 1, PhoneNumber: "+447700900123"}}, nil
+}
+
+func TestMagicLinkRoutes_OnlyPostConsumesTheLink(t *testing.T) {
+	cfg := newRoutesTestConfig()
+	cfg.MagicLink = config.MagicLink{BaseURL: "https://auth.example.com", RedirectURL: "https://app.example.com/signed-in"}
+	otpService := &linkOTPService{}
+	e, _ := newRoutesTestServerWithOTP(cfg, otpService, nil, nil)
+
+	// Link previews and mail scanners only open the link
+	for i := 0; i < 2; i++ {
+		rec := serve(e, http.MethodGet, "/api/v1/otp/magic-link/link-token", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+	assert.Zero(t, otpService.verified, "the session stays open")
+
+	rec := serve(e, http.MethodPost, "/api/v1/otp/magic-link/link-token", "")
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Contains(t, rec.Header().Get("Location"), "https://app.example.com/signed-in#")
+	assert.Equal(t, 1, otpService.verified)
+}
+
+func TestMagicLinkRoutes_NotRegisteredWhenDisabled(t *testing.T) {
+	e, _ := newRoutesTestServerWithOTP(newRoutesTestConfig(), &linkOTPService{}, nil, nil)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		rec := serve(e, method, "/api/v1/otp/magic-link/link-token", "")
+		assert.Equal(t, http.StatusNotFound, rec.Code, method)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"strings"
 
+	"otp-auth/config"
+	"otp-auth/entity"
 	"otp-auth/pkg/logger"
 	"otp-auth/service"
 
@@ -17,9 +19,12 @@ func JWTMiddleware(jwtService service.JWTService, logger *logger.Logger) echo.Mi
 			// Skip authentication for public endpoints
 			path := c.Request().URL.Path
 			if strings.HasPrefix(path, "/api/v1/otp/") ||
+				strings.HasPrefix(path, "/api/v1/webhooks/") ||
 				strings.HasPrefix(path, "/swagger") ||
 				strings.HasPrefix(path, "/docs") ||
+				strings.HasPrefix(path, "/dev/") ||
 				path == "/" ||
+				path == "/metrics" ||
 				path == "/health" {
 				return next(c)
 			}
@@ -75,13 +80,35 @@ func JWTMiddleware(jwtService service.JWTService, logger *logger.Logger) echo.Mi
 	}
 }
 
+// AdminMiddleware restricts routes to signed in admins; it relies on JWTMiddleware having
+// stored the user
+func AdminMiddleware(admin config.Admin, logger *logger.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, ok := c.Get("user").(*entity.User)
+			if !ok || !admin.IsAdmin(user.PhoneNumber) {
+				if ok {
+					logger.Warnw("Admin access denied", "user_id", user.ID, "path", c.Request().URL.Path)
+				}
+				return c.JSON(http.StatusForbidden, map[string]interface{}{
+					"error":   "Forbidden",
+					"details": "Admin access required",
+				})
+			}
+
+			return next(c)
+		}
+	}
+}
+
 // CORSMiddleware creates a CORS middleware
 func CORSMiddleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			c.Response().Header().Set("Access-Control-Allow-Origin", "*")
 			c.Response().Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			c.Response().Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
+			c.Response().Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, X-Device-ID")
+			c.Response().Header().Set("Access-Control-Expose-Headers", "RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After")
 
 			if c.Request().Method == "OPTIONS" {
 				return c.NoContent(http.StatusNoContent)
@@ -100,7 +127,7 @@ func RequestLoggerMiddleware(logger *logger.Logger) echo.MiddlewareFunc {
 
 			logger.Infow("HTTP Request",
 				"method", c.Request().Method,
-				"path", c.Request().URL.Path,
+				"path", loggedPath(c),
 				"remote_addr", c.RealIP(),
 				"user_agent", c.Request().UserAgent(),
 			)
@@ -109,7 +136,7 @@ func RequestLoggerMiddleware(logger *logger.Logger) echo.MiddlewareFunc {
 
 			logger.Infow("HTTP Response",
 				"method", c.Request().Method,
-				"path", c.Request().URL.Path,
+				"path", loggedPath(c),
 				"status", c.Response().Status,
 				"start_time", start,
 			)
@@ -118,3 +145,12 @@ func RequestLoggerMiddleware(logger *logger.Logger) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// loggedPath returns the request path with a session or magic link token masked
+func loggedPath(c echo.Context) string {
+	path := c.Request().URL.Path
+	if token := c.Param("token"); token != "" {
+		path = strings.Replace(path, token, service.MaskToken(token), 1)
+	}
+	return path
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"otp-auth/config"
+	"otp-auth/controller"
+	"otp-auth/entity"
+	"otp-auth/service"
+	"otp-auth/test"
+	"otp-auth/validator"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubRateLimitAdminService reports every limit as untouched
+type stubRateLimitAdminService struct {
+	service.RateLimitAdminService
+}
+
+// GetStatus returns a fixed status
+func (s *stubRateLimitAdminService) GetStatus(dimension, value string) (*entity.RateLimitStatusResponse, error) {
+	return &entity.RateLimitStatusResponse{Dimension: dimension, Value: value, Limit: 5, Remaining: 5}, nil
+}
+
+func TestAdminRoutes_RequireAdmin(t *testing.T) {
+	cfg := newRoutesTestConfig()
+	adminController := controller.NewRateLimitAdminController(&stubRateLimitAdminService{}, validator.New(), test.GetTestLogger())
+	e, jwtService := newRoutesTestServer(cfg, nil, adminController)
+
+	signIn := func(phoneNumber string) string {
+		auth, err := jwtService.GenerateToken(&entity.User{ID: 1, PhoneNumber: phoneNumber}, false)
+		require.NoError(t, err)
+		return auth.Token
+	}
+	confirmation, err := jwtService.GenerateConfirmationToken(&entity.Confirmation{SessionID: 1, Purpose: entity.PurposePhoneChange, PhoneNumber: "+447700900001"})
+	require.NoError(t, err)
+
+	const path = "/api/v1/admin/rate-limits/phone_number/%2B447700900123"
+	cases := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{name: "signed out", status: http.StatusUnauthorized},
+		{name: "confirmation token of an admin", token: confirmation.ConfirmationToken, status: http.StatusUnauthorized},
+		{name: "non-admin", token: signIn("+447700900123"), status: http.StatusForbidden},
+		{name: "admin", token: signIn("+447700900001"), status: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rec := serve(e, http.MethodGet, path, c.token)
+			assert.Equal(t, c.status, rec.Code)
+			if c.status == http.StatusForbidden {
+				assert.Contains(t, rec.Body.String(), "Admin access required")
+			}
+		})
+	}
+}
+
+func TestAdminRoutes_NotRegisteredWithoutAdmins(t *testing.T) {
+	cfg := newRoutesTestConfig()
+	e, jwtService := newRoutesTestServer(cfg, nil, nil)
+
+	auth, err := jwtService.GenerateToken(&entity.User{ID: 1, PhoneNumber: "+447700900001"}, false)
+	require.NoError(t, err)
+
+	rec := serve(e, http.MethodGet, "/api/v1/admin/rate-limits/phone_number/%2B447700900123", auth.Token)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAdminMiddleware_WithoutSignedInUser(t *testing.T) {
+	e := echo.New()
+	e.GET("/admin", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, AdminMiddleware(config.Admin{PhoneNumbers: []string{"+447700900001"}}, test.GetTestLogger()))
+
+	rec := serve(e, http.MethodGet, "/admin", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS update_otp_outbox_updated_at ON otp_outbox;
+DROP INDEX IF EXISTS idx_otp_outbox_otp_id;
+DROP INDEX IF EXISTS idx_otp_outbox_due;
+DROP TABLE IF EXISTS otp_outbox;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS otp_outbox (
+    id SERIAL PRIMARY KEY,
+    otp_id INTEGER REFERENCES otps(id) ON DELETE SET NULL,
+    phone_number VARCHAR(15) NOT NULL,
+    code VARCHAR(10) NOT NULL,
+    body TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    provider VARCHAR(50),
+    provider_message_id VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Index for workers picking up due messages
+CREATE INDEX IF NOT EXISTS idx_otp_outbox_due ON otp_outbox(status, next_attempt_at);
+
+-- Index for looking up deliveries of an OTP
+CREATE INDEX IF NOT EXISTS idx_otp_outbox_otp_id ON otp_outbox(otp_id);
+
+CREATE TRIGGER update_otp_outbox_updated_at
+    BEFORE UPDATE ON otp_outbox
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
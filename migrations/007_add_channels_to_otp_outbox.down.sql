@@ -0,0 +1,3 @@
+ALTER TABLE otp_outbox DROP COLUMN email;
+ALTER TABLE otp_outbox DROP COLUMN fallback_channels;
+ALTER TABLE otp_outbox DROP COLUMN channel;
@@ -0,0 +1,4 @@
+-- Delivery channel of each outbox message and the channels left to fall back to
+ALTER TABLE otp_outbox ADD COLUMN channel VARCHAR(20) NOT NULL DEFAULT 'sms';
+ALTER TABLE otp_outbox ADD COLUMN fallback_channels TEXT NOT NULL DEFAULT '';
+ALTER TABLE otp_outbox ADD COLUMN email VARCHAR(255);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_otp_delivery_receipts_otp_id;
+DROP TABLE IF EXISTS otp_delivery_receipts;
+DROP INDEX IF EXISTS idx_otp_outbox_provider_message_id;
+DROP INDEX IF EXISTS idx_otps_provider_message_id;
+ALTER TABLE otps DROP COLUMN delivered_at;
+ALTER TABLE otps DROP COLUMN delivery_updated_at;
+ALTER TABLE otps DROP COLUMN delivery_status;
+ALTER TABLE otps DROP COLUMN provider_message_id;
+ALTER TABLE otps DROP COLUMN delivery_channel;
@@ -0,0 +1,23 @@
+-- Latest delivery state of each OTP, correlated by the provider's message ID
+ALTER TABLE otps ADD COLUMN delivery_channel VARCHAR(20);
+ALTER TABLE otps ADD COLUMN provider_message_id VARCHAR(255);
+ALTER TABLE otps ADD COLUMN delivery_status VARCHAR(20) NOT NULL DEFAULT 'queued';
+ALTER TABLE otps ADD COLUMN delivery_updated_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE otps ADD COLUMN delivered_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_otps_provider_message_id ON otps(provider_message_id);
+CREATE INDEX IF NOT EXISTS idx_otp_outbox_provider_message_id ON otp_outbox(provider_message_id);
+
+-- Every receipt reported by a gateway, kept for auditing
+CREATE TABLE IF NOT EXISTS otp_delivery_receipts (
+    id SERIAL PRIMARY KEY,
+    otp_id INTEGER REFERENCES otps(id) ON DELETE CASCADE,
+    provider_message_id VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    provider_status VARCHAR(50) NOT NULL,
+    error_code VARCHAR(50),
+    reported_at TIMESTAMP WITH TIME ZONE,
+    received_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_otp_delivery_receipts_otp_id ON otp_delivery_receipts(otp_id);
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_otp_message_templates_updated_at ON otp_message_templates;
+DROP TABLE IF EXISTS otp_message_templates;
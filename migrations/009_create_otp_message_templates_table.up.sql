@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS otp_message_templates (
+    id SERIAL PRIMARY KEY,
+    locale VARCHAR(35) NOT NULL,
+    purpose VARCHAR(50) NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (locale, purpose)
+);
+
+CREATE TRIGGER update_otp_message_templates_updated_at
+    BEFORE UPDATE ON otp_message_templates
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Defaults matching templates/messages, used when MESSAGE_TEMPLATE_SOURCE=db
+INSERT INTO otp_message_templates (locale, purpose, body) VALUES
+    ('en', 'login', '{{.AppName}}: Your verification code is {{.Code}}. It expires in {{.ExpiryMinutes}} minutes.'),
+    ('fa', 'login', '{{.AppName}}: کد تأیید شما {{ltr .Code}} است. این کد تا {{.ExpiryMinutes}} دقیقه معتبر است.'),
+    ('ar', 'login', '{{.AppName}}: رمز التحقق الخاص بك هو {{ltr .Code}}. تنتهي صلاحيته خلال {{.ExpiryMinutes}} دقائق.')
+ON CONFLICT (locale, purpose) DO NOTHING;
@@ -0,0 +1,2 @@
+ALTER TABLE otp_outbox DROP COLUMN client_id;
+ALTER TABLE otps DROP COLUMN client_id;
@@ -0,0 +1,3 @@
+-- Client application that requested the OTP, used for per-app message formatting
+ALTER TABLE otps ADD COLUMN client_id VARCHAR(64);
+ALTER TABLE otp_outbox ADD COLUMN client_id VARCHAR(64);
@@ -0,0 +1,4 @@
+-- Hashed codes cannot be restored; expire them and shorten the digests to fit the old column
+UPDATE otps SET expires_at = LEAST(expires_at, CURRENT_TIMESTAMP), code = LEFT(code, 10);
+ALTER TABLE otps ALTER COLUMN code TYPE VARCHAR(10);
+CREATE INDEX IF NOT EXISTS idx_otps_phone_number_code ON otps(phone_number, code);
@@ -0,0 +1,16 @@
+-- Codes and session tokens are stored as hex HMAC-SHA256 digests keyed with OTP_HASH_PEPPER
+ALTER TABLE otps ALTER COLUMN code TYPE VARCHAR(64);
+
+-- The pepper is not available to SQL, so rows written before this migration cannot be
+-- re-keyed. They are short-lived: expire the pending ones and overwrite every plaintext
+-- value with an unkeyed digest. Holders of such a session simply request a new code.
+UPDATE otps
+SET expires_at = LEAST(expires_at, CURRENT_TIMESTAMP),
+    code = encode(sha256(convert_to(code, 'UTF8')), 'hex'),
+    session_token = encode(sha256(convert_to(session_token, 'UTF8')), 'hex');
+
+-- Delivered, dead and skipped outbox messages no longer need the plaintext code
+UPDATE otp_outbox SET code = '', body = '' WHERE status IN ('sent', 'dead', 'skipped');
+
+-- Codes are compared in the service; lookups go through the session token
+DROP INDEX IF EXISTS idx_otps_phone_number_code;
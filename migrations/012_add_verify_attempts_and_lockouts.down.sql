@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS update_otp_lockouts_updated_at ON otp_lockouts;
+DROP TABLE IF EXISTS otp_lockouts;
+ALTER TABLE otps DROP COLUMN max_attempts;
+ALTER TABLE otps DROP COLUMN attempts;
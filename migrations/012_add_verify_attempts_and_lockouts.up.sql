@@ -0,0 +1,17 @@
+-- Verification attempts per OTP session; a session is burned once attempts reach max_attempts
+ALTER TABLE otps ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE otps ADD COLUMN max_attempts INTEGER NOT NULL DEFAULT 5;
+
+-- Burned sessions per phone number within the lockout window, and the resulting lockout
+CREATE TABLE IF NOT EXISTS otp_lockouts (
+    phone_number VARCHAR(15) PRIMARY KEY,
+    burned_sessions INTEGER NOT NULL DEFAULT 0,
+    window_start_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_otp_lockouts_updated_at
+    BEFORE UPDATE ON otp_lockouts
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,3 @@
+ALTER TABLE otps DROP COLUMN locale;
+ALTER TABLE otps DROP COLUMN last_sent_at;
+ALTER TABLE otps DROP COLUMN resend_count;
@@ -0,0 +1,6 @@
+-- Resends reuse the session: the code is replaced and counted against a per-session cap
+ALTER TABLE otps ADD COLUMN resend_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE otps ADD COLUMN last_sent_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE otps ADD COLUMN locale VARCHAR(35);
+
+UPDATE otps SET last_sent_at = created_at;
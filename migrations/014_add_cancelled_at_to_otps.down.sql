@@ -0,0 +1 @@
+ALTER TABLE otps DROP COLUMN cancelled_at;
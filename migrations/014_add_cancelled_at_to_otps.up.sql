@@ -0,0 +1,2 @@
+-- Sessions cancelled by the client can no longer be verified or resent
+ALTER TABLE otps ADD COLUMN cancelled_at TIMESTAMP WITH TIME ZONE;
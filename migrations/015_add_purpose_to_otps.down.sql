@@ -0,0 +1,3 @@
+DELETE FROM otp_message_templates WHERE purpose IN ('phone_change', 'account_deletion', 'payment_confirmation');
+ALTER TABLE otps DROP COLUMN payload_hash;
+ALTER TABLE otps DROP COLUMN purpose;
@@ -0,0 +1,16 @@
+-- Codes are scoped to a purpose and optionally bound to the action they confirm
+ALTER TABLE otps ADD COLUMN purpose VARCHAR(50) NOT NULL DEFAULT 'login';
+ALTER TABLE otps ADD COLUMN payload_hash VARCHAR(64);
+
+-- Defaults matching templates/messages, used when MESSAGE_TEMPLATE_SOURCE=db
+INSERT INTO otp_message_templates (locale, purpose, body) VALUES
+    ('en', 'phone_change', '{{.AppName}}: Use {{.Code}} to confirm your new phone number. It expires in {{.ExpiryMinutes}} minutes.'),
+    ('fa', 'phone_change', '{{.AppName}}: کد تأیید شماره جدید شما {{ltr .Code}} است. اعتبار: {{.ExpiryMinutes}} دقیقه.'),
+    ('ar', 'phone_change', '{{.AppName}}: رمز تأكيد رقمك الجديد {{ltr .Code}}. صالح لمدة {{.ExpiryMinutes}} دقائق.'),
+    ('en', 'account_deletion', '{{.AppName}}: Use {{.Code}} to confirm deleting your account. Do not share this code. It expires in {{.ExpiryMinutes}} minutes.'),
+    ('fa', 'account_deletion', '{{.AppName}}: کد حذف حساب {{ltr .Code}}. آن را به کسی ندهید. اعتبار: {{.ExpiryMinutes}} دقیقه.'),
+    ('ar', 'account_deletion', '{{.AppName}}: رمز حذف الحساب {{ltr .Code}}. لا تشاركه مع أحد. صالح لمدة {{.ExpiryMinutes}} دقائق.'),
+    ('en', 'payment_confirmation', '{{.AppName}}: Use {{.Code}} to confirm your payment. Do not share this code. It expires in {{.ExpiryMinutes}} minutes.'),
+    ('fa', 'payment_confirmation', '{{.AppName}}: کد تأیید پرداخت {{ltr .Code}}. آن را به کسی ندهید. اعتبار: {{.ExpiryMinutes}} دقیقه.'),
+    ('ar', 'payment_confirmation', '{{.AppName}}: رمز تأكيد الدفع {{ltr .Code}}. لا تشاركه مع أحد. صالح لمدة {{.ExpiryMinutes}} دقائق.')
+ON CONFLICT (locale, purpose) DO NOTHING;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_otps_phone_number_created_at;
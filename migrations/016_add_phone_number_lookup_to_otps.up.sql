@@ -0,0 +1,2 @@
+-- Latest session per phone number, used by client apps that verify by phone number
+CREATE INDEX IF NOT EXISTS idx_otps_phone_number_created_at ON otps(phone_number, created_at DESC);
@@ -0,0 +1 @@
+ALTER TABLE otps DROP COLUMN is_test;
@@ -0,0 +1,2 @@
+-- Sessions of configured test phone numbers: fixed code, no delivery, no rate limiting
+ALTER TABLE otps ADD COLUMN is_test BOOLEAN NOT NULL DEFAULT FALSE;
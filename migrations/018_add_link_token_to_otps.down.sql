@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_otps_link_token;
+ALTER TABLE otps DROP COLUMN link_token;
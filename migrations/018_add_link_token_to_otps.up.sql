@@ -0,0 +1,3 @@
+-- HMAC-SHA256 of the magic link token, NULL when the session was sent without a link
+ALTER TABLE otps ADD COLUMN link_token VARCHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_otps_link_token ON otps(link_token) WHERE link_token IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_rate_limit_audit_log_target;
+DROP TABLE IF EXISTS rate_limit_audit_log;
@@ -0,0 +1,15 @@
+-- Changes made to rate limit state through the admin API. The actor is copied rather than
+-- referenced so entries outlive the admin's user record.
+CREATE TABLE IF NOT EXISTS rate_limit_audit_log (
+    id SERIAL PRIMARY KEY,
+    actor_user_id INTEGER NOT NULL,
+    actor_phone_number VARCHAR(15) NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    dimension VARCHAR(20) NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    override_limit INTEGER,
+    override_expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_audit_log_target ON rate_limit_audit_log(dimension, value, created_at DESC);
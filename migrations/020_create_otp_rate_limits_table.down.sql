@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS otp_rate_limit_overrides;
+DROP TRIGGER IF EXISTS update_otp_rate_limits_updated_at ON otp_rate_limits;
+DROP INDEX IF EXISTS idx_otp_rate_limits_expires_at;
+DROP TABLE IF EXISTS otp_rate_limits;
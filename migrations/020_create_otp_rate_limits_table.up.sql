@@ -0,0 +1,30 @@
+-- Rate limit state for RATE_LIMIT_STORE=postgres, one row per key: a phone number, or
+-- ip:, device:, country: or global. The columns in use depend on the algorithm; times are
+-- unix milliseconds.
+CREATE TABLE IF NOT EXISTS otp_rate_limits (
+    key VARCHAR(255) PRIMARY KEY,
+    algorithm VARCHAR(20) NOT NULL DEFAULT '',
+    window_start_ms BIGINT NOT NULL DEFAULT 0,
+    request_count INTEGER NOT NULL DEFAULT 0,
+    previous_count INTEGER NOT NULL DEFAULT 0,
+    tat_ms BIGINT NOT NULL DEFAULT 0,
+    request_log_ms BIGINT[],
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Index for cleanup of expired state
+CREATE INDEX IF NOT EXISTS idx_otp_rate_limits_expires_at ON otp_rate_limits(expires_at);
+
+CREATE TRIGGER update_otp_rate_limits_updated_at
+    BEFORE UPDATE ON otp_rate_limits
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Temporary limits set through the admin API
+CREATE TABLE IF NOT EXISTS otp_rate_limit_overrides (
+    key VARCHAR(255) PRIMARY KEY,
+    override_limit INTEGER NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
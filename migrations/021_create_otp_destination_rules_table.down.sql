@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_otp_destination_rules_updated_at ON otp_destination_rules;
+DROP TABLE IF EXISTS otp_destination_rules;
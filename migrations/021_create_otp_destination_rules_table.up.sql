@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS otp_destination_rules (
+    id SERIAL PRIMARY KEY,
+    prefix VARCHAR(16) NOT NULL UNIQUE,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('allow', 'deny')),
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_otp_destination_rules_updated_at
+    BEFORE UPDATE ON otp_destination_rules
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
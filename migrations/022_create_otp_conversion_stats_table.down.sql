@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_otp_conversion_stats_bucket;
+DROP TABLE IF EXISTS otp_conversion_stats;
+ALTER TABLE otps DROP COLUMN calling_code;
+ALTER TABLE otps DROP COLUMN client_ip;
@@ -0,0 +1,15 @@
+-- Where sessions come from and go to, for send-to-verify conversion per IP and country
+ALTER TABLE otps ADD COLUMN client_ip VARCHAR(45);
+ALTER TABLE otps ADD COLUMN calling_code VARCHAR(4);
+
+-- Sessions and verified sessions per minute of sending, counted as OTPs are sent and verified
+CREATE TABLE IF NOT EXISTS otp_conversion_stats (
+    dimension VARCHAR(20) NOT NULL,
+    key VARCHAR(45) NOT NULL,
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    sent INTEGER NOT NULL DEFAULT 0,
+    verified INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (dimension, key, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_otp_conversion_stats_bucket ON otp_conversion_stats(bucket);
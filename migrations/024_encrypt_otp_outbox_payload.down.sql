@@ -0,0 +1,5 @@
+-- Sealed payloads cannot be delivered by the old workers; drop them from undelivered messages
+UPDATE otp_outbox SET status = 'skipped', code = '', body = '', last_error = 'Payload stored encrypted', locked_until = NULL
+WHERE status IN ('pending', 'processing');
+UPDATE otp_outbox SET code = '' WHERE LENGTH(code) > 10;
+ALTER TABLE otp_outbox ALTER COLUMN code TYPE VARCHAR(10);
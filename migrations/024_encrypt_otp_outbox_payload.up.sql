@@ -0,0 +1,5 @@
+-- Codes and bodies are stored sealed with AES-GCM, which no longer fits the old code column.
+-- Plaintext payloads left undelivered cannot be opened by the new workers; drop them.
+UPDATE otp_outbox SET status = 'skipped', code = '', body = '', last_error = 'Payload stored before encryption', locked_until = NULL
+WHERE status IN ('pending', 'processing');
+ALTER TABLE otp_outbox ALTER COLUMN code TYPE TEXT;
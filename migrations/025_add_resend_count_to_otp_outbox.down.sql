@@ -0,0 +1 @@
+ALTER TABLE otp_outbox DROP COLUMN resend_count;
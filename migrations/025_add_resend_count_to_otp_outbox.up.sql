@@ -0,0 +1,7 @@
+-- The resend of the OTP whose code a message carries; messages of an earlier resend are never delivered
+ALTER TABLE otp_outbox ADD COLUMN resend_count INTEGER NOT NULL DEFAULT 0;
+
+-- Undelivered messages of earlier resends were skipped when the code was replaced
+UPDATE otp_outbox SET resend_count = otps.resend_count
+FROM otps
+WHERE otp_outbox.otp_id = otps.id AND otp_outbox.status IN ('pending', 'processing');
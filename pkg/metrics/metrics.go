@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// Counters exported on the metrics endpoint
+var (
+	otpDeliveries         = expvar.NewMap("otp_deliveries_total")
+	otpDeliveryReceipts   = expvar.NewMap("otp_delivery_receipts_total")
+	otpDestinationsDenied = expvar.NewMap("otp_destinations_denied_total")
+)
+
+// IncDelivery counts an outbound delivery attempt outcome (sent, retry, dead, skipped) per channel
+func IncDelivery(channel, outcome string) {
+	otpDeliveries.Add(channel+"."+outcome, 1)
+}
+
+// IncDeliveryReceipt counts a delivery receipt by normalized status
+func IncDeliveryReceipt(status string) {
+	otpDeliveryReceipts.Add(status, 1)
+}
+
+// IncDestinationDenied counts a send refused by the destination policy, by denied prefix or "unlisted"
+func IncDestinationDenied(reason string) {
+	otpDestinationsDenied.Add(reason, 1)
+}
+
+// Handler serves all counters as JSON
+func Handler() http.Handler {
+	return expvar.Handler()
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"fmt"
+
+	"otp-auth/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DeliveryReceiptRepository interface defines delivery receipt data operations
+type DeliveryReceiptRepository interface {
+	Create(receipt *entity.DeliveryReceipt) (*entity.DeliveryReceipt, error)
+	ListByOTPID(otpID int) ([]entity.DeliveryReceipt, error)
+}
+
+// deliveryReceiptRepository implements DeliveryReceiptRepository interface
+type deliveryReceiptRepository struct {
+	db *sqlx.DB
+}
+
+// NewDeliveryReceiptRepository creates a new delivery receipt repository instance
+func NewDeliveryReceiptRepository(db *sqlx.DB) DeliveryReceiptRepository {
+	return &deliveryReceiptRepository{
+		db: db,
+	}
+}
+
+// Create stores a delivery receipt
+func (r *deliveryReceiptRepository) Create(receipt *entity.DeliveryReceipt) (*entity.DeliveryReceipt, error) {
+	query := `
+		INSERT INTO otp_delivery_receipts (otp_id, provider_message_id, status, provider_status, error_code, reported_at)
+		VALUES (:otp_id, :provider_message_id, :status, :provider_status, :error_code, :reported_at)
+		RETURNING id, otp_id, provider_message_id, status, provider_status, error_code, reported_at, received_at
+	`
+
+	rows, err := r.db.NamedQuery(query, receipt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create delivery receipt: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, fmt.Errorf("failed to get created delivery receipt")
+	}
+
+	var created entity.DeliveryReceipt
+	if err := rows.StructScan(&created); err != nil {
+		return nil, fmt.Errorf("failed to scan created delivery receipt: %w", err)
+	}
+
+	return &created, nil
+}
+
+// ListByOTPID retrieves all receipts of an OTP in arrival order
+func (r *deliveryReceiptRepository) ListByOTPID(otpID int) ([]entity.DeliveryReceipt, error) {
+	query := `
+		SELECT id, otp_id, provider_message_id, status, provider_status, error_code, reported_at, received_at
+		FROM otp_delivery_receipts
+		WHERE otp_id = $1
+		ORDER BY received_at
+	`
+
+	var receipts []entity.DeliveryReceipt
+	if err := r.db.Select(&receipts, query, otpID); err != nil {
+		return nil, fmt.Errorf("failed to list delivery receipts: %w", err)
+	}
+
+	return receipts, nil
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"fmt"
+
+	"otp-auth/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DestinationRuleRepository interface defines destination rule data operations
+type DestinationRuleRepository interface {
+	List() ([]entity.DestinationRule, error)
+}
+
+// destinationRuleRepository implements DestinationRuleRepository interface
+type destinationRuleRepository struct {
+	db *sqlx.DB
+}
+
+// NewDestinationRuleRepository creates a new destination rule repository instance
+func NewDestinationRuleRepository(db *sqlx.DB) DestinationRuleRepository {
+	return &destinationRuleRepository{
+		db: db,
+	}
+}
+
+// List retrieves all destination rules
+func (r *destinationRuleRepository) List() ([]entity.DestinationRule, error) {
+	query := `
+		SELECT id, prefix, action, note, created_at, updated_at
+		FROM otp_destination_rules
+		ORDER BY prefix
+	`
+
+	var rules []entity.DestinationRule
+	if err := r.db.Select(&rules, query); err != nil {
+		return nil, fmt.Errorf("failed to list destination rules: %w", err)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"otp-auth/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const lockoutColumns = `phone_number, burned_sessions, window_start_at, locked_until, created_at, updated_at`
+
+// LockoutRepository interface defines phone number lockout operations
+type LockoutRepository interface {
+	Get(phoneNumber string) (*entity.Lockout, error)
+	RecordBurnedSession(phoneNumber string, window time.Duration, threshold int, duration time.Duration) (*entity.Lockout, error)
+	DeleteStale(olderThan time.Time) error
+}
+
+// lockoutRepository implements LockoutRepository interface
+type lockoutRepository struct {
+	db *sqlx.DB
+}
+
+// NewLockoutRepository creates a new lockout repository instance
+func NewLockoutRepository(db *sqlx.DB) LockoutRepository {
+	return &lockoutRepository{
+		db: db,
+	}
+}
+
+// Get retrieves the lockout record of a phone number
+func (r *lockoutRepository) Get(phoneNumber string) (*entity.Lockout, error) {
+	query := `SELECT ` + lockoutColumns + ` FROM otp_lockouts WHERE phone_number = $1`
+
+	var lockout entity.Lockout
+	err := r.db.Get(&lockout, query, phoneNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get lockout: %w", err)
+	}
+
+	return &lockout, nil
+}
+
+// RecordBurnedSession counts a burned session within the window and locks the phone number
+// for duration once threshold sessions were burned. The count and the lockout are decided
+// in a single statement so concurrent verifications cannot miss each other.
+func (r *lockoutRepository) RecordBurnedSession(phoneNumber string, window time.Duration, threshold int, duration time.Duration) (*entity.Lockout, error) {
+	query := `
+		INSERT INTO otp_lockouts (phone_number, burned_sessions, window_start_at, locked_until)
+		VALUES ($1, 1, $2, CASE WHEN 1 >= $4 THEN $5::timestamptz END)
+		ON CONFLICT (phone_number)
+		DO UPDATE SET
+			burned_sessions = CASE WHEN otp_lockouts.window_start_at < $3 THEN 1 ELSE otp_lockouts.burned_sessions + 1 END,
+			window_start_at = CASE WHEN otp_lockouts.window_start_at < $3 THEN $2 ELSE otp_lockouts.window_start_at END,
+			locked_until = CASE
+				WHEN (CASE WHEN otp_lockouts.window_start_at < $3 THEN 1 ELSE otp_lockouts.burned_sessions + 1 END) >= $4 THEN $5
+				ELSE otp_lockouts.locked_until
+			END
+		RETURNING ` + lockoutColumns
+
+	now := time.Now()
+
+	var lockout entity.Lockout
+	err := r.db.Get(&lockout, query, phoneNumber, now, now.Add(-window), threshold, now.Add(duration))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record burned session: %w", err)
+	}
+
+	return &lockout, nil
+}
+
+// DeleteStale removes records whose window started before olderThan and that are not locked
+func (r *lockoutRepository) DeleteStale(olderThan time.Time) error {
+	query := `
+		DELETE FROM otp_lockouts
+		WHERE window_start_at < $1 AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+	`
+
+	result, err := r.db.Exec(query, olderThan)
+	if err != nil {
+		return fmt.Errorf("failed to delete stale lockouts: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err == nil && rowsAffected > 0 {
+		fmt.Printf("Deleted %d stale lockout records\n", rowsAffected)
+	}
+
+	return nil
+}
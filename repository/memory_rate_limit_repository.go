@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+)
+
+// memoryRateLimitEntry is the state of one key and when it stops mattering
+type memoryRateLimitEntry struct {
+	state     rateLimitState
+	expiresAt time.Time
+}
+
+// MemoryRateLimitRepository implements rate limiting in process memory. State is lost on
+// restart and not shared between instances, so it suits single instance deployments and tests.
+type MemoryRateLimitRepository struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryRateLimitEntry
+	overrides map[string]entity.RateLimitOverride
+}
+
+// NewMemoryRateLimitRepository creates a new in-memory rate limit repository
+func NewMemoryRateLimitRepository() RateLimitRepository {
+	return &MemoryRateLimitRepository{
+		entries:   make(map[string]*memoryRateLimitEntry),
+		overrides: make(map[string]entity.RateLimitOverride),
+	}
+}
+
+// Allow checks and counts a request under the repository lock
+func (r *MemoryRateLimitRepository) Allow(key string, policy config.RateLimitPolicy, now time.Time) (*entity.RateLimitResult, error) {
+	return r.run(key, policy, now, true)
+}
+
+// Peek checks a request without counting it
+func (r *MemoryRateLimitRepository) Peek(key string, policy config.RateLimitPolicy, now time.Time) (*entity.RateLimitResult, error) {
+	return r.run(key, policy, now, false)
+}
+
+// run evaluates the policy's algorithm on a copy of the key's state and keeps the copy when the request is counted
+func (r *MemoryRateLimitRepository) run(key string, policy config.RateLimitPolicy, now time.Time, consume bool) (*entity.RateLimitResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var state rateLimitState
+	if entry, ok := r.entries[key]; ok {
+		state = entry.state
+	}
+
+	result, expiresAt, err := evaluateRateLimit(&state, policy, now, consume)
+	if err != nil {
+		return nil, err
+	}
+
+	if consume && result.Allowed {
+		r.entries[key] = &memoryRateLimitEntry{state: state, expiresAt: expiresAt}
+	}
+
+	return result, nil
+}
+
+// Reset deletes the state of key
+func (r *MemoryRateLimitRepository) Reset(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entries, key)
+	return nil
+}
+
+// SetOverride stores an override until it expires
+func (r *MemoryRateLimitRepository) SetOverride(key string, override *entity.RateLimitOverride) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.overrides[key] = *override
+	return nil
+}
+
+// GetOverrides returns the overrides of keys that have not expired at now
+func (r *MemoryRateLimitRepository) GetOverrides(keys []string, now time.Time) (map[string]*entity.RateLimitOverride, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	overrides := make(map[string]*entity.RateLimitOverride)
+	for _, key := range keys {
+		if override, ok := r.overrides[key]; ok && override.ExpiresAt.After(now) {
+			overrides[key] = &override
+		}
+	}
+
+	return overrides, nil
+}
+
+// DeleteOverride deletes the override of key
+func (r *MemoryRateLimitRepository) DeleteOverride(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.overrides, key)
+	return nil
+}
+
+// CleanupRateLimits drops state and overrides that expired before olderThan
+func (r *MemoryRateLimitRepository) CleanupRateLimits(olderThan time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, entry := range r.entries {
+		if entry.expiresAt.Before(olderThan) {
+			delete(r.entries, key)
+		}
+	}
+	for key, override := range r.overrides {
+		if override.ExpiresAt.Before(olderThan) {
+			delete(r.overrides, key)
+		}
+	}
+
+	return nil
+}
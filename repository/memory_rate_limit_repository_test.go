@@ -0,0 +1,42 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRateLimit_Conformance(t *testing.T) {
+	runRateLimitConformance(t, func(t *testing.T) repository.RateLimitRepository {
+		return repository.NewMemoryRateLimitRepository()
+	})
+}
+
+func BenchmarkMemoryRateLimit_Allow(b *testing.B) {
+	runRateLimitBenchmarks(b, func(b *testing.B) repository.RateLimitRepository {
+		return repository.NewMemoryRateLimitRepository()
+	})
+}
+
+func TestMemoryRateLimit_CleanupDropsExpiredRecords(t *testing.T) {
+	repo := repository.NewMemoryRateLimitRepository()
+	policy := config.RateLimitPolicy{Algorithm: config.RateLimitFixedWindow, Limit: 1, Window: time.Minute}
+
+	_, err := repo.Allow("+1234567890", policy, conformanceStart)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.CleanupRateLimits(conformanceStart.Add(30*time.Second)))
+	result, err := repo.Peek("+1234567890", policy, conformanceStart.Add(30*time.Second))
+	require.NoError(t, err)
+	assert.False(t, result.Allowed, "records inside their window are kept")
+
+	require.NoError(t, repo.CleanupRateLimits(conformanceStart.Add(2*time.Minute)))
+	result, err = repo.Peek("+1234567890", policy, conformanceStart.Add(30*time.Second))
+	require.NoError(t, err)
+	assert.True(t, result.Allowed, "expired records are dropped")
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"fmt"
+
+	"otp-auth/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MessageTemplateRepository interface defines message template data operations
+type MessageTemplateRepository interface {
+	List() ([]entity.MessageTemplate, error)
+}
+
+// messageTemplateRepository implements MessageTemplateRepository interface
+type messageTemplateRepository struct {
+	db *sqlx.DB
+}
+
+// NewMessageTemplateRepository creates a new message template repository instance
+func NewMessageTemplateRepository(db *sqlx.DB) MessageTemplateRepository {
+	return &messageTemplateRepository{
+		db: db,
+	}
+}
+
+// List retrieves all message templates
+func (r *messageTemplateRepository) List() ([]entity.MessageTemplate, error) {
+	query := `
+		SELECT id, locale, purpose, body, created_at, updated_at
+		FROM otp_message_templates
+		ORDER BY locale, purpose
+	`
+
+	var templates []entity.MessageTemplate
+	if err := r.db.Select(&templates, query); err != nil {
+		return nil, fmt.Errorf("failed to list message templates: %w", err)
+	}
+
+	return templates, nil
+}
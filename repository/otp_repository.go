@@ -10,13 +10,29 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+const otpColumns = `id, phone_number, code, session_token, expires_at, is_used, created_at, used_at,
+		delivery_channel, provider_message_id, delivery_status, delivery_updated_at, delivered_at, client_id,
+		attempts, max_attempts, resend_count, last_sent_at, locale, cancelled_at, purpose, payload_hash, is_test, link_token,
+		client_ip, calling_code`
+
 // OTPRepository interface defines OTP data operations
 type OTPRepository interface {
 	Create(otp *entity.OTP) (*entity.OTP, error)
-	GetActiveByPhoneNumberAndCode(phoneNumber, code string) (*entity.OTP, error)
-	GetActiveBySessionTokenAndCode(sessionToken, code string) (*entity.OTP, error)
-	MarkAsUsed(id int) error
+	CreateTx(tx *sqlx.Tx, otp *entity.OTP) (*entity.OTP, error)
+	GetByID(id int) (*entity.OTP, error)
+	GetBySessionToken(sessionToken string) (*entity.OTP, error)
+	GetByLinkToken(linkToken string) (*entity.OTP, error)
+	GetByProviderMessageID(providerMessageID string) (*entity.OTP, error)
+	UpdateDeliveryStatus(id int, status, channel, providerMessageID string) error
+	IncrementAttempts(id int) (*entity.OTP, error)
+	CancelTx(tx *sqlx.Tx, id int) (bool, error)
+	ResendTx(tx *sqlx.Tx, id int, code string, linkToken *string, expiresAt time.Time, maxResends int, sentBefore time.Time) (*entity.OTP, error)
+	GetLatestByPhoneNumber(phoneNumber, purpose, clientID string) (*entity.OTP, error)
+	ConsumeTx(tx *sqlx.Tx, id int) (*entity.OTP, error)
 	DeleteExpired() error
+	RecordConversionTx(tx *sqlx.Tx, otp *entity.OTP, verified bool) error
+	GetConversionStats(dimension string, since time.Time, minSent int) ([]entity.ConversionStat, error)
+	DeleteConversionStatsBefore(olderThan time.Time) error
 }
 
 // otpRepository implements OTPRepository interface
@@ -33,16 +49,31 @@ func NewOTPRepository(db *sqlx.DB) OTPRepository {
 
 // Create creates a new OTP
 func (r *otpRepository) Create(otp *entity.OTP) (*entity.OTP, error) {
+	return r.create(r.db, otp)
+}
+
+// CreateTx creates a new OTP within the caller's transaction
+func (r *otpRepository) CreateTx(tx *sqlx.Tx, otp *entity.OTP) (*entity.OTP, error) {
+	return r.create(tx, otp)
+}
+
+// create inserts an OTP using either the database handle or a transaction
+func (r *otpRepository) create(ext sqlx.Ext, otp *entity.OTP) (*entity.OTP, error) {
 	query := `
-		INSERT INTO otps (phone_number, code, session_token, expires_at, is_used, created_at)
-		VALUES (:phone_number, :code, :session_token, :expires_at, :is_used, :created_at)
-		RETURNING id, phone_number, code, session_token, expires_at, is_used, created_at, used_at
-	`
+		INSERT INTO otps (phone_number, code, session_token, expires_at, is_used, created_at, client_id, max_attempts,
+			last_sent_at, locale, purpose, payload_hash, is_test, link_token, client_ip, calling_code)
+		VALUES (:phone_number, :code, :session_token, :expires_at, :is_used, :created_at, :client_id, :max_attempts,
+			:last_sent_at, :locale, :purpose, :payload_hash, :is_test, :link_token, :client_ip, :calling_code)
+		RETURNING ` + otpColumns
 
 	otp.CreatedAt = time.Now()
+	otp.LastSentAt = otp.CreatedAt
 	otp.IsUsed = false
+	if otp.Purpose == "" {
+		otp.Purpose = entity.PurposeLogin
+	}
 
-	rows, err := r.db.NamedQuery(query, otp)
+	rows, err := sqlx.NamedQuery(ext, query, otp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OTP: %w", err)
 	}
@@ -60,73 +91,221 @@ func (r *otpRepository) Create(otp *entity.OTP) (*entity.OTP, error) {
 	return &createdOTP, nil
 }
 
-// GetActiveByPhoneNumberAndCode retrieves an active OTP by phone number and code
-func (r *otpRepository) GetActiveByPhoneNumberAndCode(phoneNumber, code string) (*entity.OTP, error) {
+// GetByID retrieves an OTP by ID regardless of its state
+func (r *otpRepository) GetByID(id int) (*entity.OTP, error) {
 	query := `
-		SELECT id, phone_number, code, session_token, expires_at, is_used, created_at, used_at
+		SELECT ` + otpColumns + `
 		FROM otps
-		WHERE phone_number = $1 AND code = $2 AND is_used = FALSE AND expires_at > CURRENT_TIMESTAMP
-		ORDER BY created_at DESC
-		LIMIT 1
+		WHERE id = $1
+	`
+
+	var otp entity.OTP
+	err := r.db.Get(&otp, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get OTP by id: %w", err)
+	}
+
+	return &otp, nil
+}
+
+// GetBySessionToken retrieves an OTP by session token regardless of its state
+func (r *otpRepository) GetBySessionToken(sessionToken string) (*entity.OTP, error) {
+	query := `
+		SELECT ` + otpColumns + `
+		FROM otps
+		WHERE session_token = $1
 	`
 
 	var otp entity.OTP
-	err := r.db.Get(&otp, query, phoneNumber, code)
+	err := r.db.Get(&otp, query, sessionToken)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("failed to get OTP: %w", err)
+		return nil, fmt.Errorf("failed to get OTP by session token: %w", err)
 	}
 
 	return &otp, nil
 }
 
-// GetActiveBySessionTokenAndCode retrieves an active OTP by session token and code
-func (r *otpRepository) GetActiveBySessionTokenAndCode(sessionToken, code string) (*entity.OTP, error) {
+// GetByLinkToken retrieves an OTP by magic link token regardless of its state
+func (r *otpRepository) GetByLinkToken(linkToken string) (*entity.OTP, error) {
 	query := `
-		SELECT id, phone_number, code, session_token, expires_at, is_used, created_at, used_at
+		SELECT ` + otpColumns + `
 		FROM otps
-		WHERE session_token = $1 AND code = $2 AND is_used = FALSE AND expires_at > CURRENT_TIMESTAMP
+		WHERE link_token = $1
+	`
+
+	var otp entity.OTP
+	err := r.db.Get(&otp, query, linkToken)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get OTP by link token: %w", err)
+	}
+
+	return &otp, nil
+}
+
+// GetByProviderMessageID retrieves the OTP a provider message belongs to,
+// including messages sent by earlier attempts of the fallback chain
+func (r *otpRepository) GetByProviderMessageID(providerMessageID string) (*entity.OTP, error) {
+	query := `
+		SELECT ` + otpColumns + `
+		FROM otps
+		WHERE provider_message_id = $1
+		   OR id IN (SELECT otp_id FROM otp_outbox WHERE provider_message_id = $1)
 		ORDER BY created_at DESC
 		LIMIT 1
 	`
 
 	var otp entity.OTP
-	err := r.db.Get(&otp, query, sessionToken, code)
+	err := r.db.Get(&otp, query, providerMessageID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("failed to get OTP by session token: %w", err)
+		return nil, fmt.Errorf("failed to get OTP by provider message id: %w", err)
 	}
 
 	return &otp, nil
 }
 
-// MarkAsUsed marks an OTP as used
-func (r *otpRepository) MarkAsUsed(id int) error {
+// UpdateDeliveryStatus records the latest delivery state; a delivered OTP keeps its state
+func (r *otpRepository) UpdateDeliveryStatus(id int, status, channel, providerMessageID string) error {
 	query := `
 		UPDATE otps
-		SET is_used = TRUE, used_at = CURRENT_TIMESTAMP
-		WHERE id = $1 AND is_used = FALSE
+		SET delivery_status = $2,
+			delivery_channel = COALESCE(NULLIF($3, ''), delivery_channel),
+			provider_message_id = COALESCE(NULLIF($4, ''), provider_message_id),
+			delivery_updated_at = CURRENT_TIMESTAMP,
+			delivered_at = CASE WHEN $5 THEN CURRENT_TIMESTAMP ELSE delivered_at END
+		WHERE id = $1 AND delivery_status <> 'delivered'
+	`
+
+	_, err := r.db.Exec(query, id, status, channel, providerMessageID, status == entity.DeliveryStatusDelivered)
+	if err != nil {
+		return fmt.Errorf("failed to update delivery status: %w", err)
+	}
+
+	return nil
+}
+
+// IncrementAttempts counts a verification attempt on an active session that has attempts left.
+// It returns nil when the session is used, expired or already burned.
+func (r *otpRepository) IncrementAttempts(id int) (*entity.OTP, error) {
+	query := `
+		UPDATE otps
+		SET attempts = attempts + 1
+		WHERE id = $1 AND is_used = FALSE AND cancelled_at IS NULL AND expires_at > CURRENT_TIMESTAMP AND attempts < max_attempts
+		RETURNING ` + otpColumns
+
+	var otp entity.OTP
+	err := r.db.Get(&otp, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to increment OTP attempts: %w", err)
+	}
+
+	return &otp, nil
+}
+
+// CancelTx cancels an open session within the caller's transaction.
+// It reports false when the session is already used or cancelled.
+func (r *otpRepository) CancelTx(tx *sqlx.Tx, id int) (bool, error) {
+	query := `
+		UPDATE otps
+		SET cancelled_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND is_used = FALSE AND cancelled_at IS NULL
 	`
 
-	result, err := r.db.Exec(query, id)
+	result, err := tx.Exec(query, id)
 	if err != nil {
-		return fmt.Errorf("failed to mark OTP as used: %w", err)
+		return false, fmt.Errorf("failed to cancel OTP: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("OTP not found or already used")
+	return rowsAffected > 0, nil
+}
+
+// ResendTx replaces the code and magic link token of an open session within the caller's
+// transaction and resets its delivery state. It returns nil when the session is used, cancelled or burned, has reached
+// maxResends, or was last sent after sentBefore (still cooling down).
+func (r *otpRepository) ResendTx(tx *sqlx.Tx, id int, code string, linkToken *string, expiresAt time.Time, maxResends int, sentBefore time.Time) (*entity.OTP, error) {
+	query := `
+		UPDATE otps
+		SET code = $2, link_token = $3, expires_at = $4, resend_count = resend_count + 1, last_sent_at = CURRENT_TIMESTAMP,
+			delivery_status = 'queued', delivery_channel = NULL, provider_message_id = NULL,
+			delivery_updated_at = NULL, delivered_at = NULL
+		WHERE id = $1 AND is_used = FALSE AND cancelled_at IS NULL AND attempts < max_attempts
+			AND resend_count < $5 AND last_sent_at <= $6
+		RETURNING ` + otpColumns
+
+	var otp entity.OTP
+	err := tx.Get(&otp, query, id, code, linkToken, expiresAt, maxResends, sentBefore)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to resend OTP: %w", err)
 	}
 
-	return nil
+	return &otp, nil
+}
+
+// GetLatestByPhoneNumber retrieves the most recent OTP of a purpose sent to a phone number
+// through a client app, in any state. Only the latest session can be verified by phone
+// number, so attempts are counted against a single session and older codes stop working.
+func (r *otpRepository) GetLatestByPhoneNumber(phoneNumber, purpose, clientID string) (*entity.OTP, error) {
+	query := `
+		SELECT ` + otpColumns + `
+		FROM otps
+		WHERE phone_number = $1 AND purpose = $2 AND client_id = $3
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`
+
+	var otp entity.OTP
+	err := r.db.Get(&otp, query, phoneNumber, purpose, clientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get OTP by phone number: %w", err)
+	}
+
+	return &otp, nil
+}
+
+// ConsumeTx marks an active OTP as used within the caller's transaction. It returns nil
+// when the session is already used, cancelled or expired, so only one caller can consume it.
+func (r *otpRepository) ConsumeTx(tx *sqlx.Tx, id int) (*entity.OTP, error) {
+	query := `
+		UPDATE otps
+		SET is_used = TRUE, used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND is_used = FALSE AND cancelled_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING ` + otpColumns
+
+	var otp entity.OTP
+	err := tx.Get(&otp, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to consume OTP: %w", err)
+	}
+
+	return &otp, nil
 }
 
 // DeleteExpired deletes expired OTPs
@@ -146,58 +325,57 @@ func (r *otpRepository) DeleteExpired() error {
 	return nil
 }
 
-// GetRateLimit retrieves rate limit information for a phone number
-func (r *otpRepository) GetRateLimit(phoneNumber string) (*entity.RateLimitInfo, error) {
+// RecordConversionTx counts a session as sent, or as verified, in the conversion stats of its
+// country calling code and client IP within the caller's transaction. Both are counted in the
+// minute the session was created so a verification lands next to its send.
+func (r *otpRepository) RecordConversionTx(tx *sqlx.Tx, otp *entity.OTP, verified bool) error {
 	query := `
-		SELECT phone_number, request_count, last_request_at, window_start_at
-		FROM otp_rate_limits
-		WHERE phone_number = $1
+		INSERT INTO otp_conversion_stats (dimension, key, bucket, sent, verified)
+		SELECT dimension, key, date_trunc('minute', $1::timestamptz), $2, $3
+		FROM (VALUES ($4::text, $5::text), ($6::text, $7::text)) AS sessions(dimension, key)
+		WHERE key IS NOT NULL
+		ON CONFLICT (dimension, key, bucket) DO UPDATE
+		SET sent = otp_conversion_stats.sent + EXCLUDED.sent,
+			verified = otp_conversion_stats.verified + EXCLUDED.verified
 	`
 
-	var rateLimitInfo entity.RateLimitInfo
-	err := r.db.Get(&rateLimitInfo, query, phoneNumber)
+	sent, verifiedCount := 1, 0
+	if verified {
+		sent, verifiedCount = 0, 1
+	}
+
+	_, err := tx.Exec(query, otp.CreatedAt, sent, verifiedCount,
+		entity.RateLimitDimensionCountry, otp.CallingCode, entity.RateLimitDimensionIP, otp.ClientIP)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("failed to get rate limit info: %w", err)
+		return fmt.Errorf("failed to record conversion: %w", err)
 	}
 
-	return &rateLimitInfo, nil
+	return nil
 }
 
-// UpdateRateLimit updates or creates rate limit information
-func (r *otpRepository) UpdateRateLimit(rateLimitInfo *entity.RateLimitInfo) error {
+// GetConversionStats sums the conversion stats of a dimension since a time, for keys with at least minSent sessions
+func (r *otpRepository) GetConversionStats(dimension string, since time.Time, minSent int) ([]entity.ConversionStat, error) {
 	query := `
-		INSERT INTO otp_rate_limits (phone_number, request_count, last_request_at, window_start_at)
-		VALUES (:phone_number, :request_count, :last_request_at, :window_start_at)
-		ON CONFLICT (phone_number)
-		DO UPDATE SET
-			request_count = EXCLUDED.request_count,
-			last_request_at = EXCLUDED.last_request_at,
-			window_start_at = EXCLUDED.window_start_at
+		SELECT key, SUM(sent) AS sent, SUM(verified) AS verified
+		FROM otp_conversion_stats
+		WHERE dimension = $1 AND bucket >= $2
+		GROUP BY key
+		HAVING SUM(sent) >= $3
+		ORDER BY key
 	`
 
-	_, err := r.db.NamedExec(query, rateLimitInfo)
-	if err != nil {
-		return fmt.Errorf("failed to update rate limit: %w", err)
+	var stats []entity.ConversionStat
+	if err := r.db.Select(&stats, query, dimension, since, minSent); err != nil {
+		return nil, fmt.Errorf("failed to get conversion stats: %w", err)
 	}
 
-	return nil
+	return stats, nil
 }
 
-// CleanupRateLimits removes old rate limit records
-func (r *otpRepository) CleanupRateLimits(olderThan time.Time) error {
-	query := `DELETE FROM otp_rate_limits WHERE window_start_at < $1`
-
-	result, err := r.db.Exec(query, olderThan)
-	if err != nil {
-		return fmt.Errorf("failed to cleanup rate limits: %w", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err == nil && rowsAffected > 0 {
-		fmt.Printf("Cleaned up %d old rate limit records\n", rowsAffected)
+// DeleteConversionStatsBefore removes conversion stats of sessions sent before olderThan
+func (r *otpRepository) DeleteConversionStatsBefore(olderThan time.Time) error {
+	if _, err := r.db.Exec(`DELETE FROM otp_conversion_stats WHERE bucket < $1`, olderThan); err != nil {
+		return fmt.Errorf("failed to delete conversion stats: %w", err)
 	}
 
 	return nil
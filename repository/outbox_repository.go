@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"otp-auth/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const outboxColumns = `id, otp_id, client_id, channel, fallback_channels, phone_number, email, code, body, resend_count, expires_at, status, attempts, max_attempts,
+		next_attempt_at, locked_until, last_error, provider, provider_message_id, created_at, updated_at, sent_at`
+
+// OutboxRepository interface defines OTP delivery outbox operations
+type OutboxRepository interface {
+	Enqueue(msg *entity.OutboxMessage) (*entity.OutboxMessage, error)
+	EnqueueTx(tx *sqlx.Tx, msg *entity.OutboxMessage) (*entity.OutboxMessage, error)
+	ClaimDue(limit int, lease time.Duration) ([]entity.OutboxMessage, error)
+	MarkSent(id int, provider, providerMessageID string) error
+	MarkRetry(id int, nextAttemptAt time.Time, lastError string) error
+	MarkDead(id int, lastError string) error
+	MarkSkipped(id int, reason string) error
+	GetLatestByOTPID(otpID int) (*entity.OutboxMessage, error)
+	SkipPendingTx(tx *sqlx.Tx, otpID int, reason string) error
+	ReleasePending(otpID int) error
+	DeleteSentBefore(olderThan time.Time) (int64, error)
+}
+
+// outboxRepository implements OutboxRepository interface
+type outboxRepository struct {
+	db *sqlx.DB
+}
+
+// NewOutboxRepository creates a new outbox repository instance
+func NewOutboxRepository(db *sqlx.DB) OutboxRepository {
+	return &outboxRepository{
+		db: db,
+	}
+}
+
+// Enqueue writes a pending message
+func (r *outboxRepository) Enqueue(msg *entity.OutboxMessage) (*entity.OutboxMessage, error) {
+	return r.enqueue(r.db, msg)
+}
+
+// EnqueueTx writes a pending message within the caller's transaction
+func (r *outboxRepository) EnqueueTx(tx *sqlx.Tx, msg *entity.OutboxMessage) (*entity.OutboxMessage, error) {
+	return r.enqueue(tx, msg)
+}
+
+// enqueue inserts a message using either the database handle or a transaction
+func (r *outboxRepository) enqueue(ext sqlx.Ext, msg *entity.OutboxMessage) (*entity.OutboxMessage, error) {
+	query := `
+		INSERT INTO otp_outbox (otp_id, client_id, channel, fallback_channels, phone_number, email, code, body, resend_count,
+			expires_at, status, attempts, max_attempts, next_attempt_at)
+		VALUES (:otp_id, :client_id, :channel, :fallback_channels, :phone_number, :email, :code, :body, :resend_count, :expires_at,
+			:status, :attempts, :max_attempts, :next_attempt_at)
+		RETURNING ` + outboxColumns
+
+	msg.Status = entity.OutboxStatusPending
+	msg.Attempts = 0
+	if msg.NextAttemptAt.IsZero() {
+		msg.NextAttemptAt = time.Now()
+	}
+
+	rows, err := sqlx.NamedQuery(ext, query, msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue outbox message: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, fmt.Errorf("failed to get enqueued outbox message")
+	}
+
+	var created entity.OutboxMessage
+	if err := rows.StructScan(&created); err != nil {
+		return nil, fmt.Errorf("failed to scan enqueued outbox message: %w", err)
+	}
+
+	return &created, nil
+}
+
+// ClaimDue locks up to limit due messages for the calling worker and counts the attempt.
+// Messages whose lease expired (e.g. a crashed worker) are picked up again.
+func (r *outboxRepository) ClaimDue(limit int, lease time.Duration) ([]entity.OutboxMessage, error) {
+	query := `
+		UPDATE otp_outbox
+		SET status = 'processing', attempts = attempts + 1, locked_until = $2
+		WHERE id IN (
+			SELECT id FROM otp_outbox
+			WHERE (status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP)
+			   OR (status = 'processing' AND locked_until < CURRENT_TIMESTAMP)
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + outboxColumns
+
+	var messages []entity.OutboxMessage
+	if err := r.db.Select(&messages, query, limit, time.Now().Add(lease)); err != nil {
+		return nil, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// MarkSent records a successful hand-over to the provider and drops the sealed code
+func (r *outboxRepository) MarkSent(id int, provider, providerMessageID string) error {
+	query := `
+		UPDATE otp_outbox
+		SET status = 'sent', code = '', body = '', provider = $2, provider_message_id = NULLIF($3, ''),
+			sent_at = CURRENT_TIMESTAMP, locked_until = NULL, last_error = NULL
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(query, id, provider, providerMessageID); err != nil {
+		return fmt.Errorf("failed to mark outbox message as sent: %w", err)
+	}
+
+	return nil
+}
+
+// MarkRetry releases the message for another attempt at nextAttemptAt. A message skipped
+// while it was being sent stays skipped.
+func (r *outboxRepository) MarkRetry(id int, nextAttemptAt time.Time, lastError string) error {
+	query := `
+		UPDATE otp_outbox
+		SET status = 'pending', next_attempt_at = $2, last_error = $3, locked_until = NULL
+		WHERE id = $1 AND status = 'processing'
+	`
+
+	if _, err := r.db.Exec(query, id, nextAttemptAt, lastError); err != nil {
+		return fmt.Errorf("failed to schedule outbox retry: %w", err)
+	}
+
+	return nil
+}
+
+// MarkDead moves the message to the dead-letter state and drops the sealed code.
+// A message skipped while it was being sent stays skipped.
+func (r *outboxRepository) MarkDead(id int, lastError string) error {
+	query := `
+		UPDATE otp_outbox
+		SET status = 'dead', code = '', body = '', last_error = $2, locked_until = NULL
+		WHERE id = $1 AND status = 'processing'
+	`
+
+	if _, err := r.db.Exec(query, id, lastError); err != nil {
+		return fmt.Errorf("failed to dead-letter outbox message: %w", err)
+	}
+
+	return nil
+}
+
+// MarkSkipped closes a fallback message that is no longer needed and drops the sealed code
+func (r *outboxRepository) MarkSkipped(id int, reason string) error {
+	query := `
+		UPDATE otp_outbox
+		SET status = 'skipped', code = '', body = '', last_error = $2, locked_until = NULL
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(query, id, reason); err != nil {
+		return fmt.Errorf("failed to skip outbox message: %w", err)
+	}
+
+	return nil
+}
+
+// GetLatestByOTPID retrieves the most recently queued message of an OTP
+func (r *outboxRepository) GetLatestByOTPID(otpID int) (*entity.OutboxMessage, error) {
+	query := `
+		SELECT ` + outboxColumns + `
+		FROM otp_outbox
+		WHERE otp_id = $1
+		ORDER BY id DESC
+		LIMIT 1
+	`
+
+	var msg entity.OutboxMessage
+	err := r.db.Get(&msg, query, otpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get outbox message: %w", err)
+	}
+
+	return &msg, nil
+}
+
+// SkipPendingTx closes the not yet delivered messages of an OTP within the caller's transaction,
+// including those a worker has claimed. The worker checks the OTP again before sending.
+func (r *outboxRepository) SkipPendingTx(tx *sqlx.Tx, otpID int, reason string) error {
+	query := `
+		UPDATE otp_outbox
+		SET status = 'skipped', code = '', body = '', last_error = $2, locked_until = NULL
+		WHERE otp_id = $1 AND status IN ('pending', 'processing')
+	`
+
+	if _, err := tx.Exec(query, otpID, reason); err != nil {
+		return fmt.Errorf("failed to skip pending outbox messages: %w", err)
+	}
+
+	return nil
+}
+
+// ReleasePending makes the pending messages of an OTP due now, e.g. a fallback waiting
+// for a delivery confirmation that the gateway reported failed
+func (r *outboxRepository) ReleasePending(otpID int) error {
+	query := `
+		UPDATE otp_outbox
+		SET next_attempt_at = CURRENT_TIMESTAMP
+		WHERE otp_id = $1 AND status = 'pending' AND next_attempt_at > CURRENT_TIMESTAMP
+	`
+
+	if _, err := r.db.Exec(query, otpID); err != nil {
+		return fmt.Errorf("failed to release pending outbox messages: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSentBefore removes delivered and skipped messages and returns how many were removed;
+// dead letters are kept for inspection
+func (r *outboxRepository) DeleteSentBefore(olderThan time.Time) (int64, error) {
+	query := `DELETE FROM otp_outbox WHERE status IN ('sent', 'skipped') AND updated_at < $1`
+
+	result, err := r.db.Exec(query, olderThan)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sent outbox messages: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
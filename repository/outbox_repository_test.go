@@ -0,0 +1,165 @@
+package repository_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"otp-auth/entity"
+	"otp-auth/repository"
+	"otp-auth/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enqueueTestMessages queues count due messages without an OTP
+func enqueueTestMessages(t *testing.T, repo repository.OutboxRepository, count int) {
+	for i := 0; i < count; i++ {
+		_, err := repo.Enqueue(&entity.OutboxMessage{
+			Channel:     "sms",
+			PhoneNumber: test.GenerateTestPhoneNumber("01"),
+			Code:        "sealed-code",
+			Body:        "sealed-body",
+			ExpiresAt:   time.Now().Add(5 * time.Minute),
+			MaxAttempts: 3,
+		})
+		require.NoError(t, err)
+	}
+}
+
+func TestOutboxRepository_ClaimDueOncePerMessage(t *testing.T) {
+	test.SkipWithoutTestDB(t)
+	tdb := test.SetupTestDB(t)
+	defer tdb.Close()
+	tdb.CleanTables(t)
+
+	const messages = 20
+	repo := repository.NewOutboxRepository(tdb.DB)
+	enqueueTestMessages(t, repo, messages)
+
+	// Two workers claim at the same time; SKIP LOCKED hands every message to only one of them
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed = make(map[int]int)
+	)
+	start := make(chan struct{})
+	for worker := 0; worker < 2; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			batch, err := repo.ClaimDue(messages, time.Minute)
+			assert.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, msg := range batch {
+				claimed[msg.ID]++
+				assert.Equal(t, entity.OutboxStatusProcessing, msg.Status)
+				assert.Equal(t, 1, msg.Attempts)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Len(t, claimed, messages)
+	for id, count := range claimed {
+		assert.Equal(t, 1, count, "message %d claimed more than once", id)
+	}
+
+	// Leased messages are not claimed again
+	batch, err := repo.ClaimDue(messages, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, batch)
+}
+
+func TestOutboxRepository_ClaimDueReclaimsExpiredLease(t *testing.T) {
+	test.SkipWithoutTestDB(t)
+	tdb := test.SetupTestDB(t)
+	defer tdb.Close()
+	tdb.CleanTables(t)
+
+	repo := repository.NewOutboxRepository(tdb.DB)
+	enqueueTestMessages(t, repo, 1)
+
+	// A worker that claimed the message and crashed leaves a lease that runs out
+	first, err := repo.ClaimDue(10, -time.Second)
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+
+	second, err := repo.ClaimDue(10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, second, 1)
+	assert.Equal(t, first[0].ID, second[0].ID)
+	assert.Equal(t, 2, second[0].Attempts)
+}
+
+func TestOutboxRepository_SkippedWhileClaimedStaysSkipped(t *testing.T) {
+	test.SkipWithoutTestDB(t)
+	tdb := test.SetupTestDB(t)
+	defer tdb.Close()
+	tdb.CleanTables(t)
+
+	otp := tdb.CreateValidOTP(t, test.GenerateTestPhoneNumber("02"), "123456")
+	repo := repository.NewOutboxRepository(tdb.DB)
+	_, err := repo.Enqueue(&entity.OutboxMessage{
+		OTPID:       &otp.ID,
+		Channel:     "sms",
+		PhoneNumber: otp.PhoneNumber,
+		Code:        "sealed-code",
+		Body:        "sealed-body",
+		ExpiresAt:   otp.ExpiresAt,
+		MaxAttempts: 3,
+	})
+	require.NoError(t, err)
+
+	claimed, err := repo.ClaimDue(10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	tx, err := tdb.DB.Beginx()
+	require.NoError(t, err)
+	require.NoError(t, repo.SkipPendingTx(tx, otp.ID, "OTP resent"))
+	require.NoError(t, tx.Commit())
+
+	// A failed send of the claimed copy neither revives nor dead-letters it
+	require.NoError(t, repo.MarkRetry(claimed[0].ID, time.Now(), "gateway timeout"))
+	require.NoError(t, repo.MarkDead(claimed[0].ID, "gateway rejected"))
+
+	latest, err := repo.GetLatestByOTPID(otp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, entity.OutboxStatusSkipped, latest.Status)
+	assert.Empty(t, latest.Code)
+
+	batch, err := repo.ClaimDue(10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, batch)
+}
+
+func TestOutboxRepository_DeleteSentBeforeReturnsCount(t *testing.T) {
+	test.SkipWithoutTestDB(t)
+	tdb := test.SetupTestDB(t)
+	defer tdb.Close()
+	tdb.CleanTables(t)
+
+	repo := repository.NewOutboxRepository(tdb.DB)
+	enqueueTestMessages(t, repo, 3)
+	claimed, err := repo.ClaimDue(2, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	require.NoError(t, repo.MarkSent(claimed[0].ID, "stub", "stub-1"))
+	require.NoError(t, repo.MarkDead(claimed[1].ID, "gateway rejected"))
+
+	// Only the sent message goes; the dead letter and the pending message stay
+	deleted, err := repo.DeleteSentBefore(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	deleted, err = repo.DeleteSentBefore(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+}
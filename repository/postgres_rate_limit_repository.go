@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const rateLimitStateColumns = `algorithm, window_start_ms, request_count, previous_count, tat_ms, request_log_ms`
+
+// PostgresRateLimitRepository implements rate limiting on the otp_rate_limits table. A
+// counted request locks its key's row, so concurrent requests for a key are decided one
+// at a time.
+type PostgresRateLimitRepository struct {
+	db        *sqlx.DB
+	txManager TxManager
+}
+
+// NewPostgresRateLimitRepository creates a new PostgreSQL rate limit repository
+func NewPostgresRateLimitRepository(db *sqlx.DB) RateLimitRepository {
+	return &PostgresRateLimitRepository{
+		db:        db,
+		txManager: NewTxManager(db),
+	}
+}
+
+// Allow checks and counts a request in a transaction holding the key's row lock
+func (r *PostgresRateLimitRepository) Allow(key string, policy config.RateLimitPolicy, now time.Time) (*entity.RateLimitResult, error) {
+	var result *entity.RateLimitResult
+	err := r.txManager.WithinTransaction(func(tx *sqlx.Tx) error {
+		// Make sure there is a row to lock; a new key starts without state
+		_, err := tx.Exec(`INSERT INTO otp_rate_limits (key, expires_at) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING`, key, now)
+		if err != nil {
+			return fmt.Errorf("failed to create rate limit: %w", err)
+		}
+
+		var state rateLimitState
+		err = tx.Get(&state, `SELECT `+rateLimitStateColumns+` FROM otp_rate_limits WHERE key = $1 FOR UPDATE`, key)
+		if err != nil {
+			return fmt.Errorf("failed to get rate limit: %w", err)
+		}
+
+		var expiresAt time.Time
+		result, expiresAt, err = evaluateRateLimit(&state, policy, now, true)
+		if err != nil || !result.Allowed {
+			return err
+		}
+
+		query := `
+			UPDATE otp_rate_limits
+			SET algorithm = $2, window_start_ms = $3, request_count = $4, previous_count = $5, tat_ms = $6,
+				request_log_ms = $7, expires_at = $8
+			WHERE key = $1
+		`
+		_, err = tx.Exec(query, key, state.Algorithm, state.WindowStart, state.Count, state.Previous, state.TAT, state.Log, expiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to update rate limit: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+
+	return result, nil
+}
+
+// Peek checks a request without counting it or taking a lock
+func (r *PostgresRateLimitRepository) Peek(key string, policy config.RateLimitPolicy, now time.Time) (*entity.RateLimitResult, error) {
+	var state rateLimitState
+	err := r.db.Get(&state, `SELECT `+rateLimitStateColumns+` FROM otp_rate_limits WHERE key = $1`, key)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get rate limit: %w", err)
+	}
+
+	result, _, err := evaluateRateLimit(&state, policy, now, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+
+	return result, nil
+}
+
+// Reset deletes the state of key
+func (r *PostgresRateLimitRepository) Reset(key string) error {
+	if _, err := r.db.Exec(`DELETE FROM otp_rate_limits WHERE key = $1`, key); err != nil {
+		return fmt.Errorf("failed to reset rate limit: %w", err)
+	}
+
+	return nil
+}
+
+// SetOverride creates or replaces the override of key
+func (r *PostgresRateLimitRepository) SetOverride(key string, override *entity.RateLimitOverride) error {
+	query := `
+		INSERT INTO otp_rate_limit_overrides (key, override_limit, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key)
+		DO UPDATE SET override_limit = EXCLUDED.override_limit, expires_at = EXCLUDED.expires_at, created_at = CURRENT_TIMESTAMP
+	`
+
+	if _, err := r.db.Exec(query, key, override.Limit, override.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to set rate limit override: %w", err)
+	}
+
+	return nil
+}
+
+// GetOverrides returns the overrides of keys that have not expired at now
+func (r *PostgresRateLimitRepository) GetOverrides(keys []string, now time.Time) (map[string]*entity.RateLimitOverride, error) {
+	overrides := make(map[string]*entity.RateLimitOverride)
+	if len(keys) == 0 {
+		return overrides, nil
+	}
+
+	var rows []struct {
+		Key       string    `db:"key"`
+		Limit     int       `db:"override_limit"`
+		ExpiresAt time.Time `db:"expires_at"`
+	}
+	query := `SELECT key, override_limit, expires_at FROM otp_rate_limit_overrides WHERE key = ANY($1) AND expires_at > $2`
+	if err := r.db.Select(&rows, query, pq.Array(keys), now); err != nil {
+		return nil, fmt.Errorf("failed to get rate limit overrides: %w", err)
+	}
+
+	for _, row := range rows {
+		overrides[row.Key] = &entity.RateLimitOverride{Limit: row.Limit, ExpiresAt: row.ExpiresAt}
+	}
+
+	return overrides, nil
+}
+
+// DeleteOverride deletes the override of key
+func (r *PostgresRateLimitRepository) DeleteOverride(key string) error {
+	if _, err := r.db.Exec(`DELETE FROM otp_rate_limit_overrides WHERE key = $1`, key); err != nil {
+		return fmt.Errorf("failed to delete rate limit override: %w", err)
+	}
+
+	return nil
+}
+
+// CleanupRateLimits removes state and overrides that expired before olderThan
+func (r *PostgresRateLimitRepository) CleanupRateLimits(olderThan time.Time) error {
+	if _, err := r.db.Exec(`DELETE FROM otp_rate_limits WHERE expires_at < $1`, olderThan); err != nil {
+		return fmt.Errorf("failed to cleanup rate limits: %w", err)
+	}
+
+	if _, err := r.db.Exec(`DELETE FROM otp_rate_limit_overrides WHERE expires_at < $1`, olderThan); err != nil {
+		return fmt.Errorf("failed to cleanup rate limit overrides: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package repository_test
+
+import (
+	"testing"
+
+	"otp-auth/repository"
+	"otp-auth/test"
+)
+
+func TestPostgresRateLimit_Conformance(t *testing.T) {
+	test.SkipWithoutTestDB(t)
+
+	tdb := test.SetupTestDB(t)
+	t.Cleanup(tdb.Close)
+
+	runRateLimitConformance(t, func(t *testing.T) repository.RateLimitRepository {
+		tdb.CleanTables(t)
+		return repository.NewPostgresRateLimitRepository(tdb.DB)
+	})
+}
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+
+	"github.com/lib/pq"
+)
+
+// slidingWindowEpsilon is the tolerance for rounding in the sliding window's weighted estimate
+const slidingWindowEpsilon = 1e-9
+
+// rateLimitState is the state of one key in the Postgres and in-memory repositories. The
+// fields an algorithm uses mirror the Redis records of its script; times are unix milliseconds.
+type rateLimitState struct {
+	Algorithm   string        `db:"algorithm"`       // empty for a key without state
+	WindowStart int64         `db:"window_start_ms"` // fixed_window: first request; sliding_window: current aligned window
+	Count       int           `db:"request_count"`   // fixed_window, sliding_window: requests in the (current) window
+	Previous    int           `db:"previous_count"`  // sliding_window: requests in the previous aligned window
+	TAT         int64         `db:"tat_ms"`          // token_bucket: theoretical arrival time
+	Log         pq.Int64Array `db:"request_log_ms"`  // sliding_log: request times within the last window
+}
+
+// evaluateRateLimit decides whether one more request for state fits the policy at now and
+// records it in state when consume is set. It returns the same result as the policy's Redis
+// script, and the time after which state no longer affects any decision.
+func evaluateRateLimit(state *rateLimitState, policy config.RateLimitPolicy, now time.Time, consume bool) (*entity.RateLimitResult, time.Time, error) {
+	// State of another algorithm, or none at all, starts the key over
+	if state.Algorithm != policy.Algorithm {
+		*state = rateLimitState{}
+	}
+	exists := state.Algorithm != ""
+
+	var values [4]int64
+	var expiresAt int64
+	nowMs, limit, window := now.UnixMilli(), int64(policy.Limit), policy.Window.Milliseconds()
+
+	switch policy.Algorithm {
+	case config.RateLimitFixedWindow:
+		values, expiresAt = evaluateFixedWindow(state, exists, nowMs, limit, window, consume)
+	case config.RateLimitSlidingLog:
+		values, expiresAt = evaluateSlidingLog(state, nowMs, limit, window, consume)
+	case config.RateLimitSlidingWindow:
+		values, expiresAt = evaluateSlidingWindow(state, exists, nowMs, limit, window, consume)
+	case config.RateLimitTokenBucket:
+		values, expiresAt = evaluateTokenBucket(state, exists, nowMs, limit, window, consume)
+	default:
+		return nil, time.Time{}, fmt.Errorf("unknown rate limit algorithm: %s", policy.Algorithm)
+	}
+
+	if consume && values[0] == 1 {
+		state.Algorithm = policy.Algorithm
+	}
+
+	result := &entity.RateLimitResult{
+		Allowed:   values[0] == 1,
+		Limit:     policy.Limit,
+		Remaining: int(values[1]),
+		ResetAt:   time.UnixMilli(values[2]),
+	}
+	if !result.Allowed {
+		result.RetryAt = time.UnixMilli(values[3])
+	}
+
+	return result, time.UnixMilli(expiresAt), nil
+}
+
+// evaluateFixedWindow mirrors fixedWindowScript
+func evaluateFixedWindow(state *rateLimitState, exists bool, now, limit, window int64, consume bool) ([4]int64, int64) {
+	start, count := state.WindowStart, int64(state.Count)
+	if !exists || now >= start+window {
+		start = now
+		count = 0
+	}
+
+	var allowed int64
+	if count+1 <= limit {
+		allowed = 1
+		if consume {
+			count++
+			state.WindowStart, state.Count = start, int(count)
+		}
+	}
+
+	reset := now
+	if count > 0 {
+		reset = start + window
+	}
+
+	var retry int64
+	if allowed == 0 {
+		retry = start + window
+	}
+
+	return [4]int64{allowed, max(limit-count, 0), reset, retry}, start + window
+}
+
+// evaluateSlidingLog mirrors slidingLogScript
+func evaluateSlidingLog(state *rateLimitState, now, limit, window int64, consume bool) ([4]int64, int64) {
+	log := state.Log[:0:0]
+	for _, at := range state.Log {
+		if at > now-window {
+			log = append(log, at)
+		}
+	}
+	count := int64(len(log))
+
+	var allowed int64
+	if count+1 <= limit {
+		allowed = 1
+		if consume {
+			log = append(log, now)
+			count++
+		}
+	}
+	if consume {
+		state.Log = log
+	}
+
+	reset := now
+	if len(log) > 0 {
+		reset = log[0]
+		for _, at := range log {
+			reset = max(reset, at)
+		}
+		reset += window
+	}
+
+	var retry int64
+	if allowed == 0 {
+		oldest := log[0]
+		for _, at := range log {
+			oldest = min(oldest, at)
+		}
+		retry = oldest + window
+	}
+
+	return [4]int64{allowed, max(limit-count, 0), reset, retry}, reset
+}
+
+// evaluateSlidingWindow mirrors slidingWindowScript
+func evaluateSlidingWindow(state *rateLimitState, exists bool, now, limit, window int64, consume bool) ([4]int64, int64) {
+	currentStart := now - now%window
+	current, previous := int64(state.Count), int64(state.Previous)
+	if !exists || state.WindowStart < currentStart {
+		if exists && state.WindowStart+window == currentStart {
+			previous = current
+		} else {
+			previous = 0
+		}
+		current = 0
+	}
+
+	weight := float64(window-(now-currentStart)) / float64(window)
+	estimate := float64(previous)*weight + float64(current)
+
+	var allowed int64
+	if estimate+1 <= float64(limit)+slidingWindowEpsilon {
+		allowed = 1
+		if consume {
+			current++
+			estimate++
+			state.WindowStart, state.Count, state.Previous = currentStart, int(current), int(previous)
+		}
+	}
+
+	reset := now
+	if current > 0 {
+		reset = currentStart + 2*window
+	} else if previous > 0 {
+		reset = currentStart + window
+	}
+
+	var retry int64
+	if allowed == 0 {
+		// First time the weighted previous count leaves room for one more request
+		room := limit - 1 - current
+		if room >= 0 && previous > 0 {
+			retry = int64(math.Ceil(float64(currentStart+window) - float64(window)*float64(room)/float64(previous)))
+		} else {
+			retry = int64(math.Ceil(float64(currentStart+2*window) - float64(window)*float64(limit-1)/float64(current)))
+		}
+	}
+
+	remaining := max(int64(math.Floor(float64(limit)-estimate+slidingWindowEpsilon)), 0)
+
+	return [4]int64{allowed, remaining, reset, retry}, currentStart + 2*window
+}
+
+// evaluateTokenBucket mirrors tokenBucketScript
+func evaluateTokenBucket(state *rateLimitState, exists bool, now, limit, window int64, consume bool) ([4]int64, int64) {
+	interval := (window + limit - 1) / limit
+	burst := interval * limit
+
+	tat := now
+	if exists && state.TAT > now {
+		tat = state.TAT
+	}
+
+	nextTAT := tat + interval
+	var allowed int64
+	if nextTAT-now <= burst {
+		allowed = 1
+		if consume {
+			tat = nextTAT
+			state.TAT = tat
+		}
+	}
+
+	var retry int64
+	if allowed == 0 {
+		retry = nextTAT - burst
+	}
+
+	return [4]int64{allowed, (burst - (tat - now)) / interval, tat, retry}, tat
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"otp-auth/entity"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const rateLimitAuditColumns = `id, actor_user_id, actor_phone_number, action, dimension, value, override_limit, override_expires_at, created_at`
+
+// RateLimitAuditRepository interface defines rate limit audit trail operations
+type RateLimitAuditRepository interface {
+	CreateTx(tx *sqlx.Tx, entry *entity.RateLimitAuditEntry) (*entity.RateLimitAuditEntry, error)
+	List(dimension, value string, limit int) ([]entity.RateLimitAuditEntry, error)
+}
+
+// rateLimitAuditRepository implements RateLimitAuditRepository interface
+type rateLimitAuditRepository struct {
+	db *sqlx.DB
+}
+
+// NewRateLimitAuditRepository creates a new rate limit audit repository instance
+func NewRateLimitAuditRepository(db *sqlx.DB) RateLimitAuditRepository {
+	return &rateLimitAuditRepository{
+		db: db,
+	}
+}
+
+// CreateTx records an audit entry within the caller's transaction, so it is only kept when the change is made
+func (r *rateLimitAuditRepository) CreateTx(tx *sqlx.Tx, entry *entity.RateLimitAuditEntry) (*entity.RateLimitAuditEntry, error) {
+	query := `
+		INSERT INTO rate_limit_audit_log (actor_user_id, actor_phone_number, action, dimension, value,
+			override_limit, override_expires_at, created_at)
+		VALUES (:actor_user_id, :actor_phone_number, :action, :dimension, :value,
+			:override_limit, :override_expires_at, :created_at)
+		RETURNING ` + rateLimitAuditColumns
+
+	entry.CreatedAt = time.Now()
+
+	rows, err := sqlx.NamedQuery(tx, query, entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rate limit audit entry: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, fmt.Errorf("failed to get created rate limit audit entry")
+	}
+
+	var created entity.RateLimitAuditEntry
+	if err := rows.StructScan(&created); err != nil {
+		return nil, fmt.Errorf("failed to scan created rate limit audit entry: %w", err)
+	}
+
+	return &created, nil
+}
+
+// List returns the most recent audit entries, newest first; empty dimension or value match any
+func (r *rateLimitAuditRepository) List(dimension, value string, limit int) ([]entity.RateLimitAuditEntry, error) {
+	query := `
+		SELECT ` + rateLimitAuditColumns + `
+		FROM rate_limit_audit_log
+		WHERE ($1 = '' OR dimension = $1) AND ($2 = '' OR value = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`
+
+	entries := []entity.RateLimitAuditEntry{}
+	if err := r.db.Select(&entries, query, dimension, value, limit); err != nil {
+		return nil, fmt.Errorf("failed to list rate limit audit entries: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,279 @@
+package repository_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conformanceStart is aligned to the conformance window so aligned and anchored windows coincide
+var conformanceStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// conformancePolicy returns the limit the conformance suite runs with
+func conformancePolicy(algorithm string) config.RateLimitPolicy {
+	return config.RateLimitPolicy{Algorithm: algorithm, Limit: 3, Window: time.Minute}
+}
+
+// runRateLimitConformance checks the behavior every RateLimitRepository shares, for every
+// algorithm. newRepo returns an empty repository.
+func runRateLimitConformance(t *testing.T, newRepo func(t *testing.T) repository.RateLimitRepository) {
+	for _, algorithm := range config.RateLimitAlgorithms {
+		policy := conformancePolicy(algorithm)
+
+		t.Run(algorithm, func(t *testing.T) {
+			t.Run("AllowsUpToLimit", func(t *testing.T) {
+				repo := newRepo(t)
+
+				for remaining := policy.Limit - 1; remaining >= 0; remaining-- {
+					result, err := repo.Allow("+1234567890", policy, conformanceStart)
+					require.NoError(t, err)
+					assert.True(t, result.Allowed)
+					assert.Equal(t, policy.Limit, result.Limit)
+					assert.Equal(t, remaining, result.Remaining)
+					assert.True(t, result.RetryAt.IsZero())
+				}
+
+				result, err := repo.Allow("+1234567890", policy, conformanceStart)
+				require.NoError(t, err)
+				assert.False(t, result.Allowed)
+				assert.Equal(t, 0, result.Remaining)
+				assert.True(t, result.RetryAt.After(conformanceStart))
+				assert.False(t, result.RetryAt.After(conformanceStart.Add(2*policy.Window)))
+			})
+
+			t.Run("AllowsAgainAtRetryAt", func(t *testing.T) {
+				repo := newRepo(t)
+				exhaust(t, repo, policy, conformanceStart)
+
+				// Denied requests do not push the retry time back
+				var retryAt time.Time
+				for i := 0; i < 5; i++ {
+					result, err := repo.Allow("+1234567890", policy, conformanceStart.Add(time.Duration(i)*time.Second))
+					require.NoError(t, err)
+					require.False(t, result.Allowed)
+					if i > 0 {
+						assert.Equal(t, retryAt, result.RetryAt)
+					}
+					retryAt = result.RetryAt
+				}
+
+				result, err := repo.Allow("+1234567890", policy, retryAt.Add(-time.Millisecond))
+				require.NoError(t, err)
+				assert.False(t, result.Allowed)
+
+				result, err = repo.Allow("+1234567890", policy, retryAt)
+				require.NoError(t, err)
+				assert.True(t, result.Allowed)
+			})
+
+			t.Run("FullQuotaAtResetAt", func(t *testing.T) {
+				repo := newRepo(t)
+				resetAt := exhaust(t, repo, policy, conformanceStart)
+
+				for i := 0; i < policy.Limit; i++ {
+					result, err := repo.Allow("+1234567890", policy, resetAt)
+					require.NoError(t, err)
+					assert.True(t, result.Allowed, "request %d at reset time", i+1)
+				}
+			})
+
+			t.Run("PeekDoesNotCount", func(t *testing.T) {
+				repo := newRepo(t)
+
+				for i := 0; i < 2*policy.Limit; i++ {
+					result, err := repo.Peek("+1234567890", policy, conformanceStart)
+					require.NoError(t, err)
+					assert.True(t, result.Allowed)
+					assert.Equal(t, policy.Limit, result.Remaining)
+				}
+
+				exhaust(t, repo, policy, conformanceStart)
+
+				result, err := repo.Peek("+1234567890", policy, conformanceStart)
+				require.NoError(t, err)
+				assert.False(t, result.Allowed)
+			})
+
+			t.Run("KeysAreIndependent", func(t *testing.T) {
+				repo := newRepo(t)
+				exhaust(t, repo, policy, conformanceStart)
+
+				result, err := repo.Allow("+1987654321", policy, conformanceStart)
+				require.NoError(t, err)
+				assert.True(t, result.Allowed)
+			})
+
+			t.Run("NoBurstAcrossWindowBoundary", func(t *testing.T) {
+				repo := newRepo(t)
+
+				// One request opens the window, the rest of the quota is used just before it ends
+				_, err := repo.Allow("+1234567890", policy, conformanceStart)
+				require.NoError(t, err)
+				for i := 1; i < policy.Limit; i++ {
+					result, err := repo.Allow("+1234567890", policy, conformanceStart.Add(policy.Window-time.Millisecond))
+					require.NoError(t, err)
+					require.True(t, result.Allowed)
+				}
+
+				allowed := 0
+				for i := 0; i < policy.Limit; i++ {
+					result, err := repo.Allow("+1234567890", policy, conformanceStart.Add(policy.Window))
+					require.NoError(t, err)
+					if result.Allowed {
+						allowed++
+					}
+				}
+
+				if algorithm == config.RateLimitFixedWindow {
+					// The fixed window restores the whole quota at its boundary
+					assert.Equal(t, policy.Limit, allowed)
+				} else {
+					assert.LessOrEqual(t, allowed, 1)
+				}
+			})
+
+			t.Run("ConcurrentRequestsHoldLimit", func(t *testing.T) {
+				repo := newRepo(t)
+
+				var allowed atomic.Int32
+				var wg sync.WaitGroup
+				start := make(chan struct{})
+				for i := 0; i < 50; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						<-start
+
+						result, err := repo.Allow("+1234567890", policy, conformanceStart)
+						if assert.NoError(t, err) && result.Allowed {
+							allowed.Add(1)
+						}
+					}()
+				}
+				close(start)
+				wg.Wait()
+
+				assert.Equal(t, int32(policy.Limit), allowed.Load())
+			})
+		})
+	}
+
+	t.Run("ResetForgetsRequests", func(t *testing.T) {
+		repo := newRepo(t)
+		policy := conformancePolicy(config.RateLimitFixedWindow)
+		exhaust(t, repo, policy, conformanceStart)
+
+		require.NoError(t, repo.Reset("+1234567890"))
+
+		result, err := repo.Peek("+1234567890", policy, conformanceStart)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, policy.Limit, result.Remaining)
+	})
+
+	t.Run("OverridesByKeyUntilExpiry", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now()
+
+		override := &entity.RateLimitOverride{Limit: 10, ExpiresAt: now.Add(time.Hour)}
+		require.NoError(t, repo.SetOverride("+1234567890", override))
+
+		overrides, err := repo.GetOverrides([]string{"+1234567890", "+1987654321"}, now)
+		require.NoError(t, err)
+		require.Len(t, overrides, 1)
+		assert.Equal(t, 10, overrides["+1234567890"].Limit)
+		assert.WithinDuration(t, override.ExpiresAt, overrides["+1234567890"].ExpiresAt, time.Millisecond)
+
+		overrides, err = repo.GetOverrides([]string{"+1234567890"}, now.Add(2*time.Hour))
+		require.NoError(t, err)
+		assert.Empty(t, overrides, "expired overrides are ignored")
+
+		require.NoError(t, repo.DeleteOverride("+1234567890"))
+		overrides, err = repo.GetOverrides([]string{"+1234567890"}, now)
+		require.NoError(t, err)
+		assert.Empty(t, overrides)
+	})
+
+	t.Run(config.RateLimitSlidingLog+"/ExactOverEverySlidingWindow", func(t *testing.T) {
+		repo := newRepo(t)
+		policy := conformancePolicy(config.RateLimitSlidingLog)
+
+		// A request every 7s for 5 windows; no window may see more than the limit
+		var allowedAt []time.Time
+		for now := conformanceStart; now.Before(conformanceStart.Add(5 * policy.Window)); now = now.Add(7 * time.Second) {
+			result, err := repo.Allow("+1234567890", policy, now)
+			require.NoError(t, err)
+			if result.Allowed {
+				allowedAt = append(allowedAt, now)
+			}
+		}
+
+		for i := range allowedAt {
+			inWindow := 0
+			for _, at := range allowedAt[i:] {
+				if at.Sub(allowedAt[i]) < policy.Window {
+					inWindow++
+				}
+			}
+			assert.LessOrEqual(t, inWindow, policy.Limit, "window starting at %s", allowedAt[i].Format(time.TimeOnly))
+		}
+	})
+}
+
+// exhaust uses up the quota of +1234567890 at now and returns the reset time of the last request
+func exhaust(t *testing.T, repo repository.RateLimitRepository, policy config.RateLimitPolicy, now time.Time) time.Time {
+	t.Helper()
+
+	var resetAt time.Time
+	for i := 0; i < policy.Limit; i++ {
+		result, err := repo.Allow("+1234567890", policy, now)
+		require.NoError(t, err)
+		require.True(t, result.Allowed)
+		resetAt = result.ResetAt
+	}
+
+	return resetAt
+}
+
+// runRateLimitBenchmarks measures Allow for every algorithm on a single hot key and spread over many keys
+func runRateLimitBenchmarks(b *testing.B, newRepo func(b *testing.B) repository.RateLimitRepository) {
+	for _, algorithm := range config.RateLimitAlgorithms {
+		policy := config.RateLimitPolicy{Algorithm: algorithm, Limit: 100, Window: time.Minute}
+
+		b.Run(algorithm+"/HotKey", func(b *testing.B) {
+			repo := newRepo(b)
+			now := conformanceStart
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.Allow("+1234567890", policy, now.Add(time.Duration(i)*time.Millisecond)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(algorithm+"/ManyKeys", func(b *testing.B) {
+			repo := newRepo(b)
+			keys := make([]string, 1000)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("+1555%07d", i)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.Allow(keys[i%len(keys)], policy, conformanceStart); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,14 +1,26 @@
 package repository
 
 import (
+	"otp-auth/config"
 	"otp-auth/entity"
 	"time"
 )
 
 // RateLimitRepository interface defines rate limiting operations
-// This can be implemented by both PostgreSQL and MongoDB repositories
+// Implemented on Redis, PostgreSQL and in process memory; RATE_LIMIT_STORE selects one
 type RateLimitRepository interface {
-	GetRateLimit(phoneNumber string) (*entity.RateLimitInfo, error)
-	UpdateRateLimit(rateLimitInfo *entity.RateLimitInfo) error
+	// Allow atomically checks whether one more request for key fits the policy at now and
+	// counts it if so. Denied requests are not counted.
+	Allow(key string, policy config.RateLimitPolicy, now time.Time) (*entity.RateLimitResult, error)
+	// Peek reports what Allow would decide without counting the request
+	Peek(key string, policy config.RateLimitPolicy, now time.Time) (*entity.RateLimitResult, error)
+	// Reset forgets the requests counted for key
+	Reset(key string) error
+	// SetOverride replaces the limit of key until the override expires
+	SetOverride(key string, override *entity.RateLimitOverride) error
+	// GetOverrides returns the overrides in effect at now for any of keys, by key
+	GetOverrides(keys []string, now time.Time) (map[string]*entity.RateLimitOverride, error)
+	// DeleteOverride restores the configured limit of key
+	DeleteOverride(key string) error
 	CleanupRateLimits(olderThan time.Time) error
 }
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"otp-auth/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Every rate limit script takes the record key as KEYS[1] and
+// ARGV = now (unix ms), limit, window (ms), consume (0 or 1)[, request id].
+// It decides whether one more request fits, records it when consume is 1, and returns
+// {allowed (0 or 1), remaining, reset at (unix ms), retry at (unix ms, 0 when allowed)}.
+// The caller's clock drives the algorithms; key expiry only reclaims memory.
+
+// rateLimitScriptPrelude reads the arguments and drops records of another type, written by
+// a different algorithm or before algorithms were selectable
+const rateLimitScriptPrelude = `
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+local consume = tonumber(ARGV[4]) == 1
+
+local kind = redis.call('TYPE', key)['ok']
+if kind ~= 'none' and kind ~= RECORD_TYPE then
+	redis.call('DEL', key)
+end
+`
+
+// fixedWindowScript counts requests in a window that starts with the first request
+var fixedWindowScript = redis.NewScript(`local RECORD_TYPE = 'hash'` + rateLimitScriptPrelude + `
+local start = tonumber(redis.call('HGET', key, 'start'))
+local count = tonumber(redis.call('HGET', key, 'count')) or 0
+if not start or now >= start + window then
+	start = now
+	count = 0
+end
+
+local allowed = 0
+if count + 1 <= limit then
+	allowed = 1
+	if consume then
+		count = count + 1
+		redis.call('HSET', key, 'start', start, 'count', count)
+		redis.call('PEXPIRE', key, start + window - now)
+	end
+end
+
+local reset = now
+if count > 0 then
+	reset = start + window
+end
+
+local retry = 0
+if allowed == 0 then
+	retry = start + window
+end
+
+return {allowed, math.max(limit - count, 0), reset, retry}
+`)
+
+// slidingLogScript keeps the time of every request within the last window
+var slidingLogScript = redis.NewScript(`local RECORD_TYPE = 'zset'` + rateLimitScriptPrelude + `
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+
+local allowed = 0
+if count + 1 <= limit then
+	allowed = 1
+	if consume then
+		redis.call('ZADD', key, now, ARGV[5])
+		redis.call('PEXPIRE', key, window)
+		count = count + 1
+	end
+end
+
+local reset = now
+local newest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+if #newest > 0 then
+	reset = tonumber(newest[2]) + window
+end
+
+local retry = 0
+if allowed == 0 then
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	retry = tonumber(oldest[2]) + window
+end
+
+return {allowed, math.max(limit - count, 0), reset, retry}
+`)
+
+// slidingWindowScript counts requests in aligned windows and estimates the sliding count
+// by weighing the previous window with the share of it still inside the sliding window
+var slidingWindowScript = redis.NewScript(`local RECORD_TYPE = 'hash'` + rateLimitScriptPrelude + `
+local current_start = now - (now % window)
+local start = tonumber(redis.call('HGET', key, 'start'))
+local current = tonumber(redis.call('HGET', key, 'current')) or 0
+local previous = tonumber(redis.call('HGET', key, 'previous')) or 0
+if not start or start < current_start then
+	if start and start + window == current_start then
+		previous = current
+	else
+		previous = 0
+	end
+	current = 0
+end
+
+local weight = (window - (now - current_start)) / window
+local estimate = previous * weight + current
+
+-- Tolerance for rounding in the weighted estimate
+local epsilon = 1e-9
+
+local allowed = 0
+if estimate + 1 <= limit + epsilon then
+	allowed = 1
+	if consume then
+		current = current + 1
+		estimate = estimate + 1
+		redis.call('HSET', key, 'start', current_start, 'current', current, 'previous', previous)
+		redis.call('PEXPIRE', key, current_start + 2 * window - now)
+	end
+end
+
+local reset = now
+if current > 0 then
+	reset = current_start + 2 * window
+elseif previous > 0 then
+	reset = current_start + window
+end
+
+local retry = 0
+if allowed == 0 then
+	-- First time the weighted previous count leaves room for one more request
+	local room = limit - 1 - current
+	if room >= 0 and previous > 0 then
+		retry = math.ceil(current_start + window - window * room / previous)
+	else
+		retry = math.ceil(current_start + 2 * window - window * (limit - 1) / current)
+	end
+end
+
+return {allowed, math.max(math.floor(limit - estimate + epsilon), 0), reset, retry}
+`)
+
+// tokenBucketScript implements GCRA: requests are spaced one emission interval apart on a
+// theoretical arrival time (TAT) that may run at most limit intervals ahead of now. The
+// interval is rounded up to whole milliseconds so the arithmetic stays exact.
+var tokenBucketScript = redis.NewScript(`local RECORD_TYPE = 'string'` + rateLimitScriptPrelude + `
+local interval = math.ceil(window / limit)
+local burst = interval * limit
+
+local tat = tonumber(redis.call('GET', key)) or now
+if tat < now then
+	tat = now
+end
+
+local next_tat = tat + interval
+local allowed = 0
+if next_tat - now <= burst then
+	allowed = 1
+	if consume then
+		tat = next_tat
+		redis.call('SET', key, tat, 'PX', tat - now)
+	end
+end
+
+local retry = 0
+if allowed == 0 then
+	retry = next_tat - burst
+end
+
+return {allowed, math.floor((burst - (tat - now)) / interval), tat, retry}
+`)
+
+// rateLimitScripts maps each algorithm to its script
+var rateLimitScripts = map[string]*redis.Script{
+	config.RateLimitFixedWindow:   fixedWindowScript,
+	config.RateLimitSlidingLog:    slidingLogScript,
+	config.RateLimitSlidingWindow: slidingWindowScript,
+	config.RateLimitTokenBucket:   tokenBucketScript,
+}
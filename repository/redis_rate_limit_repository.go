@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/rand/v2"
+	"strconv"
 	"time"
 
 	"otp-auth/config"
@@ -31,94 +33,139 @@ func NewRedisRateLimitRepository(client *redis.Client, cfg *config.Config, logge
 	}
 }
 
-// GetRateLimit retrieves rate limit information for a phone number
-func (r *RedisRateLimitRepository) GetRateLimit(phoneNumber string) (*entity.RateLimitInfo, error) {
-	key := fmt.Sprintf("rate_limit:%s", phoneNumber)
-
-	// Use pipeline to get both data and TTL in one round trip
-	pipe := r.client.Pipeline()
-	dataCmd := pipe.Get(r.ctx, key)
-	ttlCmd := pipe.TTL(r.ctx, key)
-	_, err := pipe.Exec(r.ctx)
-
-	data, err := dataCmd.Result()
-	if err == redis.Nil {
-		// No existing rate limit record
-		r.logger.Debugw("No rate limit record found", "phone_number", phoneNumber)
-		return &entity.RateLimitInfo{
-			PhoneNumber:   phoneNumber,
-			RequestCount:  0,
-			LastRequestAt: time.Time{},
-			WindowStartAt: time.Time{},
-		}, nil
+// rateLimitKey returns the Redis key of a rate limit record
+func rateLimitKey(key string) string {
+	return fmt.Sprintf("rate_limit:%s", key)
+}
+
+// rateLimitOverrideKey returns the Redis key of a rate limit override
+func rateLimitOverrideKey(key string) string {
+	return fmt.Sprintf("rate_limit_override:%s", key)
+}
+
+// Allow checks and counts a request in a single round trip
+func (r *RedisRateLimitRepository) Allow(key string, policy config.RateLimitPolicy, now time.Time) (*entity.RateLimitResult, error) {
+	return r.run(key, policy, now, true)
+}
+
+// Peek checks a request without counting it
+func (r *RedisRateLimitRepository) Peek(key string, policy config.RateLimitPolicy, now time.Time) (*entity.RateLimitResult, error) {
+	return r.run(key, policy, now, false)
+}
+
+// run evaluates the policy's algorithm script, recording the request when consume is set
+func (r *RedisRateLimitRepository) run(key string, policy config.RateLimitPolicy, now time.Time, consume bool) (*entity.RateLimitResult, error) {
+	script, ok := rateLimitScripts[policy.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown rate limit algorithm: %s", policy.Algorithm)
+	}
+
+	consumeArg := 0
+	if consume {
+		consumeArg = 1
 	}
+
+	// The sliding log stores one member per request, so each needs a unique id
+	requestID := strconv.FormatInt(now.UnixNano(), 36) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+
+	values, err := script.Run(r.ctx, r.client, []string{rateLimitKey(key)},
+		now.UnixMilli(), policy.Limit, policy.Window.Milliseconds(), consumeArg, requestID).Int64Slice()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get rate limit info: %w", err)
+		return nil, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if len(values) != 4 {
+		return nil, fmt.Errorf("unexpected rate limit script result: %v", values)
 	}
 
-	var rateLimitInfo entity.RateLimitInfo
-	if err := json.Unmarshal([]byte(data), &rateLimitInfo); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal rate limit info: %w", err)
+	result := &entity.RateLimitResult{
+		Allowed:   values[0] == 1,
+		Limit:     policy.Limit,
+		Remaining: int(values[1]),
+		ResetAt:   time.UnixMilli(values[2]),
+	}
+	if !result.Allowed {
+		result.RetryAt = time.UnixMilli(values[3])
 	}
 
-	// Get TTL for logging
-	ttl, _ := ttlCmd.Result()
-	r.logger.Debugw("Rate limit retrieved",
-		"phone_number", phoneNumber,
-		"request_count", rateLimitInfo.RequestCount,
-		"ttl_seconds", int(ttl.Seconds()))
+	r.logger.Debugw("Rate limit checked",
+		"key", key,
+		"algorithm", policy.Algorithm,
+		"consume", consume,
+		"allowed", result.Allowed,
+		"remaining", result.Remaining)
 
-	return &rateLimitInfo, nil
+	return result, nil
 }
 
-// UpdateRateLimit updates rate limit information for a phone number
-func (r *RedisRateLimitRepository) UpdateRateLimit(rateLimitInfo *entity.RateLimitInfo) error {
-	key := fmt.Sprintf("rate_limit:%s", rateLimitInfo.PhoneNumber)
-
-	// Calculate TTL based on rate limit window duration from config
-	now := time.Now()
-	windowDuration := r.config.RateLimit.WindowDuration
-
-	// If this is a new rate limit window, set WindowStartAt
-	if rateLimitInfo.WindowStartAt.IsZero() {
-		rateLimitInfo.WindowStartAt = now
+// Reset deletes the rate limit record of key
+func (r *RedisRateLimitRepository) Reset(key string) error {
+	if err := r.client.Del(r.ctx, rateLimitKey(key)).Err(); err != nil {
+		return fmt.Errorf("failed to reset rate limit: %w", err)
 	}
 
-	// Calculate remaining time in the current window
-	windowEnd := rateLimitInfo.WindowStartAt.Add(windowDuration)
-	ttl := windowEnd.Sub(now)
+	return nil
+}
 
-	// Ensure TTL is positive and not less than 1 minute
+// SetOverride stores an override that Redis expires along with it
+func (r *RedisRateLimitRepository) SetOverride(key string, override *entity.RateLimitOverride) error {
+	ttl := time.Until(override.ExpiresAt)
 	if ttl <= 0 {
-		// Start a new window if current window has expired
-		rateLimitInfo.WindowStartAt = now
-		rateLimitInfo.RequestCount = 1
-		ttl = windowDuration
-		r.logger.Debugw("Starting new rate limit window",
-			"phone_number", rateLimitInfo.PhoneNumber,
-			"window_start", rateLimitInfo.WindowStartAt,
-			"ttl_seconds", int(ttl.Seconds()))
-	} else if ttl < time.Minute {
-		// Extend TTL to at least 1 minute for better cleanup
-		ttl = time.Minute
-	}
-
-	data, err := json.Marshal(rateLimitInfo)
+		return r.DeleteOverride(key)
+	}
+
+	data, err := json.Marshal(override)
 	if err != nil {
-		return fmt.Errorf("failed to marshal rate limit info: %w", err)
+		return fmt.Errorf("failed to marshal rate limit override: %w", err)
 	}
 
-	// Set the key with calculated TTL
-	err = r.client.Set(r.ctx, key, data, ttl).Err()
+	if err := r.client.Set(r.ctx, rateLimitOverrideKey(key), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set rate limit override: %w", err)
+	}
+
+	return nil
+}
+
+// GetOverrides reads the overrides of all keys in a single round trip
+func (r *RedisRateLimitRepository) GetOverrides(keys []string, now time.Time) (map[string]*entity.RateLimitOverride, error) {
+	overrides := make(map[string]*entity.RateLimitOverride)
+	if len(keys) == 0 {
+		return overrides, nil
+	}
+
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = rateLimitOverrideKey(key)
+	}
+
+	values, err := r.client.MGet(r.ctx, redisKeys...).Result()
 	if err != nil {
-		return fmt.Errorf("failed to update rate limit info: %w", err)
+		return nil, fmt.Errorf("failed to get rate limit overrides: %w", err)
+	}
+
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		var override entity.RateLimitOverride
+		if err := json.Unmarshal([]byte(data), &override); err != nil {
+			r.logger.Warnw("Ignoring malformed rate limit override", "key", keys[i], "error", err)
+			continue
+		}
+		if override.ExpiresAt.After(now) {
+			overrides[keys[i]] = &override
+		}
 	}
 
-	r.logger.Debugw("Rate limit updated with TTL",
-		"phone_number", rateLimitInfo.PhoneNumber,
-		"request_count", rateLimitInfo.RequestCount,
-		"ttl_seconds", int(ttl.Seconds()),
-		"expires_at", now.Add(ttl).Format(time.RFC3339))
+	return overrides, nil
+}
+
+// DeleteOverride deletes the override of key
+func (r *RedisRateLimitRepository) DeleteOverride(key string) error {
+	if err := r.client.Del(r.ctx, rateLimitOverrideKey(key)).Err(); err != nil {
+		return fmt.Errorf("failed to delete rate limit override: %w", err)
+	}
 
 	return nil
 }
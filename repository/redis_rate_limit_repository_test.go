@@ -0,0 +1,134 @@
+package repository_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/repository"
+	"otp-auth/test"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRedisRateLimitTestRepository wires a rate limit repository against an in-process Redis
+func newRedisRateLimitTestRepository(tb testing.TB) (repository.RateLimitRepository, *miniredis.Miniredis) {
+	mr := miniredis.RunT(tb)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	tb.Cleanup(func() { client.Close() })
+
+	cfg := &config.Config{
+		RateLimit: config.RateLimit{MaxRequests: 3, WindowDuration: 10 * time.Minute, Algorithm: config.RateLimitFixedWindow},
+	}
+
+	return repository.NewRedisRateLimitRepository(client, cfg, test.GetTestLogger()), mr
+}
+
+func TestRedisRateLimit_Conformance(t *testing.T) {
+	runRateLimitConformance(t, func(t *testing.T) repository.RateLimitRepository {
+		repo, _ := newRedisRateLimitTestRepository(t)
+		return repo
+	})
+}
+
+func BenchmarkRedisRateLimit_Allow(b *testing.B) {
+	runRateLimitBenchmarks(b, func(b *testing.B) repository.RateLimitRepository {
+		repo, _ := newRedisRateLimitTestRepository(b)
+		return repo
+	})
+}
+
+func TestRedisRateLimit_AllowConcurrentRequestsHoldLimit(t *testing.T) {
+	repo, _ := newRedisRateLimitTestRepository(t)
+	policy := config.RateLimitPolicy{Algorithm: config.RateLimitFixedWindow, Limit: 3, Window: 10 * time.Minute}
+
+	const workers = 50
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			// Real clock: the requests race on the same record
+			result, err := repo.Allow("+1234567890", policy, time.Now())
+			if !assert.NoError(t, err) {
+				return
+			}
+			if result.Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, int32(policy.Limit), allowed.Load())
+
+	result, err := repo.Peek("+1234567890", policy, time.Now())
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining, "denied requests must not be counted")
+}
+
+func TestRedisRateLimit_AllowReportsRemainingAndReset(t *testing.T) {
+	repo, _ := newRedisRateLimitTestRepository(t)
+	policy := config.RateLimitPolicy{Algorithm: config.RateLimitFixedWindow, Limit: 3, Window: 10 * time.Minute}
+
+	now := time.Now()
+	for remaining := 2; remaining >= 0; remaining-- {
+		result, err := repo.Allow("+1234567890", policy, now)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, remaining, result.Remaining)
+		assert.WithinDuration(t, now.Add(10*time.Minute), result.ResetAt, time.Millisecond)
+	}
+
+	result, err := repo.Allow("+1234567890", policy, now)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.WithinDuration(t, now.Add(10*time.Minute), result.RetryAt, time.Millisecond)
+}
+
+func TestRedisRateLimit_RecordsExpireWithWindow(t *testing.T) {
+	repo, mr := newRedisRateLimitTestRepository(t)
+
+	for _, algorithm := range config.RateLimitAlgorithms {
+		policy := config.RateLimitPolicy{Algorithm: algorithm, Limit: 3, Window: time.Minute}
+		_, err := repo.Allow(algorithm, policy, time.Now())
+		require.NoError(t, err)
+
+		ttl := mr.TTL("rate_limit:" + algorithm)
+		assert.True(t, ttl > 0 && ttl <= 2*time.Minute, "%s: ttl %s", algorithm, ttl)
+	}
+}
+
+func TestRedisRateLimit_AllowReplacesRecordOfOtherType(t *testing.T) {
+	repo, mr := newRedisRateLimitTestRepository(t)
+	policy := config.RateLimitPolicy{Algorithm: config.RateLimitSlidingLog, Limit: 3, Window: 10 * time.Minute}
+
+	// JSON record from before counters were atomic
+	require.NoError(t, mr.Set("rate_limit:+1234567890", `{"phone_number":"+1234567890","request_count":3}`))
+
+	result, err := repo.Allow("+1234567890", policy, time.Now())
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+
+	// Switching algorithms starts the key over rather than failing on the old record
+	policy.Algorithm = config.RateLimitFixedWindow
+	result, err = repo.Allow("+1234567890", policy, time.Now())
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+}
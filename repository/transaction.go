@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TxManager runs repository operations inside a single database transaction
+type TxManager interface {
+	WithinTransaction(fn func(tx *sqlx.Tx) error) error
+}
+
+// txManager implements TxManager interface
+type txManager struct {
+	db *sqlx.DB
+}
+
+// NewTxManager creates a new transaction manager instance
+func NewTxManager(db *sqlx.DB) TxManager {
+	return &txManager{
+		db: db,
+	}
+}
+
+// WithinTransaction commits when fn succeeds and rolls back otherwise
+func (m *txManager) WithinTransaction(fn func(tx *sqlx.Tx) error) error {
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
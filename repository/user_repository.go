@@ -19,6 +19,7 @@ type UserRepository interface {
 	Update(user *entity.User) (*entity.User, error)
 	List(page, pageSize int, search string) ([]entity.User, int, error)
 	UpdateLastLogin(phoneNumber string) error
+	UpsertByPhoneNumberTx(tx *sqlx.Tx, phoneNumber string) (*entity.User, bool, error)
 }
 
 // userRepository implements UserRepository interface
@@ -198,3 +199,32 @@ func (r *userRepository) UpdateLastLogin(phoneNumber string) error {
 
 	return nil
 }
+
+// UpsertByPhoneNumberTx registers a user or records a login for an existing one within the
+// caller's transaction, and reports whether the user was created. It returns nil for an
+// inactive user.
+func (r *userRepository) UpsertByPhoneNumberTx(tx *sqlx.Tx, phoneNumber string) (*entity.User, bool, error) {
+	// xmax is zero only for rows inserted by this statement
+	query := `
+		INSERT INTO users (phone_number, registered_at, last_login_at, is_active)
+		VALUES ($1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, TRUE)
+		ON CONFLICT (phone_number) DO UPDATE
+		SET last_login_at = EXCLUDED.last_login_at
+		WHERE users.is_active = TRUE
+		RETURNING id, phone_number, registered_at, last_login_at, is_active, (xmax = 0) AS inserted
+	`
+
+	var row struct {
+		entity.User
+		Inserted bool `db:"inserted"`
+	}
+	err := tx.Get(&row, query, phoneNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to upsert user: %w", err)
+	}
+
+	return &row.User, row.Inserted, nil
+}
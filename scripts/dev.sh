@@ -65,6 +65,10 @@ SWAGGER_ENABLED=true
 # Logger Configuration
 LOGGER_LEVEL=debug
 LOGGER_MODE=development
+
+# Application Environment
+APP_ENV=development
+DEV_INBOX_ENABLED=true
 EOF
     print_status "Created .env file with default values"
 fi
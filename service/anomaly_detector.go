@@ -0,0 +1,237 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/pkg/logger"
+	"otp-auth/repository"
+)
+
+// anomalyWebhookTimeout bounds each alert posted to the anomaly webhook
+const anomalyWebhookTimeout = 10 * time.Second
+
+// ErrSendingSuspended is returned when sends to a country calling code or from an IP are blocked
+var ErrSendingSuspended = errors.New("sending suspended")
+
+// SuspendedError reports the country calling code or IP whose sends are blocked
+type SuspendedError struct {
+	Dimension string
+	Value     string
+}
+
+// Error returns the suspension message
+func (e *SuspendedError) Error() string {
+	return fmt.Sprintf("%s for %s %s: verify conversion below threshold", ErrSendingSuspended, e.Dimension, e.Value)
+}
+
+// Unwrap returns ErrSendingSuspended
+func (e *SuspendedError) Unwrap() error {
+	return ErrSendingSuspended
+}
+
+// AnomalyDetector interface defines detection of SMS pumping from send-to-verify conversion
+type AnomalyDetector interface {
+	Restrictions(phoneNumber, clientIP string) []entity.AnomalyRestriction
+	Evaluate() error
+	Start(ctx context.Context)
+}
+
+// anomalyDetector implements AnomalyDetector interface. Conversion is read from the shared
+// conversion stats, so every instance reaches the same restrictions; they are swapped
+// atomically after each evaluation.
+type anomalyDetector struct {
+	otpRepo      repository.OTPRepository
+	restrictions atomic.Pointer[map[string]entity.AnomalyRestriction] // keyed by dimension:value
+	client       *http.Client
+	cfg          config.Anomaly
+	logger       *logger.Logger
+}
+
+// NewAnomalyDetector creates an anomaly detector; it restricts nothing until evaluated
+func NewAnomalyDetector(otpRepo repository.OTPRepository, cfg config.Anomaly, logger *logger.Logger) AnomalyDetector {
+	d := &anomalyDetector{
+		otpRepo: otpRepo,
+		client:  &http.Client{Timeout: anomalyWebhookTimeout},
+		cfg:     cfg,
+		logger:  logger,
+	}
+	d.restrictions.Store(&map[string]entity.AnomalyRestriction{})
+
+	return d
+}
+
+// Restrictions returns the throttles and blocks in effect for a send to phoneNumber from clientIP
+func (d *anomalyDetector) Restrictions(phoneNumber, clientIP string) []entity.AnomalyRestriction {
+	restrictions := *d.restrictions.Load()
+	if len(restrictions) == 0 {
+		return nil
+	}
+
+	var matched []entity.AnomalyRestriction
+	for _, key := range []string{
+		entity.RateLimitDimensionCountry + ":" + callingCode(phoneNumber),
+		entity.RateLimitDimensionIP + ":" + clientIP,
+	} {
+		if r, ok := restrictions[key]; ok && r.Action != config.AnomalyActionAlert {
+			matched = append(matched, r)
+		}
+	}
+
+	return matched
+}
+
+// Evaluate flags every country calling code and IP whose conversion over the window is below
+// the threshold, and alerts on those newly flagged or no longer flagged
+func (d *anomalyDetector) Evaluate() error {
+	now := time.Now()
+	previous := *d.restrictions.Load()
+
+	current := make(map[string]entity.AnomalyRestriction)
+	for _, dimension := range []string{entity.RateLimitDimensionCountry, entity.RateLimitDimensionIP} {
+		stats, err := d.otpRepo.GetConversionStats(dimension, now.Add(-d.cfg.Window), d.cfg.MinSends)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate %s conversion: %w", dimension, err)
+		}
+
+		for _, stat := range stats {
+			if stat.ConversionRate() >= d.cfg.MinConversionRate {
+				continue
+			}
+
+			key := dimension + ":" + stat.Key
+			detectedAt := now
+			if r, ok := previous[key]; ok {
+				detectedAt = r.DetectedAt
+			}
+			current[key] = entity.AnomalyRestriction{Dimension: dimension, Value: stat.Key, Action: d.cfg.Action, Stat: stat, DetectedAt: detectedAt}
+		}
+	}
+
+	d.restrictions.Store(&current)
+
+	for key, r := range current {
+		if _, ok := previous[key]; !ok {
+			d.alert(entity.AnomalyEventDetected, r, now)
+		}
+	}
+	for key, r := range previous {
+		if _, ok := current[key]; !ok {
+			d.alert(entity.AnomalyEventResolved, r, now)
+		}
+	}
+
+	return nil
+}
+
+// Start evaluates conversion right away and then every check interval until ctx is cancelled
+func (d *anomalyDetector) Start(ctx context.Context) {
+	if !d.cfg.Enabled {
+		return
+	}
+
+	d.logger.Infow("Starting anomaly detection", "window", d.cfg.Window, "min_sends", d.cfg.MinSends, "min_conversion_rate", d.cfg.MinConversionRate, "action", d.cfg.Action)
+
+	ticker := time.NewTicker(d.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Evaluate(); err != nil {
+			d.logger.Errorw("Failed to evaluate verify conversion, keeping the previous restrictions", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// alert logs a detected or resolved anomaly and posts it to the webhook when one is configured
+func (d *anomalyDetector) alert(event string, r entity.AnomalyRestriction, now time.Time) {
+	alert := entity.AnomalyAlert{
+		Event:          event,
+		Dimension:      r.Dimension,
+		Value:          r.Value,
+		Action:         r.Action,
+		Sent:           r.Stat.Sent,
+		Verified:       r.Stat.Verified,
+		ConversionRate: r.Stat.ConversionRate(),
+		Threshold:      d.cfg.MinConversionRate,
+		Window:         d.cfg.Window.String(),
+		At:             now,
+	}
+
+	if event == entity.AnomalyEventDetected {
+		d.logger.Warnw("Verify conversion collapsed, possible SMS pumping", "dimension", alert.Dimension, "value", alert.Value, "action", alert.Action, "sent", alert.Sent, "verified", alert.Verified, "conversion_rate", alert.ConversionRate)
+	} else {
+		d.logger.Infow("Verify conversion recovered", "dimension", alert.Dimension, "value", alert.Value, "action", alert.Action, "detected_at", r.DetectedAt)
+	}
+
+	if d.cfg.WebhookURL == "" {
+		return
+	}
+
+	if err := d.postAlert(alert); err != nil {
+		d.logger.Errorw("Failed to post anomaly alert", "event", event, "dimension", alert.Dimension, "value", alert.Value, "error", err)
+	}
+}
+
+// postAlert posts an alert to the anomaly webhook
+func (d *anomalyDetector) postAlert(alert entity.AnomalyAlert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal anomaly alert: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.cfg.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create anomaly alert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.cfg.WebhookAuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+d.cfg.WebhookAuthToken)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call anomaly webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("anomaly webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// anomalyRateLimitChecks returns a SuspendedError for a blocked send, otherwise the throttle
+// limits of its flagged country calling code and IP. Throttles are counted under their own
+// keys, apart from the regular limits of the same dimension.
+func anomalyRateLimitChecks(cfg *config.Config, restrictions []entity.AnomalyRestriction) ([]rateLimitCheck, error) {
+	var checks []rateLimitCheck
+	for _, r := range restrictions {
+		switch r.Action {
+		case config.AnomalyActionBlock:
+			return nil, &SuspendedError{Dimension: r.Dimension, Value: r.Value}
+		case config.AnomalyActionThrottle:
+			checks = append(checks, rateLimitCheck{
+				dimension: r.Dimension,
+				key:       "anomaly:" + rateLimitKey(r.Dimension, r.Value),
+				policy:    cfg.Anomaly.ThrottlePolicy(cfg.RateLimit.Algorithm),
+			})
+		}
+	}
+
+	return checks, nil
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/repository"
+	"otp-auth/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conversionStatsRepository serves fixed conversion stats per dimension
+type conversionStatsRepository struct {
+	repository.OTPRepository
+	stats map[string][]entity.ConversionStat
+}
+
+// GetConversionStats returns the stats of a dimension with at least minSent sessions
+func (r *conversionStatsRepository) GetConversionStats(dimension string, since time.Time, minSent int) ([]entity.ConversionStat, error) {
+	var stats []entity.ConversionStat
+	for _, stat := range r.stats[dimension] {
+		if stat.Sent >= minSent {
+			stats = append(stats, stat)
+		}
+	}
+	return stats, nil
+}
+
+// anomalyTestConfig flags keys with at least 20 sessions and under 20% verified
+func anomalyTestConfig(action string) config.Anomaly {
+	return config.Anomaly{
+		Enabled:             true,
+		Window:              time.Hour,
+		CheckInterval:       time.Minute,
+		MinSends:            20,
+		MinConversionRate:   0.2,
+		Action:              action,
+		ThrottleMaxRequests: 5,
+		ThrottleWindow:      10 * time.Minute,
+	}
+}
+
+func TestAnomalyDetector_FlagsCollapsedConversion(t *testing.T) {
+	repo := &conversionStatsRepository{stats: map[string][]entity.ConversionStat{
+		entity.RateLimitDimensionCountry: {
+			{Key: "+44", Sent: 200, Verified: 150},
+			{Key: "+882", Sent: 120, Verified: 3},
+			{Key: "+98", Sent: 10, Verified: 0}, // too few sessions to judge
+		},
+		entity.RateLimitDimensionIP: {
+			{Key: "203.0.113.7", Sent: 40, Verified: 1},
+		},
+	}}
+	detector := NewAnomalyDetector(repo, anomalyTestConfig(config.AnomalyActionBlock), test.GetTestLogger())
+
+	require.NoError(t, detector.Evaluate())
+
+	assert.Empty(t, detector.Restrictions("+447700900123", "198.51.100.1"))
+	assert.Empty(t, detector.Restrictions("+989121234567", ""))
+
+	restrictions := detector.Restrictions("+88216123456", "203.0.113.7")
+	require.Len(t, restrictions, 2)
+	assert.Equal(t, entity.RateLimitDimensionCountry, restrictions[0].Dimension)
+	assert.Equal(t, "+882", restrictions[0].Value)
+	assert.Equal(t, config.AnomalyActionBlock, restrictions[0].Action)
+	assert.Equal(t, entity.RateLimitDimensionIP, restrictions[1].Dimension)
+}
+
+func TestAnomalyDetector_AlertOnlyRestrictsNothing(t *testing.T) {
+	repo := &conversionStatsRepository{stats: map[string][]entity.ConversionStat{
+		entity.RateLimitDimensionCountry: {{Key: "+882", Sent: 120, Verified: 3}},
+	}}
+	detector := NewAnomalyDetector(repo, anomalyTestConfig(config.AnomalyActionAlert), test.GetTestLogger())
+
+	require.NoError(t, detector.Evaluate())
+	assert.Empty(t, detector.Restrictions("+88216123456", ""))
+}
+
+func TestAnomalyDetector_PostsDetectedAndResolvedAlerts(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		alerts []entity.AnomalyAlert
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer alert-token", r.Header.Get("Authorization"))
+
+		var alert entity.AnomalyAlert
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		mu.Lock()
+		alerts = append(alerts, alert)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	cfg := anomalyTestConfig(config.AnomalyActionThrottle)
+	cfg.WebhookURL = server.URL
+	cfg.WebhookAuthToken = "alert-token"
+
+	repo := &conversionStatsRepository{stats: map[string][]entity.ConversionStat{
+		entity.RateLimitDimensionCountry: {{Key: "+882", Sent: 120, Verified: 3}},
+	}}
+	detector := NewAnomalyDetector(repo, cfg, test.GetTestLogger())
+
+	// A key stays flagged without alerting again
+	require.NoError(t, detector.Evaluate())
+	require.NoError(t, detector.Evaluate())
+
+	repo.stats[entity.RateLimitDimensionCountry] = []entity.ConversionStat{{Key: "+882", Sent: 120, Verified: 60}}
+	require.NoError(t, detector.Evaluate())
+	assert.Empty(t, detector.Restrictions("+88216123456", ""))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, alerts, 2)
+	assert.Equal(t, entity.AnomalyEventDetected, alerts[0].Event)
+	assert.Equal(t, "+882", alerts[0].Value)
+	assert.Equal(t, config.AnomalyActionThrottle, alerts[0].Action)
+	assert.InDelta(t, 0.025, alerts[0].ConversionRate, 1e-9)
+	assert.Equal(t, 0.2, alerts[0].Threshold)
+	assert.Equal(t, entity.AnomalyEventResolved, alerts[1].Event)
+}
+
+func TestAnomalyRateLimitChecks(t *testing.T) {
+	cfg := &config.Config{
+		RateLimit: config.RateLimit{Algorithm: config.RateLimitSlidingWindow},
+		Anomaly:   anomalyTestConfig(config.AnomalyActionThrottle),
+	}
+
+	checks, err := anomalyRateLimitChecks(cfg, []entity.AnomalyRestriction{
+		{Dimension: entity.RateLimitDimensionCountry, Value: "+882", Action: config.AnomalyActionThrottle},
+	})
+	require.NoError(t, err)
+	if assert.Len(t, checks, 1) {
+		assert.Equal(t, entity.RateLimitDimensionCountry, checks[0].dimension)
+		assert.Equal(t, "anomaly:country:+882", checks[0].key)
+		assert.Equal(t, config.RateLimitPolicy{Algorithm: config.RateLimitSlidingWindow, Limit: 5, Window: 10 * time.Minute}, checks[0].policy)
+	}
+
+	_, err = anomalyRateLimitChecks(cfg, []entity.AnomalyRestriction{
+		{Dimension: entity.RateLimitDimensionCountry, Value: "+882", Action: config.AnomalyActionThrottle},
+		{Dimension: entity.RateLimitDimensionIP, Value: "203.0.113.7", Action: config.AnomalyActionBlock},
+	})
+	var suspendedErr *SuspendedError
+	require.True(t, errors.As(err, &suspendedErr))
+	assert.ErrorIs(t, err, ErrSendingSuspended)
+	assert.Equal(t, "203.0.113.7", suspendedErr.Value)
+}
+
+func TestSendAndVerify_CountConversion(t *testing.T) {
+	cfg := serviceTestConfig()
+	cfg.TestNumbers = config.TestNumbers{Numbers: []string{"+15005550*"}, Code: "000000"}
+	svc, repos := newServiceTestService(t, cfg)
+
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123", ClientIP: "203.0.113.7"})
+	sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900456", ClientIP: "203.0.113.7"})
+
+	// Counted as sent as soon as the sessions exist
+	stats, err := repos.otps.GetConversionStats(entity.RateLimitDimensionCountry, time.Now().Add(-time.Hour), 1)
+	require.NoError(t, err)
+	assert.Equal(t, []entity.ConversionStat{{Key: "+44", Sent: 2}}, stats)
+
+	_, err = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code})
+	require.NoError(t, err)
+
+	// Test numbers are neither sent nor verified
+	response, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+15005550006", ClientIP: "203.0.113.7"})
+	require.NoError(t, err)
+	_, err = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: response.Token, Code: "000000"})
+	require.NoError(t, err)
+
+	for dimension, key := range map[string]string{
+		entity.RateLimitDimensionCountry: "+44",
+		entity.RateLimitDimensionIP:      "203.0.113.7",
+	} {
+		stats, err := repos.otps.GetConversionStats(dimension, time.Now().Add(-time.Hour), 1)
+		require.NoError(t, err)
+		assert.Equal(t, []entity.ConversionStat{{Key: key, Sent: 2, Verified: 1}}, stats, dimension)
+	}
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"otp-auth/pkg/logger"
+)
+
+// consoleSender prints OTP messages to stdout, intended for local development
+type consoleSender struct {
+	logger *logger.Logger
+}
+
+// NewConsoleSender creates a sender that prints codes to the console
+func NewConsoleSender(logger *logger.Logger) Sender {
+	return &consoleSender{
+		logger: logger,
+	}
+}
+
+// Name returns the provider name
+func (s *consoleSender) Name() string {
+	return "console"
+}
+
+// Send prints the OTP to the console
+func (s *consoleSender) Send(ctx context.Context, msg *Message) (*SendResult, error) {
+	fmt.Printf("🔐 OTP for %s: %s (expires at %s)\n", msg.PhoneNumber, msg.Code, msg.ExpiresAt.Format("15:04:05"))
+	return &SendResult{}, nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/pkg/logger"
+	"otp-auth/pkg/metrics"
+	"otp-auth/repository"
+)
+
+// Delivery receipt errors
+var (
+	ErrInvalidSignature = errors.New("invalid delivery receipt signature")
+	ErrUnknownMessage   = errors.New("unknown provider message ID")
+)
+
+// DeliveryReceiptService interface defines delivery receipt operations
+type DeliveryReceiptService interface {
+	VerifySignature(timestamp, signature string, body []byte) error
+	HandleReceipt(req *entity.DeliveryReceiptRequest) error
+}
+
+// deliveryReceiptService implements DeliveryReceiptService interface
+type deliveryReceiptService struct {
+	otpRepo     repository.OTPRepository
+	receiptRepo repository.DeliveryReceiptRepository
+	outboxRepo  repository.OutboxRepository
+	cfg         *config.Config
+	logger      *logger.Logger
+}
+
+// NewDeliveryReceiptService creates a new delivery receipt service instance
+func NewDeliveryReceiptService(otpRepo repository.OTPRepository, receiptRepo repository.DeliveryReceiptRepository, outboxRepo repository.OutboxRepository, cfg *config.Config, logger *logger.Logger) DeliveryReceiptService {
+	return &deliveryReceiptService{
+		otpRepo:     otpRepo,
+		receiptRepo: receiptRepo,
+		outboxRepo:  outboxRepo,
+		cfg:         cfg,
+		logger:      logger,
+	}
+}
+
+// VerifySignature checks the hex HMAC-SHA256 of "<timestamp>.<body>" against the shared secret
+func (s *deliveryReceiptService) VerifySignature(timestamp, signature string, body []byte) error {
+	if s.cfg.DeliveryReceipts.Secret == "" || timestamp == "" || signature == "" {
+		return ErrInvalidSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	skew := time.Since(time.Unix(unix, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > s.cfg.DeliveryReceipts.MaxSkew {
+		return fmt.Errorf("%w: timestamp outside allowed window", ErrInvalidSignature)
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.cfg.DeliveryReceipts.Secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// HandleReceipt stores a receipt and updates the delivery state of the matching OTP.
+// A failed delivery brings the fallback over the next channel forward.
+func (s *deliveryReceiptService) HandleReceipt(req *entity.DeliveryReceiptRequest) error {
+	otp, err := s.otpRepo.GetByProviderMessageID(req.MessageID)
+	if err != nil {
+		s.logger.Errorw("Failed to correlate delivery receipt", "provider_message_id", req.MessageID, "error", err)
+		return fmt.Errorf("failed to correlate delivery receipt: %w", err)
+	}
+
+	if otp == nil {
+		s.logger.Warnw("Delivery receipt for unknown message", "provider_message_id", req.MessageID, "status", req.Status)
+		return ErrUnknownMessage
+	}
+
+	status := normalizeDeliveryStatus(req.Status)
+
+	var errorCode *string
+	if req.ErrorCode != "" {
+		errorCode = &req.ErrorCode
+	}
+
+	_, err = s.receiptRepo.Create(&entity.DeliveryReceipt{
+		OTPID:             &otp.ID,
+		ProviderMessageID: req.MessageID,
+		Status:            status,
+		ProviderStatus:    req.Status,
+		ErrorCode:         errorCode,
+		ReportedAt:        req.Timestamp,
+	})
+	if err != nil {
+		s.logger.Errorw("Failed to store delivery receipt", "otp_id", otp.ID, "provider_message_id", req.MessageID, "error", err)
+		return fmt.Errorf("failed to store delivery receipt: %w", err)
+	}
+
+	// Receipts for earlier fallback attempts only count when they confirm delivery
+	latest := otp.ProviderMessageID != nil && *otp.ProviderMessageID == req.MessageID
+	if latest || status == entity.DeliveryStatusDelivered {
+		if err := s.otpRepo.UpdateDeliveryStatus(otp.ID, status, "", ""); err != nil {
+			s.logger.Errorw("Failed to update OTP delivery status", "otp_id", otp.ID, "status", status, "error", err)
+			return fmt.Errorf("failed to update OTP delivery status: %w", err)
+		}
+	}
+
+	// A failed delivery need not wait out the confirmation timeout before the next channel
+	if latest && status == entity.DeliveryStatusFailed {
+		if err := s.outboxRepo.ReleasePending(otp.ID); err != nil {
+			s.logger.Errorw("Failed to release fallback delivery", "otp_id", otp.ID, "error", err)
+			return fmt.Errorf("failed to release fallback delivery: %w", err)
+		}
+	}
+
+	metrics.IncDeliveryReceipt(status)
+	s.logger.Infow("Delivery receipt processed",
+		"otp_id", otp.ID,
+		"phone_number", otp.PhoneNumber,
+		"provider_message_id", req.MessageID,
+		"status", status,
+		"provider_status", req.Status,
+		"error_code", req.ErrorCode)
+
+	return nil
+}
+
+// toDeliveryStatusResponse converts an OTP and its receipts to the API representation
+func toDeliveryStatusResponse(otp *entity.OTP, receipts []entity.DeliveryReceipt) *entity.DeliveryStatusResponse {
+	response := &entity.DeliveryStatusResponse{
+		Status:      otp.DeliveryStatus,
+		UpdatedAt:   otp.DeliveryUpdatedAt,
+		DeliveredAt: otp.DeliveredAt,
+		Receipts:    make([]entity.DeliveryReceiptStatus, len(receipts)),
+	}
+	if otp.DeliveryChannel != nil {
+		response.Channel = *otp.DeliveryChannel
+	}
+
+	for i, receipt := range receipts {
+		response.Receipts[i] = entity.DeliveryReceiptStatus{
+			Status:     receipt.Status,
+			ErrorCode:  receipt.ErrorCode,
+			ReportedAt: receipt.ReportedAt,
+			ReceivedAt: receipt.ReceivedAt,
+		}
+	}
+
+	return response
+}
+
+// normalizeDeliveryStatus maps gateway-specific states (including SMPP stat values) to ours
+func normalizeDeliveryStatus(status string) string {
+	switch strings.ToUpper(strings.TrimSpace(status)) {
+	case "DELIVERED", "DELIVRD":
+		return entity.DeliveryStatusDelivered
+	case "FAILED", "UNDELIVERED", "UNDELIV", "REJECTED", "REJECTD", "EXPIRED", "DELETED", "UNKNOWN":
+		return entity.DeliveryStatusFailed
+	case "SENT", "ACCEPTED", "ACCEPTD", "ENROUTE":
+		return entity.DeliveryStatusSent
+	default:
+		return entity.DeliveryStatusQueued
+	}
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signReceipt returns the hex HMAC-SHA256 a gateway sends with a receipt
+func signReceipt(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestDeliveryReceiptService_VerifySignature(t *testing.T) {
+	cfg := &config.Config{DeliveryReceipts: config.DeliveryReceipts{Secret: "dlr-secret", MaxSkew: 5 * time.Minute}}
+	svc := NewDeliveryReceiptService(nil, nil, nil, cfg, test.GetTestLogger())
+
+	body := []byte(`{"message_id":"gw-1","status":"DELIVRD"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	at := func(offset time.Duration) string {
+		return strconv.FormatInt(time.Now().Add(offset).Unix(), 10)
+	}
+
+	cases := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      []byte
+		valid     bool
+	}{
+		{name: "valid", timestamp: now, signature: signReceipt("dlr-secret", now, body), body: body, valid: true},
+		{name: "valid with scheme prefix", timestamp: now, signature: "sha256=" + signReceipt("dlr-secret", now, body), body: body, valid: true},
+		{name: "valid within skew in the past", timestamp: at(-4 * time.Minute), signature: signReceipt("dlr-secret", at(-4*time.Minute), body), body: body, valid: true},
+		{name: "valid within skew in the future", timestamp: at(4 * time.Minute), signature: signReceipt("dlr-secret", at(4*time.Minute), body), body: body, valid: true},
+		{name: "wrong secret", timestamp: now, signature: signReceipt("other-secret", now, body), body: body},
+		{name: "tampered body", timestamp: now, signature: signReceipt("dlr-secret", now, body), body: []byte(`{"message_id":"gw-1","status":"UNDELIV"}`)},
+		{name: "signed for another timestamp", timestamp: now, signature: signReceipt("dlr-secret", at(-time.Minute), body), body: body},
+		{name: "non-hex signature", timestamp: now, signature: "not-a-signature", body: body},
+		{name: "empty signature", timestamp: now, signature: "", body: body},
+		{name: "empty timestamp", timestamp: "", signature: signReceipt("dlr-secret", "", body), body: body},
+		{name: "non-numeric timestamp", timestamp: "yesterday", signature: signReceipt("dlr-secret", "yesterday", body), body: body},
+		{name: "too old", timestamp: at(-6 * time.Minute), signature: signReceipt("dlr-secret", at(-6*time.Minute), body), body: body},
+		{name: "too far in the future", timestamp: at(6 * time.Minute), signature: signReceipt("dlr-secret", at(6*time.Minute), body), body: body},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := svc.VerifySignature(c.timestamp, c.signature, c.body)
+			if c.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestDeliveryReceiptService_VerifySignatureWithoutSecret(t *testing.T) {
+	svc := NewDeliveryReceiptService(nil, nil, nil, &config.Config{DeliveryReceipts: config.DeliveryReceipts{MaxSkew: 5 * time.Minute}}, test.GetTestLogger())
+
+	body := []byte(`{"message_id":"gw-1","status":"DELIVRD"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	assert.ErrorIs(t, svc.VerifySignature(now, signReceipt("", now, body), body), ErrInvalidSignature)
+}
+
+// newReceiptTestService wires a receipt service against the repositories of a worker test service
+func newReceiptTestService(repos *serviceTestRepositories, cfg *config.Config) DeliveryReceiptService {
+	return NewDeliveryReceiptService(repos.otps, repos.receipts, repos.outbox, cfg, test.GetTestLogger())
+}
+
+// deliverFirst sends an OTP, delivers it over SMS and returns the session token and provider message ID
+func deliverFirst(t *testing.T, svc *otpService, repos *serviceTestRepositories, worker *OutboxWorker) (string, string) {
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	worker.deliver(context.Background(), claimOne(t, repos))
+
+	otp := sessionByToken(t, repos, token)
+	require.Equal(t, entity.DeliveryStatusSent, otp.DeliveryStatus)
+	require.NotNil(t, otp.ProviderMessageID)
+	return token, *otp.ProviderMessageID
+}
+
+func TestDeliveryReceiptService_UnknownMessage(t *testing.T) {
+	_, repos := newServiceTestService(t, serviceTestConfig())
+	receipts := newReceiptTestService(repos, serviceTestConfig())
+
+	err := receipts.HandleReceipt(&entity.DeliveryReceiptRequest{MessageID: "gw-unknown", Status: "DELIVRD"})
+	assert.ErrorIs(t, err, ErrUnknownMessage)
+	assert.Empty(t, repos.receipts.receipts)
+}
+
+func TestDeliveryReceiptService_DeliveredSuppressesFallback(t *testing.T) {
+	cfg := workerTestConfig()
+	svc, repos, worker, senders := newWorkerTestService(t, cfg)
+	token, messageID := deliverFirst(t, svc, repos, worker)
+
+	reportedAt := time.Now().Add(-time.Second)
+	require.NoError(t, newReceiptTestService(repos, cfg).HandleReceipt(&entity.DeliveryReceiptRequest{MessageID: messageID, Status: "DELIVRD", Timestamp: &reportedAt}))
+
+	otp := sessionByToken(t, repos, token)
+	assert.Equal(t, entity.DeliveryStatusDelivered, otp.DeliveryStatus)
+
+	stored, err := repos.receipts.ListByOTPID(otp.ID)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.Equal(t, entity.DeliveryStatusDelivered, stored[0].Status)
+	assert.Equal(t, "DELIVRD", stored[0].ProviderStatus)
+	assert.Equal(t, &reportedAt, stored[0].ReportedAt)
+
+	// The voice fallback queued at send time is dropped when it comes due
+	messages := repos.outbox.forOTP(otp.ID)
+	require.Len(t, messages, 2)
+	fallback := messages[1]
+	worker.deliver(context.Background(), &fallback)
+	assert.Empty(t, senders[ChannelVoice].sent())
+	assert.Equal(t, entity.OutboxStatusSkipped, repos.outbox.forOTP(otp.ID)[1].Status)
+
+	// A later failure report does not undo the delivery
+	require.NoError(t, newReceiptTestService(repos, cfg).HandleReceipt(&entity.DeliveryReceiptRequest{MessageID: messageID, Status: "UNDELIV"}))
+	assert.Equal(t, entity.DeliveryStatusDelivered, sessionByToken(t, repos, token).DeliveryStatus)
+}
+
+func TestDeliveryReceiptService_FailedReleasesFallback(t *testing.T) {
+	cfg := workerTestConfig()
+	svc, repos, worker, senders := newWorkerTestService(t, cfg)
+	token, messageID := deliverFirst(t, svc, repos, worker)
+
+	// The fallback waits for the confirmation timeout
+	claimed, err := repos.outbox.ClaimDue(10, time.Minute)
+	require.NoError(t, err)
+	require.Empty(t, claimed)
+
+	require.NoError(t, newReceiptTestService(repos, cfg).HandleReceipt(&entity.DeliveryReceiptRequest{MessageID: messageID, Status: "UNDELIV", ErrorCode: "001"}))
+
+	otp := sessionByToken(t, repos, token)
+	assert.Equal(t, entity.DeliveryStatusFailed, otp.DeliveryStatus)
+	stored, err := repos.receipts.ListByOTPID(otp.ID)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	require.NotNil(t, stored[0].ErrorCode)
+	assert.Equal(t, "001", *stored[0].ErrorCode)
+
+	// and goes out over voice right away once delivery is reported failed
+	fallback := claimOne(t, repos)
+	assert.Equal(t, ChannelVoice, fallback.Channel)
+	worker.deliver(context.Background(), fallback)
+	require.Len(t, senders[ChannelVoice].sent(), 1)
+	assert.Equal(t, entity.DeliveryStatusSent, sessionByToken(t, repos, token).DeliveryStatus)
+}
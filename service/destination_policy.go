@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/pkg/logger"
+	"otp-auth/repository"
+)
+
+// ErrDestinationNotAllowed is returned when the destination policy refuses a phone number
+var ErrDestinationNotAllowed = errors.New("destination not allowed")
+
+// destinationPrefixPattern matches a "+" followed by the leading digits of E.164 numbers
+var destinationPrefixPattern = regexp.MustCompile(`^\+[1-9]\d{0,14}$`)
+
+// DestinationError reports the rule that refused a phone number
+type DestinationError struct {
+	Prefix string // prefix of the matching deny rule; empty when the number matches no allow rule
+}
+
+// Error returns the destination message
+func (e *DestinationError) Error() string {
+	if e.Prefix == "" {
+		return fmt.Sprintf("%s: not on the allow list", ErrDestinationNotAllowed)
+	}
+	return fmt.Sprintf("%s: prefix %s is denied", ErrDestinationNotAllowed, e.Prefix)
+}
+
+// Unwrap returns ErrDestinationNotAllowed
+func (e *DestinationError) Unwrap() error {
+	return ErrDestinationNotAllowed
+}
+
+// DestinationPolicy interface defines the allow and deny rules OTP destinations are checked against
+type DestinationPolicy interface {
+	Check(phoneNumber string) error
+	Reload() error
+	Start(ctx context.Context)
+}
+
+// destinationRules is a compiled rule set; the longest matching prefix decides
+type destinationRules struct {
+	actions   map[string]string // prefix -> allow or deny
+	allowList bool              // numbers matching no rule are denied when any allow rule exists
+}
+
+// destinationPolicy implements DestinationPolicy interface. Rules are swapped atomically on
+// reload so sends never wait on it.
+type destinationPolicy struct {
+	load   func() ([]entity.DestinationRule, error)
+	rules  atomic.Pointer[destinationRules]
+	cfg    config.DestinationPolicy
+	logger *logger.Logger
+}
+
+// NewDestinationPolicy loads the configured rules. With no source every destination is allowed.
+func NewDestinationPolicy(cfg config.DestinationPolicy, repo repository.DestinationRuleRepository, logger *logger.Logger) (DestinationPolicy, error) {
+	p := &destinationPolicy{
+		cfg:    cfg,
+		logger: logger,
+	}
+
+	switch cfg.Source {
+	case config.DestinationPolicySourceFile:
+		p.load = func() ([]entity.DestinationRule, error) {
+			return loadDestinationRuleFile(cfg.File)
+		}
+	case config.DestinationPolicySourceDB:
+		p.load = repo.List
+	default:
+		p.load = func() ([]entity.DestinationRule, error) {
+			return nil, nil
+		}
+	}
+
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Check returns a DestinationError when the rules refuse the phone number
+func (p *destinationPolicy) Check(phoneNumber string) error {
+	rules := p.rules.Load()
+
+	for end := len(phoneNumber); end > 1; end-- {
+		prefix := phoneNumber[:end]
+		switch rules.actions[prefix] {
+		case entity.DestinationRuleAllow:
+			return nil
+		case entity.DestinationRuleDeny:
+			return &DestinationError{Prefix: prefix}
+		}
+	}
+
+	if rules.allowList {
+		return &DestinationError{}
+	}
+
+	return nil
+}
+
+// Reload reads and compiles the rules, keeping the current rules when they are invalid
+func (p *destinationPolicy) Reload() error {
+	list, err := p.load()
+	if err != nil {
+		return fmt.Errorf("failed to load destination rules: %w", err)
+	}
+
+	rules, err := compileDestinationRules(list)
+	if err != nil {
+		return err
+	}
+
+	previous := p.rules.Swap(rules)
+	if previous == nil || !reflect.DeepEqual(previous.actions, rules.actions) {
+		p.logger.Infow("Destination rules loaded", "source", p.cfg.Source, "rules", len(rules.actions), "allow_list", rules.allowList)
+	}
+
+	return nil
+}
+
+// Start reloads the rules every reload interval until ctx is cancelled
+func (p *destinationPolicy) Start(ctx context.Context) {
+	if !p.cfg.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(p.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Reload(); err != nil {
+				p.logger.Errorw("Failed to reload destination rules, keeping the previous rules", "source", p.cfg.Source, "error", err)
+			}
+		}
+	}
+}
+
+// compileDestinationRules validates the rules and indexes them by prefix
+func compileDestinationRules(list []entity.DestinationRule) (*destinationRules, error) {
+	rules := &destinationRules{actions: make(map[string]string, len(list))}
+
+	for _, rule := range list {
+		if !destinationPrefixPattern.MatchString(rule.Prefix) {
+			return nil, fmt.Errorf("destination rule %q: prefix must be + followed by up to 15 digits", rule.Prefix)
+		}
+		if _, exists := rules.actions[rule.Prefix]; exists {
+			return nil, fmt.Errorf("duplicate destination rule %s", rule.Prefix)
+		}
+
+		switch rule.Action {
+		case entity.DestinationRuleAllow:
+			rules.allowList = true
+		case entity.DestinationRuleDeny:
+		default:
+			return nil, fmt.Errorf("destination rule %s: action must be allow or deny", rule.Prefix)
+		}
+
+		rules.actions[rule.Prefix] = rule.Action
+	}
+
+	return rules, nil
+}
+
+// loadDestinationRuleFile reads the rules from a JSON array file
+func loadDestinationRuleFile(path string) ([]entity.DestinationRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read destination rules file: %w", err)
+	}
+
+	var rules []entity.DestinationRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse destination rules file: %w", err)
+	}
+
+	return rules, nil
+}
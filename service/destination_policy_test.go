@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFileDestinationPolicy writes rules to a temporary file and loads a policy from it
+func newFileDestinationPolicy(t *testing.T, rules string) (DestinationPolicy, string) {
+	path := filepath.Join(t.TempDir(), "destinations.json")
+	require.NoError(t, os.WriteFile(path, []byte(rules), 0o600))
+
+	cfg := config.DestinationPolicy{Source: config.DestinationPolicySourceFile, File: path, ReloadInterval: time.Minute}
+	policy, err := NewDestinationPolicy(cfg, nil, test.GetTestLogger())
+	require.NoError(t, err)
+
+	return policy, path
+}
+
+func TestDestinationPolicy_LongestPrefixDecides(t *testing.T) {
+	policy, _ := newFileDestinationPolicy(t, `[
+		{"prefix": "+44", "action": "allow"},
+		{"prefix": "+44909", "action": "deny", "note": "premium rate"},
+		{"prefix": "+449098", "action": "allow"},
+		{"prefix": "+1", "action": "allow"}
+	]`)
+
+	cases := map[string]string{
+		"+447700900123": "",
+		"+449091234567": "+44909",
+		"+449098123456": "",
+		"+14155550123":  "",
+		"+989121234567": "unlisted",
+	}
+
+	for phoneNumber, denied := range cases {
+		err := policy.Check(phoneNumber)
+		if denied == "" {
+			assert.NoError(t, err, phoneNumber)
+			continue
+		}
+
+		var destinationErr *DestinationError
+		require.True(t, errors.As(err, &destinationErr), phoneNumber)
+		assert.ErrorIs(t, err, ErrDestinationNotAllowed)
+		if denied == "unlisted" {
+			assert.Empty(t, destinationErr.Prefix, phoneNumber)
+		} else {
+			assert.Equal(t, denied, destinationErr.Prefix, phoneNumber)
+		}
+	}
+}
+
+func TestDestinationPolicy_DenyRulesAloneAllowEverythingElse(t *testing.T) {
+	policy, _ := newFileDestinationPolicy(t, `[{"prefix": "+882", "action": "deny"}]`)
+
+	assert.ErrorIs(t, policy.Check("+88216123456"), ErrDestinationNotAllowed)
+	assert.NoError(t, policy.Check("+447700900123"))
+}
+
+func TestDestinationPolicy_NoSourceAllowsEverything(t *testing.T) {
+	cfg := config.DestinationPolicy{Source: config.DestinationPolicySourceNone, ReloadInterval: time.Minute}
+	policy, err := NewDestinationPolicy(cfg, nil, test.GetTestLogger())
+	require.NoError(t, err)
+
+	assert.NoError(t, policy.Check("+88216123456"))
+}
+
+func TestDestinationPolicy_ReloadKeepsRulesWhenInvalid(t *testing.T) {
+	policy, path := newFileDestinationPolicy(t, `[{"prefix": "+882", "action": "deny"}]`)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"prefix": "+44", "action": "allow"}]`), 0o600))
+	require.NoError(t, policy.Reload())
+	assert.ErrorIs(t, policy.Check("+14155550123"), ErrDestinationNotAllowed)
+	assert.NoError(t, policy.Check("+447700900123"))
+
+	for _, invalid := range []string{
+		`not json`,
+		`[{"prefix": "44", "action": "deny"}]`,
+		`[{"prefix": "+44", "action": "block"}]`,
+		`[{"prefix": "+44", "action": "deny"}, {"prefix": "+44", "action": "allow"}]`,
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(invalid), 0o600))
+		assert.Error(t, policy.Reload(), invalid)
+		assert.NoError(t, policy.Check("+447700900123"), "previous rules stay in force after %s", invalid)
+	}
+}
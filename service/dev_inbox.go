@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"otp-auth/entity"
+)
+
+// DevInbox interface defines an in-memory store of delivered OTP messages for local
+// development and end-to-end tests
+type DevInbox interface {
+	Record(msg *Message)
+	Messages(phoneNumber string) []entity.DevInboxMessage
+}
+
+// devInbox keeps the most recent messages per phone number
+type devInbox struct {
+	mu       sync.Mutex
+	size     int
+	messages map[string][]entity.DevInboxMessage
+}
+
+// NewDevInbox creates a dev inbox keeping up to size messages per phone number
+func NewDevInbox(size int) DevInbox {
+	return &devInbox{
+		size:     size,
+		messages: make(map[string][]entity.DevInboxMessage),
+	}
+}
+
+// Record stores a delivered message, dropping the oldest one when the phone number's inbox is full
+func (i *devInbox) Record(msg *Message) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	messages := append(i.messages[msg.PhoneNumber], entity.DevInboxMessage{
+		Channel:    msg.Channel,
+		Email:      msg.Email,
+		Code:       msg.Code,
+		Body:       msg.Body,
+		ExpiresAt:  msg.ExpiresAt,
+		ReceivedAt: time.Now(),
+	})
+	if len(messages) > i.size {
+		messages = messages[len(messages)-i.size:]
+	}
+	i.messages[msg.PhoneNumber] = messages
+}
+
+// Messages returns the messages recorded for a phone number, newest first
+func (i *devInbox) Messages(phoneNumber string) []entity.DevInboxMessage {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	stored := i.messages[phoneNumber]
+	messages := make([]entity.DevInboxMessage, 0, len(stored))
+	for j := len(stored) - 1; j >= 0; j-- {
+		messages = append(messages, stored[j])
+	}
+	return messages
+}
+
+// devInboxSender keeps messages in the dev inbox instead of delivering them
+type devInboxSender struct {
+	inbox DevInbox
+}
+
+// Name returns the provider name
+func (s *devInboxSender) Name() string {
+	return "dev_inbox"
+}
+
+// Send records the message in the dev inbox
+func (s *devInboxSender) Send(ctx context.Context, msg *Message) (*SendResult, error) {
+	s.inbox.Record(msg)
+	return &SendResult{}, nil
+}
+
+// NewDevInboxSenders creates a sender per channel that keeps messages in the dev inbox, in place
+// of the configured providers
+func NewDevInboxSenders(channels []string, inbox DevInbox) map[string]Sender {
+	senders := make(map[string]Sender, len(channels))
+	for _, channel := range channels {
+		senders[channel] = &devInboxSender{inbox: inbox}
+	}
+	return senders
+}
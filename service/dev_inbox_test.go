@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"otp-auth/entity"
+	"otp-auth/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevInbox_RecordsInsteadOfDelivering(t *testing.T) {
+	cfg := workerTestConfig()
+	svc, repos := newServiceTestService(t, cfg)
+	inbox := NewDevInbox(10)
+	worker := NewOutboxWorker(repos.outbox, repos.otps, NewDevInboxSenders(cfg.Delivery.Channels, inbox), cfg, test.GetTestLogger())
+
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	otpID := sessionByToken(t, repos, token).ID
+	_, body := sentPayload(t, repos, otpID)
+
+	worker.deliver(context.Background(), claimOne(t, repos))
+
+	// The rendered message is kept and the delivery counts as sent
+	messages := inbox.Messages("+447700900123")
+	require.Len(t, messages, 1)
+	assert.Equal(t, ChannelSMS, messages[0].Channel)
+	assert.Equal(t, code, messages[0].Code)
+	assert.Equal(t, body, messages[0].Body)
+	assert.Equal(t, entity.OutboxStatusSent, repos.outbox.forOTP(otpID)[0].Status)
+	assert.Empty(t, inbox.Messages("+447700900456"))
+}
+
+func TestDevInbox_NewestFirstWithinSize(t *testing.T) {
+	inbox := NewDevInbox(3)
+	for i := 1; i <= 5; i++ {
+		inbox.Record(&Message{Channel: ChannelSMS, PhoneNumber: "+447700900123", Code: fmt.Sprintf("00000%d", i), ExpiresAt: time.Now().Add(time.Minute)})
+	}
+	inbox.Record(&Message{Channel: ChannelSMS, PhoneNumber: "+447700900456", Code: "999999"})
+
+	messages := inbox.Messages("+447700900123")
+	require.Len(t, messages, 3)
+	for i, code := range []string{"000005", "000004", "000003"} {
+		assert.Equal(t, code, messages[i].Code)
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fallbackTestConfig returns a worker test configuration with an SMS, voice and messaging app chain
+func fallbackTestConfig() *config.Config {
+	cfg := workerTestConfig()
+	cfg.Delivery.Channels = []string{ChannelSMS, ChannelVoice, ChannelMessagingApp}
+	return cfg
+}
+
+func TestFallbackChain_AfterDeadLetter(t *testing.T) {
+	cfg := fallbackTestConfig()
+	cfg.Outbox.MaxAttempts = 1
+	svc, repos, worker, senders := newWorkerTestService(t, cfg)
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	otpID := sessionByToken(t, repos, token).ID
+
+	senders[ChannelSMS].send = func(msg *Message) error {
+		return fmt.Errorf("gateway rejected")
+	}
+	before := time.Now()
+	worker.deliver(context.Background(), claimOne(t, repos))
+
+	// The next channel is queued right away with the same sealed code
+	messages := repos.outbox.forOTP(otpID)
+	require.Len(t, messages, 2)
+	assert.Equal(t, entity.OutboxStatusDead, messages[0].Status)
+	fallback := messages[1]
+	assert.Equal(t, ChannelVoice, fallback.Channel)
+	assert.Equal(t, ChannelMessagingApp, fallback.FallbackChannels)
+	assert.Equal(t, entity.OutboxStatusPending, fallback.Status)
+	assert.False(t, fallback.NextAttemptAt.Before(before))
+	assert.False(t, fallback.NextAttemptAt.After(time.Now()))
+
+	// The OTP is not reported failed while channels remain
+	assert.Equal(t, entity.DeliveryStatusQueued, sessionByToken(t, repos, token).DeliveryStatus)
+
+	worker.deliver(context.Background(), claimOne(t, repos))
+	sent := senders[ChannelVoice].sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, code, sent[0].Code)
+}
+
+func TestFallbackChain_AfterConfirmationTimeout(t *testing.T) {
+	cfg := fallbackTestConfig()
+	svc, repos, worker, senders := newWorkerTestService(t, cfg)
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	otpID := sessionByToken(t, repos, token).ID
+
+	// Each hop delivers over the next channel and passes on the rest of the chain
+	for hop, want := range []struct {
+		channel   string
+		fallbacks string
+	}{
+		{channel: ChannelSMS, fallbacks: "voice,messaging_app"},
+		{channel: ChannelVoice, fallbacks: "messaging_app"},
+		{channel: ChannelMessagingApp, fallbacks: ""},
+	} {
+		msg := claimOne(t, repos)
+		require.Equal(t, want.channel, msg.Channel, "hop %d", hop)
+		assert.Equal(t, want.fallbacks, msg.FallbackChannels, "hop %d", hop)
+
+		sentAt := time.Now()
+		worker.deliver(context.Background(), msg)
+		sent := senders[want.channel].sent()
+		require.Len(t, sent, 1, "hop %d", hop)
+		assert.Equal(t, code, sent[0].Code)
+
+		messages := repos.outbox.forOTP(otpID)
+		if want.fallbacks == "" {
+			assert.Len(t, messages, hop+1, "the chain ends with the last channel")
+			break
+		}
+
+		// The next channel waits for the confirmation timeout
+		require.Len(t, messages, hop+2)
+		next := messages[hop+1]
+		assert.False(t, next.NextAttemptAt.Before(sentAt.Add(cfg.Delivery.ConfirmationTimeout)), "hop %d", hop)
+		claimed, err := repos.outbox.ClaimDue(10, time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, claimed, "hop %d", hop)
+
+		// No receipt or verification arrives in time
+		require.NoError(t, repos.outbox.ReleasePending(otpID))
+	}
+
+	otp := sessionByToken(t, repos, token)
+	require.NotNil(t, otp.DeliveryChannel)
+	assert.Equal(t, ChannelMessagingApp, *otp.DeliveryChannel)
+}
+
+func TestFallbackChain_SuppressedByVerification(t *testing.T) {
+	svc, repos, worker, senders := newWorkerTestService(t, fallbackTestConfig())
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	otpID := sessionByToken(t, repos, token).ID
+
+	worker.deliver(context.Background(), claimOne(t, repos))
+	require.Len(t, repos.outbox.forOTP(otpID), 2)
+
+	_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code})
+	require.NoError(t, err)
+
+	// The queued fallback is dropped and nothing further goes out
+	require.NoError(t, repos.outbox.ReleasePending(otpID))
+	claimed, err := repos.outbox.ClaimDue(10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+	assert.Equal(t, entity.OutboxStatusSkipped, repos.outbox.forOTP(otpID)[1].Status)
+	assert.Empty(t, senders[ChannelVoice].sent())
+}
+
+func TestFallbackChain_SuppressedByConfirmedDelivery(t *testing.T) {
+	svc, repos, worker, senders := newWorkerTestService(t, fallbackTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	otpID := sessionByToken(t, repos, token).ID
+
+	worker.deliver(context.Background(), claimOne(t, repos))
+	require.NoError(t, repos.otps.UpdateDeliveryStatus(otpID, entity.DeliveryStatusDelivered, "", ""))
+
+	require.NoError(t, repos.outbox.ReleasePending(otpID))
+	worker.deliver(context.Background(), claimOne(t, repos))
+
+	assert.Empty(t, senders[ChannelVoice].sent())
+	messages := repos.outbox.forOTP(otpID)
+	require.Len(t, messages, 2, "the rest of the chain is not queued")
+	assert.Equal(t, entity.OutboxStatusSkipped, messages[1].Status)
+}
+
+func TestFallbackChain_StopsAtExpiry(t *testing.T) {
+	cfg := fallbackTestConfig()
+	cfg.Delivery.ConfirmationTimeout = 5 * time.Minute // beyond the 2 minute OTP lifetime
+	svc, repos, worker, senders := newWorkerTestService(t, cfg)
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	worker.deliver(context.Background(), claimOne(t, repos))
+	require.Len(t, senders[ChannelSMS].sent(), 1)
+
+	// A fallback that could only go out after the code expired is not queued
+	assert.Len(t, repos.outbox.forOTP(sessionByToken(t, repos, token).ID), 1)
+}
+
+func TestFallbackChain_DeadLetterAfterExpiry(t *testing.T) {
+	svc, repos, worker, senders := newWorkerTestService(t, fallbackTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	// The code expires while a failing provider call is in flight
+	msg := claimOne(t, repos)
+	msg.ExpiresAt = time.Now().Add(20 * time.Millisecond)
+	senders[ChannelSMS].send = func(msg *Message) error {
+		time.Sleep(30 * time.Millisecond)
+		return fmt.Errorf("gateway timeout")
+	}
+	worker.deliver(context.Background(), msg)
+
+	// The message is given up without retry and the chain stops there
+	messages := repos.outbox.forOTP(sessionByToken(t, repos, token).ID)
+	require.Len(t, messages, 1)
+	assert.Equal(t, entity.OutboxStatusDead, messages[0].Status)
+}
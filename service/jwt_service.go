@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"slices"
 	"time"
 
 	"otp-auth/config"
@@ -15,13 +16,18 @@ import (
 
 // JWTService interface defines JWT operations
 type JWTService interface {
-	GenerateToken(user *entity.User) (*entity.AuthResponse, error)
+	GenerateToken(user *entity.User, testNumber bool) (*entity.AuthResponse, error)
 	ValidateToken(tokenString string) (*jwt.Token, error)
 	GetUserFromToken(token *jwt.Token) (*entity.User, error)
 	RevokeToken(tokenString string) error
 	RevokeAllUserTokens(userID int) error
+	GenerateConfirmationToken(confirmation *entity.Confirmation) (*entity.ConfirmationResponse, error)
+	ValidateConfirmationToken(tokenString string) (*ConfirmationClaims, error)
 }
 
+// confirmationAudience marks confirmation tokens so they cannot be used as login tokens
+const confirmationAudience = "otp-confirmation"
+
 // jwtService implements JWTService interface
 type jwtService struct {
 	cfg          *config.Config
@@ -33,6 +39,16 @@ type jwtService struct {
 type JWTClaims struct {
 	UserID      int    `json:"user_id"`
 	PhoneNumber string `json:"phone_number"`
+	TestNumber  bool   `json:"test_number,omitempty"` // signed in with a configured test phone number
+	jwt.RegisteredClaims
+}
+
+// ConfirmationClaims represents the claims of a signed OTP confirmation
+type ConfirmationClaims struct {
+	Purpose     string `json:"purpose"`
+	PhoneNumber string `json:"phone_number"`
+	PayloadHash string `json:"payload_hash,omitempty"`
+	TestNumber  bool   `json:"test_number,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -45,13 +61,14 @@ func NewJWTService(cfg *config.Config, logger *logger.Logger, tokenService *Toke
 	}
 }
 
-// GenerateToken generates a JWT token for the user
-func (s *jwtService) GenerateToken(user *entity.User) (*entity.AuthResponse, error) {
+// GenerateToken generates a JWT token for the user; testNumber flags a sign-in with a test phone number
+func (s *jwtService) GenerateToken(user *entity.User, testNumber bool) (*entity.AuthResponse, error) {
 	expiresAt := time.Now().Add(s.cfg.JWT.ExpirationTime)
 
 	claims := JWTClaims{
 		UserID:      user.ID,
 		PhoneNumber: user.PhoneNumber,
+		TestNumber:  testNumber,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -85,7 +102,7 @@ func (s *jwtService) GenerateToken(user *entity.User) (*entity.AuthResponse, err
 		}
 	}
 
-	s.logger.Infow("JWT token generated", "user_id", user.ID, "expires_at", expiresAt)
+	s.logger.Infow("JWT token generated", "user_id", user.ID, "expires_at", expiresAt, "test_number", testNumber)
 
 	userResponse := &entity.UserResponse{
 		ID:           user.ID,
@@ -122,6 +139,11 @@ func (s *jwtService) ValidateToken(tokenString string) (*jwt.Token, error) {
 		return nil, fmt.Errorf("invalid token")
 	}
 
+	// Confirmations are signed with the same secret but do not authenticate a user
+	if claims, ok := token.Claims.(*JWTClaims); ok && slices.Contains(claims.Audience, confirmationAudience) {
+		return nil, fmt.Errorf("invalid token: confirmation tokens cannot be used for authentication")
+	}
+
 	// Verify token exists in Redis if token service is available
 	if s.tokenService != nil {
 		tokenHash := s.hashToken(tokenString)
@@ -170,6 +192,69 @@ func (s *jwtService) RevokeAllUserTokens(userID int) error {
 	return s.tokenService.RevokeAllUserTokens(userID)
 }
 
+// GenerateConfirmationToken signs a confirmation of a verified non-login OTP. The token ID
+// identifies the OTP session so consumers can reject a confirmation used twice.
+func (s *jwtService) GenerateConfirmationToken(confirmation *entity.Confirmation) (*entity.ConfirmationResponse, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.cfg.JWT.ConfirmationExpirationTime)
+
+	claims := ConfirmationClaims{
+		Purpose:     confirmation.Purpose,
+		PhoneNumber: confirmation.PhoneNumber,
+		PayloadHash: confirmation.PayloadHash,
+		TestNumber:  confirmation.TestNumber,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "otp-auth-service",
+			Subject:   fmt.Sprintf("phone:%s", confirmation.PhoneNumber),
+			Audience:  jwt.ClaimStrings{confirmationAudience},
+			ID:        fmt.Sprintf("otp:%d", confirmation.SessionID),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(s.cfg.JWT.Secret))
+	if err != nil {
+		s.logger.Errorw("Failed to sign confirmation token", "otp_id", confirmation.SessionID, "error", err)
+		return nil, fmt.Errorf("failed to generate confirmation token: %w", err)
+	}
+
+	s.logger.Infow("Confirmation token generated", "otp_id", confirmation.SessionID, "purpose", confirmation.Purpose, "expires_at", expiresAt)
+
+	return &entity.ConfirmationResponse{
+		ConfirmationToken: tokenString,
+		Purpose:           confirmation.Purpose,
+		PhoneNumber:       confirmation.PhoneNumber,
+		PayloadHash:       confirmation.PayloadHash,
+		ExpiresAt:         expiresAt,
+		Message:           "Confirmation successful",
+	}, nil
+}
+
+// ValidateConfirmationToken validates a confirmation token and returns its claims
+func (s *jwtService) ValidateConfirmationToken(tokenString string) (*ConfirmationClaims, error) {
+	claims := &ConfirmationClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(s.cfg.JWT.Secret), nil
+	}, jwt.WithAudience(confirmationAudience))
+
+	if err != nil {
+		s.logger.Warnw("Failed to validate confirmation token", "error", err)
+		return nil, fmt.Errorf("invalid confirmation token: %w", err)
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid confirmation token")
+	}
+
+	return claims, nil
+}
+
 // hashToken creates a hash of the token for storage in Redis
 func (s *jwtService) hashToken(token string) string {
 	hash := sha256.Sum256([]byte(token))
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"otp-auth/entity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sendMagicLink starts a login session with a magic link and returns its session token, code and link token
+func sendMagicLink(t *testing.T, svc *otpService, repos *serviceTestRepositories) (string, string, string) {
+	response, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123", MagicLink: true})
+	require.NoError(t, err)
+
+	code, body := sentPayload(t, repos, sessionByToken(t, repos, response.Token).ID)
+	return response.Token, code, magicLinkToken(t, body)
+}
+
+func TestMagicLinkToken_Signature(t *testing.T) {
+	token, err := newMagicLinkToken("link-key")
+	require.NoError(t, err)
+
+	nonce, signature, ok := strings.Cut(token, ".")
+	require.True(t, ok)
+	assert.Len(t, nonce, 32) // 24 random bytes in unpadded base64url
+	assert.NotContains(t, token, "=")
+	assert.True(t, magicLinkSignatureValid("link-key", token))
+
+	other, err := newMagicLinkToken("link-key")
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+
+	for _, forged := range []string{
+		"",
+		nonce,
+		"." + signature,
+		nonce + ".",
+		nonce + "." + signature + "x",
+		"x" + nonce + "." + signature,
+	} {
+		assert.False(t, magicLinkSignatureValid("link-key", forged), forged)
+	}
+	assert.False(t, magicLinkSignatureValid("other-key", token))
+}
+
+func TestSendOTP_MagicLink(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+
+	response, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123", MagicLink: true})
+	require.NoError(t, err)
+
+	otp := sessionByToken(t, repos, response.Token)
+	code, body := sentPayload(t, repos, otp.ID)
+
+	// The code stays in the message and the link follows it on its own line
+	lines := strings.Split(body, "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], code)
+	require.True(t, strings.HasPrefix(lines[1], "https://auth.example.com/api/v1/otp/magic-link/"), lines[1])
+
+	linkToken := magicLinkToken(t, body)
+	assert.True(t, magicLinkSignatureValid(serviceTestConfig().JWT.Secret, linkToken))
+	require.NotNil(t, otp.LinkToken)
+	assert.Equal(t, hashSecret(serviceTestPepper, linkToken), *otp.LinkToken)
+}
+
+func TestSendOTP_WithoutMagicLink(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+
+	response, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	require.NoError(t, err)
+
+	otp := sessionByToken(t, repos, response.Token)
+	_, body := sentPayload(t, repos, otp.ID)
+	assert.NotContains(t, body, magicLinkPath)
+	assert.Nil(t, otp.LinkToken)
+}
+
+func TestSendOTP_MagicLinkUnavailable(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+
+	// Only login codes carry links
+	_, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123", MagicLink: true, Purpose: entity.PurposePhoneChange})
+	assert.ErrorIs(t, err, ErrMagicLinkUnavailable)
+
+	// Links are disabled without a base URL
+	cfg := serviceTestConfig()
+	cfg.MagicLink.BaseURL = ""
+	disabled, _ := newServiceTestService(t, cfg)
+	_, err = disabled.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123", MagicLink: true})
+	assert.ErrorIs(t, err, ErrMagicLinkUnavailable)
+
+	assert.Empty(t, repos.otps.all())
+}
+
+func TestVerifyMagicLink_SingleUse(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _, linkToken := sendMagicLink(t, svc, repos)
+
+	result, err := svc.VerifyMagicLink(linkToken)
+	require.NoError(t, err)
+	require.NotNil(t, result.User)
+	assert.Equal(t, "+447700900123", result.User.PhoneNumber)
+	assert.True(t, sessionByToken(t, repos, token).IsUsed)
+
+	_, err = svc.VerifyMagicLink(linkToken)
+	assert.ErrorIs(t, err, ErrInvalidOTP)
+}
+
+func TestVerifyMagicLink_Expired(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _, linkToken := sendMagicLink(t, svc, repos)
+	repos.otps.set(t, sessionByToken(t, repos, token).ID, func(otp *entity.OTP) {
+		otp.ExpiresAt = time.Now().Add(-time.Second)
+	})
+
+	_, err := svc.VerifyMagicLink(linkToken)
+	assert.ErrorIs(t, err, ErrInvalidOTP)
+	assert.False(t, sessionByToken(t, repos, token).IsUsed)
+}
+
+func TestVerifyMagicLink_Forged(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _, linkToken := sendMagicLink(t, svc, repos)
+
+	// A validly signed link that was never issued, and the issued one signed with another key
+	unissued, err := newMagicLinkToken(serviceTestConfig().JWT.Secret)
+	require.NoError(t, err)
+	nonce, _, _ := strings.Cut(linkToken, ".")
+
+	for _, forged := range []string{unissued, nonce + "." + signMagicLinkNonce("other-key", nonce), "not-a-link"} {
+		_, err := svc.VerifyMagicLink(forged)
+		assert.ErrorIs(t, err, ErrInvalidOTP, forged)
+	}
+	assert.False(t, sessionByToken(t, repos, token).IsUsed)
+}
+
+func TestVerifyMagicLink_ThenCode(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, code, linkToken := sendMagicLink(t, svc, repos)
+
+	_, err := svc.VerifyMagicLink(linkToken)
+	require.NoError(t, err)
+
+	_, err = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code})
+	assert.ErrorIs(t, err, ErrInvalidOTP)
+}
+
+func TestVerifyOTP_ThenMagicLink(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, code, linkToken := sendMagicLink(t, svc, repos)
+
+	_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code})
+	require.NoError(t, err)
+
+	_, err = svc.VerifyMagicLink(linkToken)
+	assert.ErrorIs(t, err, ErrInvalidOTP)
+}
+
+func TestVerifyMagicLink_AfterWrongCodes(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, code, linkToken := sendMagicLink(t, svc, repos)
+
+	// Wrong codes leave the link usable while attempts remain, and the link uses none
+	_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: wrongCode(code)})
+	require.ErrorIs(t, err, ErrInvalidOTP)
+
+	_, err = svc.VerifyMagicLink(linkToken)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sessionByToken(t, repos, token).Attempts)
+}
+
+func TestVerifyMagicLink_BurnedSession(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, code, linkToken := sendMagicLink(t, svc, repos)
+
+	for i := 0; i < 3; i++ {
+		_, _ = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: wrongCode(code)})
+	}
+
+	_, err := svc.VerifyMagicLink(linkToken)
+	assert.ErrorIs(t, err, ErrSessionLocked)
+	assert.False(t, sessionByToken(t, repos, token).IsUsed)
+}
+
+func TestVerifyMagicLink_CancelledSession(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _, linkToken := sendMagicLink(t, svc, repos)
+
+	require.NoError(t, svc.CancelSession(token))
+
+	_, err := svc.VerifyMagicLink(linkToken)
+	assert.ErrorIs(t, err, ErrInvalidOTP)
+}
+
+func TestVerifyMagicLink_ReplacedOnResend(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _, oldLink := sendMagicLink(t, svc, repos)
+	passCooldown(t, repos, token)
+
+	_, err := svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+	require.NoError(t, err)
+
+	_, body := sentPayload(t, repos, sessionByToken(t, repos, token).ID)
+	newLink := magicLinkToken(t, body)
+	require.NotEqual(t, oldLink, newLink)
+
+	_, err = svc.VerifyMagicLink(oldLink)
+	assert.ErrorIs(t, err, ErrInvalidOTP)
+
+	_, err = svc.VerifyMagicLink(newLink)
+	assert.NoError(t, err)
+}
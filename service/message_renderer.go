@@ -0,0 +1,235 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/repository"
+)
+
+// Unicode directional marks used to lay out right-to-left messages
+const (
+	leftToRightMark = "\u200e"
+	rightToLeftMark = "\u200f"
+)
+
+// rtlLanguages lists the base languages written right to left
+var rtlLanguages = map[string]bool{
+	"ar":  true,
+	"ckb": true,
+	"dv":  true,
+	"fa":  true,
+	"he":  true,
+	"ps":  true,
+	"ur":  true,
+	"yi":  true,
+}
+
+// MessageData holds the values available to message templates
+type MessageData struct {
+	Code          string
+	ExpiryMinutes int
+	AppName       string
+}
+
+// MessageRenderer interface defines OTP message rendering operations
+type MessageRenderer interface {
+	Render(locale, purpose string, data MessageData) (string, error)
+	ResolveLocale(preferences string) string
+	Locales() []string
+}
+
+// messageRenderer implements MessageRenderer interface
+type messageRenderer struct {
+	templates     map[string]map[string]*template.Template // locale -> purpose -> template
+	defaultLocale string
+}
+
+// templateFuncs are the helpers available to message templates
+var templateFuncs = template.FuncMap{
+	// ltr keeps codes and other left-to-right runs intact inside right-to-left text
+	"ltr": func(s string) string {
+		return leftToRightMark + s + leftToRightMark
+	},
+}
+
+// NewMessageRenderer parses and validates the templates. Every purpose must have
+// a template in the default locale so any request can be rendered.
+func NewMessageRenderer(templates []entity.MessageTemplate, defaultLocale string, purposes []string) (MessageRenderer, error) {
+	r := &messageRenderer{
+		templates:     make(map[string]map[string]*template.Template),
+		defaultLocale: normalizeLocale(defaultLocale),
+	}
+
+	sample := MessageData{Code: "123456", ExpiryMinutes: 2, AppName: "App"}
+	for _, t := range templates {
+		locale := normalizeLocale(t.Locale)
+		name := locale + "/" + t.Purpose
+
+		tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(t.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse message template %s: %w", name, err)
+		}
+
+		var out strings.Builder
+		if err := tmpl.Execute(&out, sample); err != nil {
+			return nil, fmt.Errorf("failed to execute message template %s: %w", name, err)
+		}
+		if !strings.Contains(out.String(), sample.Code) {
+			return nil, fmt.Errorf("message template %s does not include the code", name)
+		}
+
+		if r.templates[locale] == nil {
+			r.templates[locale] = make(map[string]*template.Template)
+		}
+		r.templates[locale][t.Purpose] = tmpl
+	}
+
+	for _, purpose := range purposes {
+		if r.templates[r.defaultLocale][purpose] == nil {
+			return nil, fmt.Errorf("missing message template for default locale %s and purpose %s", r.defaultLocale, purpose)
+		}
+	}
+
+	return r, nil
+}
+
+// Render renders the message for a purpose, falling back from the regional locale
+// to its base language and then to the default locale
+func (r *messageRenderer) Render(locale, purpose string, data MessageData) (string, error) {
+	locale = normalizeLocale(locale)
+
+	var tmpl *template.Template
+	for _, candidate := range []string{locale, baseLanguage(locale), r.defaultLocale} {
+		if tmpl = r.templates[candidate][purpose]; tmpl != nil {
+			locale = candidate
+			break
+		}
+	}
+	if tmpl == nil {
+		return "", fmt.Errorf("no message template for purpose %s", purpose)
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render message template: %w", err)
+	}
+
+	body := strings.TrimSpace(out.String())
+
+	// Set the paragraph direction explicitly: the first strong character may be
+	// Latin (e.g. the app name), which would make handsets lay the text out LTR
+	if rtlLanguages[baseLanguage(locale)] && !strings.HasPrefix(body, rightToLeftMark) {
+		body = rightToLeftMark + body
+	}
+
+	return body, nil
+}
+
+// ResolveLocale picks the best supported locale from a locale or an Accept-Language value
+func (r *messageRenderer) ResolveLocale(preferences string) string {
+	type preference struct {
+		locale string
+		q      float64
+	}
+
+	var prefs []preference
+	for _, part := range strings.Split(preferences, ",") {
+		fields := strings.Split(part, ";")
+		locale := normalizeLocale(fields[0])
+		if locale == "" || locale == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, preference{locale: locale, q: q})
+		}
+	}
+
+	sort.SliceStable(prefs, func(i, j int) bool {
+		return prefs[i].q > prefs[j].q
+	})
+
+	for _, pref := range prefs {
+		if r.templates[pref.locale] != nil {
+			return pref.locale
+		}
+		if base := baseLanguage(pref.locale); r.templates[base] != nil {
+			return base
+		}
+	}
+
+	return r.defaultLocale
+}
+
+// Locales returns the locales that have at least one template
+func (r *messageRenderer) Locales() []string {
+	locales := make([]string, 0, len(r.templates))
+	for locale := range r.templates {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// LoadMessageTemplates reads the templates from the configured source
+func LoadMessageTemplates(cfg *config.Config, repo repository.MessageTemplateRepository) ([]entity.MessageTemplate, error) {
+	switch cfg.Messages.Source {
+	case "db":
+		return repo.List()
+	case "", "file":
+		return loadMessageTemplateFiles(cfg.Messages.Dir)
+	default:
+		return nil, fmt.Errorf("unknown message template source: %s", cfg.Messages.Source)
+	}
+}
+
+// loadMessageTemplateFiles reads templates laid out as <dir>/<locale>/<purpose>.tmpl
+func loadMessageTemplateFiles(dir string) ([]entity.MessageTemplate, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message templates: %w", err)
+	}
+
+	templates := make([]entity.MessageTemplate, 0, len(paths))
+	for _, path := range paths {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read message template %s: %w", path, err)
+		}
+
+		templates = append(templates, entity.MessageTemplate{
+			Locale:  filepath.Base(filepath.Dir(path)),
+			Purpose: strings.TrimSuffix(filepath.Base(path), ".tmpl"),
+			Body:    string(body),
+		})
+	}
+
+	return templates, nil
+}
+
+// normalizeLocale lower-cases a locale tag and uses "-" as the separator (fa_IR -> fa-ir)
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// baseLanguage returns the language subtag of a locale (fa-ir -> fa)
+func baseLanguage(locale string) string {
+	base, _, _ := strings.Cut(locale, "-")
+	return base
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"otp-auth/entity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newShippedMessageRenderer loads the templates shipped in templates/messages
+func newShippedMessageRenderer(t *testing.T) MessageRenderer {
+	templates, err := loadMessageTemplateFiles("../templates/messages")
+	require.NoError(t, err)
+	require.NotEmpty(t, templates)
+
+	renderer, err := NewMessageRenderer(templates, "en", entity.Purposes)
+	require.NoError(t, err)
+	return renderer
+}
+
+func TestMessageRenderer_RightToLeftLocales(t *testing.T) {
+	renderer := newShippedMessageRenderer(t)
+	data := MessageData{Code: "042917", ExpiryMinutes: 2, AppName: "Acme"}
+
+	for _, locale := range []string{"fa", "ar"} {
+		for _, purpose := range entity.Purposes {
+			body, err := renderer.Render(locale, purpose, data)
+			require.NoError(t, err, locale+"/"+purpose)
+
+			// The paragraph is marked RTL once, even though it starts with the Latin app name
+			assert.True(t, strings.HasPrefix(body, rightToLeftMark+"Acme"), "%s/%s: %q", locale, purpose, body)
+			assert.Equal(t, 1, strings.Count(body, rightToLeftMark), locale+"/"+purpose)
+
+			// The code keeps its ASCII digits in order, isolated as a left-to-right run
+			assert.Contains(t, body, leftToRightMark+"042917"+leftToRightMark, locale+"/"+purpose)
+			assert.NotContains(t, body, "۰۴۲۹۱۷", locale+"/"+purpose)
+			assert.NotContains(t, body, "٠٤٢٩١٧", locale+"/"+purpose)
+			assert.NotContains(t, body, "719240", locale+"/"+purpose)
+		}
+	}
+}
+
+func TestMessageRenderer_LeftToRightLocaleHasNoMarks(t *testing.T) {
+	renderer := newShippedMessageRenderer(t)
+
+	body, err := renderer.Render("en", entity.PurposeLogin, MessageData{Code: "042917", ExpiryMinutes: 2, AppName: "Acme"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Acme: Your verification code is 042917. It expires in 2 minutes.", body)
+	assert.NotContains(t, body, rightToLeftMark)
+	assert.NotContains(t, body, leftToRightMark)
+}
+
+func TestMessageRenderer_MarkedTemplateIsNotMarkedTwice(t *testing.T) {
+	renderer, err := NewMessageRenderer([]entity.MessageTemplate{
+		{Locale: "en", Purpose: entity.PurposeLogin, Body: "Code {{.Code}}"},
+		{Locale: "he", Purpose: entity.PurposeLogin, Body: rightToLeftMark + "קוד {{ltr .Code}}"},
+	}, "en", []string{entity.PurposeLogin})
+	require.NoError(t, err)
+
+	body, err := renderer.Render("he", entity.PurposeLogin, MessageData{Code: "123456"})
+	require.NoError(t, err)
+	assert.Equal(t, rightToLeftMark+"קוד "+leftToRightMark+"123456"+leftToRightMark, body)
+}
+
+func TestMessageRenderer_LocaleFallback(t *testing.T) {
+	renderer, err := NewMessageRenderer([]entity.MessageTemplate{
+		{Locale: "en", Purpose: entity.PurposeLogin, Body: "en {{.Code}}"},
+		{Locale: "en", Purpose: entity.PurposePhoneChange, Body: "en change {{.Code}}"},
+		{Locale: "fa", Purpose: entity.PurposeLogin, Body: "fa {{.Code}}"},
+		{Locale: "fa_AF", Purpose: entity.PurposeLogin, Body: "fa-af {{.Code}}"},
+	}, "en", []string{entity.PurposeLogin, entity.PurposePhoneChange})
+	require.NoError(t, err)
+
+	cases := []struct {
+		locale  string
+		purpose string
+		want    string
+	}{
+		{"fa-AF", entity.PurposeLogin, rightToLeftMark + "fa-af 123456"},   // regional template
+		{"fa_IR", entity.PurposeLogin, rightToLeftMark + "fa 123456"},      // base language
+		{"FA", entity.PurposeLogin, rightToLeftMark + "fa 123456"},         // case insensitive
+		{"fa-IR", entity.PurposePhoneChange, "en change 123456"},           // purpose missing in fa, LTR default
+		{"de-DE", entity.PurposeLogin, "en 123456"},                        // unsupported locale
+		{"", entity.PurposeLogin, "en 123456"},                             // no locale
+		{"fa-af", entity.PurposePhoneChange, "en change 123456"},           // regional without the purpose
+		{"en-GB", entity.PurposeLogin, "en 123456"},                        // regional default locale
+		{"ar", entity.PurposeLogin, "en 123456"},                           // RTL locale without templates
+		{"fa", entity.PurposeLogin, rightToLeftMark + "fa 123456"},         // exact base
+		{"fa-Latn-IR", entity.PurposeLogin, rightToLeftMark + "fa 123456"}, // script subtag
+	}
+
+	for _, c := range cases {
+		body, err := renderer.Render(c.locale, c.purpose, MessageData{Code: "123456"})
+		require.NoError(t, err, c.locale)
+		assert.Equal(t, c.want, body, "%s/%s", c.locale, c.purpose)
+	}
+
+	_, err = renderer.Render("fa", entity.PurposePaymentConfirmation, MessageData{Code: "123456"})
+	assert.Error(t, err)
+}
+
+func TestMessageRenderer_ResolveLocale(t *testing.T) {
+	renderer := newShippedMessageRenderer(t)
+
+	cases := map[string]string{
+		"":                                "en",
+		"fa":                              "fa",
+		"fa-IR":                           "fa",
+		"ar_EG":                           "ar",
+		"de-DE":                           "en",
+		"*":                               "en",
+		"de-DE,fa;q=0.8,en;q=0.5":         "fa",
+		"en;q=0.4, ar-SA;q=0.9, fa;q=0.6": "ar",
+		"fa;q=0, ar;q=0.2":                "ar",
+		"fa;q=0":                          "en",
+		"de, fr;q=0.9, *;q=0.1":           "en",
+		"ar;q=0.5, fa;q=0.5":              "ar", // ties keep header order
+		"fa;q=bogus, ar;q=0.9":            "fa", // an unparsable weight counts as 1
+		" FA-ir ; q=0.7 , en-US;q=0.6":    "fa",
+	}
+
+	for preferences, want := range cases {
+		assert.Equal(t, want, renderer.ResolveLocale(preferences), preferences)
+	}
+}
+
+func TestNewMessageRenderer_RejectsInvalidTemplates(t *testing.T) {
+	valid := entity.MessageTemplate{Locale: "en", Purpose: entity.PurposeLogin, Body: "Code {{.Code}}"}
+
+	for name, templates := range map[string][]entity.MessageTemplate{
+		"syntax":          {valid, {Locale: "fa", Purpose: entity.PurposeLogin, Body: "{{.Code"}},
+		"unknown field":   {valid, {Locale: "fa", Purpose: entity.PurposeLogin, Body: "{{.Code}} {{.Missing}}"}},
+		"no code":         {valid, {Locale: "fa", Purpose: entity.PurposeLogin, Body: "کد شما آماده است"}},
+		"missing default": {{Locale: "fa", Purpose: entity.PurposeLogin, Body: "{{ltr .Code}}"}},
+	} {
+		_, err := NewMessageRenderer(templates, "en", []string{entity.PurposeLogin})
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"otp-auth/entity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyOTP_CountsAttempts(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	for remaining := 2; remaining >= 1; remaining-- {
+		_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: wrongCode(code)})
+
+		var attemptErr *AttemptError
+		require.True(t, errors.As(err, &attemptErr))
+		assert.ErrorIs(t, err, ErrInvalidOTP)
+		assert.Equal(t, remaining, attemptErr.RemainingAttempts)
+	}
+
+	// The last attempt still verifies
+	result, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code})
+	require.NoError(t, err)
+	assert.NotNil(t, result.User)
+	assert.Equal(t, 3, sessionByToken(t, repos, token).Attempts)
+}
+
+func TestVerifyOTP_MalformedCodeKeepsAttempts(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: "12ab"})
+	assert.ErrorIs(t, err, ErrInvalidCodeFormat)
+	assert.Zero(t, sessionByToken(t, repos, token).Attempts)
+}
+
+func TestVerifyOTP_BurnsSessionWithoutAttemptsLeft(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	var err error
+	for i := 0; i < 3; i++ {
+		_, err = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: wrongCode(code)})
+	}
+	assert.ErrorIs(t, err, ErrSessionLocked, "the last failed attempt burns the session")
+
+	// A burned session refuses the right code without counting further attempts
+	_, err = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code})
+	assert.ErrorIs(t, err, ErrSessionLocked)
+
+	otp := sessionByToken(t, repos, token)
+	assert.Equal(t, 3, otp.Attempts)
+	assert.False(t, otp.IsUsed)
+
+	lockout, err := repos.lockouts.Get("+447700900123")
+	require.NoError(t, err)
+	require.NotNil(t, lockout)
+	assert.Equal(t, 1, lockout.BurnedSessions)
+	assert.False(t, lockout.IsLocked(time.Now()), "one burned session is below the threshold")
+
+	status, err := svc.GetSession(token)
+	require.NoError(t, err)
+	assert.Equal(t, entity.SessionStatusLocked, status.Status)
+}
+
+func TestVerifyOTP_LocksPhoneNumberAfterBurnedSessions(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	phoneNumber := "+447700900123"
+
+	// Two burned sessions reach the lockout threshold
+	for i := 0; i < 2; i++ {
+		token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: phoneNumber})
+		for j := 0; j < 3; j++ {
+			_, _ = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: wrongCode(code)})
+		}
+	}
+
+	lockout, err := repos.lockouts.Get(phoneNumber)
+	require.NoError(t, err)
+	require.True(t, lockout.IsLocked(time.Now()))
+
+	_, err = svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: phoneNumber})
+	var lockoutErr *LockoutError
+	require.True(t, errors.As(err, &lockoutErr))
+	assert.ErrorIs(t, err, ErrPhoneLocked)
+	assert.Equal(t, *lockout.LockedUntil, lockoutErr.LockedUntil)
+
+	// Other phone numbers are not affected
+	_, err = svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900456"})
+	assert.NoError(t, err)
+}
+
+func TestVerifyOTP_LockoutRefusesOpenSessions(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	phoneNumber := "+447700900123"
+
+	// A session started before the lockout cannot be verified during it
+	openToken, openCode := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: phoneNumber})
+	for i := 0; i < 2; i++ {
+		token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: phoneNumber})
+		for j := 0; j < 3; j++ {
+			_, _ = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: wrongCode(code)})
+		}
+	}
+
+	_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: openToken, Code: openCode})
+	assert.ErrorIs(t, err, ErrPhoneLocked)
+	assert.Zero(t, sessionByToken(t, repos, openToken).Attempts, "refused before counting an attempt")
+}
+
+func TestBurnSession_CountsWithinWindow(t *testing.T) {
+	cfg := serviceTestConfig()
+	cfg.OTP.LockoutThreshold = 3
+	svc, repos := newServiceTestService(t, cfg)
+	otp := &entity.OTP{ID: 1, PhoneNumber: "+447700900123"}
+
+	svc.burnSession(otp)
+	svc.burnSession(otp)
+
+	lockout, err := repos.lockouts.Get(otp.PhoneNumber)
+	require.NoError(t, err)
+	assert.Equal(t, 2, lockout.BurnedSessions)
+	assert.Nil(t, lockout.LockedUntil)
+
+	// Burned sessions outside the window start a new count
+	repos.lockouts.lockouts[otp.PhoneNumber].WindowStartAt = time.Now().Add(-2 * cfg.OTP.LockoutWindow)
+	svc.burnSession(otp)
+
+	lockout, err = repos.lockouts.Get(otp.PhoneNumber)
+	require.NoError(t, err)
+	assert.Equal(t, 1, lockout.BurnedSessions)
+	assert.False(t, lockout.IsLocked(time.Now()))
+
+	svc.burnSession(otp)
+	svc.burnSession(otp)
+
+	lockout, err = repos.lockouts.Get(otp.PhoneNumber)
+	require.NoError(t, err)
+	require.NotNil(t, lockout.LockedUntil)
+	assert.WithinDuration(t, time.Now().Add(cfg.OTP.LockoutDuration), *lockout.LockedUntil, time.Minute)
+}
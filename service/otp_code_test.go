@@ -0,0 +1,66 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCodeTestService returns an OTP service with numeric login codes and 12 character alphanumeric payment codes
+func newCodeTestService() *otpService {
+	return &otpService{cfg: &config.Config{
+		OTP: config.OTP{
+			Length:   6,
+			Alphabet: config.CodeAlphabetNumeric,
+			CodePolicies: map[string]config.CodePolicy{
+				entity.PurposePaymentConfirmation: {Length: 12, Alphabet: config.CodeAlphabetAlphanumeric},
+			},
+		},
+	}}
+}
+
+func TestGenerateOTPCode_FollowsPurposePolicy(t *testing.T) {
+	s := newCodeTestService()
+
+	for purpose, policy := range map[string]config.CodePolicy{
+		entity.PurposeLogin:               {Length: 6, Alphabet: config.CodeAlphabetNumeric},
+		entity.PurposePaymentConfirmation: {Length: 12, Alphabet: config.CodeAlphabetAlphanumeric},
+	} {
+		for i := 0; i < 50; i++ {
+			code, err := s.generateOTPCode(purpose)
+			require.NoError(t, err)
+			require.Len(t, code, policy.Length, purpose)
+			for _, r := range code {
+				require.True(t, strings.ContainsRune(policy.Characters(), r), "%s: %q in %s", purpose, r, code)
+			}
+		}
+	}
+}
+
+func TestNormalizeOTPCode(t *testing.T) {
+	s := newCodeTestService()
+
+	code, err := s.normalizeOTPCode(entity.PurposePaymentConfirmation, " abcd2345wxyz ")
+	require.NoError(t, err)
+	assert.Equal(t, "ABCD2345WXYZ", code, "alphanumeric codes are accepted in any case")
+
+	code, err = s.normalizeOTPCode(entity.PurposeLogin, "123456")
+	require.NoError(t, err)
+	assert.Equal(t, "123456", code)
+
+	for purpose, invalid := range map[string][]string{
+		entity.PurposeLogin:               {"12345", "1234567", "12345a"},
+		entity.PurposePaymentConfirmation: {"ABCD2345WXY", "ABCD2345WXY0", "ABCD2345WXYI"},
+	} {
+		for _, c := range invalid {
+			_, err := s.normalizeOTPCode(purpose, c)
+			assert.True(t, errors.Is(err, ErrInvalidCodeFormat), "%s: %s", purpose, c)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"otp-auth/entity"
+	"otp-auth/test"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// paymentPayload is the action a payment confirmation code is bound to in the purpose tests
+var paymentPayload = map[string]interface{}{"amount": "120.00", "currency": "GBP", "payee": "ACME Ltd"}
+
+func TestVerifyOTP_BoundToPurposeAndPayload(t *testing.T) {
+	cases := []struct {
+		name    string
+		send    entity.SendOTPRequest
+		verify  entity.VerifyOTPRequest
+		matches bool
+	}{
+		{
+			name:    "login code for phone change",
+			send:    entity.SendOTPRequest{Purpose: entity.PurposeLogin},
+			verify:  entity.VerifyOTPRequest{Purpose: entity.PurposePhoneChange},
+			matches: false,
+		},
+		{
+			name:    "phone change code for login",
+			send:    entity.SendOTPRequest{Purpose: entity.PurposePhoneChange},
+			verify:  entity.VerifyOTPRequest{},
+			matches: false,
+		},
+		{
+			name:    "payment code for account deletion",
+			send:    entity.SendOTPRequest{Purpose: entity.PurposePaymentConfirmation, Payload: paymentPayload},
+			verify:  entity.VerifyOTPRequest{Purpose: entity.PurposeAccountDeletion, Payload: paymentPayload},
+			matches: false,
+		},
+		{
+			name:    "payment code for another amount",
+			send:    entity.SendOTPRequest{Purpose: entity.PurposePaymentConfirmation, Payload: paymentPayload},
+			verify:  entity.VerifyOTPRequest{Purpose: entity.PurposePaymentConfirmation, Payload: map[string]interface{}{"amount": "9999.00", "currency": "GBP", "payee": "ACME Ltd"}},
+			matches: false,
+		},
+		{
+			name:    "payment code without its payload",
+			send:    entity.SendOTPRequest{Purpose: entity.PurposePaymentConfirmation, Payload: paymentPayload},
+			verify:  entity.VerifyOTPRequest{Purpose: entity.PurposePaymentConfirmation},
+			matches: false,
+		},
+		{
+			name:    "unbound code with a payload",
+			send:    entity.SendOTPRequest{Purpose: entity.PurposePhoneChange},
+			verify:  entity.VerifyOTPRequest{Purpose: entity.PurposePhoneChange, Payload: map[string]interface{}{"new_phone_number": "+447700900999"}},
+			matches: false,
+		},
+		{
+			name:    "payment code for the same payload in another key order",
+			send:    entity.SendOTPRequest{Purpose: entity.PurposePaymentConfirmation, Payload: paymentPayload},
+			verify:  entity.VerifyOTPRequest{Purpose: entity.PurposePaymentConfirmation, Payload: map[string]interface{}{"payee": "ACME Ltd", "currency": "GBP", "amount": "120.00"}},
+			matches: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			svc, repos := newServiceTestService(t, serviceTestConfig())
+			send := c.send
+			send.PhoneNumber = "+447700900123"
+			token, code := sendTestOTP(t, svc, repos, &send)
+
+			verify := c.verify
+			verify.Token = token
+			verify.Code = code
+			_, err := svc.VerifyOTP(&verify)
+
+			otp := sessionByToken(t, repos, token)
+			assert.Equal(t, 1, otp.Attempts)
+			if c.matches {
+				assert.NoError(t, err)
+				assert.True(t, otp.IsUsed)
+				return
+			}
+
+			// The right code for another action fails like a wrong code and uses up an attempt
+			var attemptErr *AttemptError
+			require.ErrorAs(t, err, &attemptErr)
+			assert.ErrorIs(t, err, ErrInvalidOTP)
+			assert.Equal(t, 2, attemptErr.RemainingAttempts)
+			assert.False(t, otp.IsUsed)
+		})
+	}
+}
+
+func TestVerifyOTP_LoginSignsTheUserIn(t *testing.T) {
+	cfg := serviceTestConfig()
+	cfg.JWT.ExpirationTime = time.Hour
+	svc, repos := newServiceTestService(t, cfg)
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	result, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code})
+	require.NoError(t, err)
+	require.NotNil(t, result.User)
+	assert.Nil(t, result.Confirmation)
+	assert.Equal(t, "+447700900123", result.User.PhoneNumber)
+
+	jwtService := NewJWTService(cfg, test.GetTestLogger(), nil)
+	auth, err := jwtService.GenerateToken(result.User, result.TestNumber)
+	require.NoError(t, err)
+	assert.Equal(t, result.User.ID, auth.User.ID)
+
+	parsed, err := jwtService.ValidateToken(auth.Token)
+	require.NoError(t, err)
+	claims := parsed.Claims.(*JWTClaims)
+	assert.Equal(t, "+447700900123", claims.PhoneNumber)
+	assert.Empty(t, claims.Audience)
+}
+
+func TestVerifyOTP_OtherPurposesOnlyConfirm(t *testing.T) {
+	cfg := serviceTestConfig()
+	cfg.JWT.ConfirmationExpirationTime = 5 * time.Minute
+	svc, repos := newServiceTestService(t, cfg)
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123", Purpose: entity.PurposePaymentConfirmation, Payload: paymentPayload})
+
+	result, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code, Purpose: entity.PurposePaymentConfirmation, Payload: paymentPayload})
+	require.NoError(t, err)
+	assert.Nil(t, result.User)
+	require.NotNil(t, result.Confirmation)
+	assert.Empty(t, repos.users.users, "no user is provisioned for a confirmation")
+
+	payloadHash, err := HashPayload(paymentPayload)
+	require.NoError(t, err)
+	assert.Equal(t, payloadHash, result.Confirmation.PayloadHash)
+
+	jwtService := NewJWTService(cfg, test.GetTestLogger(), nil)
+	confirmation, err := jwtService.GenerateConfirmationToken(result.Confirmation)
+	require.NoError(t, err)
+
+	claims, err := jwtService.ValidateConfirmationToken(confirmation.ConfirmationToken)
+	require.NoError(t, err)
+	assert.Equal(t, jwt.ClaimStrings{"otp-confirmation"}, claims.Audience)
+	assert.Equal(t, entity.PurposePaymentConfirmation, claims.Purpose)
+	assert.Equal(t, payloadHash, claims.PayloadHash)
+	assert.Equal(t, "+447700900123", claims.PhoneNumber)
+
+	// A confirmation does not authenticate anyone
+	_, err = jwtService.ValidateToken(confirmation.ConfirmationToken)
+	assert.Error(t, err)
+}
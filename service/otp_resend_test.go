@@ -0,0 +1,167 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"otp-auth/entity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// passCooldown moves the last send of a session back past the resend cooldown
+func passCooldown(t *testing.T, repos *serviceTestRepositories, token string) {
+	repos.otps.set(t, sessionByToken(t, repos, token).ID, func(otp *entity.OTP) {
+		otp.LastSentAt = time.Now().Add(-time.Minute)
+	})
+}
+
+func TestResendOTP_ReusesTheSessionToken(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, oldCode := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	before := sessionByToken(t, repos, token)
+	passCooldown(t, repos, token)
+
+	response, err := svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+	require.NoError(t, err)
+
+	// The same session carries the new code under the same token
+	assert.Equal(t, token, response.Token)
+	after := sessionByToken(t, repos, token)
+	assert.Equal(t, before.ID, after.ID)
+	assert.Len(t, repos.otps.all(), 1)
+	assert.Equal(t, 1, after.ResendCount)
+	assert.True(t, after.ExpiresAt.After(before.ExpiresAt))
+	assert.Equal(t, after.ExpiresAt, response.ExpiresAt)
+	assert.Equal(t, after.LastSentAt.Add(30*time.Second), response.ResendAvailableAt)
+
+	// The first delivery is dropped if still queued and the new code replaces the old one
+	messages := repos.outbox.forOTP(after.ID)
+	require.Len(t, messages, 2)
+	assert.Equal(t, entity.OutboxStatusSkipped, messages[0].Status)
+	assert.Equal(t, entity.OutboxStatusPending, messages[1].Status)
+
+	newCode, _ := sentPayload(t, repos, after.ID)
+	if newCode != oldCode {
+		_, err = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: oldCode})
+		assert.ErrorIs(t, err, ErrInvalidOTP)
+	}
+	_, err = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: newCode})
+	assert.NoError(t, err)
+}
+
+func TestResendOTP_InsideCooldown(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	otp := sessionByToken(t, repos, token)
+
+	_, err := svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+
+	var cooldownErr *CooldownError
+	require.True(t, errors.As(err, &cooldownErr))
+	assert.ErrorIs(t, err, ErrResendCooldown)
+	assert.Equal(t, otp.LastSentAt.Add(30*time.Second), cooldownErr.AvailableAt)
+	assert.Len(t, repos.outbox.forOTP(otp.ID), 1)
+	assert.Zero(t, sessionByToken(t, repos, token).ResendCount)
+}
+
+func TestResendOTP_CooldownRestartsAfterResend(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	passCooldown(t, repos, token)
+
+	_, err := svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+	require.NoError(t, err)
+
+	_, err = svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+	assert.ErrorIs(t, err, ErrResendCooldown)
+}
+
+func TestResendOTP_PastTheCap(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	for i := 0; i < 2; i++ {
+		passCooldown(t, repos, token)
+		_, err := svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+		require.NoError(t, err, "resend %d", i+1)
+	}
+
+	passCooldown(t, repos, token)
+	_, err := svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+	assert.ErrorIs(t, err, ErrResendLimitReached)
+	assert.Equal(t, 2, sessionByToken(t, repos, token).ResendCount)
+	assert.Len(t, repos.outbox.forOTP(sessionByToken(t, repos, token).ID), 3)
+}
+
+func TestResendOTP_DisabledWithoutResends(t *testing.T) {
+	cfg := serviceTestConfig()
+	cfg.OTP.MaxResends = 0
+	svc, repos := newServiceTestService(t, cfg)
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	passCooldown(t, repos, token)
+
+	_, err := svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+	assert.ErrorIs(t, err, ErrResendLimitReached)
+}
+
+func TestResendOTP_AfterVerification(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code})
+	require.NoError(t, err)
+	passCooldown(t, repos, token)
+
+	_, err = svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+	assert.ErrorIs(t, err, ErrSessionUsed)
+}
+
+func TestResendOTP_AfterCancellation(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	require.NoError(t, svc.CancelSession(token))
+	passCooldown(t, repos, token)
+
+	_, err := svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+	assert.ErrorIs(t, err, ErrSessionCancelled)
+}
+
+func TestResendOTP_LockedSession(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	repos.otps.set(t, sessionByToken(t, repos, token).ID, func(otp *entity.OTP) {
+		otp.Attempts = otp.MaxAttempts
+	})
+	passCooldown(t, repos, token)
+
+	_, err := svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+	assert.ErrorIs(t, err, ErrSessionLocked)
+}
+
+func TestResendOTP_RenewsAnExpiredSession(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	repos.otps.set(t, sessionByToken(t, repos, token).ID, func(otp *entity.OTP) {
+		otp.ExpiresAt = time.Now().Add(-time.Second)
+		otp.LastSentAt = time.Now().Add(-2 * time.Minute)
+	})
+
+	response, err := svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+	require.NoError(t, err)
+	assert.True(t, response.ExpiresAt.After(time.Now()))
+
+	code, _ := sentPayload(t, repos, sessionByToken(t, repos, token).ID)
+	_, err = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code})
+	assert.NoError(t, err)
+}
+
+func TestResendOTP_UnknownToken(t *testing.T) {
+	svc, _ := newServiceTestService(t, serviceTestConfig())
+
+	_, err := svc.ResendOTP(&entity.ResendOTPRequest{Token: "unknown-token"})
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
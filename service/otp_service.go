@@ -2,61 +2,240 @@ package service
 
 import (
 	"crypto/rand"
-	"database/sql"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
+	"strings"
 	"time"
 
 	"otp-auth/config"
 	"otp-auth/entity"
 	"otp-auth/pkg/logger"
+	"otp-auth/pkg/metrics"
 	"otp-auth/repository"
+
+	"github.com/jmoiron/sqlx"
 )
 
 // OTPService interface defines OTP business operations
 type OTPService interface {
-	SendOTP(phoneNumber string) (*entity.OTPResponse, error)
-	VerifyOTP(sessionToken, code string) (*entity.User, error)
+	SendOTP(req *entity.SendOTPRequest) (*entity.OTPResponse, error)
+	ResendOTP(req *entity.ResendOTPRequest) (*entity.OTPResponse, error)
+	GetSession(sessionToken string) (*entity.SessionStatusResponse, error)
+	CancelSession(sessionToken string) error
+	VerifyOTP(req *entity.VerifyOTPRequest) (*VerificationResult, error)
+	VerifyMagicLink(linkToken string) (*VerificationResult, error)
 	IsRateLimited(phoneNumber string) (bool, error)
+	RateLimitState(phoneNumber, clientIP, deviceID string) (*entity.RateLimitResult, error)
 	CleanupExpiredOTPs() error
 }
 
+// OTP send errors
+var (
+	ErrChannelUnavailable   = errors.New("delivery channel unavailable")
+	ErrUnknownClientApp     = errors.New("unknown client app")
+	ErrPayloadRequired      = errors.New("payload required for purpose")
+	ErrMagicLinkUnavailable = errors.New("magic link not available")
+	ErrRateLimited          = errors.New("rate limit exceeded")
+)
+
+// OTP session errors
+var (
+	ErrSessionNotFound    = errors.New("OTP session not found")
+	ErrSessionUsed        = errors.New("OTP session already verified")
+	ErrSessionCancelled   = errors.New("OTP session cancelled")
+	ErrResendCooldown     = errors.New("resend not available yet")
+	ErrResendLimitReached = errors.New("resend limit reached")
+)
+
+// OTP verification errors
+var (
+	ErrInvalidOTP           = errors.New("invalid or expired OTP")
+	ErrInvalidCodeFormat    = errors.New("invalid code format")
+	ErrSessionLocked        = errors.New("OTP session locked")
+	ErrPhoneLocked          = errors.New("phone number locked")
+	ErrUserInactive         = errors.New("user account is inactive")
+	ErrVerifyModeNotAllowed = errors.New("phone number verification not enabled for client app")
+)
+
+// AttemptError reports a failed verification together with the attempts left on the session
+type AttemptError struct {
+	Err               error
+	RemainingAttempts int
+}
+
+// Error returns the underlying error message
+func (e *AttemptError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *AttemptError) Unwrap() error {
+	return e.Err
+}
+
+// RateLimitError reports that sends are refused until RetryAt because the limit of one
+// dimension (phone number, IP, device, country or global) is used up
+type RateLimitError struct {
+	Dimension string
+	Limit     int
+	Window    time.Duration
+	RetryAt   time.Time // when a send could next succeed
+	ResetAt   time.Time // when the full quota is available again
+}
+
+// Error returns the rate limit message
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s for %s. Maximum %d requests per %v", ErrRateLimited, e.Dimension, e.Limit, e.Window)
+}
+
+// Unwrap returns ErrRateLimited
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// CooldownError reports that a session cannot be resent before AvailableAt
+type CooldownError struct {
+	AvailableAt time.Time
+}
+
+// Error returns the cooldown message
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("%s, available at %s", ErrResendCooldown, e.AvailableAt.Format(time.RFC3339))
+}
+
+// Unwrap returns ErrResendCooldown
+func (e *CooldownError) Unwrap() error {
+	return ErrResendCooldown
+}
+
+// LockoutError reports that a phone number is locked out after too many burned sessions
+type LockoutError struct {
+	LockedUntil time.Time
+}
+
+// Error returns the lockout message
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%s until %s", ErrPhoneLocked, e.LockedUntil.Format(time.RFC3339))
+}
+
+// Unwrap returns ErrPhoneLocked
+func (e *LockoutError) Unwrap() error {
+	return ErrPhoneLocked
+}
+
+// VerificationResult is the outcome of a successful verification: the logged in user
+// for login, or a confirmation to be signed for any other purpose
+type VerificationResult struct {
+	User         *entity.User
+	Confirmation *entity.Confirmation
+	TestNumber   bool // verified for a configured test phone number
+}
+
 // otpService implements OTPService interface
 type otpService struct {
 	otpRepo       repository.OTPRepository
 	userRepo      repository.UserRepository
 	rateLimitRepo repository.RateLimitRepository
+	lockoutRepo   repository.LockoutRepository
+	outboxRepo    repository.OutboxRepository
+	receiptRepo   repository.DeliveryReceiptRepository
+	txManager     repository.TxManager
+	renderer      MessageRenderer
+	destinations  DestinationPolicy
+	anomalies     AnomalyDetector
 	cfg           *config.Config
 	logger        *logger.Logger
 }
 
 // NewOTPService creates a new OTP service instance
-func NewOTPService(otpRepo repository.OTPRepository, userRepo repository.UserRepository, rateLimitRepo repository.RateLimitRepository, cfg *config.Config, logger *logger.Logger) OTPService {
+func NewOTPService(otpRepo repository.OTPRepository, userRepo repository.UserRepository, rateLimitRepo repository.RateLimitRepository, lockoutRepo repository.LockoutRepository, outboxRepo repository.OutboxRepository, receiptRepo repository.DeliveryReceiptRepository, txManager repository.TxManager, renderer MessageRenderer, destinations DestinationPolicy, anomalies AnomalyDetector, cfg *config.Config, logger *logger.Logger) OTPService {
 	return &otpService{
 		otpRepo:       otpRepo,
 		userRepo:      userRepo,
 		rateLimitRepo: rateLimitRepo,
+		lockoutRepo:   lockoutRepo,
+		outboxRepo:    outboxRepo,
+		receiptRepo:   receiptRepo,
+		txManager:     txManager,
+		renderer:      renderer,
+		destinations:  destinations,
+		anomalies:     anomalies,
 		cfg:           cfg,
 		logger:        logger,
 	}
 }
 
 // SendOTP generates and sends an OTP to the provided phone number
-func (s *otpService) SendOTP(phoneNumber string) (*entity.OTPResponse, error) {
-	// Check rate limiting
-	isLimited, err := s.IsRateLimited(phoneNumber)
+func (s *otpService) SendOTP(req *entity.SendOTPRequest) (*entity.OTPResponse, error) {
+	phoneNumber := req.PhoneNumber
+
+	var clientID *string
+	if req.ClientID != "" {
+		if _, ok := s.cfg.ClientApps[req.ClientID]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownClientApp, req.ClientID)
+		}
+		clientID = &req.ClientID
+	}
+
+	purpose := req.Purpose
+	if purpose == "" {
+		purpose = entity.PurposeLogin
+	}
+
+	// Payments must be bound to the transaction they confirm
+	if purpose == entity.PurposePaymentConfirmation && len(req.Payload) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPayloadRequired, purpose)
+	}
+
+	// Magic links sign the user in, so they only come with login codes
+	if req.MagicLink && (purpose != entity.PurposeLogin || !s.cfg.MagicLink.Enabled()) {
+		return nil, fmt.Errorf("%w: %s", ErrMagicLinkUnavailable, purpose)
+	}
+
+	var payloadHash *string
+	if len(req.Payload) > 0 {
+		hash, err := HashPayload(req.Payload)
+		if err != nil {
+			return nil, err
+		}
+		payloadHash = &hash
+	}
+
+	// Resolve the delivery channels before anything is stored
+	chain, err := s.deliveryChain(req)
 	if err != nil {
-		s.logger.Errorw("Failed to check rate limit", "phone_number", phoneNumber, "error", err)
-		return nil, fmt.Errorf("failed to check rate limit: %w", err)
+		return nil, err
 	}
 
-	if isLimited {
-		return nil, fmt.Errorf("rate limit exceeded. Maximum %d requests per %v", s.cfg.RateLimit.MaxRequests, s.cfg.RateLimit.WindowDuration)
+	// Test numbers get a known code and are neither rate limited nor delivered to
+	testNumber := s.cfg.TestNumbers.Matches(phoneNumber)
+
+	// Refuse destinations outside the allow and deny rules before anything is stored or counted
+	if !testNumber {
+		if err := s.checkDestination(phoneNumber); err != nil {
+			return nil, err
+		}
+	}
+
+	// Locked out phone numbers cannot start new sessions either
+	if err := s.checkLockout(phoneNumber); err != nil {
+		return nil, err
+	}
+
+	// Count the request against the phone number, client and global rate limits; check and
+	// increment are a single step per limit so concurrent sends cannot all pass on the same count
+	var rateLimit *entity.RateLimitResult
+	if !testNumber {
+		rateLimit, err = s.consumeRateLimit(phoneNumber, req.ClientIP, req.DeviceID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Generate OTP code
-	code, err := s.generateOTPCode()
+	code, err := s.issueOTPCode(purpose, phoneNumber, testNumber)
 	if err != nil {
 		s.logger.Errorw("Failed to generate OTP code", "error", err)
 		return nil, fmt.Errorf("failed to generate OTP code: %w", err)
@@ -69,166 +248,883 @@ func (s *otpService) SendOTP(phoneNumber string) (*entity.OTPResponse, error) {
 		return nil, fmt.Errorf("failed to generate session token: %w", err)
 	}
 
-	// Create OTP entity
+	// Render the message in the requested language
+	locale := s.renderer.ResolveLocale(req.Locale)
+	body, err := s.renderMessage(locale, purpose, code)
+	if err != nil {
+		return nil, err
+	}
+
+	var linkToken *string
+	if req.MagicLink {
+		link, tokenHash, err := s.issueMagicLink()
+		if err != nil {
+			return nil, err
+		}
+		body += "\n" + link
+		linkToken = &tokenHash
+	}
+
+	// Create OTP entity; only keyed hashes of the code and session token are stored
 	otp := &entity.OTP{
 		PhoneNumber:  phoneNumber,
-		Code:         code,
-		SessionToken: sessionToken,
+		Code:         hashSecret(s.cfg.OTP.HashPepper, code),
+		SessionToken: hashSecret(s.cfg.OTP.HashPepper, sessionToken),
 		ExpiresAt:    time.Now().Add(s.cfg.OTP.ExpirationTime),
+		ClientID:     clientID,
+		MaxAttempts:  s.cfg.OTP.MaxVerifyAttempts,
+		Locale:       &locale,
+		Purpose:      purpose,
+		PayloadHash:  payloadHash,
+		IsTest:       testNumber,
+		LinkToken:    linkToken,
+	}
+
+	// Kept for verify conversion per country and IP
+	if code := callingCode(phoneNumber); code != "" {
+		otp.CallingCode = &code
+	}
+	if req.ClientIP != "" {
+		otp.ClientIP = &req.ClientIP
 	}
 
-	// Store OTP in database
-	createdOTP, err := s.otpRepo.Create(otp)
+	// Store OTP and its delivery request atomically; the outbox worker delivers it
+	var createdOTP *entity.OTP
+	err = s.txManager.WithinTransaction(func(tx *sqlx.Tx) error {
+		var err error
+		createdOTP, err = s.otpRepo.CreateTx(tx, otp)
+		if err != nil || testNumber {
+			return err
+		}
+
+		if err := s.otpRepo.RecordConversionTx(tx, createdOTP, false); err != nil {
+			return err
+		}
+
+		var email *string
+		if req.Email != "" {
+			email = &req.Email
+		}
+
+		return s.enqueueDelivery(tx, createdOTP, chain, email, code, body)
+	})
 	if err != nil {
 		s.logger.Errorw("Failed to create OTP", "phone_number", phoneNumber, "error", err)
 		return nil, fmt.Errorf("failed to create OTP: %w", err)
 	}
 
-	// Update rate limiting
-	err = s.updateRateLimit(phoneNumber)
+	if testNumber {
+		s.logger.Warnw("OTP issued to test phone number, delivery and rate limiting skipped", "otp_id", createdOTP.ID, "phone_number", phoneNumber, "purpose", purpose, "test_number", true)
+	} else {
+		s.logger.Infow("OTP generated and queued for delivery", "phone_number", phoneNumber, "purpose", purpose, "locale", locale, "channel", chain[0], "fallback_channels", chain[1:], "expires_at", createdOTP.ExpiresAt)
+	}
+
+	return &entity.OTPResponse{
+		Message:           "OTP sent successfully",
+		Token:             sessionToken,
+		PhoneNumber:       phoneNumber,
+		Purpose:           purpose,
+		ExpiresAt:         createdOTP.ExpiresAt,
+		Channel:           chain[0],
+		AvailableChannels: chain[1:],
+		ResendAvailableAt: createdOTP.LastSentAt.Add(s.cfg.OTP.ResendCooldown),
+		RateLimit:         rateLimit,
+	}, nil
+}
+
+// ResendOTP issues a new code on an existing session, invalidating the previous one.
+// The session token stays the same; resends are subject to a per-session cooldown and
+// cap as well as the same rate limits as sends.
+func (s *otpService) ResendOTP(req *entity.ResendOTPRequest) (*entity.OTPResponse, error) {
+	otp, err := s.otpRepo.GetBySessionToken(hashSecret(s.cfg.OTP.HashPepper, req.Token))
 	if err != nil {
-		s.logger.Errorw("Failed to update rate limit", "phone_number", phoneNumber, "error", err)
-		// Don't return error as OTP was created successfully
+		s.logger.Errorw("Failed to get OTP session", "error", err)
+		return nil, fmt.Errorf("failed to get OTP session: %w", err)
+	}
+
+	switch {
+	case otp == nil:
+		return nil, ErrSessionNotFound
+	case otp.IsUsed:
+		return nil, ErrSessionUsed
+	case otp.CancelledAt != nil:
+		return nil, ErrSessionCancelled
+	case otp.RemainingAttempts() == 0:
+		return nil, &AttemptError{Err: ErrSessionLocked}
+	case otp.ResendCount >= s.cfg.OTP.MaxResends:
+		return nil, ErrResendLimitReached
+	}
+
+	if availableAt := otp.LastSentAt.Add(s.cfg.OTP.ResendCooldown); time.Now().Before(availableAt) {
+		return nil, &CooldownError{AvailableAt: availableAt}
 	}
 
-	// Print OTP to console (as per requirements)
-	fmt.Printf("🔐 OTP for %s: %s (expires at %s)\n", phoneNumber, code, createdOTP.ExpiresAt.Format("15:04:05"))
-	s.logger.Infow("OTP generated", "phone_number", phoneNumber, "expires_at", createdOTP.ExpiresAt)
+	// Rules may have changed since the session was started
+	if !otp.IsTest {
+		if err := s.checkDestination(otp.PhoneNumber); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.checkLockout(otp.PhoneNumber); err != nil {
+		return nil, err
+	}
+
+	// Deliver to the same recipient and app as the original send
+	previous, err := s.outboxRepo.GetLatestByOTPID(otp.ID)
+	if err != nil {
+		s.logger.Errorw("Failed to get previous delivery", "otp_id", otp.ID, "error", err)
+		return nil, fmt.Errorf("failed to get previous delivery: %w", err)
+	}
+
+	var email *string
+	if previous != nil {
+		email = previous.Email
+	}
+
+	sendReq := &entity.SendOTPRequest{PhoneNumber: otp.PhoneNumber, Channel: req.Channel}
+	if email != nil {
+		sendReq.Email = *email
+	}
+
+	chain, err := s.deliveryChain(sendReq)
+	if err != nil {
+		return nil, err
+	}
+
+	var rateLimit *entity.RateLimitResult
+	if !otp.IsTest {
+		rateLimit, err = s.consumeRateLimit(otp.PhoneNumber, req.ClientIP, req.DeviceID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	code, err := s.issueOTPCode(otp.Purpose, otp.PhoneNumber, otp.IsTest)
+	if err != nil {
+		s.logger.Errorw("Failed to generate OTP code", "error", err)
+		return nil, fmt.Errorf("failed to generate OTP code: %w", err)
+	}
+
+	locale := s.cfg.Messages.DefaultLocale
+	if otp.Locale != nil {
+		locale = *otp.Locale
+	}
+
+	body, err := s.renderMessage(locale, otp.Purpose, code)
+	if err != nil {
+		return nil, err
+	}
+
+	// A new link replaces the previous one along with the code
+	var linkToken *string
+	if otp.LinkToken != nil {
+		link, tokenHash, err := s.issueMagicLink()
+		if err != nil {
+			return nil, err
+		}
+		body += "\n" + link
+		linkToken = &tokenHash
+	}
+
+	now := time.Now()
+	var resent *entity.OTP
+	err = s.txManager.WithinTransaction(func(tx *sqlx.Tx) error {
+		var err error
+		resent, err = s.otpRepo.ResendTx(tx, otp.ID, hashSecret(s.cfg.OTP.HashPepper, code), linkToken, now.Add(s.cfg.OTP.ExpirationTime),
+			s.cfg.OTP.MaxResends, now.Add(-s.cfg.OTP.ResendCooldown))
+		if err != nil || resent == nil {
+			return err
+		}
+
+		// Queued deliveries still carry the old code
+		if err := s.outboxRepo.SkipPendingTx(tx, otp.ID, "OTP resent"); err != nil || resent.IsTest {
+			return err
+		}
+
+		return s.enqueueDelivery(tx, resent, chain, email, code, body)
+	})
+	if err != nil {
+		s.logger.Errorw("Failed to resend OTP", "otp_id", otp.ID, "error", err)
+		return nil, fmt.Errorf("failed to resend OTP: %w", err)
+	}
+
+	if resent == nil {
+		// A concurrent resend or verification changed the session in the meantime
+		return nil, &CooldownError{AvailableAt: now.Add(s.cfg.OTP.ResendCooldown)}
+	}
+
+	if resent.IsTest {
+		s.logger.Warnw("OTP resent to test phone number, delivery and rate limiting skipped", "otp_id", resent.ID, "phone_number", resent.PhoneNumber, "test_number", true)
+	}
+
+	s.logger.Infow("OTP resent", "otp_id", resent.ID, "phone_number", resent.PhoneNumber, "resend_count", resent.ResendCount, "channel", chain[0], "expires_at", resent.ExpiresAt)
 
 	return &entity.OTPResponse{
-		Message:     "OTP sent successfully",
-		Token:       sessionToken,
-		PhoneNumber: phoneNumber,
-		ExpiresAt:   createdOTP.ExpiresAt,
+		Message:           "OTP resent successfully",
+		Token:             req.Token,
+		PhoneNumber:       resent.PhoneNumber,
+		Purpose:           resent.Purpose,
+		ExpiresAt:         resent.ExpiresAt,
+		Channel:           chain[0],
+		AvailableChannels: chain[1:],
+		ResendAvailableAt: resent.LastSentAt.Add(s.cfg.OTP.ResendCooldown),
+		RateLimit:         rateLimit,
+	}, nil
+}
+
+// GetSession returns the state of an OTP session, including its delivery receipts, without revealing the code
+func (s *otpService) GetSession(sessionToken string) (*entity.SessionStatusResponse, error) {
+	otp, err := s.otpRepo.GetBySessionToken(hashSecret(s.cfg.OTP.HashPepper, sessionToken))
+	if err != nil {
+		s.logger.Errorw("Failed to get OTP session", "error", err)
+		return nil, fmt.Errorf("failed to get OTP session: %w", err)
+	}
+
+	if otp == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	status := sessionStatus(otp, time.Now())
+
+	remainingResends := s.cfg.OTP.MaxResends - otp.ResendCount
+	if remainingResends < 0 {
+		remainingResends = 0
+	}
+
+	var resendAvailableAt *time.Time
+	if remainingResends > 0 && (status == entity.SessionStatusPending || status == entity.SessionStatusExpired) {
+		availableAt := otp.LastSentAt.Add(s.cfg.OTP.ResendCooldown)
+		resendAvailableAt = &availableAt
+	}
+
+	receipts, err := s.receiptRepo.ListByOTPID(otp.ID)
+	if err != nil {
+		s.logger.Errorw("Failed to list delivery receipts", "otp_id", otp.ID, "error", err)
+		return nil, fmt.Errorf("failed to list delivery receipts: %w", err)
+	}
+
+	return &entity.SessionStatusResponse{
+		Status:            status,
+		PhoneNumber:       maskPhoneNumber(otp.PhoneNumber),
+		Purpose:           otp.Purpose,
+		ExpiresAt:         otp.ExpiresAt,
+		RemainingAttempts: otp.RemainingAttempts(),
+		RemainingResends:  remainingResends,
+		ResendAvailableAt: resendAvailableAt,
+		Delivery:          toDeliveryStatusResponse(otp, receipts),
 	}, nil
 }
 
-// VerifyOTP verifies the provided OTP code using session token
-func (s *otpService) VerifyOTP(sessionToken, code string) (*entity.User, error) {
-	// Get active OTP by session token
-	otp, err := s.otpRepo.GetActiveBySessionTokenAndCode(sessionToken, code)
+// CancelSession cancels a pending session so its code can no longer be used and
+// drops deliveries that have not gone out yet. Cancelling twice is not an error.
+func (s *otpService) CancelSession(sessionToken string) error {
+	otp, err := s.otpRepo.GetBySessionToken(hashSecret(s.cfg.OTP.HashPepper, sessionToken))
+	if err != nil {
+		s.logger.Errorw("Failed to get OTP session", "error", err)
+		return fmt.Errorf("failed to get OTP session: %w", err)
+	}
+
+	switch {
+	case otp == nil:
+		return ErrSessionNotFound
+	case otp.IsUsed:
+		return ErrSessionUsed
+	case otp.CancelledAt != nil:
+		return nil
+	}
+
+	err = s.txManager.WithinTransaction(func(tx *sqlx.Tx) error {
+		cancelled, err := s.otpRepo.CancelTx(tx, otp.ID)
+		if err != nil || !cancelled {
+			return err
+		}
+		return s.outboxRepo.SkipPendingTx(tx, otp.ID, "OTP session cancelled")
+	})
+	if err != nil {
+		s.logger.Errorw("Failed to cancel OTP session", "otp_id", otp.ID, "error", err)
+		return fmt.Errorf("failed to cancel OTP session: %w", err)
+	}
+
+	s.logger.Infow("OTP session cancelled", "otp_id", otp.ID, "phone_number", otp.PhoneNumber)
+	return nil
+}
+
+// sessionStatus derives the status of an OTP session at the given time
+func sessionStatus(otp *entity.OTP, now time.Time) string {
+	switch {
+	case otp.IsUsed:
+		return entity.SessionStatusVerified
+	case otp.CancelledAt != nil:
+		return entity.SessionStatusCancelled
+	case otp.RemainingAttempts() == 0:
+		return entity.SessionStatusLocked
+	case now.After(otp.ExpiresAt):
+		return entity.SessionStatusExpired
+	default:
+		return entity.SessionStatusPending
+	}
+}
+
+// maskPhoneNumber hides all but the country prefix and the last two digits
+func maskPhoneNumber(phoneNumber string) string {
+	if len(phoneNumber) <= 6 {
+		return strings.Repeat("*", len(phoneNumber))
+	}
+	return phoneNumber[:4] + strings.Repeat("*", len(phoneNumber)-6) + phoneNumber[len(phoneNumber)-2:]
+}
+
+// renderMessage renders the message for a purpose and code in the given locale
+func (s *otpService) renderMessage(locale, purpose, code string) (string, error) {
+	body, err := s.renderer.Render(locale, purpose, MessageData{
+		Code:          code,
+		ExpiryMinutes: int(math.Ceil(s.cfg.OTP.ExpirationTime.Minutes())),
+		AppName:       s.cfg.Messages.AppName,
+	})
+	if err != nil {
+		s.logger.Errorw("Failed to render OTP message", "locale", locale, "purpose", purpose, "error", err)
+		return "", fmt.Errorf("failed to render OTP message: %w", err)
+	}
+
+	return body, nil
+}
+
+// issueMagicLink returns a new magic link and the keyed hash of its token to store on the session
+func (s *otpService) issueMagicLink() (string, string, error) {
+	token, err := newMagicLinkToken(s.cfg.JWT.Secret)
+	if err != nil {
+		s.logger.Errorw("Failed to generate magic link", "error", err)
+		return "", "", fmt.Errorf("failed to generate magic link: %w", err)
+	}
+
+	return magicLinkURL(s.cfg.MagicLink.BaseURL, token), hashSecret(s.cfg.OTP.HashPepper, token), nil
+}
+
+// enqueueDelivery queues the code for delivery over the channel chain within the caller's transaction
+func (s *otpService) enqueueDelivery(tx *sqlx.Tx, otp *entity.OTP, chain []string, email *string, code, body string) error {
+	// The outbox only ever holds the code and body encrypted; the worker opens them at send time
+	sealedCode, err := sealSecret(s.cfg.OTP.HashPepper, code)
 	if err != nil {
-		s.logger.Errorw("Failed to get OTP", "session_token", sessionToken, "error", err)
+		return err
+	}
+	sealedBody, err := sealSecret(s.cfg.OTP.HashPepper, body)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.outboxRepo.EnqueueTx(tx, &entity.OutboxMessage{
+		OTPID:            &otp.ID,
+		ClientID:         otp.ClientID,
+		Channel:          chain[0],
+		FallbackChannels: strings.Join(chain[1:], ","),
+		PhoneNumber:      otp.PhoneNumber,
+		Email:            email,
+		Code:             sealedCode,
+		Body:             sealedBody,
+		ResendCount:      otp.ResendCount,
+		ExpiresAt:        otp.ExpiresAt,
+		MaxAttempts:      s.cfg.Outbox.MaxAttempts,
+	})
+	return err
+}
+
+// deliveryChain returns the channels to try in order: the preferred channel first,
+// then the configured fallback chain, leaving out channels the request cannot use
+func (s *otpService) deliveryChain(req *entity.SendOTPRequest) ([]string, error) {
+	usable := func(channel string) bool {
+		return channel != ChannelEmail || req.Email != ""
+	}
+
+	chain := make([]string, 0, len(s.cfg.Delivery.Channels))
+	if req.Channel != "" {
+		configured := false
+		for _, channel := range s.cfg.Delivery.Channels {
+			if channel == req.Channel {
+				configured = true
+				break
+			}
+		}
+		if !configured || !usable(req.Channel) {
+			return nil, fmt.Errorf("%w: %s", ErrChannelUnavailable, req.Channel)
+		}
+		chain = append(chain, req.Channel)
+	}
+
+	for _, channel := range s.cfg.Delivery.Channels {
+		if channel != req.Channel && usable(channel) {
+			chain = append(chain, channel)
+		}
+	}
+
+	if len(chain) == 0 {
+		return nil, ErrChannelUnavailable
+	}
+
+	return chain, nil
+}
+
+// VerifyOTP verifies the provided OTP code using session token. Every attempt counts
+// against the session; a session without attempts left is burned. The code only verifies
+// for the purpose and payload it was issued for.
+func (s *otpService) VerifyOTP(req *entity.VerifyOTPRequest) (*VerificationResult, error) {
+	purpose := req.Purpose
+	if purpose == "" {
+		purpose = entity.PurposeLogin
+	}
+
+	// Malformed codes are rejected without using up an attempt
+	code, err := s.normalizeOTPCode(purpose, req.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadHash, err := HashPayload(req.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the session regardless of its state to tell burned sessions apart
+	otp, err := s.findVerifySession(req, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	if otp == nil || otp.IsUsed || otp.CancelledAt != nil || time.Now().After(otp.ExpiresAt) {
+		s.logger.Warnw("Invalid or expired OTP", "session_token", MaskToken(req.Token), "phone_number", req.PhoneNumber)
+		return nil, ErrInvalidOTP
+	}
+
+	if err := s.checkLockout(otp.PhoneNumber); err != nil {
+		return nil, err
+	}
+
+	if otp.RemainingAttempts() == 0 {
+		s.logger.Warnw("Verification attempt on locked OTP session", "otp_id", otp.ID, "phone_number", otp.PhoneNumber)
+		return nil, &AttemptError{Err: ErrSessionLocked}
+	}
+
+	// Count the attempt before comparing so parallel guesses cannot exceed the limit
+	otpID := otp.ID
+	otp, err = s.otpRepo.IncrementAttempts(otpID)
+	if err != nil {
+		s.logger.Errorw("Failed to count verification attempt", "otp_id", otpID, "error", err)
 		return nil, fmt.Errorf("failed to verify OTP: %w", err)
 	}
 
 	if otp == nil {
-		s.logger.Warnw("Invalid or expired OTP", "session_token", sessionToken, "code", code)
-		return nil, fmt.Errorf("invalid or expired OTP")
+		// Used, expired or burned by a concurrent request
+		return nil, ErrInvalidOTP
+	}
+
+	// A code used for another action fails like a wrong code, so it reveals nothing
+	bound := otp.Purpose == purpose && payloadMatches(otp.PayloadHash, payloadHash)
+	if !bound {
+		s.logger.Warnw("OTP purpose or payload mismatch", "otp_id", otp.ID, "phone_number", otp.PhoneNumber, "purpose", otp.Purpose, "requested_purpose", purpose)
 	}
 
-	// Mark OTP as used
-	err = s.otpRepo.MarkAsUsed(otp.ID)
+	if !bound || !secretMatches(s.cfg.OTP.HashPepper, code, otp.Code) {
+		remaining := otp.RemainingAttempts()
+		s.logger.Warnw("Invalid OTP code", "otp_id", otp.ID, "phone_number", otp.PhoneNumber, "remaining_attempts", remaining)
+
+		if remaining == 0 {
+			s.burnSession(otp)
+			return nil, &AttemptError{Err: ErrSessionLocked}
+		}
+		return nil, &AttemptError{Err: ErrInvalidOTP, RemainingAttempts: remaining}
+	}
+
+	return s.completeVerification(otp, payloadHash)
+}
+
+// VerifyMagicLink verifies a session by the magic link sent with its code. The link is
+// single-use and expires with the code; it does not count against the session's attempts
+// but cannot open a burned session.
+func (s *otpService) VerifyMagicLink(linkToken string) (*VerificationResult, error) {
+	// Forged or mangled links are rejected without a database lookup
+	if !magicLinkSignatureValid(s.cfg.JWT.Secret, linkToken) {
+		s.logger.Warnw("Invalid magic link signature")
+		return nil, ErrInvalidOTP
+	}
+
+	otp, err := s.otpRepo.GetByLinkToken(hashSecret(s.cfg.OTP.HashPepper, linkToken))
 	if err != nil {
-		s.logger.Errorw("Failed to mark OTP as used", "otp_id", otp.ID, "error", err)
-		return nil, fmt.Errorf("failed to mark OTP as used: %w", err)
+		s.logger.Errorw("Failed to get OTP by magic link", "error", err)
+		return nil, fmt.Errorf("failed to verify magic link: %w", err)
 	}
 
-	// Get or create user using phone number from OTP record
-	phoneNumber := otp.PhoneNumber
-	user, err := s.userRepo.GetByPhoneNumber(phoneNumber)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		s.logger.Errorw("Failed to get user", "phone_number", phoneNumber, "error", err)
-		return nil, fmt.Errorf("failed to get user: %w", err)
+	if otp == nil || otp.IsUsed || otp.CancelledAt != nil || time.Now().After(otp.ExpiresAt) {
+		s.logger.Warnw("Invalid or expired magic link")
+		return nil, ErrInvalidOTP
 	}
 
-	if user == nil || errors.Is(err, sql.ErrNoRows) {
-		// Create new user (last_login_at will be set to registered_at in repository)
-		newUser := &entity.User{
-			PhoneNumber: phoneNumber,
+	if err := s.checkLockout(otp.PhoneNumber); err != nil {
+		return nil, err
+	}
+
+	if otp.RemainingAttempts() == 0 {
+		s.logger.Warnw("Magic link used on locked OTP session", "otp_id", otp.ID, "phone_number", otp.PhoneNumber)
+		return nil, &AttemptError{Err: ErrSessionLocked}
+	}
+
+	var payloadHash string
+	if otp.PayloadHash != nil {
+		payloadHash = *otp.PayloadHash
+	}
+
+	return s.completeVerification(otp, payloadHash)
+}
+
+// completeVerification consumes a session whose code or link checked out and returns the
+// logged in user for login, or the confirmation for any other purpose
+func (s *otpService) completeVerification(otp *entity.OTP, payloadHash string) (*VerificationResult, error) {
+	// Consume the session and provision the user together so concurrent verifies
+	// cannot both succeed and first-time logins cannot race into duplicate users
+	var user *entity.User
+	var created bool
+	err := s.txManager.WithinTransaction(func(tx *sqlx.Tx) error {
+		consumed, err := s.otpRepo.ConsumeTx(tx, otp.ID)
+		if err != nil {
+			return err
+		}
+		if consumed == nil {
+			return ErrInvalidOTP
+		}
+
+		// Drop queued fallbacks and retries along with their sealed codes
+		if err := s.outboxRepo.SkipPendingTx(tx, otp.ID, "OTP already verified"); err != nil {
+			return err
+		}
+
+		if !otp.IsTest {
+			if err := s.otpRepo.RecordConversionTx(tx, otp, true); err != nil {
+				return err
+			}
 		}
-		user, err = s.userRepo.Create(newUser)
+
+		// Only a login signs the user in; other purposes confirm an action
+		if otp.Purpose != entity.PurposeLogin {
+			return nil
+		}
+
+		user, created, err = s.userRepo.UpsertByPhoneNumberTx(tx, otp.PhoneNumber)
 		if err != nil {
-			s.logger.Errorw("Failed to create user", "phone_number", phoneNumber, "error", err)
-			return nil, fmt.Errorf("failed to create user: %w", err)
+			return err
 		}
-		s.logger.Infow("New user registered", "user_id", user.ID, "phone_number", phoneNumber)
+		if user == nil {
+			return ErrUserInactive
+		}
+
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidOTP) {
+			// Verified by a concurrent request
+			s.logger.Warnw("OTP already consumed", "otp_id", otp.ID, "phone_number", otp.PhoneNumber)
+			return nil, err
+		}
+		if errors.Is(err, ErrUserInactive) {
+			s.logger.Warnw("Verification for inactive user", "otp_id", otp.ID, "phone_number", otp.PhoneNumber)
+			return nil, err
+		}
+		s.logger.Errorw("Failed to complete OTP verification", "otp_id", otp.ID, "phone_number", otp.PhoneNumber, "error", err)
+		return nil, fmt.Errorf("failed to verify OTP: %w", err)
+	}
+
+	if otp.IsTest {
+		s.logger.Warnw("OTP verified for test phone number", "otp_id", otp.ID, "phone_number", otp.PhoneNumber, "purpose", otp.Purpose, "test_number", true)
+	}
+
+	if otp.Purpose != entity.PurposeLogin {
+		s.logger.Infow("OTP confirmed", "otp_id", otp.ID, "phone_number", otp.PhoneNumber, "purpose", otp.Purpose)
+		return &VerificationResult{
+			Confirmation: &entity.Confirmation{
+				SessionID:   otp.ID,
+				Purpose:     otp.Purpose,
+				PhoneNumber: otp.PhoneNumber,
+				PayloadHash: payloadHash,
+				TestNumber:  otp.IsTest,
+			},
+			TestNumber: otp.IsTest,
+		}, nil
+	}
+
+	if created {
+		s.logger.Infow("New user registered", "user_id", user.ID, "phone_number", user.PhoneNumber)
 	} else {
-		// Update last login for existing user
-		if err := s.userRepo.UpdateLastLogin(phoneNumber); err != nil {
-			s.logger.Errorw("Failed to update last login", "phone_number", phoneNumber, "error", err)
-			return nil, fmt.Errorf("failed to update last login: %w", err)
+		s.logger.Infow("User logged in", "user_id", user.ID, "phone_number", user.PhoneNumber)
+	}
+
+	return &VerificationResult{User: user, TestNumber: otp.IsTest}, nil
+}
+
+// findVerifySession looks up the session to verify, by session token or, for client apps
+// in phone number verify mode, as the latest session sent to the phone number
+func (s *otpService) findVerifySession(req *entity.VerifyOTPRequest, purpose string) (*entity.OTP, error) {
+	if req.PhoneNumber == "" {
+		otp, err := s.otpRepo.GetBySessionToken(hashSecret(s.cfg.OTP.HashPepper, req.Token))
+		if err != nil {
+			s.logger.Errorw("Failed to get OTP", "session_token", MaskToken(req.Token), "error", err)
+			return nil, fmt.Errorf("failed to verify OTP: %w", err)
 		}
-		s.logger.Infow("User logged in", "user_id", user.ID, "phone_number", phoneNumber)
+		return otp, nil
+	}
+
+	app, ok := s.cfg.ClientApps[req.ClientID]
+	if !ok || app.VerifyMode != config.VerifyModePhoneNumber {
+		s.logger.Warnw("Phone number verification not allowed", "client_id", req.ClientID, "phone_number", req.PhoneNumber)
+		return nil, ErrVerifyModeNotAllowed
+	}
+
+	otp, err := s.otpRepo.GetLatestByPhoneNumber(req.PhoneNumber, purpose, req.ClientID)
+	if err != nil {
+		s.logger.Errorw("Failed to get OTP", "phone_number", req.PhoneNumber, "client_id", req.ClientID, "error", err)
+		return nil, fmt.Errorf("failed to verify OTP: %w", err)
 	}
 
-	return user, nil
+	return otp, nil
 }
 
-// IsRateLimited checks if the phone number has exceeded the rate limit
-func (s *otpService) IsRateLimited(phoneNumber string) (bool, error) {
-	rateLimitInfo, err := s.rateLimitRepo.GetRateLimit(phoneNumber)
+// payloadMatches compares the payload hash of a session with the hash of the submitted payload
+func payloadMatches(stored *string, payloadHash string) bool {
+	if stored == nil {
+		return payloadHash == ""
+	}
+	return *stored == payloadHash
+}
+
+// checkDestination refuses phone numbers the destination policy does not allow and counts the refusal
+func (s *otpService) checkDestination(phoneNumber string) error {
+	err := s.destinations.Check(phoneNumber)
+
+	var destinationErr *DestinationError
+	if errors.As(err, &destinationErr) {
+		reason := destinationErr.Prefix
+		if reason == "" {
+			reason = "unlisted"
+		}
+		metrics.IncDestinationDenied(reason)
+		s.logger.Warnw("OTP refused by destination policy", "phone_number", phoneNumber, "reason", reason)
+	}
+
+	return err
+}
+
+// checkLockout returns a LockoutError while the phone number is locked out
+func (s *otpService) checkLockout(phoneNumber string) error {
+	lockout, err := s.lockoutRepo.Get(phoneNumber)
 	if err != nil {
-		return false, fmt.Errorf("failed to get rate limit info: %w", err)
+		s.logger.Errorw("Failed to check lockout", "phone_number", phoneNumber, "error", err)
+		return fmt.Errorf("failed to check lockout: %w", err)
 	}
 
-	if rateLimitInfo == nil {
-		// No previous requests, not rate limited
-		return false, nil
+	if lockout.IsLocked(time.Now()) {
+		s.logger.Warnw("Phone number is locked out", "phone_number", phoneNumber, "locked_until", *lockout.LockedUntil)
+		return &LockoutError{LockedUntil: *lockout.LockedUntil}
 	}
 
-	now := time.Now()
-	windowStart := rateLimitInfo.WindowStartAt
-	windowDuration := s.cfg.RateLimit.WindowDuration
+	return nil
+}
 
-	// Check if we're still in the same window
-	if now.Sub(windowStart) >= windowDuration {
-		// Window has expired, reset the counter
-		return false, nil
+// burnSession records a burned session and locks the phone number after too many of them
+func (s *otpService) burnSession(otp *entity.OTP) {
+	lockout, err := s.lockoutRepo.RecordBurnedSession(otp.PhoneNumber, s.cfg.OTP.LockoutWindow, s.cfg.OTP.LockoutThreshold, s.cfg.OTP.LockoutDuration)
+	if err != nil {
+		s.logger.Errorw("Failed to record burned OTP session", "otp_id", otp.ID, "phone_number", otp.PhoneNumber, "error", err)
+		return
 	}
 
-	// Check if request count exceeds limit
-	return rateLimitInfo.RequestCount >= s.cfg.RateLimit.MaxRequests, nil
+	s.logger.Warnw("OTP session burned", "otp_id", otp.ID, "phone_number", otp.PhoneNumber, "burned_sessions", lockout.BurnedSessions)
+	if lockout.IsLocked(time.Now()) {
+		s.logger.Warnw("Phone number locked out", "phone_number", otp.PhoneNumber, "locked_until", *lockout.LockedUntil)
+	}
 }
 
-// updateRateLimit updates the rate limiting information
-func (s *otpService) updateRateLimit(phoneNumber string) error {
-	rateLimitInfo, err := s.rateLimitRepo.GetRateLimit(phoneNumber)
+// consumeRateLimit counts a send against every enabled rate limit, as changed by admin
+// overrides, and against the throttles of anomalous prefixes and IPs. It returns the state
+// of the most constrained limit, a RateLimitError naming the exhausted dimension, or a
+// SuspendedError when anomaly detection blocks the send. With more than one limit, all are
+// checked before any is counted so a send refused by one limit does not use up the others.
+func (s *otpService) consumeRateLimit(phoneNumber, clientIP, deviceID string) (*entity.RateLimitResult, error) {
+	now := time.Now()
+
+	checks, err := s.sendRateLimitChecks(phoneNumber, clientIP, deviceID, s.anomalies.Restrictions(phoneNumber, clientIP), now)
 	if err != nil {
-		return fmt.Errorf("failed to get rate limit info: %w", err)
+		return nil, err
+	}
+
+	if len(checks) > 1 {
+		for _, check := range checks {
+			result, err := s.rateLimitRepo.Peek(check.key, check.policy, now)
+			if err != nil {
+				s.logger.Errorw("Failed to check rate limit", "dimension", check.dimension, "key", check.key, "error", err)
+				return nil, fmt.Errorf("failed to check rate limit: %w", err)
+			}
+			if !result.Allowed {
+				return nil, s.rateLimitExceeded(phoneNumber, check, result)
+			}
+		}
 	}
 
+	// Each limit is counted atomically; a concurrent send may still exhaust one after the check above
+	var constrained *entity.RateLimitResult
+	for _, check := range checks {
+		result, err := s.rateLimitRepo.Allow(check.key, check.policy, now)
+		if err != nil {
+			s.logger.Errorw("Failed to check rate limit", "dimension", check.dimension, "key", check.key, "error", err)
+			return nil, fmt.Errorf("failed to check rate limit: %w", err)
+		}
+		if !result.Allowed {
+			return nil, s.rateLimitExceeded(phoneNumber, check, result)
+		}
+
+		if moreConstrained(result, constrained) {
+			constrained = result
+		}
+	}
+
+	return constrained, nil
+}
+
+// RateLimitState returns the state of the most constrained limit a send to phoneNumber from
+// clientIP and deviceID is counted against, without counting anything. Limits whose value is
+// unknown (e.g. an empty phone number) are left out; it returns nil when none applies.
+func (s *otpService) RateLimitState(phoneNumber, clientIP, deviceID string) (*entity.RateLimitResult, error) {
 	now := time.Now()
 
-	if rateLimitInfo == nil {
-		// First request
-		rateLimitInfo = &entity.RateLimitInfo{
-			PhoneNumber:   phoneNumber,
-			RequestCount:  1,
-			LastRequestAt: now,
-			WindowStartAt: now,
+	// Blocked sends still report their regular limits and throttles
+	var throttles []entity.AnomalyRestriction
+	for _, r := range s.anomalies.Restrictions(phoneNumber, clientIP) {
+		if r.Action == config.AnomalyActionThrottle {
+			throttles = append(throttles, r)
 		}
-	} else {
-		// Check if we need to reset the window
-		if now.Sub(rateLimitInfo.WindowStartAt) >= s.cfg.RateLimit.WindowDuration {
-			// Reset window
-			rateLimitInfo.RequestCount = 1
-			rateLimitInfo.WindowStartAt = now
-		} else {
-			// Increment counter
-			rateLimitInfo.RequestCount++
+	}
+
+	checks, err := s.sendRateLimitChecks(phoneNumber, clientIP, deviceID, throttles, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var constrained *entity.RateLimitResult
+	for _, check := range checks {
+		result, err := s.rateLimitRepo.Peek(check.key, check.policy, now)
+		if err != nil {
+			s.logger.Errorw("Failed to check rate limit", "dimension", check.dimension, "key", check.key, "error", err)
+			return nil, fmt.Errorf("failed to check rate limit: %w", err)
+		}
+		if moreConstrained(result, constrained) {
+			constrained = result
 		}
-		rateLimitInfo.LastRequestAt = now
 	}
 
-	return s.rateLimitRepo.UpdateRateLimit(rateLimitInfo)
+	return constrained, nil
 }
 
-// generateOTPCode generates a random OTP code
-func (s *otpService) generateOTPCode() (string, error) {
-	maxValue := big.NewInt(1)
-	for i := 0; i < s.cfg.OTP.Length; i++ {
-		maxValue.Mul(maxValue, big.NewInt(10))
+// sendRateLimitChecks returns the limits a send is counted against, with admin overrides
+// applied, or a SuspendedError when one of the anomaly restrictions blocks the send
+func (s *otpService) sendRateLimitChecks(phoneNumber, clientIP, deviceID string, restrictions []entity.AnomalyRestriction, now time.Time) ([]rateLimitCheck, error) {
+	checks := rateLimitChecks(s.cfg.RateLimit, phoneNumber, clientIP, deviceID)
+
+	anomalyChecks, err := anomalyRateLimitChecks(s.cfg, restrictions)
+	if err != nil {
+		s.logger.Warnw("OTP refused by anomaly detection", "phone_number", phoneNumber, "client_ip", clientIP, "error", err)
+		return nil, err
+	}
+	checks = append(checks, anomalyChecks...)
+
+	keys := make([]string, len(checks))
+	for i, check := range checks {
+		keys[i] = check.key
 	}
+	overrides, err := s.rateLimitRepo.GetOverrides(keys, now)
+	if err != nil {
+		s.logger.Errorw("Failed to get rate limit overrides", "phone_number", phoneNumber, "error", err)
+		return nil, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	applyRateLimitOverrides(checks, overrides)
 
-	randomNumber, err := rand.Int(rand.Reader, maxValue)
+	return checks, nil
+}
+
+// moreConstrained reports whether result leaves fewer requests than constrained, or as many
+// but for longer
+func moreConstrained(result, constrained *entity.RateLimitResult) bool {
+	return constrained == nil || result.Remaining < constrained.Remaining ||
+		(result.Remaining == constrained.Remaining && result.ResetAt.After(constrained.ResetAt))
+}
+
+// rateLimitExceeded logs a refused send and returns the RateLimitError for the dimension that refused it
+func (s *otpService) rateLimitExceeded(phoneNumber string, check rateLimitCheck, result *entity.RateLimitResult) error {
+	s.logger.Warnw("Rate limit exceeded", "phone_number", phoneNumber, "dimension", check.dimension, "key", check.key, "algorithm", check.policy.Algorithm, "limit", result.Limit, "retry_at", result.RetryAt)
+	return &RateLimitError{Dimension: check.dimension, Limit: result.Limit, Window: check.policy.Window, RetryAt: result.RetryAt, ResetAt: result.ResetAt}
+}
+
+// IsRateLimited checks if the phone number has exceeded the rate limit
+func (s *otpService) IsRateLimited(phoneNumber string) (bool, error) {
+	result, err := s.rateLimitRepo.Peek(phoneNumber, s.cfg.RateLimit.Policy(), time.Now())
 	if err != nil {
-		return "", fmt.Errorf("failed to generate random number: %w", err)
+		return false, fmt.Errorf("failed to get rate limit info: %w", err)
 	}
 
-	// Format with leading zeros
-	format := fmt.Sprintf("%%0%dd", s.cfg.OTP.Length)
-	return fmt.Sprintf(format, randomNumber), nil
+	return !result.Allowed, nil
+}
+
+// issueOTPCode returns the code for a new send: the known code for test numbers, a random one otherwise
+func (s *otpService) issueOTPCode(purpose, phoneNumber string, testNumber bool) (string, error) {
+	if !testNumber {
+		return s.generateOTPCode(purpose)
+	}
+
+	if s.cfg.TestNumbers.Code != "" {
+		return s.cfg.TestNumbers.Code, nil
+	}
+
+	// Derived from the number so reviewers can be told the rule rather than a code
+	length := s.cfg.OTP.CodePolicy(purpose).Length
+	digits := strings.TrimPrefix(phoneNumber, "+")
+	if len(digits) >= length {
+		return digits[len(digits)-length:], nil
+	}
+	return strings.Repeat("0", length-len(digits)) + digits, nil
+}
+
+// generateOTPCode generates a random code following the purpose's code policy
+func (s *otpService) generateOTPCode(purpose string) (string, error) {
+	policy := s.cfg.OTP.CodePolicy(purpose)
+	characters := policy.Characters()
+	maxValue := big.NewInt(int64(len(characters)))
+
+	code := make([]byte, policy.Length)
+	for i := range code {
+		randomNumber, err := rand.Int(rand.Reader, maxValue)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate random number: %w", err)
+		}
+		code[i] = characters[randomNumber.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// normalizeOTPCode checks a submitted code against the purpose's code policy. Alphanumeric
+// codes are accepted in any case.
+func (s *otpService) normalizeOTPCode(purpose, code string) (string, error) {
+	policy := s.cfg.OTP.CodePolicy(purpose)
+
+	code = strings.TrimSpace(code)
+	if policy.Alphabet == config.CodeAlphabetAlphanumeric {
+		code = strings.ToUpper(code)
+	}
+
+	if len(code) != policy.Length {
+		return "", fmt.Errorf("%w: code must be exactly %d characters long", ErrInvalidCodeFormat, policy.Length)
+	}
+	for _, r := range code {
+		if !strings.ContainsRune(policy.Characters(), r) {
+			return "", fmt.Errorf("%w: code must be %s", ErrInvalidCodeFormat, policy.Alphabet)
+		}
+	}
+
+	return code, nil
 }
 
 // generateSessionToken generates a random session token
@@ -244,7 +1140,7 @@ func (s *otpService) generateSessionToken() (string, error) {
 	return fmt.Sprintf("%x", bytes), nil
 }
 
-// CleanupExpiredOTPs removes expired OTPs and old rate limit records
+// CleanupExpiredOTPs removes expired OTPs, delivered outbox messages and old rate limit records
 func (s *otpService) CleanupExpiredOTPs() error {
 	// Delete expired OTPs
 	if err := s.otpRepo.DeleteExpired(); err != nil {
@@ -252,8 +1148,27 @@ func (s *otpService) CleanupExpiredOTPs() error {
 		return fmt.Errorf("failed to delete expired OTPs: %w", err)
 	}
 
-	// Cleanup old rate limit records (older than 24 hours)
+	// Cleanup delivered outbox messages, conversion stats and old rate limit records (older than 24 hours)
 	olderThan := time.Now().Add(-24 * time.Hour)
+	deleted, err := s.outboxRepo.DeleteSentBefore(olderThan)
+	if err != nil {
+		s.logger.Errorw("Failed to delete sent outbox messages", "error", err)
+		return fmt.Errorf("failed to delete sent outbox messages: %w", err)
+	}
+	if deleted > 0 {
+		s.logger.Infow("Deleted sent outbox messages", "count", deleted, "older_than", olderThan)
+	}
+
+	if err := s.lockoutRepo.DeleteStale(time.Now().Add(-s.cfg.OTP.LockoutWindow)); err != nil {
+		s.logger.Errorw("Failed to delete stale lockouts", "error", err)
+		return fmt.Errorf("failed to delete stale lockouts: %w", err)
+	}
+
+	if err := s.otpRepo.DeleteConversionStatsBefore(olderThan); err != nil {
+		s.logger.Errorw("Failed to delete old conversion stats", "error", err)
+		return fmt.Errorf("failed to delete old conversion stats: %w", err)
+	}
+
 	if err := s.rateLimitRepo.CleanupRateLimits(olderThan); err != nil {
 		s.logger.Errorw("Failed to cleanup rate limits", "error", err)
 		return fmt.Errorf("failed to cleanup rate limits: %w", err)
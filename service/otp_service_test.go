@@ -0,0 +1,789 @@
+package service
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/repository"
+	"otp-auth/test"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const serviceTestPepper = "service-test-pepper"
+
+// memoryOTPRepository keeps OTP sessions in memory with the same conditions as the SQL repository
+type memoryOTPRepository struct {
+	mu         sync.Mutex
+	nextID     int
+	otps       map[int]*entity.OTP
+	conversion map[string]map[string]*entity.ConversionStat // keyed by dimension, then key
+}
+
+// newMemoryOTPRepository creates an empty in-memory OTP repository
+func newMemoryOTPRepository() *memoryOTPRepository {
+	return &memoryOTPRepository{otps: make(map[int]*entity.OTP), conversion: make(map[string]map[string]*entity.ConversionStat)}
+}
+
+// Create stores a new session
+func (r *memoryOTPRepository) Create(otp *entity.OTP) (*entity.OTP, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	created := *otp
+	created.ID = r.nextID
+	created.CreatedAt = time.Now()
+	created.LastSentAt = created.CreatedAt
+	created.IsUsed = false
+	created.DeliveryStatus = entity.DeliveryStatusQueued
+	if created.Purpose == "" {
+		created.Purpose = entity.PurposeLogin
+	}
+	r.otps[created.ID] = &created
+
+	return r.copy(&created), nil
+}
+
+// CreateTx stores a new session
+func (r *memoryOTPRepository) CreateTx(tx *sqlx.Tx, otp *entity.OTP) (*entity.OTP, error) {
+	return r.Create(otp)
+}
+
+// GetByID returns a session by ID
+func (r *memoryOTPRepository) GetByID(id int) (*entity.OTP, error) {
+	return r.find(func(otp *entity.OTP) bool { return otp.ID == id }), nil
+}
+
+// GetBySessionToken returns a session by its session token digest
+func (r *memoryOTPRepository) GetBySessionToken(sessionToken string) (*entity.OTP, error) {
+	return r.find(func(otp *entity.OTP) bool { return otp.SessionToken == sessionToken }), nil
+}
+
+// GetByLinkToken returns a session by its magic link token digest
+func (r *memoryOTPRepository) GetByLinkToken(linkToken string) (*entity.OTP, error) {
+	return r.find(func(otp *entity.OTP) bool { return otp.LinkToken != nil && *otp.LinkToken == linkToken }), nil
+}
+
+// GetByProviderMessageID returns the session a provider message belongs to
+func (r *memoryOTPRepository) GetByProviderMessageID(providerMessageID string) (*entity.OTP, error) {
+	return r.find(func(otp *entity.OTP) bool {
+		return otp.ProviderMessageID != nil && *otp.ProviderMessageID == providerMessageID
+	}), nil
+}
+
+// UpdateDeliveryStatus records the delivery state unless the session was delivered
+func (r *memoryOTPRepository) UpdateDeliveryStatus(id int, status, channel, providerMessageID string) error {
+	r.update(id, func(otp *entity.OTP) bool {
+		if otp.DeliveryStatus == entity.DeliveryStatusDelivered {
+			return false
+		}
+		otp.DeliveryStatus = status
+		if channel != "" {
+			otp.DeliveryChannel = &channel
+		}
+		if providerMessageID != "" {
+			otp.ProviderMessageID = &providerMessageID
+		}
+		return true
+	})
+	return nil
+}
+
+// IncrementAttempts counts an attempt on an open session with attempts left
+func (r *memoryOTPRepository) IncrementAttempts(id int) (*entity.OTP, error) {
+	return r.update(id, func(otp *entity.OTP) bool {
+		if !r.open(otp) || otp.Attempts >= otp.MaxAttempts {
+			return false
+		}
+		otp.Attempts++
+		return true
+	}), nil
+}
+
+// CancelTx cancels a session that is neither used nor cancelled
+func (r *memoryOTPRepository) CancelTx(tx *sqlx.Tx, id int) (bool, error) {
+	cancelled := r.update(id, func(otp *entity.OTP) bool {
+		if otp.IsUsed || otp.CancelledAt != nil {
+			return false
+		}
+		now := time.Now()
+		otp.CancelledAt = &now
+		return true
+	})
+	return cancelled != nil, nil
+}
+
+// ResendTx replaces the code of a session that may be resent
+func (r *memoryOTPRepository) ResendTx(tx *sqlx.Tx, id int, code string, linkToken *string, expiresAt time.Time, maxResends int, sentBefore time.Time) (*entity.OTP, error) {
+	return r.update(id, func(otp *entity.OTP) bool {
+		if otp.IsUsed || otp.CancelledAt != nil || otp.Attempts >= otp.MaxAttempts ||
+			otp.ResendCount >= maxResends || otp.LastSentAt.After(sentBefore) {
+			return false
+		}
+		otp.Code = code
+		otp.LinkToken = linkToken
+		otp.ExpiresAt = expiresAt
+		otp.ResendCount++
+		otp.LastSentAt = time.Now()
+		otp.DeliveryStatus = entity.DeliveryStatusQueued
+		otp.DeliveryChannel = nil
+		otp.ProviderMessageID = nil
+		return true
+	}), nil
+}
+
+// GetLatestByPhoneNumber returns the latest session of a purpose sent to a phone number through a client app
+func (r *memoryOTPRepository) GetLatestByPhoneNumber(phoneNumber, purpose, clientID string) (*entity.OTP, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var latest *entity.OTP
+	for _, otp := range r.otps {
+		if otp.PhoneNumber != phoneNumber || otp.Purpose != purpose || otp.ClientID == nil || *otp.ClientID != clientID {
+			continue
+		}
+		if latest == nil || otp.ID > latest.ID {
+			latest = otp
+		}
+	}
+
+	return r.copy(latest), nil
+}
+
+// ConsumeTx marks an open session as used
+func (r *memoryOTPRepository) ConsumeTx(tx *sqlx.Tx, id int) (*entity.OTP, error) {
+	return r.update(id, func(otp *entity.OTP) bool {
+		if !r.open(otp) {
+			return false
+		}
+		now := time.Now()
+		otp.IsUsed = true
+		otp.UsedAt = &now
+		return true
+	}), nil
+}
+
+// DeleteExpired removes expired sessions
+func (r *memoryOTPRepository) DeleteExpired() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, otp := range r.otps {
+		if time.Now().After(otp.ExpiresAt) {
+			delete(r.otps, id)
+		}
+	}
+	return nil
+}
+
+// RecordConversionTx counts a session as sent or verified for its calling code and client IP
+func (r *memoryOTPRepository) RecordConversionTx(tx *sqlx.Tx, otp *entity.OTP, verified bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for dimension, key := range map[string]*string{
+		entity.RateLimitDimensionCountry: otp.CallingCode,
+		entity.RateLimitDimensionIP:      otp.ClientIP,
+	} {
+		if key == nil {
+			continue
+		}
+		if r.conversion[dimension] == nil {
+			r.conversion[dimension] = make(map[string]*entity.ConversionStat)
+		}
+		stat := r.conversion[dimension][*key]
+		if stat == nil {
+			stat = &entity.ConversionStat{Key: *key}
+			r.conversion[dimension][*key] = stat
+		}
+		if verified {
+			stat.Verified++
+		} else {
+			stat.Sent++
+		}
+	}
+	return nil
+}
+
+// GetConversionStats returns the recorded stats of a dimension with at least minSent sessions
+func (r *memoryOTPRepository) GetConversionStats(dimension string, since time.Time, minSent int) ([]entity.ConversionStat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var stats []entity.ConversionStat
+	for _, stat := range r.conversion[dimension] {
+		if stat.Sent >= minSent {
+			stats = append(stats, *stat)
+		}
+	}
+	return stats, nil
+}
+
+// DeleteConversionStatsBefore does nothing
+func (r *memoryOTPRepository) DeleteConversionStatsBefore(olderThan time.Time) error {
+	return nil
+}
+
+// all returns copies of every stored session
+func (r *memoryOTPRepository) all() []entity.OTP {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	otps := make([]entity.OTP, 0, len(r.otps))
+	for _, otp := range r.otps {
+		otps = append(otps, *otp)
+	}
+	return otps
+}
+
+// set changes a stored session in place, e.g. to expire it
+func (r *memoryOTPRepository) set(t *testing.T, id int, change func(otp *entity.OTP)) {
+	require.NotNil(t, r.update(id, func(otp *entity.OTP) bool {
+		change(otp)
+		return true
+	}))
+}
+
+// open reports whether a session can still be verified
+func (r *memoryOTPRepository) open(otp *entity.OTP) bool {
+	return !otp.IsUsed && otp.CancelledAt == nil && time.Now().Before(otp.ExpiresAt)
+}
+
+// find returns a copy of the first session matching a condition
+func (r *memoryOTPRepository) find(match func(otp *entity.OTP) bool) *entity.OTP {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, otp := range r.otps {
+		if match(otp) {
+			return r.copy(otp)
+		}
+	}
+	return nil
+}
+
+// update applies a change to a session and returns a copy when the change applied
+func (r *memoryOTPRepository) update(id int, change func(otp *entity.OTP) bool) *entity.OTP {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	otp, ok := r.otps[id]
+	if !ok || !change(otp) {
+		return nil
+	}
+	return r.copy(otp)
+}
+
+// copy returns a copy of a session so callers cannot change the stored one
+func (r *memoryOTPRepository) copy(otp *entity.OTP) *entity.OTP {
+	if otp == nil {
+		return nil
+	}
+	copied := *otp
+	return &copied
+}
+
+// memoryOutboxRepository keeps queued deliveries in memory
+type memoryOutboxRepository struct {
+	repository.OutboxRepository
+	mu       sync.Mutex
+	messages []entity.OutboxMessage
+}
+
+// EnqueueTx queues a pending message
+func (r *memoryOutboxRepository) EnqueueTx(tx *sqlx.Tx, msg *entity.OutboxMessage) (*entity.OutboxMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	queued := *msg
+	queued.ID = len(r.messages) + 1
+	queued.Status = entity.OutboxStatusPending
+	queued.Attempts = 0
+	if queued.NextAttemptAt.IsZero() {
+		queued.NextAttemptAt = time.Now()
+	}
+	r.messages = append(r.messages, queued)
+
+	return &queued, nil
+}
+
+// Enqueue queues a pending message, e.g. a fallback
+func (r *memoryOutboxRepository) Enqueue(msg *entity.OutboxMessage) (*entity.OutboxMessage, error) {
+	return r.EnqueueTx(nil, msg)
+}
+
+// ClaimDue claims due messages and those whose lease expired like the SQL repository
+func (r *memoryOutboxRepository) ClaimDue(limit int, lease time.Duration) ([]entity.OutboxMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var claimed []entity.OutboxMessage
+	for i := range r.messages {
+		msg := &r.messages[i]
+		due := msg.Status == entity.OutboxStatusPending && !msg.NextAttemptAt.After(now)
+		abandoned := msg.Status == entity.OutboxStatusProcessing && msg.LockedUntil != nil && msg.LockedUntil.Before(now)
+		if len(claimed) == limit || !due && !abandoned {
+			continue
+		}
+		lockedUntil := now.Add(lease)
+		msg.Status = entity.OutboxStatusProcessing
+		msg.Attempts++
+		msg.LockedUntil = &lockedUntil
+		claimed = append(claimed, *msg)
+	}
+	return claimed, nil
+}
+
+// MarkSent records a delivered message and drops its payload
+func (r *memoryOutboxRepository) MarkSent(id int, provider, providerMessageID string) error {
+	r.mark(id, func(msg *entity.OutboxMessage) {
+		msg.Status = entity.OutboxStatusSent
+		msg.Code = ""
+		msg.Body = ""
+		msg.Provider = &provider
+		msg.ProviderMessageID = &providerMessageID
+		msg.LockedUntil = nil
+	})
+	return nil
+}
+
+// MarkRetry releases a claimed message for another attempt
+func (r *memoryOutboxRepository) MarkRetry(id int, nextAttemptAt time.Time, lastError string) error {
+	r.mark(id, func(msg *entity.OutboxMessage) {
+		if msg.Status != entity.OutboxStatusProcessing {
+			return
+		}
+		msg.Status = entity.OutboxStatusPending
+		msg.NextAttemptAt = nextAttemptAt
+		msg.LastError = &lastError
+		msg.LockedUntil = nil
+	})
+	return nil
+}
+
+// MarkDead dead-letters a claimed message and drops its payload
+func (r *memoryOutboxRepository) MarkDead(id int, lastError string) error {
+	r.mark(id, func(msg *entity.OutboxMessage) {
+		if msg.Status != entity.OutboxStatusProcessing {
+			return
+		}
+		msg.Status = entity.OutboxStatusDead
+		msg.Code = ""
+		msg.Body = ""
+		msg.LastError = &lastError
+		msg.LockedUntil = nil
+	})
+	return nil
+}
+
+// MarkSkipped closes a message and drops its payload
+func (r *memoryOutboxRepository) MarkSkipped(id int, reason string) error {
+	r.mark(id, func(msg *entity.OutboxMessage) {
+		msg.Status = entity.OutboxStatusSkipped
+		msg.Code = ""
+		msg.Body = ""
+		msg.LastError = &reason
+		msg.LockedUntil = nil
+	})
+	return nil
+}
+
+// GetLatestByOTPID returns the last message queued for a session
+func (r *memoryOutboxRepository) GetLatestByOTPID(otpID int) (*entity.OutboxMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.messages) - 1; i >= 0; i-- {
+		if msg := r.messages[i]; msg.OTPID != nil && *msg.OTPID == otpID {
+			return &msg, nil
+		}
+	}
+	return nil, nil
+}
+
+// SkipPendingTx skips the pending and claimed messages of a session and drops their payload
+func (r *memoryOutboxRepository) SkipPendingTx(tx *sqlx.Tx, otpID int, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.messages {
+		msg := &r.messages[i]
+		if msg.OTPID != nil && *msg.OTPID == otpID && (msg.Status == entity.OutboxStatusPending || msg.Status == entity.OutboxStatusProcessing) {
+			msg.Status = entity.OutboxStatusSkipped
+			msg.Code = ""
+			msg.Body = ""
+			msg.LastError = &reason
+			msg.LockedUntil = nil
+		}
+	}
+	return nil
+}
+
+// ReleasePending makes the pending messages of a session due now
+func (r *memoryOutboxRepository) ReleasePending(otpID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for i := range r.messages {
+		msg := &r.messages[i]
+		if msg.OTPID != nil && *msg.OTPID == otpID && msg.Status == entity.OutboxStatusPending && msg.NextAttemptAt.After(now) {
+			msg.NextAttemptAt = now
+		}
+	}
+	return nil
+}
+
+// mark applies an outcome to a stored message
+func (r *memoryOutboxRepository) mark(id int, change func(msg *entity.OutboxMessage)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.messages {
+		if r.messages[i].ID == id {
+			change(&r.messages[i])
+		}
+	}
+}
+
+// forOTP returns copies of the messages queued for a session
+func (r *memoryOutboxRepository) forOTP(otpID int) []entity.OutboxMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var messages []entity.OutboxMessage
+	for _, msg := range r.messages {
+		if msg.OTPID != nil && *msg.OTPID == otpID {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// memoryReceiptRepository keeps delivery receipts in memory
+type memoryReceiptRepository struct {
+	mu       sync.Mutex
+	receipts []entity.DeliveryReceipt
+}
+
+// Create stores a receipt
+func (r *memoryReceiptRepository) Create(receipt *entity.DeliveryReceipt) (*entity.DeliveryReceipt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	created := *receipt
+	created.ID = len(r.receipts) + 1
+	created.ReceivedAt = time.Now()
+	r.receipts = append(r.receipts, created)
+
+	return &created, nil
+}
+
+// ListByOTPID returns the receipts of a session in the order they were received
+func (r *memoryReceiptRepository) ListByOTPID(otpID int) ([]entity.DeliveryReceipt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var receipts []entity.DeliveryReceipt
+	for _, receipt := range r.receipts {
+		if receipt.OTPID != nil && *receipt.OTPID == otpID {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts, nil
+}
+
+// memoryLockoutRepository counts burned sessions in memory like the SQL repository
+type memoryLockoutRepository struct {
+	mu       sync.Mutex
+	lockouts map[string]*entity.Lockout
+}
+
+// Get returns the lockout record of a phone number
+func (r *memoryLockoutRepository) Get(phoneNumber string) (*entity.Lockout, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lockout, ok := r.lockouts[phoneNumber]
+	if !ok {
+		return nil, nil
+	}
+	copied := *lockout
+	return &copied, nil
+}
+
+// RecordBurnedSession counts a burned session and locks the phone number at the threshold
+func (r *memoryLockoutRepository) RecordBurnedSession(phoneNumber string, window time.Duration, threshold int, duration time.Duration) (*entity.Lockout, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	lockout, ok := r.lockouts[phoneNumber]
+	if !ok || lockout.WindowStartAt.Before(now.Add(-window)) {
+		previous := lockout
+		lockout = &entity.Lockout{PhoneNumber: phoneNumber, WindowStartAt: now}
+		if previous != nil {
+			lockout.LockedUntil = previous.LockedUntil
+		}
+		r.lockouts[phoneNumber] = lockout
+	}
+
+	lockout.BurnedSessions++
+	if lockout.BurnedSessions >= threshold {
+		lockedUntil := now.Add(duration)
+		lockout.LockedUntil = &lockedUntil
+	}
+
+	copied := *lockout
+	return &copied, nil
+}
+
+// DeleteStale does nothing
+func (r *memoryLockoutRepository) DeleteStale(olderThan time.Time) error {
+	return nil
+}
+
+// memoryUserRepository provisions users in memory
+type memoryUserRepository struct {
+	repository.UserRepository
+	mu    sync.Mutex
+	users map[string]*entity.User
+}
+
+// UpsertByPhoneNumberTx returns the user of a phone number, creating it on first login
+func (r *memoryUserRepository) UpsertByPhoneNumberTx(tx *sqlx.Tx, phoneNumber string) (*entity.User, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	user, ok := r.users[phoneNumber]
+	if !ok {
+		user = &entity.User{ID: len(r.users) + 1, PhoneNumber: phoneNumber, RegisteredAt: now, IsActive: true}
+		r.users[phoneNumber] = user
+	}
+	user.LastLoginAt = &now
+
+	copied := *user
+	return &copied, !ok, nil
+}
+
+// memoryTxManager runs the function without a transaction; the memory repositories ignore tx
+type memoryTxManager struct{}
+
+// WithinTransaction runs fn
+func (memoryTxManager) WithinTransaction(fn func(tx *sqlx.Tx) error) error {
+	return fn(nil)
+}
+
+// serviceTestRepositories are the in-memory repositories behind a service under test
+type serviceTestRepositories struct {
+	otps       *memoryOTPRepository
+	outbox     *memoryOutboxRepository
+	receipts   *memoryReceiptRepository
+	lockouts   *memoryLockoutRepository
+	users      *memoryUserRepository
+	rateLimits repository.RateLimitRepository
+}
+
+// serviceTestConfig returns a configuration for service tests; tests adjust it before building the service
+func serviceTestConfig() *config.Config {
+	return &config.Config{
+		OTP: config.OTP{
+			Length:            6,
+			Alphabet:          config.CodeAlphabetNumeric,
+			ExpirationTime:    2 * time.Minute,
+			HashPepper:        serviceTestPepper,
+			MaxVerifyAttempts: 3,
+			LockoutThreshold:  2,
+			LockoutWindow:     time.Hour,
+			LockoutDuration:   time.Hour,
+			ResendCooldown:    30 * time.Second,
+			MaxResends:        2,
+		},
+		Messages: config.Messages{DefaultLocale: "en", AppName: "Test"},
+		RateLimit: config.RateLimit{
+			MaxRequests:    100,
+			WindowDuration: time.Hour,
+			Algorithm:      config.RateLimitFixedWindow,
+		},
+		Delivery:  config.Delivery{Channels: []string{ChannelSMS}},
+		Outbox:    config.Outbox{MaxAttempts: 3},
+		JWT:       config.JWT{Secret: "service-test-secret"},
+		MagicLink: config.MagicLink{BaseURL: "https://auth.example.com", RedirectURL: "https://app.example.com/signed-in"},
+	}
+}
+
+// newServiceTestService wires an OTP service against in-memory repositories
+func newServiceTestService(t *testing.T, cfg *config.Config) (*otpService, *serviceTestRepositories) {
+	templates := make([]entity.MessageTemplate, 0, len(entity.Purposes))
+	for _, purpose := range entity.Purposes {
+		templates = append(templates, entity.MessageTemplate{Locale: "en", Purpose: purpose, Body: "Your {{.AppName}} code is {{.Code}}"})
+	}
+	renderer, err := NewMessageRenderer(templates, "en", entity.Purposes)
+	require.NoError(t, err)
+
+	destinations, err := NewDestinationPolicy(config.DestinationPolicy{Source: config.DestinationPolicySourceNone}, nil, test.GetTestLogger())
+	require.NoError(t, err)
+
+	repos := &serviceTestRepositories{
+		otps:       newMemoryOTPRepository(),
+		outbox:     &memoryOutboxRepository{},
+		receipts:   &memoryReceiptRepository{},
+		lockouts:   &memoryLockoutRepository{lockouts: make(map[string]*entity.Lockout)},
+		users:      &memoryUserRepository{users: make(map[string]*entity.User)},
+		rateLimits: repository.NewMemoryRateLimitRepository(),
+	}
+
+	svc := NewOTPService(
+		repos.otps,
+		repos.users,
+		repos.rateLimits,
+		repos.lockouts,
+		repos.outbox,
+		repos.receipts,
+		memoryTxManager{},
+		renderer,
+		destinations,
+		NewAnomalyDetector(repos.otps, cfg.Anomaly, test.GetTestLogger()),
+		cfg,
+		test.GetTestLogger(),
+	)
+
+	return svc.(*otpService), repos
+}
+
+// sentPayload opens the code and body of the last message queued for a session
+func sentPayload(t *testing.T, repos *serviceTestRepositories, otpID int) (string, string) {
+	messages := repos.outbox.forOTP(otpID)
+	require.NotEmpty(t, messages)
+
+	last := messages[len(messages)-1]
+	code, err := openSecret(serviceTestPepper, last.Code)
+	require.NoError(t, err)
+	body, err := openSecret(serviceTestPepper, last.Body)
+	require.NoError(t, err)
+
+	return code, body
+}
+
+// sendTestOTP starts a session and returns its token and the code queued for delivery
+func sendTestOTP(t *testing.T, svc *otpService, repos *serviceTestRepositories, req *entity.SendOTPRequest) (string, string) {
+	response, err := svc.SendOTP(req)
+	require.NoError(t, err)
+
+	code, _ := sentPayload(t, repos, sessionByToken(t, repos, response.Token).ID)
+	return response.Token, code
+}
+
+// wrongCode returns a code of the same length and alphabet that does not match code
+func wrongCode(code string) string {
+	if code[0] == '0' {
+		return "1" + code[1:]
+	}
+	return "0" + code[1:]
+}
+
+// sessionByToken returns the stored session of a session token
+func sessionByToken(t *testing.T, repos *serviceTestRepositories, token string) *entity.OTP {
+	otp, err := repos.otps.GetBySessionToken(hashSecret(serviceTestPepper, token))
+	require.NoError(t, err)
+	require.NotNil(t, otp)
+	return otp
+}
+
+// magicLinkToken extracts the magic link token from a message body
+func magicLinkToken(t *testing.T, body string) string {
+	_, token, ok := strings.Cut(body, magicLinkPath)
+	require.True(t, ok, "body has no magic link: %s", body)
+	return token
+}
+
+func TestSendOTP_StoresOnlyDigests(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+
+	response, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123", MagicLink: true})
+	require.NoError(t, err)
+
+	otp := sessionByToken(t, repos, response.Token)
+	code, body := sentPayload(t, repos, otp.ID)
+	linkToken := magicLinkToken(t, body)
+
+	assert.Equal(t, hashSecret(serviceTestPepper, code), otp.Code)
+	assert.Equal(t, hashSecret(serviceTestPepper, response.Token), otp.SessionToken)
+	require.NotNil(t, otp.LinkToken)
+	assert.Equal(t, hashSecret(serviceTestPepper, linkToken), *otp.LinkToken)
+
+	// Nothing stored with the session or its delivery reveals a secret
+	stored := otp.Code + otp.SessionToken + *otp.LinkToken
+	for _, msg := range repos.outbox.forOTP(otp.ID) {
+		stored += msg.Code + msg.Body
+	}
+	assert.NotContains(t, stored, code)
+	assert.NotContains(t, stored, response.Token)
+	assert.NotContains(t, stored, linkToken)
+}
+
+func TestVerifyOTP_MatchesStoredDigest(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+
+	response, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	require.NoError(t, err)
+	code, _ := sentPayload(t, repos, sessionByToken(t, repos, response.Token).ID)
+
+	// The stored digest itself is not accepted as the code or the token
+	otp := sessionByToken(t, repos, response.Token)
+	_, err = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: otp.SessionToken, Code: code})
+	assert.ErrorIs(t, err, ErrInvalidOTP)
+
+	result, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: response.Token, Code: code})
+	require.NoError(t, err)
+	require.NotNil(t, result.User)
+	assert.Equal(t, "+447700900123", result.User.PhoneNumber)
+	assert.True(t, sessionByToken(t, repos, response.Token).IsUsed)
+}
+
+func TestVerifyOTP_DigestDependsOnPepper(t *testing.T) {
+	cfg := serviceTestConfig()
+	svc, repos := newServiceTestService(t, cfg)
+
+	response, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	require.NoError(t, err)
+	code, _ := sentPayload(t, repos, sessionByToken(t, repos, response.Token).ID)
+
+	// A service keyed with another pepper finds neither the session nor the code
+	cfg.OTP.HashPepper = "rotated-pepper"
+	_, err = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: response.Token, Code: code})
+	assert.ErrorIs(t, err, ErrInvalidOTP)
+}
+
+func TestVerifyOTP_SkipsQueuedDeliveries(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+
+	response, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	require.NoError(t, err)
+	otp := sessionByToken(t, repos, response.Token)
+	code, _ := sentPayload(t, repos, otp.ID)
+
+	_, err = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: response.Token, Code: code})
+	require.NoError(t, err)
+
+	for _, msg := range repos.outbox.forOTP(otp.ID) {
+		assert.Equal(t, entity.OutboxStatusSkipped, msg.Status)
+		assert.Empty(t, msg.Code)
+		assert.Empty(t, msg.Body)
+	}
+}
+
+func TestMaskToken(t *testing.T) {
+	assert.Equal(t, "3f9c1e0a...", MaskToken("3f9c1e0a7b5d42c8"))
+	assert.Equal(t, "...", MaskToken("short"))
+	assert.Empty(t, MaskToken(""))
+}
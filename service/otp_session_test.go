@@ -0,0 +1,150 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"otp-auth/entity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSession_Pending(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	otp := sessionByToken(t, repos, token)
+
+	response, err := svc.GetSession(token)
+	require.NoError(t, err)
+
+	assert.Equal(t, entity.SessionStatusPending, response.Status)
+	assert.Equal(t, "+447*******23", response.PhoneNumber)
+	assert.Equal(t, entity.PurposeLogin, response.Purpose)
+	assert.Equal(t, otp.ExpiresAt, response.ExpiresAt)
+	assert.Equal(t, 3, response.RemainingAttempts)
+	assert.Equal(t, 2, response.RemainingResends)
+	require.NotNil(t, response.ResendAvailableAt)
+	assert.Equal(t, otp.LastSentAt.Add(30*time.Second), *response.ResendAvailableAt)
+	require.NotNil(t, response.Delivery)
+	assert.Equal(t, entity.DeliveryStatusQueued, response.Delivery.Status)
+	assert.Empty(t, response.Delivery.Receipts)
+}
+
+func TestGetSession_IncludesDeliveryReceipts(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	otp := sessionByToken(t, repos, token)
+
+	require.NoError(t, repos.otps.UpdateDeliveryStatus(otp.ID, entity.DeliveryStatusDelivered, ChannelSMS, "msg-1"))
+	_, err := repos.receipts.Create(&entity.DeliveryReceipt{OTPID: &otp.ID, ProviderMessageID: "msg-1", Status: entity.DeliveryStatusDelivered, ProviderStatus: "DELIVRD"})
+	require.NoError(t, err)
+
+	response, err := svc.GetSession(token)
+	require.NoError(t, err)
+
+	assert.Equal(t, entity.DeliveryStatusDelivered, response.Delivery.Status)
+	assert.Equal(t, ChannelSMS, response.Delivery.Channel)
+	require.Len(t, response.Delivery.Receipts, 1)
+	assert.Equal(t, entity.DeliveryStatusDelivered, response.Delivery.Receipts[0].Status)
+}
+
+func TestGetSession_UnknownToken(t *testing.T) {
+	svc, _ := newServiceTestService(t, serviceTestConfig())
+
+	_, err := svc.GetSession("unknown-token")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+func TestGetSession_Expired(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	repos.otps.set(t, sessionByToken(t, repos, token).ID, func(otp *entity.OTP) {
+		otp.ExpiresAt = time.Now().Add(-time.Minute)
+	})
+
+	response, err := svc.GetSession(token)
+	require.NoError(t, err)
+
+	// An expired session can still be resent
+	assert.Equal(t, entity.SessionStatusExpired, response.Status)
+	assert.NotNil(t, response.ResendAvailableAt)
+}
+
+func TestGetSession_Verified(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code})
+	require.NoError(t, err)
+
+	response, err := svc.GetSession(token)
+	require.NoError(t, err)
+
+	assert.Equal(t, entity.SessionStatusVerified, response.Status)
+	assert.Nil(t, response.ResendAvailableAt)
+}
+
+func TestCancelSession_Pending(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	otp := sessionByToken(t, repos, token)
+
+	require.NoError(t, svc.CancelSession(token))
+
+	response, err := svc.GetSession(token)
+	require.NoError(t, err)
+	assert.Equal(t, entity.SessionStatusCancelled, response.Status)
+	assert.Nil(t, response.ResendAvailableAt)
+
+	// Queued deliveries are dropped and the code can neither be verified nor resent
+	for _, msg := range repos.outbox.forOTP(otp.ID) {
+		assert.Equal(t, entity.OutboxStatusSkipped, msg.Status)
+		assert.Empty(t, msg.Code)
+	}
+	_, err = svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code})
+	assert.ErrorIs(t, err, ErrInvalidOTP)
+	repos.otps.set(t, otp.ID, func(otp *entity.OTP) {
+		otp.LastSentAt = time.Now().Add(-time.Minute)
+	})
+	_, err = svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+	assert.ErrorIs(t, err, ErrSessionCancelled)
+
+	// Cancelling again is not an error
+	assert.NoError(t, svc.CancelSession(token))
+}
+
+func TestCancelSession_UnknownToken(t *testing.T) {
+	svc, _ := newServiceTestService(t, serviceTestConfig())
+
+	assert.ErrorIs(t, svc.CancelSession("unknown-token"), ErrSessionNotFound)
+}
+
+func TestCancelSession_Expired(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	repos.otps.set(t, sessionByToken(t, repos, token).ID, func(otp *entity.OTP) {
+		otp.ExpiresAt = time.Now().Add(-time.Minute)
+	})
+
+	// Cancelling also stops an expired session from being resent
+	require.NoError(t, svc.CancelSession(token))
+
+	response, err := svc.GetSession(token)
+	require.NoError(t, err)
+	assert.Equal(t, entity.SessionStatusCancelled, response.Status)
+}
+
+func TestCancelSession_Verified(t *testing.T) {
+	svc, repos := newServiceTestService(t, serviceTestConfig())
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, svc.CancelSession(token), ErrSessionUsed)
+
+	response, err := svc.GetSession(token)
+	require.NoError(t, err)
+	assert.Equal(t, entity.SessionStatusVerified, response.Status)
+}
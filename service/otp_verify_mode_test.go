@@ -0,0 +1,115 @@
+package service
+
+import (
+	"testing"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newVerifyModeTestService wires a service with a kiosk app in phone_number verify mode
+// and a mobile app in the default session_token mode
+func newVerifyModeTestService(t *testing.T) (*otpService, *serviceTestRepositories) {
+	cfg := serviceTestConfig()
+	cfg.ClientApps = map[string]config.ClientApp{
+		"kiosk":  {ID: "kiosk", VerifyMode: config.VerifyModePhoneNumber},
+		"mobile": {ID: "mobile", VerifyMode: config.VerifyModeSessionToken},
+	}
+	return newServiceTestService(t, cfg)
+}
+
+func TestVerifyOTP_ByPhoneNumber(t *testing.T) {
+	svc, repos := newVerifyModeTestService(t)
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123", ClientID: "kiosk"})
+
+	result, err := svc.VerifyOTP(&entity.VerifyOTPRequest{PhoneNumber: "+447700900123", ClientID: "kiosk", Code: code})
+	require.NoError(t, err)
+	require.NotNil(t, result.User)
+	assert.Equal(t, "+447700900123", result.User.PhoneNumber)
+	assert.True(t, sessionByToken(t, repos, token).IsUsed)
+}
+
+func TestVerifyOTP_ByPhoneNumberUsesTheLatestSession(t *testing.T) {
+	svc, repos := newVerifyModeTestService(t)
+	firstToken, firstCode := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123", ClientID: "kiosk"})
+	latestToken, latestCode := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123", ClientID: "kiosk"})
+
+	// The code of an earlier session is checked against the latest one and costs it an attempt
+	if firstCode != latestCode {
+		_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{PhoneNumber: "+447700900123", ClientID: "kiosk", Code: firstCode})
+		assert.ErrorIs(t, err, ErrInvalidOTP)
+		assert.Equal(t, 1, sessionByToken(t, repos, latestToken).Attempts)
+	}
+
+	_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{PhoneNumber: "+447700900123", ClientID: "kiosk", Code: latestCode})
+	require.NoError(t, err)
+	assert.True(t, sessionByToken(t, repos, latestToken).IsUsed)
+	assert.False(t, sessionByToken(t, repos, firstToken).IsUsed)
+}
+
+func TestVerifyOTP_ByPhoneNumberRejectedForOtherClients(t *testing.T) {
+	svc, repos := newVerifyModeTestService(t)
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123", ClientID: "mobile"})
+
+	for name, clientID := range map[string]string{
+		"missing client_id":  "",
+		"unknown client app": "unknown",
+		"session_token mode": "mobile",
+	} {
+		_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{PhoneNumber: "+447700900123", ClientID: clientID, Code: code})
+		assert.ErrorIs(t, err, ErrVerifyModeNotAllowed, name)
+	}
+
+	// Refused before the session is looked up, so no attempt is used
+	otp := sessionByToken(t, repos, token)
+	assert.Zero(t, otp.Attempts)
+	assert.False(t, otp.IsUsed)
+
+	// The app still verifies by session token
+	_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: token, Code: code})
+	assert.NoError(t, err)
+}
+
+func TestVerifyOTP_ByPhoneNumberOnlyFindsSessionsOfTheClient(t *testing.T) {
+	svc, repos := newVerifyModeTestService(t)
+
+	// Sent through another app, or without one
+	_, mobileCode := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123", ClientID: "mobile"})
+	_, plainCode := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	for _, code := range []string{mobileCode, plainCode} {
+		_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{PhoneNumber: "+447700900123", ClientID: "kiosk", Code: code})
+		assert.ErrorIs(t, err, ErrInvalidOTP)
+	}
+	for _, otp := range repos.otps.all() {
+		assert.Zero(t, otp.Attempts)
+	}
+}
+
+func TestVerifyOTP_ByPhoneNumberIsScopedToThePurpose(t *testing.T) {
+	svc, repos := newVerifyModeTestService(t)
+	_, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123", ClientID: "kiosk", Purpose: entity.PurposePhoneChange})
+
+	_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{PhoneNumber: "+447700900123", ClientID: "kiosk", Code: code})
+	assert.ErrorIs(t, err, ErrInvalidOTP)
+
+	result, err := svc.VerifyOTP(&entity.VerifyOTPRequest{PhoneNumber: "+447700900123", ClientID: "kiosk", Code: code, Purpose: entity.PurposePhoneChange})
+	require.NoError(t, err)
+	assert.NotNil(t, result.Confirmation)
+}
+
+func TestVerifyOTP_ByPhoneNumberCountsAttempts(t *testing.T) {
+	svc, repos := newVerifyModeTestService(t)
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123", ClientID: "kiosk"})
+
+	_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{PhoneNumber: "+447700900123", ClientID: "kiosk", Code: wrongCode(code)})
+
+	var attemptErr *AttemptError
+	require.ErrorAs(t, err, &attemptErr)
+	assert.ErrorIs(t, err, ErrInvalidOTP)
+	assert.Equal(t, 2, attemptErr.RemainingAttempts)
+	assert.Equal(t, 1, sessionByToken(t, repos, token).Attempts)
+}
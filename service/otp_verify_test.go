@@ -0,0 +1,146 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/repository"
+	"otp-auth/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const verifyTestPepper = "test-pepper"
+
+// newVerifyTestService wires an OTP service against the test database
+func newVerifyTestService(tdb *test.TestDB) OTPService {
+	cfg := &config.Config{
+		OTP: config.OTP{
+			Length:           6,
+			Alphabet:         config.CodeAlphabetNumeric,
+			HashPepper:       verifyTestPepper,
+			LockoutThreshold: 3,
+			LockoutWindow:    time.Hour,
+			LockoutDuration:  time.Hour,
+		},
+	}
+
+	return NewOTPService(
+		repository.NewOTPRepository(tdb.DB),
+		repository.NewUserRepository(tdb.DB),
+		nil,
+		repository.NewLockoutRepository(tdb.DB),
+		repository.NewOutboxRepository(tdb.DB),
+		repository.NewDeliveryReceiptRepository(tdb.DB),
+		repository.NewTxManager(tdb.DB),
+		nil,
+		nil,
+		nil,
+		cfg,
+		test.GetTestLogger(),
+	)
+}
+
+// createVerifyTestSession stores an open session with hashed code and token
+func createVerifyTestSession(t *testing.T, tdb *test.TestDB, phoneNumber, token, code string, maxAttempts int) {
+	_, err := repository.NewOTPRepository(tdb.DB).Create(&entity.OTP{
+		PhoneNumber:  phoneNumber,
+		Code:         hashSecret(verifyTestPepper, code),
+		SessionToken: hashSecret(verifyTestPepper, token),
+		ExpiresAt:    time.Now().Add(2 * time.Minute),
+		MaxAttempts:  maxAttempts,
+	})
+	require.NoError(t, err)
+}
+
+func TestVerifyOTP_ConcurrentVerifiesSucceedOnce(t *testing.T) {
+	test.SkipWithoutTestDB(t)
+	tdb := test.SetupTestDB(t)
+	defer tdb.Close()
+	tdb.CleanTables(t)
+
+	const workers = 20
+	phoneNumber := test.GenerateTestPhoneNumber("01")
+	createVerifyTestSession(t, tdb, phoneNumber, "session-token", "123456", workers)
+	svc := newVerifyTestService(tdb)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		successes int
+		failures  []error
+	)
+	start := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: "session-token", Code: "123456"})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				successes++
+			} else {
+				failures = append(failures, err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, 1, successes)
+	for _, err := range failures {
+		assert.True(t, errors.Is(err, ErrInvalidOTP), "unexpected error: %v", err)
+	}
+	tdb.AssertUserCount(t, 1)
+	tdb.AssertUserExists(t, phoneNumber)
+}
+
+func TestVerifyOTP_ConcurrentFirstLoginsCreateOneUser(t *testing.T) {
+	test.SkipWithoutTestDB(t)
+	tdb := test.SetupTestDB(t)
+	defer tdb.Close()
+	tdb.CleanTables(t)
+
+	const sessions = 10
+	phoneNumber := test.GenerateTestPhoneNumber("02")
+	tokens := make([]string, sessions)
+	for i := range tokens {
+		tokens[i] = "session-token-" + string(rune('a'+i))
+		createVerifyTestSession(t, tdb, phoneNumber, tokens[i], "654321", 5)
+	}
+	svc := newVerifyTestService(tdb)
+
+	var wg sync.WaitGroup
+	users := make([]*entity.User, sessions)
+	errs := make([]error, sessions)
+	start := make(chan struct{})
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			result, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: tokens[i], Code: "654321"})
+			if err == nil {
+				users[i] = result.User
+			}
+			errs[i] = err
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	for i := range tokens {
+		require.NoError(t, errs[i])
+		assert.Equal(t, users[0].ID, users[i].ID)
+	}
+	tdb.AssertUserCount(t, 1)
+	tdb.AssertLastLoginUpdated(t, phoneNumber, time.Minute)
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/pkg/logger"
+	"otp-auth/pkg/metrics"
+	"otp-auth/repository"
+)
+
+// OutboxWorker drains the OTP delivery outbox with a pool of goroutines
+type OutboxWorker struct {
+	outboxRepo repository.OutboxRepository
+	otpRepo    repository.OTPRepository
+	senders    map[string]Sender
+	cfg        *config.Config
+	logger     *logger.Logger
+}
+
+// NewOutboxWorker creates a new outbox worker pool
+func NewOutboxWorker(outboxRepo repository.OutboxRepository, otpRepo repository.OTPRepository, senders map[string]Sender, cfg *config.Config, logger *logger.Logger) *OutboxWorker {
+	return &OutboxWorker{
+		outboxRepo: outboxRepo,
+		otpRepo:    otpRepo,
+		senders:    senders,
+		cfg:        cfg,
+		logger:     logger,
+	}
+}
+
+// Start runs the worker pool until ctx is cancelled
+func (w *OutboxWorker) Start(ctx context.Context) {
+	workers := w.cfg.Outbox.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	w.logger.Infow("Starting outbox workers", "workers", workers, "poll_interval", w.cfg.Outbox.PollInterval)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			w.run(ctx, workerID)
+		}(i)
+	}
+	wg.Wait()
+
+	w.logger.Infow("Outbox workers stopped")
+}
+
+// run polls for due messages until ctx is cancelled
+func (w *OutboxWorker) run(ctx context.Context, workerID int) {
+	ticker := time.NewTicker(w.cfg.Outbox.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.processBatch(ctx, workerID)
+		}
+	}
+}
+
+// processBatch claims a batch of due messages and delivers them one by one
+func (w *OutboxWorker) processBatch(ctx context.Context, workerID int) {
+	messages, err := w.outboxRepo.ClaimDue(w.cfg.Outbox.BatchSize, w.cfg.Outbox.LeaseDuration)
+	if err != nil {
+		w.logger.Errorw("Failed to claim outbox messages", "worker_id", workerID, "error", err)
+		return
+	}
+
+	for i := range messages {
+		if ctx.Err() != nil {
+			// Unprocessed messages become claimable again once their lease expires
+			return
+		}
+		w.deliver(ctx, &messages[i])
+	}
+}
+
+// deliver hands a single message to the channel's provider and records the outcome
+func (w *OutboxWorker) deliver(ctx context.Context, msg *entity.OutboxMessage) {
+	if reason := w.skipReason(msg); reason != "" {
+		if err := w.outboxRepo.MarkSkipped(msg.ID, reason); err != nil {
+			w.logger.Errorw("Failed to skip outbox message", "outbox_id", msg.ID, "error", err)
+		}
+		metrics.IncDelivery(msg.Channel, "skipped")
+		w.logger.Infow("OTP delivery skipped", "outbox_id", msg.ID, "channel", msg.Channel, "reason", reason)
+		return
+	}
+
+	sender, ok := w.senders[msg.Channel]
+	if !ok {
+		w.deadLetter(msg, "none", fmt.Errorf("no provider configured for channel %s", msg.Channel))
+		return
+	}
+
+	code, body, err := w.openPayload(msg)
+	if err != nil {
+		// A payload sealed under another pepper can never be delivered
+		w.deadLetter(msg, "none", err)
+		return
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, w.cfg.Delivery.Timeout)
+	defer cancel()
+
+	email := ""
+	if msg.Email != nil {
+		email = *msg.Email
+	}
+
+	result, err := sender.Send(sendCtx, &Message{
+		Channel:     msg.Channel,
+		PhoneNumber: msg.PhoneNumber,
+		Email:       email,
+		Code:        code,
+		Body:        w.messageBody(msg, code, body),
+		ExpiresAt:   msg.ExpiresAt,
+	})
+	if err == nil {
+		if err := w.outboxRepo.MarkSent(msg.ID, sender.Name(), result.ProviderMessageID); err != nil {
+			w.logger.Errorw("Failed to mark outbox message as sent", "outbox_id", msg.ID, "error", err)
+		}
+		w.updateDeliveryStatus(msg, entity.DeliveryStatusSent, result.ProviderMessageID)
+		metrics.IncDelivery(msg.Channel, "sent")
+		w.logger.Infow("OTP delivered",
+			"outbox_id", msg.ID,
+			"phone_number", msg.PhoneNumber,
+			"channel", msg.Channel,
+			"provider", sender.Name(),
+			"provider_message_id", result.ProviderMessageID,
+			"attempt", msg.Attempts)
+
+		// Re-deliver over the next channel unless the OTP is confirmed in time
+		w.scheduleFallback(msg, time.Now().Add(w.cfg.Delivery.ConfirmationTimeout))
+		return
+	}
+
+	if msg.Attempts >= msg.MaxAttempts || time.Now().After(msg.ExpiresAt) {
+		w.deadLetter(msg, sender.Name(), err)
+		return
+	}
+
+	nextAttemptAt := time.Now().Add(w.backoff(msg.Attempts))
+	if markErr := w.outboxRepo.MarkRetry(msg.ID, nextAttemptAt, err.Error()); markErr != nil {
+		w.logger.Errorw("Failed to schedule outbox retry", "outbox_id", msg.ID, "error", markErr)
+	}
+	metrics.IncDelivery(msg.Channel, "retry")
+	w.logger.Warnw("OTP delivery failed, retry scheduled",
+		"outbox_id", msg.ID,
+		"phone_number", msg.PhoneNumber,
+		"channel", msg.Channel,
+		"provider", sender.Name(),
+		"attempt", msg.Attempts,
+		"next_attempt_at", nextAttemptAt,
+		"error", err)
+}
+
+// openPayload decrypts the code and body sealed into the message when it was queued
+func (w *OutboxWorker) openPayload(msg *entity.OutboxMessage) (string, string, error) {
+	code, err := openSecret(w.cfg.OTP.HashPepper, msg.Code)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open outbox code: %w", err)
+	}
+
+	body, err := openSecret(w.cfg.OTP.HashPepper, msg.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open outbox body: %w", err)
+	}
+
+	return code, body, nil
+}
+
+// messageBody adds the client app's autofill lines to SMS messages. A message that
+// would no longer fit the autofill limit is sent without them rather than not at all.
+func (w *OutboxWorker) messageBody(msg *entity.OutboxMessage, code, body string) string {
+	if msg.Channel != ChannelSMS || msg.ClientID == nil {
+		return body
+	}
+
+	app, ok := w.cfg.ClientApps[*msg.ClientID]
+	if !ok {
+		return body
+	}
+
+	formatted, err := FormatAutofill(body, code, app)
+	if err != nil {
+		w.logger.Warnw("Sending OTP without autofill formatting", "outbox_id", msg.ID, "client_id", app.ID, "error", err)
+		return body
+	}
+
+	return formatted
+}
+
+// deadLetter gives up on a message and falls back to the next channel right away
+func (w *OutboxWorker) deadLetter(msg *entity.OutboxMessage, provider string, cause error) {
+	if err := w.outboxRepo.MarkDead(msg.ID, cause.Error()); err != nil {
+		w.logger.Errorw("Failed to dead-letter outbox message", "outbox_id", msg.ID, "error", err)
+	}
+	metrics.IncDelivery(msg.Channel, "dead")
+	if len(msg.Fallbacks()) == 0 {
+		w.updateDeliveryStatus(msg, entity.DeliveryStatusFailed, "")
+	}
+	w.logger.Errorw("OTP delivery failed permanently",
+		"outbox_id", msg.ID,
+		"phone_number", msg.PhoneNumber,
+		"channel", msg.Channel,
+		"provider", provider,
+		"attempts", msg.Attempts,
+		"error", cause)
+
+	w.scheduleFallback(msg, time.Now())
+}
+
+// skipReason reports why a message should not be delivered any more, if at all
+func (w *OutboxWorker) skipReason(msg *entity.OutboxMessage) string {
+	if time.Now().After(msg.ExpiresAt) {
+		return "OTP expired"
+	}
+	if msg.OTPID == nil {
+		return ""
+	}
+
+	otp, err := w.otpRepo.GetByID(*msg.OTPID)
+	if err != nil {
+		// Prefer a duplicate delivery over a lost one
+		w.logger.Warnw("Failed to check OTP state before delivery", "outbox_id", msg.ID, "otp_id", *msg.OTPID, "error", err)
+		return ""
+	}
+
+	switch {
+	case otp == nil:
+		return "OTP no longer exists"
+	case otp.ResendCount != msg.ResendCount:
+		return "OTP resent"
+	case otp.IsUsed:
+		return "OTP already verified"
+	case otp.CancelledAt != nil:
+		return "OTP session cancelled"
+	case otp.RemainingAttempts() == 0:
+		return "OTP session locked"
+	case otp.DeliveryStatus == entity.DeliveryStatusDelivered:
+		return "OTP delivery confirmed"
+	default:
+		return ""
+	}
+}
+
+// updateDeliveryStatus mirrors the outcome on the OTP row
+func (w *OutboxWorker) updateDeliveryStatus(msg *entity.OutboxMessage, status, providerMessageID string) {
+	if msg.OTPID == nil {
+		return
+	}
+	if err := w.otpRepo.UpdateDeliveryStatus(*msg.OTPID, status, msg.Channel, providerMessageID); err != nil {
+		w.logger.Errorw("Failed to update OTP delivery status", "otp_id", *msg.OTPID, "status", status, "error", err)
+	}
+}
+
+// scheduleFallback enqueues delivery over the next channel in the chain at the given time.
+// The fallback carries the code and body still sealed, as they were claimed, so none is
+// scheduled once the OTP has been resent, verified or closed in the meantime.
+func (w *OutboxWorker) scheduleFallback(msg *entity.OutboxMessage, at time.Time) {
+	fallbacks := msg.Fallbacks()
+	if len(fallbacks) == 0 || at.After(msg.ExpiresAt) {
+		return
+	}
+	if reason := w.skipReason(msg); reason != "" {
+		w.logger.Infow("Fallback delivery not scheduled", "outbox_id", msg.ID, "channel", fallbacks[0], "reason", reason)
+		return
+	}
+
+	next, err := w.outboxRepo.Enqueue(&entity.OutboxMessage{
+		OTPID:            msg.OTPID,
+		ClientID:         msg.ClientID,
+		Channel:          fallbacks[0],
+		FallbackChannels: strings.Join(fallbacks[1:], ","),
+		PhoneNumber:      msg.PhoneNumber,
+		Email:            msg.Email,
+		Code:             msg.Code,
+		Body:             msg.Body,
+		ResendCount:      msg.ResendCount,
+		ExpiresAt:        msg.ExpiresAt,
+		MaxAttempts:      msg.MaxAttempts,
+		NextAttemptAt:    at,
+	})
+	if err != nil {
+		w.logger.Errorw("Failed to schedule fallback delivery", "outbox_id", msg.ID, "channel", fallbacks[0], "error", err)
+		return
+	}
+
+	w.logger.Infow("Fallback delivery scheduled",
+		"outbox_id", next.ID,
+		"previous_channel", msg.Channel,
+		"channel", next.Channel,
+		"next_attempt_at", at)
+}
+
+// backoff returns the exponential delay before the next attempt, with up to 20% jitter
+func (w *OutboxWorker) backoff(attempts int) time.Duration {
+	delay := w.cfg.Outbox.BaseBackoff
+	for i := 1; i < attempts && delay < w.cfg.Outbox.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > w.cfg.Outbox.MaxBackoff {
+		delay = w.cfg.Outbox.MaxBackoff
+	}
+
+	if jitter := int64(delay) / 5; jitter > 0 {
+		delay += time.Duration(rand.Int63n(jitter))
+	}
+
+	return delay
+}
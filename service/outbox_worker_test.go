@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubSender keeps the messages it is given and answers them with send, if set
+type stubSender struct {
+	mu       sync.Mutex
+	messages []Message
+	send     func(msg *Message) error
+}
+
+// Name returns the provider name
+func (s *stubSender) Name() string {
+	return "stub"
+}
+
+// Send records the message and returns the scripted outcome
+func (s *stubSender) Send(ctx context.Context, msg *Message) (*SendResult, error) {
+	s.mu.Lock()
+	s.messages = append(s.messages, *msg)
+	count := len(s.messages)
+	s.mu.Unlock()
+
+	if s.send != nil {
+		if err := s.send(msg); err != nil {
+			return nil, err
+		}
+	}
+	return &SendResult{ProviderMessageID: fmt.Sprintf("stub-%d", count)}, nil
+}
+
+// sent returns copies of the messages handed to the sender
+func (s *stubSender) sent() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+// workerTestConfig returns a service test configuration with an SMS then voice chain and worker settings
+func workerTestConfig() *config.Config {
+	cfg := serviceTestConfig()
+	cfg.Delivery.Channels = []string{ChannelSMS, ChannelVoice}
+	cfg.Delivery.Timeout = time.Second
+	cfg.Delivery.ConfirmationTimeout = time.Minute
+	cfg.Outbox = config.Outbox{
+		Workers:       1,
+		BatchSize:     10,
+		LeaseDuration: time.Minute,
+		MaxAttempts:   3,
+		BaseBackoff:   10 * time.Second,
+		MaxBackoff:    time.Minute,
+	}
+	return cfg
+}
+
+// newWorkerTestService wires an OTP service and an outbox worker against the same in-memory
+// repositories, with a stub sender for every configured channel
+func newWorkerTestService(t *testing.T, cfg *config.Config) (*otpService, *serviceTestRepositories, *OutboxWorker, map[string]*stubSender) {
+	svc, repos := newServiceTestService(t, cfg)
+
+	stubs := make(map[string]*stubSender, len(cfg.Delivery.Channels))
+	senders := make(map[string]Sender, len(cfg.Delivery.Channels))
+	for _, channel := range cfg.Delivery.Channels {
+		stubs[channel] = &stubSender{}
+		senders[channel] = stubs[channel]
+	}
+
+	return svc, repos, NewOutboxWorker(repos.outbox, repos.otps, senders, cfg, test.GetTestLogger()), stubs
+}
+
+// claimOne claims the due messages and requires exactly one
+func claimOne(t *testing.T, repos *serviceTestRepositories) *entity.OutboxMessage {
+	claimed, err := repos.outbox.ClaimDue(10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	return &claimed[0]
+}
+
+func TestOutboxWorker_ResendWhileClaimed(t *testing.T) {
+	svc, repos, worker, senders := newWorkerTestService(t, workerTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	// A worker claims the first message, then the code is resent before it sends
+	stale := claimOne(t, repos)
+	passCooldown(t, repos, token)
+	_, err := svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+	require.NoError(t, err)
+
+	otpID := sessionByToken(t, repos, token).ID
+	assert.Equal(t, entity.OutboxStatusSkipped, repos.outbox.forOTP(otpID)[0].Status)
+
+	worker.deliver(context.Background(), stale)
+
+	// The old code is neither sent nor handed to the fallback channel
+	assert.Empty(t, senders[ChannelSMS].sent())
+	messages := repos.outbox.forOTP(otpID)
+	require.Len(t, messages, 2)
+	assert.Equal(t, entity.OutboxStatusSkipped, messages[0].Status)
+	assert.Equal(t, entity.OutboxStatusPending, messages[1].Status)
+
+	newCode, _ := sentPayload(t, repos, otpID)
+	worker.deliver(context.Background(), claimOne(t, repos))
+	sent := senders[ChannelSMS].sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, newCode, sent[0].Code)
+}
+
+func TestOutboxWorker_ResendDuringSend(t *testing.T) {
+	svc, repos, worker, senders := newWorkerTestService(t, workerTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	passCooldown(t, repos, token)
+
+	// The code is resent while the provider call is in flight
+	senders[ChannelSMS].send = func(msg *Message) error {
+		_, err := svc.ResendOTP(&entity.ResendOTPRequest{Token: token})
+		return err
+	}
+	worker.deliver(context.Background(), claimOne(t, repos))
+
+	// No voice fallback is queued with the replaced code
+	messages := repos.outbox.forOTP(sessionByToken(t, repos, token).ID)
+	require.Len(t, messages, 2)
+	assert.Equal(t, ChannelSMS, messages[1].Channel)
+	assert.Equal(t, 1, messages[1].ResendCount)
+}
+
+func TestOutboxWorker_RetriesTransientFailureAtBackoff(t *testing.T) {
+	svc, repos, worker, senders := newWorkerTestService(t, workerTestConfig())
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	otpID := sessionByToken(t, repos, token).ID
+
+	failures := 0
+	senders[ChannelSMS].send = func(msg *Message) error {
+		if failures < 2 {
+			failures++
+			return fmt.Errorf("gateway timeout")
+		}
+		return nil
+	}
+
+	// Each failure doubles the delay from OUTBOX_BASE_BACKOFF, plus up to 20% jitter
+	for attempt, backoff := range []time.Duration{10 * time.Second, 20 * time.Second} {
+		before := time.Now()
+		worker.deliver(context.Background(), claimOne(t, repos))
+
+		msg := repos.outbox.forOTP(otpID)[0]
+		assert.Equal(t, entity.OutboxStatusPending, msg.Status)
+		assert.Equal(t, attempt+1, msg.Attempts)
+		require.NotNil(t, msg.LastError)
+		assert.Equal(t, "gateway timeout", *msg.LastError)
+		assert.False(t, msg.NextAttemptAt.Before(before.Add(backoff)), "attempt %d", attempt+1)
+		assert.False(t, msg.NextAttemptAt.After(time.Now().Add(backoff*6/5)), "attempt %d", attempt+1)
+		assert.NotEmpty(t, msg.Code, "the sealed payload is kept for the retry")
+
+		// Not claimed again before it is due
+		claimed, err := repos.outbox.ClaimDue(10, time.Minute)
+		require.NoError(t, err)
+		assert.Empty(t, claimed)
+		require.NoError(t, repos.outbox.ReleasePending(otpID))
+	}
+
+	worker.deliver(context.Background(), claimOne(t, repos))
+	sent := senders[ChannelSMS].sent()
+	require.Len(t, sent, 3)
+	assert.Equal(t, code, sent[2].Code)
+	assert.Equal(t, entity.OutboxStatusSent, repos.outbox.forOTP(otpID)[0].Status)
+	assert.Equal(t, entity.DeliveryStatusSent, sessionByToken(t, repos, token).DeliveryStatus)
+}
+
+func TestOutboxWorker_DeadAfterMaxAttempts(t *testing.T) {
+	cfg := workerTestConfig()
+	cfg.Delivery.Channels = []string{ChannelSMS}
+	svc, repos, worker, senders := newWorkerTestService(t, cfg)
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	otpID := sessionByToken(t, repos, token).ID
+
+	senders[ChannelSMS].send = func(msg *Message) error {
+		return fmt.Errorf("gateway unavailable")
+	}
+
+	for attempt := 1; attempt <= cfg.Outbox.MaxAttempts; attempt++ {
+		msg := claimOne(t, repos)
+		require.Equal(t, attempt, msg.Attempts)
+		worker.deliver(context.Background(), msg)
+		require.NoError(t, repos.outbox.ReleasePending(otpID))
+	}
+
+	messages := repos.outbox.forOTP(otpID)
+	require.Len(t, messages, 1)
+	assert.Equal(t, entity.OutboxStatusDead, messages[0].Status)
+	assert.Empty(t, messages[0].Code)
+	assert.Empty(t, messages[0].Body)
+	assert.Len(t, senders[ChannelSMS].sent(), cfg.Outbox.MaxAttempts)
+
+	// With no channel left the OTP is reported failed and nothing is claimed any more
+	assert.Equal(t, entity.DeliveryStatusFailed, sessionByToken(t, repos, token).DeliveryStatus)
+	claimed, err := repos.outbox.ClaimDue(10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+}
+
+func TestOutboxWorker_SkipsExpiredOTP(t *testing.T) {
+	svc, repos, worker, senders := newWorkerTestService(t, workerTestConfig())
+	token, _ := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	otpID := sessionByToken(t, repos, token).ID
+
+	// Claimed after the code expired, e.g. behind a long backlog
+	msg := claimOne(t, repos)
+	msg.ExpiresAt = time.Now().Add(-time.Second)
+	worker.deliver(context.Background(), msg)
+
+	assert.Empty(t, senders[ChannelSMS].sent())
+	messages := repos.outbox.forOTP(otpID)
+	require.Len(t, messages, 1, "no fallback is queued for an expired code")
+	assert.Equal(t, entity.OutboxStatusSkipped, messages[0].Status)
+	require.NotNil(t, messages[0].LastError)
+	assert.Equal(t, "OTP expired", *messages[0].LastError)
+	assert.Empty(t, messages[0].Code)
+}
+
+func TestOutboxWorker_ReclaimsExpiredLease(t *testing.T) {
+	svc, repos, worker, senders := newWorkerTestService(t, workerTestConfig())
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	// A worker claimed the message and crashed before its lease ran out
+	abandoned, err := repos.outbox.ClaimDue(10, -time.Second)
+	require.NoError(t, err)
+	require.Len(t, abandoned, 1)
+
+	worker.processBatch(context.Background(), 0)
+
+	sent := senders[ChannelSMS].sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, code, sent[0].Code)
+	msg := repos.outbox.forOTP(sessionByToken(t, repos, token).ID)[0]
+	assert.Equal(t, entity.OutboxStatusSent, msg.Status)
+	assert.Equal(t, 2, msg.Attempts)
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// HashPayload returns the hex SHA-256 of a payload serialized as compact JSON with sorted
+// keys and unescaped HTML characters, or "" for an empty payload. Services that act on a
+// confirmation compute the same hash over the action they are about to perform.
+func HashPayload(payload map[string]interface{}) (string, error) {
+	if len(payload) == 0 {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(payload); err != nil {
+		return "", fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	sum := sha256.Sum256(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
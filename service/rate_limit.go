@@ -0,0 +1,109 @@
+package service
+
+import (
+	"strings"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+)
+
+// twoDigitCallingCodes lists the two-digit country calling codes. Apart from the one-digit
+// codes 1 and 7, every other calling code is three digits long.
+var twoDigitCallingCodes = map[string]bool{
+	"20": true, "27": true, "30": true, "31": true, "32": true, "33": true, "34": true, "36": true,
+	"39": true, "40": true, "41": true, "43": true, "44": true, "45": true, "46": true, "47": true,
+	"48": true, "49": true, "51": true, "52": true, "53": true, "54": true, "55": true, "56": true,
+	"57": true, "58": true, "60": true, "61": true, "62": true, "63": true, "64": true, "65": true,
+	"66": true, "81": true, "82": true, "84": true, "86": true, "90": true, "91": true, "92": true,
+	"93": true, "94": true, "95": true, "98": true,
+}
+
+// callingCode returns the country calling code of an E.164 phone number, e.g. +44 for +447700900123
+func callingCode(phoneNumber string) string {
+	digits := strings.TrimPrefix(phoneNumber, "+")
+
+	switch {
+	case digits == "":
+		return ""
+	case digits[0] == '1' || digits[0] == '7':
+		return "+" + digits[:1]
+	case len(digits) >= 2 && twoDigitCallingCodes[digits[:2]]:
+		return "+" + digits[:2]
+	case len(digits) >= 3:
+		return "+" + digits[:3]
+	}
+
+	return "+" + digits
+}
+
+// rateLimitCheck is one limit a send is counted against
+type rateLimitCheck struct {
+	dimension string
+	key       string
+	policy    config.RateLimitPolicy
+}
+
+// rateLimitPolicy returns the configured limit of a dimension
+func rateLimitPolicy(cfg config.RateLimit, dimension string) (config.RateLimitPolicy, bool) {
+	switch dimension {
+	case entity.RateLimitDimensionPhoneNumber:
+		return cfg.Policy(), true
+	case entity.RateLimitDimensionIP:
+		return cfg.IP, true
+	case entity.RateLimitDimensionDevice:
+		return cfg.Device, true
+	case entity.RateLimitDimensionCountry:
+		return cfg.Country, true
+	case entity.RateLimitDimensionGlobal:
+		return cfg.Global, true
+	}
+
+	return config.RateLimitPolicy{}, false
+}
+
+// rateLimitKey returns the repository key of a dimension's limit for value. The phone number
+// limit keeps the bare phone number as its key; the other dimensions are prefixed.
+func rateLimitKey(dimension, value string) string {
+	switch dimension {
+	case entity.RateLimitDimensionPhoneNumber:
+		return value
+	case entity.RateLimitDimensionGlobal:
+		return "global"
+	}
+
+	return dimension + ":" + value
+}
+
+// rateLimitChecks returns the enabled limits for a send to phoneNumber from clientIP and deviceID
+func rateLimitChecks(cfg config.RateLimit, phoneNumber, clientIP, deviceID string) []rateLimitCheck {
+	values := []struct {
+		dimension string
+		value     string
+	}{
+		{entity.RateLimitDimensionPhoneNumber, phoneNumber},
+		{entity.RateLimitDimensionIP, clientIP},
+		{entity.RateLimitDimensionDevice, deviceID},
+		{entity.RateLimitDimensionCountry, callingCode(phoneNumber)},
+		{entity.RateLimitDimensionGlobal, ""},
+	}
+
+	var checks []rateLimitCheck
+	for _, v := range values {
+		policy, _ := rateLimitPolicy(cfg, v.dimension)
+		if !policy.Enabled() || (v.value == "" && v.dimension != entity.RateLimitDimensionGlobal) {
+			continue
+		}
+		checks = append(checks, rateLimitCheck{dimension: v.dimension, key: rateLimitKey(v.dimension, v.value), policy: policy})
+	}
+
+	return checks
+}
+
+// applyRateLimitOverrides replaces the limit of every check that has an override in effect
+func applyRateLimitOverrides(checks []rateLimitCheck, overrides map[string]*entity.RateLimitOverride) {
+	for i := range checks {
+		if override, ok := overrides[checks[i].key]; ok {
+			checks[i].policy.Limit = override.Limit
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/repository"
+	"otp-auth/test"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryAuditRepository keeps audit entries in memory; entries written in a transaction
+// are only kept when it commits
+type memoryAuditRepository struct {
+	mu      sync.Mutex
+	pending []entity.RateLimitAuditEntry
+	entries []entity.RateLimitAuditEntry
+}
+
+// CreateTx stages an entry until the transaction commits
+func (r *memoryAuditRepository) CreateTx(tx *sqlx.Tx, entry *entity.RateLimitAuditEntry) (*entity.RateLimitAuditEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	created := *entry
+	created.CreatedAt = time.Now()
+	r.pending = append(r.pending, created)
+	return &created, nil
+}
+
+// List returns the committed entries, newest first
+func (r *memoryAuditRepository) List(dimension, value string, limit int) ([]entity.RateLimitAuditEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []entity.RateLimitAuditEntry
+	for i := len(r.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		if dimension == "" || r.entries[i].Dimension == dimension && r.entries[i].Value == value {
+			entries = append(entries, r.entries[i])
+		}
+	}
+	return entries, nil
+}
+
+// WithinTransaction commits the staged entries when fn succeeds and drops them otherwise
+func (r *memoryAuditRepository) WithinTransaction(fn func(tx *sqlx.Tx) error) error {
+	err := fn(nil)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.entries = append(r.entries, r.pending...)
+	}
+	r.pending = nil
+	return err
+}
+
+// failingRateLimitRepository refuses every change to the rate limit store
+type failingRateLimitRepository struct {
+	repository.RateLimitRepository
+}
+
+// Reset fails
+func (r failingRateLimitRepository) Reset(key string) error {
+	return errors.New("redis unavailable")
+}
+
+// SetOverride fails
+func (r failingRateLimitRepository) SetOverride(key string, override *entity.RateLimitOverride) error {
+	return errors.New("redis unavailable")
+}
+
+// DeleteOverride fails
+func (r failingRateLimitRepository) DeleteOverride(key string) error {
+	return errors.New("redis unavailable")
+}
+
+// rateLimitAdmin is the admin acting in the rate limit admin tests
+var rateLimitAdmin = &entity.User{ID: 7, PhoneNumber: "+447700900001"}
+
+// newRateLimitAdminTestService wires an admin service against the rate limits of an OTP test
+// service, with the country limit enabled and the IP limit not
+func newRateLimitAdminTestService(t *testing.T) (RateLimitAdminService, *memoryAuditRepository, *otpService, *serviceTestRepositories) {
+	cfg := serviceTestConfig()
+	cfg.RateLimit.Country = config.RateLimitPolicy{Algorithm: config.RateLimitFixedWindow, Limit: 1000, Window: time.Hour}
+	svc, repos := newServiceTestService(t, cfg)
+	audit := &memoryAuditRepository{}
+
+	return NewRateLimitAdminService(repos.rateLimits, audit, audit, cfg, test.GetTestLogger()), audit, svc, repos
+}
+
+func TestRateLimitAdmin_OverrideAppliesAndExpires(t *testing.T) {
+	admin, _, svc, repos := newRateLimitAdminTestService(t)
+
+	status, err := admin.SetOverride(rateLimitAdmin, entity.RateLimitDimensionPhoneNumber, "+447700900123", &entity.RateLimitOverrideRequest{Limit: 1, Duration: "1h"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, status.Limit)
+	require.NotNil(t, status.Override)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), status.Override.ExpiresAt, time.Minute)
+
+	// The override replaces the configured 100 sends per hour
+	_, err = svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	require.NoError(t, err)
+	_, err = svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	var rateLimitErr *RateLimitError
+	require.ErrorAs(t, err, &rateLimitErr)
+	assert.Equal(t, 1, rateLimitErr.Limit)
+
+	// Other phone numbers keep the configured limit
+	status, err = admin.GetStatus(entity.RateLimitDimensionPhoneNumber, "+447700900456")
+	require.NoError(t, err)
+	assert.Equal(t, 100, status.Limit)
+	assert.Nil(t, status.Override)
+
+	// Once the override runs out the configured limit applies again
+	key := rateLimitKey(entity.RateLimitDimensionPhoneNumber, "+447700900123")
+	require.NoError(t, repos.rateLimits.SetOverride(key, &entity.RateLimitOverride{Limit: 1, ExpiresAt: time.Now().Add(-time.Second)}))
+	status, err = admin.GetStatus(entity.RateLimitDimensionPhoneNumber, "+447700900123")
+	require.NoError(t, err)
+	assert.Equal(t, 100, status.Limit)
+	assert.Nil(t, status.Override)
+	_, err = svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	assert.NoError(t, err)
+}
+
+func TestRateLimitAdmin_OverrideDuration(t *testing.T) {
+	for _, duration := range []string{"0s", "-1h", "169h", "8d", "forever", ""} {
+		admin, audit, _, _ := newRateLimitAdminTestService(t)
+
+		_, err := admin.SetOverride(rateLimitAdmin, entity.RateLimitDimensionPhoneNumber, "+447700900123", &entity.RateLimitOverrideRequest{Limit: 5, Duration: duration})
+		assert.ErrorIs(t, err, ErrInvalidRateLimitOverride, duration)
+		assert.Empty(t, audit.entries, duration)
+	}
+
+	for _, duration := range []string{"1s", "168h"} {
+		admin, _, _, _ := newRateLimitAdminTestService(t)
+
+		_, err := admin.SetOverride(rateLimitAdmin, entity.RateLimitDimensionPhoneNumber, "+447700900123", &entity.RateLimitOverrideRequest{Limit: 5, Duration: duration})
+		assert.NoError(t, err, duration)
+	}
+}
+
+func TestRateLimitAdmin_ClearOverride(t *testing.T) {
+	admin, _, _, _ := newRateLimitAdminTestService(t)
+
+	_, err := admin.SetOverride(rateLimitAdmin, entity.RateLimitDimensionPhoneNumber, "+447700900123", &entity.RateLimitOverrideRequest{Limit: 1, Duration: "1h"})
+	require.NoError(t, err)
+	require.NoError(t, admin.ClearOverride(rateLimitAdmin, entity.RateLimitDimensionPhoneNumber, "+447700900123"))
+
+	status, err := admin.GetStatus(entity.RateLimitDimensionPhoneNumber, "+447700900123")
+	require.NoError(t, err)
+	assert.Equal(t, 100, status.Limit)
+	assert.Nil(t, status.Override)
+}
+
+func TestRateLimitAdmin_Reset(t *testing.T) {
+	admin, _, svc, _ := newRateLimitAdminTestService(t)
+
+	for i := 0; i < 3; i++ {
+		_, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+		require.NoError(t, err)
+	}
+	status, err := admin.GetStatus(entity.RateLimitDimensionPhoneNumber, "+447700900123")
+	require.NoError(t, err)
+	require.Equal(t, 97, status.Remaining)
+
+	require.NoError(t, admin.Reset(rateLimitAdmin, entity.RateLimitDimensionPhoneNumber, "+447700900123"))
+
+	status, err = admin.GetStatus(entity.RateLimitDimensionPhoneNumber, "+447700900123")
+	require.NoError(t, err)
+	assert.Equal(t, 100, status.Remaining)
+}
+
+func TestRateLimitAdmin_AuditsEachAction(t *testing.T) {
+	admin, audit, _, _ := newRateLimitAdminTestService(t)
+
+	_, err := admin.SetOverride(rateLimitAdmin, entity.RateLimitDimensionCountry, "+447700900123", &entity.RateLimitOverrideRequest{Limit: 50, Duration: "2h"})
+	require.NoError(t, err)
+	require.NoError(t, admin.ClearOverride(rateLimitAdmin, entity.RateLimitDimensionCountry, "44"))
+	require.NoError(t, admin.Reset(rateLimitAdmin, entity.RateLimitDimensionCountry, "+44"))
+
+	// One entry per action, keyed by the normalized calling code
+	require.Len(t, audit.entries, 3)
+	for i, action := range []string{entity.RateLimitActionOverride, entity.RateLimitActionClearOverride, entity.RateLimitActionReset} {
+		entry := audit.entries[i]
+		assert.Equal(t, action, entry.Action)
+		assert.Equal(t, entity.RateLimitDimensionCountry, entry.Dimension)
+		assert.Equal(t, "+44", entry.Value)
+		assert.Equal(t, rateLimitAdmin.ID, entry.ActorUserID)
+		assert.Equal(t, rateLimitAdmin.PhoneNumber, entry.ActorPhoneNumber)
+	}
+	require.NotNil(t, audit.entries[0].OverrideLimit)
+	assert.Equal(t, 50, *audit.entries[0].OverrideLimit)
+	require.NotNil(t, audit.entries[0].OverrideExpiresAt)
+	assert.Nil(t, audit.entries[1].OverrideLimit)
+
+	entries, err := admin.ListAudit(entity.RateLimitDimensionCountry, "+44", 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, entity.RateLimitActionReset, entries[0].Action)
+
+	// Lookups are not audited
+	_, err = admin.GetStatus(entity.RateLimitDimensionCountry, "44")
+	require.NoError(t, err)
+	assert.Len(t, audit.entries, 3)
+}
+
+func TestRateLimitAdmin_NoAuditWhenStoreFails(t *testing.T) {
+	cfg := serviceTestConfig()
+	audit := &memoryAuditRepository{}
+	admin := NewRateLimitAdminService(failingRateLimitRepository{repository.NewMemoryRateLimitRepository()}, audit, audit, cfg, test.GetTestLogger())
+
+	_, err := admin.SetOverride(rateLimitAdmin, entity.RateLimitDimensionPhoneNumber, "+447700900123", &entity.RateLimitOverrideRequest{Limit: 1, Duration: "1h"})
+	assert.Error(t, err)
+	assert.Error(t, admin.ClearOverride(rateLimitAdmin, entity.RateLimitDimensionPhoneNumber, "+447700900123"))
+	assert.Error(t, admin.Reset(rateLimitAdmin, entity.RateLimitDimensionPhoneNumber, "+447700900123"))
+
+	assert.Empty(t, audit.entries)
+	assert.Empty(t, audit.pending)
+}
+
+func TestRateLimitAdmin_UnknownOrDisabledDimension(t *testing.T) {
+	admin, audit, _, _ := newRateLimitAdminTestService(t)
+
+	assert.ErrorIs(t, admin.Reset(rateLimitAdmin, "planet", "earth"), ErrUnknownRateLimitDimension)
+	assert.ErrorIs(t, admin.Reset(rateLimitAdmin, entity.RateLimitDimensionIP, "203.0.113.7"), ErrRateLimitDimensionDisabled)
+	assert.Empty(t, audit.entries)
+}
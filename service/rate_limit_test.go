@@ -0,0 +1,115 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallingCode(t *testing.T) {
+	cases := map[string]string{
+		"+14155550123":   "+1",
+		"+79161234567":   "+7",
+		"+447700900123":  "+44",
+		"+989121234567":  "+98",
+		"+4915123456789": "+49",
+		"+971501234567":  "+971",
+		"+3538612345678": "+353",
+		"+8801712345678": "+880",
+		"+2348031234567": "+234",
+		"+12":            "+1",
+		"+35":            "+35",
+		"":               "",
+	}
+
+	for phoneNumber, expected := range cases {
+		assert.Equal(t, expected, callingCode(phoneNumber), phoneNumber)
+	}
+}
+
+func TestRateLimitChecks_OnlyEnabledDimensions(t *testing.T) {
+	cfg := config.RateLimit{
+		MaxRequests:    3,
+		WindowDuration: 10 * time.Minute,
+		Algorithm:      config.RateLimitFixedWindow,
+		IP:             config.RateLimitPolicy{Algorithm: config.RateLimitSlidingWindow, Limit: 20, Window: time.Hour},
+		Global:         config.RateLimitPolicy{Algorithm: config.RateLimitTokenBucket, Limit: 1000, Window: time.Minute},
+	}
+
+	checks := rateLimitChecks(cfg, "+447700900123", "203.0.113.7", "device-1")
+
+	assert.Equal(t, []rateLimitCheck{
+		{dimension: entity.RateLimitDimensionPhoneNumber, key: "+447700900123", policy: cfg.Policy()},
+		{dimension: entity.RateLimitDimensionIP, key: "ip:203.0.113.7", policy: cfg.IP},
+		{dimension: entity.RateLimitDimensionGlobal, key: "global", policy: cfg.Global},
+	}, checks)
+}
+
+func TestRateLimitChecks_SkipsMissingClientDetails(t *testing.T) {
+	policy := config.RateLimitPolicy{Algorithm: config.RateLimitFixedWindow, Limit: 5, Window: time.Hour}
+	cfg := config.RateLimit{MaxRequests: 3, WindowDuration: 10 * time.Minute, Algorithm: config.RateLimitFixedWindow, IP: policy, Device: policy, Country: policy}
+
+	checks := rateLimitChecks(cfg, "+447700900123", "", "")
+
+	if assert.Len(t, checks, 2) {
+		assert.Equal(t, entity.RateLimitDimensionPhoneNumber, checks[0].dimension)
+		assert.Equal(t, entity.RateLimitDimensionCountry, checks[1].dimension)
+		assert.Equal(t, "country:+44", checks[1].key)
+	}
+}
+
+func TestApplyRateLimitOverrides(t *testing.T) {
+	policy := config.RateLimitPolicy{Algorithm: config.RateLimitFixedWindow, Limit: 3, Window: 10 * time.Minute}
+	checks := []rateLimitCheck{
+		{dimension: entity.RateLimitDimensionPhoneNumber, key: "+447700900123", policy: policy},
+		{dimension: entity.RateLimitDimensionIP, key: "ip:203.0.113.7", policy: policy},
+	}
+
+	applyRateLimitOverrides(checks, map[string]*entity.RateLimitOverride{
+		"ip:203.0.113.7": {Limit: 50, ExpiresAt: time.Now().Add(time.Hour)},
+	})
+
+	assert.Equal(t, 3, checks[0].policy.Limit)
+	assert.Equal(t, 50, checks[1].policy.Limit)
+	assert.Equal(t, 10*time.Minute, checks[1].policy.Window)
+}
+
+func TestNormalizeRateLimitValue(t *testing.T) {
+	assert.Equal(t, "+447700900123", normalizeRateLimitValue(entity.RateLimitDimensionPhoneNumber, "+447700900123"))
+	assert.Equal(t, "+44", normalizeRateLimitValue(entity.RateLimitDimensionCountry, "44"))
+	assert.Equal(t, "+44", normalizeRateLimitValue(entity.RateLimitDimensionCountry, "+447700900123"))
+	assert.Equal(t, "", normalizeRateLimitValue(entity.RateLimitDimensionGlobal, "all"))
+}
+
+func TestRateLimitState_ReportsWithoutCounting(t *testing.T) {
+	cfg := serviceTestConfig()
+	cfg.RateLimit.MaxRequests = 3
+	cfg.RateLimit.IP = config.RateLimitPolicy{Algorithm: config.RateLimitFixedWindow, Limit: 10, Window: time.Hour}
+	svc, _ := newServiceTestService(t, cfg)
+
+	_, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123", ClientIP: "203.0.113.7"})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		state, err := svc.RateLimitState("+447700900123", "203.0.113.7", "")
+		require.NoError(t, err)
+		require.NotNil(t, state)
+		assert.Equal(t, 3, state.Limit, "the phone number limit is the most constrained")
+		assert.Equal(t, 2, state.Remaining)
+	}
+
+	// Without a phone number only the other limits apply
+	state, err := svc.RateLimitState("", "203.0.113.7", "")
+	require.NoError(t, err)
+	assert.Equal(t, 10, state.Limit)
+	assert.Equal(t, 9, state.Remaining)
+
+	state, err = svc.RateLimitState("", "", "")
+	require.NoError(t, err)
+	assert.Nil(t, state)
+}
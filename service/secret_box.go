@@ -0,0 +1,67 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// outboxKeyContext separates the outbox encryption key from the HMAC digests keyed with the same pepper
+const outboxKeyContext = "otp-outbox-encryption"
+
+// errSealedSecretMalformed is returned when a sealed value is too short or not base64
+var errSealedSecretMalformed = errors.New("malformed sealed secret")
+
+// sealSecret encrypts an outbox code or body with AES-256-GCM under a key derived from the pepper
+func sealSecret(pepper, plaintext string) (string, error) {
+	aead, err := outboxCipher(pepper)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openSecret decrypts a value sealed by sealSecret
+func openSecret(pepper, sealed string) (string, error) {
+	aead, err := outboxCipher(pepper)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", errSealedSecretMalformed
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt sealed secret: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// outboxCipher returns the AES-256-GCM cipher keyed with the pepper's outbox key
+func outboxCipher(pepper string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(outboxKeyContext))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create outbox cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/repository"
+	"otp-auth/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealSecret_RoundTrip(t *testing.T) {
+	sealed, err := sealSecret("pepper", "482913")
+	require.NoError(t, err)
+	assert.NotContains(t, sealed, "482913")
+
+	again, err := sealSecret("pepper", "482913")
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "every seal uses a fresh nonce")
+
+	opened, err := openSecret("pepper", sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "482913", opened)
+}
+
+func TestOpenSecret_Rejects(t *testing.T) {
+	sealed, err := sealSecret("pepper", "482913")
+	require.NoError(t, err)
+
+	_, err = openSecret("other-pepper", sealed)
+	assert.Error(t, err)
+
+	_, err = openSecret("pepper", "482913")
+	assert.Error(t, err, "plaintext is not a sealed value")
+
+	_, err = openSecret("pepper", "")
+	assert.ErrorIs(t, err, errSealedSecretMalformed)
+}
+
+// recordingOutboxRepository keeps the messages a worker enqueues and the outcomes it records
+type recordingOutboxRepository struct {
+	repository.OutboxRepository
+	enqueued []entity.OutboxMessage
+	sent     []int
+	dead     []int
+}
+
+// Enqueue records a fallback message
+func (r *recordingOutboxRepository) Enqueue(msg *entity.OutboxMessage) (*entity.OutboxMessage, error) {
+	r.enqueued = append(r.enqueued, *msg)
+	return msg, nil
+}
+
+// MarkSent records a delivered message
+func (r *recordingOutboxRepository) MarkSent(id int, provider, providerMessageID string) error {
+	r.sent = append(r.sent, id)
+	return nil
+}
+
+// MarkDead records a dead-lettered message
+func (r *recordingOutboxRepository) MarkDead(id int, lastError string) error {
+	r.dead = append(r.dead, id)
+	return nil
+}
+
+// recordingSender accepts every message and keeps it
+type recordingSender struct {
+	messages []Message
+}
+
+// Name returns the provider name
+func (s *recordingSender) Name() string {
+	return "recording"
+}
+
+// Send records the message
+func (s *recordingSender) Send(ctx context.Context, msg *Message) (*SendResult, error) {
+	s.messages = append(s.messages, *msg)
+	return &SendResult{ProviderMessageID: "msg-1"}, nil
+}
+
+func TestOutboxWorker_OpensSealedPayloadAtSendTime(t *testing.T) {
+	cfg := &config.Config{
+		OTP:      config.OTP{HashPepper: "pepper"},
+		Delivery: config.Delivery{Timeout: time.Second, ConfirmationTimeout: time.Minute},
+	}
+	repo := &recordingOutboxRepository{}
+	sender := &recordingSender{}
+	worker := NewOutboxWorker(repo, nil, map[string]Sender{ChannelSMS: sender}, cfg, test.GetTestLogger())
+
+	code, err := sealSecret("pepper", "482913")
+	require.NoError(t, err)
+	body, err := sealSecret("pepper", "Your code is 482913")
+	require.NoError(t, err)
+
+	worker.deliver(context.Background(), &entity.OutboxMessage{
+		ID:               1,
+		Channel:          ChannelSMS,
+		FallbackChannels: ChannelVoice,
+		PhoneNumber:      "+447700900123",
+		Code:             code,
+		Body:             body,
+		ExpiresAt:        time.Now().Add(5 * time.Minute),
+		Attempts:         1,
+		MaxAttempts:      3,
+	})
+
+	require.Len(t, sender.messages, 1)
+	assert.Equal(t, "482913", sender.messages[0].Code)
+	assert.Equal(t, "Your code is 482913", sender.messages[0].Body)
+	assert.Equal(t, []int{1}, repo.sent)
+
+	// The fallback is queued with the payload still sealed
+	require.Len(t, repo.enqueued, 1)
+	assert.Equal(t, ChannelVoice, repo.enqueued[0].Channel)
+	assert.False(t, strings.Contains(repo.enqueued[0].Code+repo.enqueued[0].Body, "482913"))
+	assert.Equal(t, code, repo.enqueued[0].Code)
+}
+
+func TestOutboxWorker_DeadLettersUnreadablePayload(t *testing.T) {
+	cfg := &config.Config{
+		OTP:      config.OTP{HashPepper: "pepper"},
+		Delivery: config.Delivery{Timeout: time.Second},
+	}
+	repo := &recordingOutboxRepository{}
+	sender := &recordingSender{}
+	worker := NewOutboxWorker(repo, nil, map[string]Sender{ChannelSMS: sender}, cfg, test.GetTestLogger())
+
+	worker.deliver(context.Background(), &entity.OutboxMessage{
+		ID:          2,
+		Channel:     ChannelSMS,
+		PhoneNumber: "+447700900123",
+		Code:        "482913",
+		Body:        "Your code is 482913",
+		ExpiresAt:   time.Now().Add(5 * time.Minute),
+		Attempts:    1,
+		MaxAttempts: 3,
+	})
+
+	assert.Empty(t, sender.messages)
+	assert.Equal(t, []int{2}, repo.dead)
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// hashSecret returns the hex HMAC-SHA256 of an OTP code or session token keyed with the server-side pepper
+func hashSecret(pepper, value string) string {
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// secretMatches compares a plaintext value with a stored digest in constant time
+func secretMatches(pepper, value, digest string) bool {
+	return hmac.Equal([]byte(hashSecret(pepper, value)), []byte(digest))
+}
+
+// MaskToken shortens a session or magic link token to a prefix that correlates log lines
+// without revealing the token
+func MaskToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	if len(token) <= 8 {
+		return "..."
+	}
+	return token[:8] + "..."
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/pkg/logger"
+)
+
+// Delivery channels
+const (
+	ChannelSMS          = "sms"
+	ChannelVoice        = "voice"
+	ChannelEmail        = "email"
+	ChannelMessagingApp = "messaging_app"
+)
+
+// Message represents an outbound OTP message
+type Message struct {
+	Channel     string
+	PhoneNumber string
+	Email       string
+	Code        string
+	Body        string
+	ExpiresAt   time.Time
+}
+
+// SendResult holds the provider's answer for an accepted message
+type SendResult struct {
+	ProviderMessageID string
+}
+
+// Sender interface defines an OTP delivery provider
+type Sender interface {
+	Name() string
+	Send(ctx context.Context, msg *Message) (*SendResult, error)
+}
+
+// NewSenders creates a delivery provider for every channel in the configured fallback chain.
+// With the console provider every channel prints to stdout.
+func NewSenders(cfg *config.Config, logger *logger.Logger) (map[string]Sender, error) {
+	senders := make(map[string]Sender, len(cfg.Delivery.Channels))
+
+	for _, channel := range cfg.Delivery.Channels {
+		if cfg.Delivery.Provider == "" || cfg.Delivery.Provider == "console" {
+			senders[channel] = NewConsoleSender(logger)
+			continue
+		}
+
+		var sender Sender
+		var err error
+
+		switch channel {
+		case ChannelSMS:
+			sender, err = newSMSSender(cfg, logger)
+		case ChannelVoice:
+			if cfg.Delivery.Voice.URL == "" {
+				return nil, fmt.Errorf("VOICE_WEBHOOK_URL is required for the voice channel")
+			}
+			sender = NewWebhookSender(ChannelVoice, cfg.Delivery.Voice, cfg.Delivery.Timeout, logger)
+		case ChannelMessagingApp:
+			if cfg.Delivery.MessagingApp.URL == "" {
+				return nil, fmt.Errorf("MESSAGING_APP_WEBHOOK_URL is required for the messaging_app channel")
+			}
+			sender = NewWebhookSender(ChannelMessagingApp, cfg.Delivery.MessagingApp, cfg.Delivery.Timeout, logger)
+		case ChannelEmail:
+			if cfg.Delivery.Email.Host == "" || cfg.Delivery.Email.From == "" {
+				return nil, fmt.Errorf("SMTP_HOST and SMTP_FROM are required for the email channel")
+			}
+			sender = NewSMTPSender(cfg.Delivery.Email, cfg.Delivery.Timeout, logger)
+		default:
+			return nil, fmt.Errorf("unknown delivery channel: %s", channel)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		senders[channel] = sender
+	}
+
+	if len(senders) == 0 {
+		return nil, fmt.Errorf("at least one delivery channel must be configured")
+	}
+
+	return senders, nil
+}
+
+// newSMSSender creates the SMS provider selected in the configuration
+func newSMSSender(cfg *config.Config, logger *logger.Logger) (Sender, error) {
+	switch cfg.Delivery.Provider {
+	case "webhook":
+		if cfg.Delivery.Webhook.URL == "" {
+			return nil, fmt.Errorf("SMS_WEBHOOK_URL is required for the webhook delivery provider")
+		}
+		return NewWebhookSender(ChannelSMS, cfg.Delivery.Webhook, cfg.Delivery.Timeout, logger), nil
+	case "smpp":
+		if cfg.Delivery.SMPP.Host == "" {
+			return nil, fmt.Errorf("SMPP_HOST is required for the smpp delivery provider")
+		}
+		return NewSMPPSender(cfg.Delivery.SMPP, cfg.Delivery.Timeout, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown delivery provider: %s", cfg.Delivery.Provider)
+	}
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf16"
+
+	"otp-auth/config"
+	"otp-auth/pkg/logger"
+)
+
+// SMPP v3.4 command identifiers used by the client
+const (
+	smppGenericNack         uint32 = 0x80000000
+	smppBindTransmitter     uint32 = 0x00000002
+	smppBindTransmitterResp uint32 = 0x80000002
+	smppSubmitSM            uint32 = 0x00000004
+	smppSubmitSMResp        uint32 = 0x80000004
+	smppUnbind              uint32 = 0x00000006
+	smppEnquireLink         uint32 = 0x00000015
+	smppEnquireLinkResp     uint32 = 0x80000015
+
+	smppInterfaceVersion byte   = 0x34
+	smppMessagePayload   uint16 = 0x0424
+	smppMaxShortMessage         = 254
+	smppHeaderLength            = 16
+	smppMaxPDULength            = 64 * 1024
+)
+
+// smppPDU is a decoded SMPP protocol data unit
+type smppPDU struct {
+	CommandID uint32
+	Status    uint32
+	Sequence  uint32
+	Body      []byte
+}
+
+// smppSender delivers OTP messages to an SMSC over a bound SMPP transmitter session
+type smppSender struct {
+	cfg      config.SMPP
+	timeout  time.Duration
+	logger   *logger.Logger
+	mu       sync.Mutex
+	conn     net.Conn
+	reader   *bufio.Reader
+	sequence uint32
+}
+
+// NewSMPPSender creates a sender that submits messages to an SMPP server
+func NewSMPPSender(cfg config.SMPP, timeout time.Duration, logger *logger.Logger) Sender {
+	return &smppSender{
+		cfg:     cfg,
+		timeout: timeout,
+		logger:  logger,
+	}
+}
+
+// Name returns the provider name
+func (s *smppSender) Name() string {
+	return "smpp"
+}
+
+// Send submits the message and returns the SMSC message ID
+func (s *smppSender) Send(ctx context.Context, msg *Message) (*SendResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(s.timeout)
+	}
+
+	if s.conn == nil {
+		if err := s.bind(ctx, deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	messageID, err := s.submit(msg, deadline)
+	if err != nil {
+		// Drop the session so the next send starts with a fresh bind
+		s.close()
+		return nil, err
+	}
+
+	return &SendResult{ProviderMessageID: messageID}, nil
+}
+
+// bind opens a TCP connection and binds as a transmitter
+func (s *smppSender) bind(ctx context.Context, deadline time.Time) error {
+	dialer := &net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port))
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMPP server: %w", err)
+	}
+
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+
+	var body bytes.Buffer
+	writeCString(&body, s.cfg.SystemID)
+	writeCString(&body, s.cfg.Password)
+	writeCString(&body, s.cfg.SystemType)
+	body.WriteByte(smppInterfaceVersion)
+	body.WriteByte(0) // addr_ton
+	body.WriteByte(0) // addr_npi
+	writeCString(&body, "")
+
+	resp, err := s.roundTrip(smppBindTransmitter, body.Bytes(), smppBindTransmitterResp, deadline)
+	if err != nil {
+		s.close()
+		return fmt.Errorf("failed to bind SMPP transmitter: %w", err)
+	}
+	if resp.Status != 0 {
+		s.close()
+		return fmt.Errorf("SMPP bind rejected with status 0x%08X", resp.Status)
+	}
+
+	s.logger.Infow("SMPP transmitter bound", "host", s.cfg.Host, "port", s.cfg.Port, "system_id", s.cfg.SystemID)
+	return nil
+}
+
+// submit sends a submit_sm PDU and waits for the response
+func (s *smppSender) submit(msg *Message, deadline time.Time) (string, error) {
+	dataCoding, shortMessage := encodeSMPPMessage(msg.Body)
+
+	var body bytes.Buffer
+	writeCString(&body, "") // service_type
+	sourceTON, sourceNPI := smppAddressType(s.cfg.SourceAddr)
+	body.WriteByte(sourceTON)
+	body.WriteByte(sourceNPI)
+	writeCString(&body, s.cfg.SourceAddr)
+	body.WriteByte(1) // dest_addr_ton: international
+	body.WriteByte(1) // dest_addr_npi: ISDN
+	writeCString(&body, strings.TrimPrefix(msg.PhoneNumber, "+"))
+	body.WriteByte(0) // esm_class
+	body.WriteByte(0) // protocol_id
+	body.WriteByte(0) // priority_flag
+	writeCString(&body, "")
+	writeCString(&body, "")
+	body.WriteByte(1) // registered_delivery: request a delivery receipt
+	body.WriteByte(0) // replace_if_present_flag
+	body.WriteByte(dataCoding)
+	body.WriteByte(0) // sm_default_msg_id
+
+	if len(shortMessage) <= smppMaxShortMessage {
+		body.WriteByte(byte(len(shortMessage)))
+		body.Write(shortMessage)
+	} else {
+		body.WriteByte(0)
+		binary.Write(&body, binary.BigEndian, smppMessagePayload)
+		binary.Write(&body, binary.BigEndian, uint16(len(shortMessage)))
+		body.Write(shortMessage)
+	}
+
+	resp, err := s.roundTrip(smppSubmitSM, body.Bytes(), smppSubmitSMResp, deadline)
+	if err != nil {
+		return "", fmt.Errorf("failed to submit SMPP message: %w", err)
+	}
+	if resp.Status != 0 {
+		return "", fmt.Errorf("SMPP submit rejected with status 0x%08X", resp.Status)
+	}
+
+	return strings.TrimRight(string(resp.Body), "\x00"), nil
+}
+
+// roundTrip writes a request PDU and reads until the matching response arrives
+func (s *smppSender) roundTrip(commandID uint32, body []byte, expected uint32, deadline time.Time) (*smppPDU, error) {
+	if err := s.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	s.sequence++
+	sequence := s.sequence
+	if err := s.writePDU(commandID, 0, sequence, body); err != nil {
+		return nil, err
+	}
+
+	for {
+		pdu, err := s.readPDU()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case pdu.CommandID == smppEnquireLink:
+			if err := s.writePDU(smppEnquireLinkResp, 0, pdu.Sequence, nil); err != nil {
+				return nil, err
+			}
+		case pdu.CommandID == smppGenericNack && pdu.Sequence == sequence:
+			return nil, fmt.Errorf("SMPP generic_nack with status 0x%08X", pdu.Status)
+		case pdu.CommandID == expected && pdu.Sequence == sequence:
+			return pdu, nil
+		default:
+			s.logger.Debugw("Ignoring unexpected SMPP PDU", "command_id", fmt.Sprintf("0x%08X", pdu.CommandID), "sequence", pdu.Sequence)
+		}
+	}
+}
+
+// writePDU encodes and writes a single PDU
+func (s *smppSender) writePDU(commandID, status, sequence uint32, body []byte) error {
+	header := make([]byte, smppHeaderLength)
+	binary.BigEndian.PutUint32(header[0:4], uint32(smppHeaderLength+len(body)))
+	binary.BigEndian.PutUint32(header[4:8], commandID)
+	binary.BigEndian.PutUint32(header[8:12], status)
+	binary.BigEndian.PutUint32(header[12:16], sequence)
+
+	if _, err := s.conn.Write(append(header, body...)); err != nil {
+		return fmt.Errorf("failed to write SMPP PDU: %w", err)
+	}
+	return nil
+}
+
+// readPDU reads and decodes a single PDU
+func (s *smppSender) readPDU() (*smppPDU, error) {
+	header := make([]byte, smppHeaderLength)
+	if _, err := io.ReadFull(s.reader, header); err != nil {
+		return nil, fmt.Errorf("failed to read SMPP PDU header: %w", err)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < smppHeaderLength || length > smppMaxPDULength {
+		return nil, fmt.Errorf("invalid SMPP PDU length: %d", length)
+	}
+
+	body := make([]byte, length-smppHeaderLength)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return nil, fmt.Errorf("failed to read SMPP PDU body: %w", err)
+	}
+
+	return &smppPDU{
+		CommandID: binary.BigEndian.Uint32(header[4:8]),
+		Status:    binary.BigEndian.Uint32(header[8:12]),
+		Sequence:  binary.BigEndian.Uint32(header[12:16]),
+		Body:      body,
+	}, nil
+}
+
+// close unbinds (best effort) and closes the connection
+func (s *smppSender) close() {
+	if s.conn == nil {
+		return
+	}
+	s.sequence++
+	_ = s.writePDU(smppUnbind, 0, s.sequence, nil)
+	_ = s.conn.Close()
+	s.conn = nil
+	s.reader = nil
+}
+
+// encodeSMPPMessage picks the data coding for the text and encodes it
+func encodeSMPPMessage(text string) (byte, []byte) {
+	for _, r := range text {
+		if r > unicode.MaxASCII {
+			// UCS2 for anything outside ASCII (e.g. Persian or Arabic text)
+			encoded := utf16.Encode([]rune(text))
+			buf := make([]byte, len(encoded)*2)
+			for i, unit := range encoded {
+				binary.BigEndian.PutUint16(buf[i*2:], unit)
+			}
+			return 0x08, buf
+		}
+	}
+	return 0x00, []byte(text)
+}
+
+// smppAddressType returns the TON/NPI pair for a source address
+func smppAddressType(addr string) (byte, byte) {
+	if addr == "" {
+		return 0, 0
+	}
+	for _, r := range strings.TrimPrefix(addr, "+") {
+		if !unicode.IsDigit(r) {
+			return 5, 0 // alphanumeric sender ID
+		}
+	}
+	return 1, 1
+}
+
+// writeCString writes a NUL-terminated string
+func writeCString(buf *bytes.Buffer, value string) {
+	buf.WriteString(value)
+	buf.WriteByte(0)
+}
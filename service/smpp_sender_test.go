@@ -0,0 +1,360 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubSMSC is an SMPP server that records the PDUs it receives and answers them through respond
+type stubSMSC struct {
+	listener net.Listener
+	respond  func(pdu *smppPDU) []*smppPDU
+
+	mu       sync.Mutex
+	received []*smppPDU
+	binds    int
+}
+
+// newStubSMSC starts an SMPP server on a loopback port
+func newStubSMSC(t *testing.T, respond func(pdu *smppPDU) []*smppPDU) *stubSMSC {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	smsc := &stubSMSC{listener: listener, respond: respond}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go smsc.serve(conn)
+		}
+	}()
+
+	return smsc
+}
+
+// serve reads PDUs from a client connection and writes the responses
+func (s *stubSMSC) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		header := make([]byte, smppHeaderLength)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header[0:4])-smppHeaderLength)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return
+		}
+
+		pdu := &smppPDU{
+			CommandID: binary.BigEndian.Uint32(header[4:8]),
+			Status:    binary.BigEndian.Uint32(header[8:12]),
+			Sequence:  binary.BigEndian.Uint32(header[12:16]),
+			Body:      body,
+		}
+
+		s.mu.Lock()
+		s.received = append(s.received, pdu)
+		if pdu.CommandID == smppBindTransmitter {
+			s.binds++
+		}
+		s.mu.Unlock()
+
+		for _, resp := range s.respond(pdu) {
+			out := make([]byte, smppHeaderLength, smppHeaderLength+len(resp.Body))
+			binary.BigEndian.PutUint32(out[0:4], uint32(smppHeaderLength+len(resp.Body)))
+			binary.BigEndian.PutUint32(out[4:8], resp.CommandID)
+			binary.BigEndian.PutUint32(out[8:12], resp.Status)
+			binary.BigEndian.PutUint32(out[12:16], resp.Sequence)
+			if _, err := conn.Write(append(out, resp.Body...)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// pdus returns the received PDUs with the given command ID
+func (s *stubSMSC) pdus(commandID uint32) []*smppPDU {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []*smppPDU
+	for _, pdu := range s.received {
+		if pdu.CommandID == commandID {
+			matched = append(matched, pdu)
+		}
+	}
+	return matched
+}
+
+// bindCount returns the number of bind requests received
+func (s *stubSMSC) bindCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.binds
+}
+
+// config returns the SMPP settings pointing at the stub
+func (s *stubSMSC) config() config.SMPP {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return config.SMPP{Host: addr.IP.String(), Port: addr.Port, SystemID: "otp", Password: "secret", SystemType: "OTP", SourceAddr: "Acme"}
+}
+
+// acceptAll binds every client and accepts every message with a fixed message ID
+func acceptAll(pdu *smppPDU) []*smppPDU {
+	switch pdu.CommandID {
+	case smppBindTransmitter:
+		return []*smppPDU{{CommandID: smppBindTransmitterResp, Sequence: pdu.Sequence, Body: []byte("SMSC\x00")}}
+	case smppSubmitSM:
+		return []*smppPDU{{CommandID: smppSubmitSMResp, Sequence: pdu.Sequence, Body: []byte("msg-1\x00")}}
+	}
+	return nil
+}
+
+// cStrings splits the first n NUL-terminated strings off a PDU body
+func cStrings(t *testing.T, body []byte, n int) ([]string, []byte) {
+	values := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		end := bytes.IndexByte(body, 0)
+		require.GreaterOrEqual(t, end, 0, "missing NUL terminator")
+		values = append(values, string(body[:end]))
+		body = body[end+1:]
+	}
+	return values, body
+}
+
+func TestSMPPSender_BindsAndSubmits(t *testing.T) {
+	smsc := newStubSMSC(t, acceptAll)
+	sender := NewSMPPSender(smsc.config(), time.Second, test.GetTestLogger())
+
+	result, err := sender.Send(context.Background(), &Message{PhoneNumber: "+447700900123", Body: "Your code is 123456"})
+	require.NoError(t, err)
+	assert.Equal(t, "msg-1", result.ProviderMessageID)
+	assert.Equal(t, "smpp", sender.Name())
+
+	binds := smsc.pdus(smppBindTransmitter)
+	require.Len(t, binds, 1)
+	fields, rest := cStrings(t, binds[0].Body, 3)
+	assert.Equal(t, []string{"otp", "secret", "OTP"}, fields)
+	assert.Equal(t, []byte{smppInterfaceVersion, 0, 0, 0}, rest)
+
+	submits := smsc.pdus(smppSubmitSM)
+	require.Len(t, submits, 1)
+	assert.Greater(t, submits[0].Sequence, binds[0].Sequence)
+
+	body := submits[0].Body
+	serviceType, body := cStrings(t, body, 1)
+	assert.Equal(t, []string{""}, serviceType)
+	assert.Equal(t, []byte{5, 0}, body[:2], "alphanumeric source TON/NPI")
+	source, body := cStrings(t, body[2:], 1)
+	assert.Equal(t, []string{"Acme"}, source)
+	assert.Equal(t, []byte{1, 1}, body[:2], "international destination TON/NPI")
+	destination, body := cStrings(t, body[2:], 1)
+	assert.Equal(t, []string{"447700900123"}, destination)
+	assert.Equal(t, []byte{0, 0, 0}, body[:3]) // esm_class, protocol_id, priority_flag
+	schedule, body := cStrings(t, body[3:], 2)
+	assert.Equal(t, []string{"", ""}, schedule)
+	assert.Equal(t, []byte{1, 0, 0x00, 0}, body[:4]) // registered_delivery, replace, data_coding, default_msg_id
+	assert.Equal(t, byte(len("Your code is 123456")), body[4])
+	assert.Equal(t, "Your code is 123456", string(body[5:]))
+}
+
+func TestSMPPSender_ReusesTheBoundSession(t *testing.T) {
+	smsc := newStubSMSC(t, acceptAll)
+	sender := NewSMPPSender(smsc.config(), time.Second, test.GetTestLogger())
+
+	for i := 0; i < 3; i++ {
+		_, err := sender.Send(context.Background(), &Message{PhoneNumber: "+447700900123", Body: "Your code is 123456"})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, smsc.bindCount())
+	assert.Len(t, smsc.pdus(smppSubmitSM), 3)
+}
+
+func TestSMPPSender_AnswersEnquireLinkWhileWaiting(t *testing.T) {
+	smsc := newStubSMSC(t, func(pdu *smppPDU) []*smppPDU {
+		if pdu.CommandID == smppSubmitSM {
+			return []*smppPDU{
+				{CommandID: smppEnquireLink, Sequence: 900},
+				{CommandID: smppSubmitSMResp, Sequence: pdu.Sequence, Body: []byte("msg-2\x00")},
+			}
+		}
+		return acceptAll(pdu)
+	})
+	sender := NewSMPPSender(smsc.config(), time.Second, test.GetTestLogger())
+
+	result, err := sender.Send(context.Background(), &Message{PhoneNumber: "+447700900123", Body: "Your code is 123456"})
+	require.NoError(t, err)
+	assert.Equal(t, "msg-2", result.ProviderMessageID)
+
+	require.Eventually(t, func() bool { return len(smsc.pdus(smppEnquireLinkResp)) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint32(900), smsc.pdus(smppEnquireLinkResp)[0].Sequence)
+}
+
+func TestSMPPSender_BindRejected(t *testing.T) {
+	smsc := newStubSMSC(t, func(pdu *smppPDU) []*smppPDU {
+		if pdu.CommandID == smppBindTransmitter {
+			return []*smppPDU{{CommandID: smppBindTransmitterResp, Status: 0x0000000E, Sequence: pdu.Sequence}}
+		}
+		return nil
+	})
+	sender := NewSMPPSender(smsc.config(), time.Second, test.GetTestLogger())
+
+	_, err := sender.Send(context.Background(), &Message{PhoneNumber: "+447700900123", Body: "Your code is 123456"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SMPP bind rejected with status 0x0000000E")
+	assert.Empty(t, smsc.pdus(smppSubmitSM))
+}
+
+func TestSMPPSender_SubmitRejectedRebindsNextTime(t *testing.T) {
+	var mu sync.Mutex
+	rejected := false
+	smsc := newStubSMSC(t, func(pdu *smppPDU) []*smppPDU {
+		mu.Lock()
+		defer mu.Unlock()
+		if pdu.CommandID == smppSubmitSM && !rejected {
+			rejected = true
+			return []*smppPDU{{CommandID: smppSubmitSMResp, Status: 0x00000058, Sequence: pdu.Sequence}}
+		}
+		return acceptAll(pdu)
+	})
+	sender := NewSMPPSender(smsc.config(), time.Second, test.GetTestLogger())
+
+	_, err := sender.Send(context.Background(), &Message{PhoneNumber: "+447700900123", Body: "Your code is 123456"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SMPP submit rejected with status 0x00000058")
+
+	// The failed session is unbound and the next send binds again
+	result, err := sender.Send(context.Background(), &Message{PhoneNumber: "+447700900123", Body: "Your code is 123456"})
+	require.NoError(t, err)
+	assert.Equal(t, "msg-1", result.ProviderMessageID)
+	assert.Equal(t, 2, smsc.bindCount())
+	require.Eventually(t, func() bool { return len(smsc.pdus(smppUnbind)) == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestSMPPSender_GenericNack(t *testing.T) {
+	smsc := newStubSMSC(t, func(pdu *smppPDU) []*smppPDU {
+		if pdu.CommandID == smppSubmitSM {
+			return []*smppPDU{{CommandID: smppGenericNack, Status: 0x00000003, Sequence: pdu.Sequence}}
+		}
+		return acceptAll(pdu)
+	})
+	sender := NewSMPPSender(smsc.config(), time.Second, test.GetTestLogger())
+
+	_, err := sender.Send(context.Background(), &Message{PhoneNumber: "+447700900123", Body: "Your code is 123456"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SMPP generic_nack with status 0x00000003")
+}
+
+func TestSMPPSender_Timeout(t *testing.T) {
+	// Binds, then never answers the submit
+	smsc := newStubSMSC(t, func(pdu *smppPDU) []*smppPDU {
+		if pdu.CommandID == smppSubmitSM {
+			return nil
+		}
+		return acceptAll(pdu)
+	})
+	sender := NewSMPPSender(smsc.config(), 100*time.Millisecond, test.GetTestLogger())
+
+	started := time.Now()
+	_, err := sender.Send(context.Background(), &Message{PhoneNumber: "+447700900123", Body: "Your code is 123456"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to submit SMPP message")
+	var netErr net.Error
+	if assert.ErrorAs(t, err, &netErr) {
+		assert.True(t, netErr.Timeout())
+	}
+	assert.Less(t, time.Since(started), time.Second)
+}
+
+func TestSMPPSender_ContextDeadlineBoundsTheSend(t *testing.T) {
+	smsc := newStubSMSC(t, func(pdu *smppPDU) []*smppPDU { return nil })
+	sender := NewSMPPSender(smsc.config(), time.Minute, test.GetTestLogger())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	_, err := sender.Send(ctx, &Message{PhoneNumber: "+447700900123", Body: "Your code is 123456"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to bind SMPP transmitter")
+	assert.Less(t, time.Since(started), time.Second)
+}
+
+func TestSMPPSender_Unreachable(t *testing.T) {
+	smsc := newStubSMSC(t, acceptAll)
+	cfg := smsc.config()
+	require.NoError(t, smsc.listener.Close())
+
+	_, err := NewSMPPSender(cfg, time.Second, test.GetTestLogger()).Send(context.Background(), &Message{PhoneNumber: "+447700900123", Body: "Your code is 123456"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to SMPP server")
+}
+
+func TestSMPPSender_LongUnicodeMessageUsesPayload(t *testing.T) {
+	smsc := newStubSMSC(t, acceptAll)
+	sender := NewSMPPSender(smsc.config(), time.Second, test.GetTestLogger())
+
+	text := strings.Repeat("کد شما ", 20) + "123456"
+	_, err := sender.Send(context.Background(), &Message{PhoneNumber: "+989121234567", Body: text})
+	require.NoError(t, err)
+
+	submits := smsc.pdus(smppSubmitSM)
+	require.Len(t, submits, 1)
+
+	dataCoding, encoded := encodeSMPPMessage(text)
+	require.Greater(t, len(encoded), smppMaxShortMessage)
+
+	// data_coding, sm_default_msg_id, sm_length 0, then the message_payload TLV
+	var tail bytes.Buffer
+	tail.Write([]byte{dataCoding, 0, 0})
+	_ = binary.Write(&tail, binary.BigEndian, smppMessagePayload)
+	_ = binary.Write(&tail, binary.BigEndian, uint16(len(encoded)))
+	tail.Write(encoded)
+	assert.True(t, bytes.HasSuffix(submits[0].Body, tail.Bytes()))
+}
+
+func TestEncodeSMPPMessage(t *testing.T) {
+	dataCoding, encoded := encodeSMPPMessage("Code 123456")
+	assert.Equal(t, byte(0x00), dataCoding)
+	assert.Equal(t, []byte("Code 123456"), encoded)
+
+	// UCS2 big endian for text outside ASCII
+	dataCoding, encoded = encodeSMPPMessage("کد 12")
+	assert.Equal(t, byte(0x08), dataCoding)
+	assert.Equal(t, []byte{0x06, 0xA9, 0x06, 0x2F, 0x00, 0x20, 0x00, 0x31, 0x00, 0x32}, encoded)
+}
+
+func TestSMPPAddressType(t *testing.T) {
+	cases := map[string][2]byte{
+		"":              {0, 0},
+		"Acme":          {5, 0},
+		"+447700900123": {1, 1},
+		"12345":         {1, 1},
+	}
+
+	for addr, want := range cases {
+		ton, npi := smppAddressType(addr)
+		assert.Equal(t, want, [2]byte{ton, npi}, addr)
+	}
+}
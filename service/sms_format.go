@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+)
+
+// MaxRetrieverMessageBytes is the size limit of an SMS Retriever message:
+// one SMS segment, i.e. 160 GSM-7 characters or 70 UCS-2 characters
+const MaxRetrieverMessageBytes = 140
+
+// ErrMessageTooLong is returned when a formatted message exceeds the autofill size limit
+var ErrMessageTooLong = errors.New("message exceeds autofill size limit")
+
+// gsm7Basic holds the GSM 03.38 basic character set (one septet each)
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension holds characters sent as an escape sequence (two septets each)
+const gsm7Extension = "\f^{}\\[~]|€"
+
+// FormatAutofill appends the client app's autofill lines to an SMS body:
+// the SMS Retriever app hash on its own line, then the WebOTP "@domain #code"
+// line, which must be the last line of the message.
+func FormatAutofill(body, code string, app config.ClientApp) (string, error) {
+	if app.AndroidAppHash == "" && app.WebOTPDomain == "" {
+		return body, nil
+	}
+
+	var b strings.Builder
+	b.WriteString(body)
+	if app.AndroidAppHash != "" {
+		b.WriteString("\n")
+		b.WriteString(app.AndroidAppHash)
+	}
+	if app.WebOTPDomain != "" {
+		b.WriteString("\n@")
+		b.WriteString(app.WebOTPDomain)
+		b.WriteString(" #")
+		b.WriteString(code)
+	}
+
+	formatted := b.String()
+	if app.AndroidAppHash != "" {
+		if size, _ := SMSEncodedLength(formatted); size > MaxRetrieverMessageBytes {
+			return "", fmt.Errorf("%w: %d bytes for client app %s", ErrMessageTooLong, size, app.ID)
+		}
+	}
+
+	return formatted, nil
+}
+
+// SMSEncodedLength returns the size in bytes of text in a single SMS and whether it
+// fits the GSM-7 alphabet; anything else is sent as UCS-2
+func SMSEncodedLength(text string) (int, bool) {
+	septets := 0
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			septets++
+		case strings.ContainsRune(gsm7Extension, r):
+			septets += 2
+		default:
+			return 2 * len(utf16.Encode([]rune(text))), false
+		}
+	}
+
+	return (septets*7 + 7) / 8, true
+}
+
+// CheckAutofillFormats renders every locale and purpose for every client app with autofill
+// enabled and reports the combinations that exceed the SMS Retriever limit
+func CheckAutofillFormats(renderer MessageRenderer, cfg *config.Config) []error {
+	var problems []error
+	for _, app := range cfg.ClientApps {
+		for _, locale := range renderer.Locales() {
+			for _, purpose := range entity.Purposes {
+				code := strings.Repeat("0", cfg.OTP.CodePolicy(purpose).Length)
+				body, err := renderer.Render(locale, purpose, MessageData{
+					Code:          code,
+					ExpiryMinutes: int(cfg.OTP.ExpirationTime.Minutes()),
+					AppName:       cfg.Messages.AppName,
+				})
+				if err != nil {
+					problems = append(problems, err)
+					continue
+				}
+				if _, err := FormatAutofill(body, code, app); err != nil {
+					problems = append(problems, fmt.Errorf("locale %s, purpose %s: %w", locale, purpose, err))
+				}
+			}
+		}
+	}
+
+	return problems
+}
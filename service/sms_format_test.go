@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"otp-auth/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatAutofill_NoAutofillConfigured(t *testing.T) {
+	body := "Your verification code is 123456."
+
+	formatted, err := FormatAutofill(body, "123456", config.ClientApp{ID: "plain"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, body, formatted)
+}
+
+func TestFormatAutofill_AndroidRetriever(t *testing.T) {
+	app := config.ClientApp{ID: "android", AndroidAppHash: "FA+9qCX9VSu"}
+
+	formatted, err := FormatAutofill("Your verification code is 123456.", "123456", app)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("Your verification code is 123456.\nFA+9qCX9VSu"), []byte(formatted))
+}
+
+func TestFormatAutofill_WebOTP(t *testing.T) {
+	app := config.ClientApp{ID: "web", WebOTPDomain: "example.com"}
+
+	formatted, err := FormatAutofill("Your verification code is 123456.", "123456", app)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("Your verification code is 123456.\n@example.com #123456"), []byte(formatted))
+}
+
+func TestFormatAutofill_BothKeepWebOTPLineLast(t *testing.T) {
+	app := config.ClientApp{ID: "both", AndroidAppHash: "FA+9qCX9VSu", WebOTPDomain: "example.com"}
+
+	formatted, err := FormatAutofill("Code: 123456", "123456", app)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("Code: 123456\nFA+9qCX9VSu\n@example.com #123456"), []byte(formatted))
+
+	lines := strings.Split(formatted, "\n")
+	assert.Equal(t, "@example.com #123456", lines[len(lines)-1])
+}
+
+func TestFormatAutofill_RightToLeftBody(t *testing.T) {
+	app := config.ClientApp{ID: "both", AndroidAppHash: "FA+9qCX9VSu", WebOTPDomain: "example.com"}
+	body := "\u200fکد: \u200e123456\u200e"
+
+	formatted, err := FormatAutofill(body, "123456", app)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(body+"\nFA+9qCX9VSu\n@example.com #123456"), []byte(formatted))
+}
+
+func TestFormatAutofill_GSM7Limit(t *testing.T) {
+	app := config.ClientApp{ID: "android", AndroidAppHash: "FA+9qCX9VSu"}
+
+	// 148 characters + "\n" + 11-character hash = 160 septets = 140 bytes
+	fits := strings.Repeat("a", 148)
+	formatted, err := FormatAutofill(fits, "123456", app)
+	assert.NoError(t, err)
+	size, gsm7 := SMSEncodedLength(formatted)
+	assert.True(t, gsm7)
+	assert.Equal(t, MaxRetrieverMessageBytes, size)
+
+	_, err = FormatAutofill(fits+"a", "123456", app)
+	assert.True(t, errors.Is(err, ErrMessageTooLong))
+}
+
+func TestFormatAutofill_UCS2Limit(t *testing.T) {
+	app := config.ClientApp{ID: "android", AndroidAppHash: "FA+9qCX9VSu"}
+
+	// 58 characters + "\n" + 11-character hash = 70 UTF-16 units = 140 bytes
+	fits := strings.Repeat("ک", 58)
+	formatted, err := FormatAutofill(fits, "123456", app)
+	assert.NoError(t, err)
+	size, gsm7 := SMSEncodedLength(formatted)
+	assert.False(t, gsm7)
+	assert.Equal(t, MaxRetrieverMessageBytes, size)
+
+	_, err = FormatAutofill(fits+"ک", "123456", app)
+	assert.True(t, errors.Is(err, ErrMessageTooLong))
+}
+
+func TestFormatAutofill_WebOTPOnlyHasNoLimit(t *testing.T) {
+	app := config.ClientApp{ID: "web", WebOTPDomain: "example.com"}
+
+	_, err := FormatAutofill(strings.Repeat("a", 200), "123456", app)
+
+	assert.NoError(t, err)
+}
+
+func TestSMSEncodedLength(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		size int
+		gsm7 bool
+	}{
+		{"empty", "", 0, true},
+		{"single septet", "a", 1, true},
+		{"eight septets pack into seven bytes", "12345678", 7, true},
+		{"160 septets", strings.Repeat("x", 160), 140, true},
+		{"basic set symbols", "@£$¥èé", 6, true},
+		{"extension characters take two septets", "€[]", 6, true},
+		{"non-GSM character switches to UCS-2", "code ✓", 12, false},
+		{"Persian text is UCS-2", "کد", 4, false},
+		{"directional marks are UCS-2", "\u200f1", 4, false},
+		{"astral characters take two UTF-16 units", "🔐", 4, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, gsm7 := SMSEncodedLength(tt.text)
+			assert.Equal(t, tt.size, size)
+			assert.Equal(t, tt.gsm7, gsm7)
+		})
+	}
+}
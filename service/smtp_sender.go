@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/pkg/logger"
+)
+
+// smtpSender delivers OTP messages by email
+type smtpSender struct {
+	cfg     config.SMTP
+	timeout time.Duration
+	logger  *logger.Logger
+}
+
+// NewSMTPSender creates a sender that emails codes through an SMTP relay
+func NewSMTPSender(cfg config.SMTP, timeout time.Duration, logger *logger.Logger) Sender {
+	return &smtpSender{
+		cfg:     cfg,
+		timeout: timeout,
+		logger:  logger,
+	}
+}
+
+// Name returns the provider name
+func (s *smtpSender) Name() string {
+	return "smtp"
+}
+
+// Send emails the message to the recipient address
+func (s *smtpSender) Send(ctx context.Context, msg *Message) (*SendResult, error) {
+	if msg.Email == "" {
+		return nil, fmt.Errorf("no email address for recipient")
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(s.timeout)
+	}
+
+	dialer := &net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	if s.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return nil, fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(s.cfg.From); err != nil {
+		return nil, fmt.Errorf("SMTP MAIL FROM rejected: %w", err)
+	}
+	if err := client.Rcpt(msg.Email); err != nil {
+		return nil, fmt.Errorf("SMTP RCPT TO rejected: %w", err)
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return nil, fmt.Errorf("SMTP DATA rejected: %w", err)
+	}
+
+	var email strings.Builder
+	email.WriteString("From: " + s.cfg.From + "\r\n")
+	email.WriteString("To: " + msg.Email + "\r\n")
+	email.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", s.cfg.Subject) + "\r\n")
+	email.WriteString("MIME-Version: 1.0\r\n")
+	email.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	email.WriteString("\r\n")
+	email.WriteString(msg.Body + "\r\n")
+
+	if _, err := writer.Write([]byte(email.String())); err != nil {
+		return nil, fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("SMTP server rejected email: %w", err)
+	}
+
+	if err := client.Quit(); err != nil {
+		s.logger.Warnw("SMTP QUIT failed", "error", err)
+	}
+
+	return &SendResult{}, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/entity"
+	"otp-auth/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testNumbersTestConfig returns a service test configuration with a range of test numbers
+func testNumbersTestConfig(code string) *config.Config {
+	cfg := serviceTestConfig()
+	cfg.TestNumbers = config.TestNumbers{Numbers: []string{"+1500555*"}, Code: code}
+	return cfg
+}
+
+func TestIssueOTPCode_TestNumbers(t *testing.T) {
+	cases := []struct {
+		name        string
+		code        string
+		phoneNumber string
+		want        string
+	}{
+		{name: "configured code", code: "424242", phoneNumber: "+15005550006", want: "424242"},
+		{name: "last digits of the number", phoneNumber: "+15005550006", want: "550006"},
+		{name: "number shorter than the code", phoneNumber: "+1500", want: "001500"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			svc, _ := newServiceTestService(t, testNumbersTestConfig(c.code))
+
+			code, err := svc.issueOTPCode(entity.PurposeLogin, c.phoneNumber, true)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, code)
+		})
+	}
+}
+
+func TestSendOTP_TestNumberIsNotDelivered(t *testing.T) {
+	cfg := testNumbersTestConfig("424242")
+	cfg.RateLimit.MaxRequests = 1
+	svc, repos := newServiceTestService(t, cfg)
+
+	// Neither queued for delivery nor counted against the rate limits
+	for i := 0; i < 3; i++ {
+		response, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+15005550006"})
+		require.NoError(t, err)
+
+		otp := sessionByToken(t, repos, response.Token)
+		assert.True(t, otp.IsTest)
+		assert.Empty(t, repos.outbox.forOTP(otp.ID))
+	}
+
+	// Other numbers are still delivered
+	response, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+	require.NoError(t, err)
+	otp := sessionByToken(t, repos, response.Token)
+	assert.False(t, otp.IsTest)
+	assert.Len(t, repos.outbox.forOTP(otp.ID), 1)
+}
+
+func TestVerifyOTP_TestNumberSignInIsFlagged(t *testing.T) {
+	cfg := testNumbersTestConfig("424242")
+	cfg.JWT.ExpirationTime = time.Hour
+	svc, repos := newServiceTestService(t, cfg)
+	jwtService := NewJWTService(cfg, test.GetTestLogger(), nil)
+
+	response, err := svc.SendOTP(&entity.SendOTPRequest{PhoneNumber: "+15005550006"})
+	require.NoError(t, err)
+	token, code := sendTestOTP(t, svc, repos, &entity.SendOTPRequest{PhoneNumber: "+447700900123"})
+
+	// Tokens from test number sign-ins carry the test_number claim so downstream services can tell them apart
+	for _, c := range []struct {
+		token, code string
+		testNumber  bool
+	}{
+		{token: response.Token, code: "424242", testNumber: true},
+		{token: token, code: code, testNumber: false},
+	} {
+		result, err := svc.VerifyOTP(&entity.VerifyOTPRequest{Token: c.token, Code: c.code})
+		require.NoError(t, err)
+		assert.Equal(t, c.testNumber, result.TestNumber)
+
+		auth, err := jwtService.GenerateToken(result.User, result.TestNumber)
+		require.NoError(t, err)
+		parsed, err := jwtService.ValidateToken(auth.Token)
+		require.NoError(t, err)
+		assert.Equal(t, c.testNumber, parsed.Claims.(*JWTClaims).TestNumber)
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/pkg/logger"
+)
+
+// webhookRequest is the JSON body posted to the gateway
+type webhookRequest struct {
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+	From    string `json:"from,omitempty"`
+	Message string `json:"message"`
+}
+
+// webhookResponse is the optional JSON body returned by the gateway
+type webhookResponse struct {
+	MessageID string `json:"message_id"`
+}
+
+// webhookSender delivers OTP messages through a generic HTTP/JSON gateway (SMS, voice or messaging app)
+type webhookSender struct {
+	channel string
+	cfg     config.WebhookGateway
+	client  *http.Client
+	logger  *logger.Logger
+}
+
+// NewWebhookSender creates a sender that posts messages for a channel to an HTTP gateway
+func NewWebhookSender(channel string, cfg config.WebhookGateway, timeout time.Duration, logger *logger.Logger) Sender {
+	return &webhookSender{
+		channel: channel,
+		cfg:     cfg,
+		client:  &http.Client{Timeout: timeout},
+		logger:  logger,
+	}
+}
+
+// Name returns the provider name
+func (s *webhookSender) Name() string {
+	return "webhook"
+}
+
+// Send posts the message to the gateway and returns the gateway message ID
+func (s *webhookSender) Send(ctx context.Context, msg *Message) (*SendResult, error) {
+	payload, err := json.Marshal(webhookRequest{
+		Channel: s.channel,
+		To:      msg.PhoneNumber,
+		From:    s.cfg.SenderID,
+		Message: msg.Body,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal webhook request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.AuthToken)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s gateway: %w", s.channel, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s gateway response: %w", s.channel, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s gateway returned status %d: %s", s.channel, resp.StatusCode, string(body))
+	}
+
+	var gatewayResp webhookResponse
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &gatewayResp); err != nil {
+			s.logger.Warnw("Failed to parse gateway response", "channel", s.channel, "status", resp.StatusCode, "error", err)
+		}
+	}
+
+	return &SendResult{ProviderMessageID: gatewayResp.MessageID}, nil
+}
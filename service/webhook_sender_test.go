@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"otp-auth/config"
+	"otp-auth/test"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookTestMessage is the message sent in the webhook sender tests
+var webhookTestMessage = &Message{Channel: ChannelSMS, PhoneNumber: "+447700900123", Code: "123456", Body: "Your code is 123456"}
+
+func TestWebhookSender_PostsMessage(t *testing.T) {
+	var (
+		req  *http.Request
+		body map[string]interface{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"message_id": "gw-42"}`))
+	}))
+	defer server.Close()
+
+	sender := NewWebhookSender(ChannelVoice, config.WebhookGateway{URL: server.URL, AuthToken: "gateway-token", SenderID: "Acme"}, time.Second, test.GetTestLogger())
+
+	result, err := sender.Send(context.Background(), webhookTestMessage)
+	require.NoError(t, err)
+	assert.Equal(t, "gw-42", result.ProviderMessageID)
+	assert.Equal(t, "webhook", sender.Name())
+
+	require.NotNil(t, req)
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, "Bearer gateway-token", req.Header.Get("Authorization"))
+	assert.Equal(t, map[string]interface{}{
+		"channel": ChannelVoice,
+		"to":      "+447700900123",
+		"from":    "Acme",
+		"message": "Your code is 123456",
+	}, body)
+}
+
+func TestWebhookSender_OmitsOptionalFields(t *testing.T) {
+	var (
+		authorization string
+		body          map[string]interface{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sender := NewWebhookSender(ChannelSMS, config.WebhookGateway{URL: server.URL}, time.Second, test.GetTestLogger())
+
+	// A gateway that answers without a body still accepts the message
+	result, err := sender.Send(context.Background(), webhookTestMessage)
+	require.NoError(t, err)
+	assert.Empty(t, result.ProviderMessageID)
+
+	assert.Empty(t, authorization)
+	assert.NotContains(t, body, "from")
+}
+
+func TestWebhookSender_UnparsableResponseIsAccepted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	sender := NewWebhookSender(ChannelSMS, config.WebhookGateway{URL: server.URL}, time.Second, test.GetTestLogger())
+
+	result, err := sender.Send(context.Background(), webhookTestMessage)
+	require.NoError(t, err)
+	assert.Empty(t, result.ProviderMessageID)
+}
+
+func TestWebhookSender_ErrorStatus(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusBadGateway} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"error": "rejected"}`))
+		}))
+
+		sender := NewWebhookSender(ChannelMessagingApp, config.WebhookGateway{URL: server.URL}, time.Second, test.GetTestLogger())
+
+		result, err := sender.Send(context.Background(), webhookTestMessage)
+		assert.Nil(t, result, status)
+		if assert.Error(t, err, status) {
+			assert.Contains(t, err.Error(), fmt.Sprintf("messaging_app gateway returned status %d", status))
+			assert.Contains(t, err.Error(), `{"error": "rejected"}`, status)
+		}
+
+		server.Close()
+	}
+}
+
+func TestWebhookSender_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	sender := NewWebhookSender(ChannelSMS, config.WebhookGateway{URL: server.URL}, 50*time.Millisecond, test.GetTestLogger())
+
+	started := time.Now()
+	_, err := sender.Send(context.Background(), webhookTestMessage)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to call sms gateway")
+	assert.Less(t, time.Since(started), time.Second)
+}
+
+func TestWebhookSender_ContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	sender := NewWebhookSender(ChannelSMS, config.WebhookGateway{URL: server.URL}, time.Minute, test.GetTestLogger())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := sender.Send(ctx, webhookTestMessage)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestWebhookSender_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	sender := NewWebhookSender(ChannelSMS, config.WebhookGateway{URL: url}, time.Second, test.GetTestLogger())
+
+	_, err := sender.Send(context.Background(), webhookTestMessage)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to call sms gateway")
+}
@@ -23,20 +23,7 @@ type TestDB struct {
 
 // SetupTestDB creates a test database and runs migrations
 func SetupTestDB(t *testing.T) *TestDB {
-	// Use environment variables or defaults for test database
-	host := getEnvOrDefault("TEST_DB_HOST", "localhost")
-	port := getEnvOrDefault("TEST_DB_PORT", "5432")
-	user := getEnvOrDefault("TEST_DB_USER", "otp_auth")
-	password := getEnvOrDefault("TEST_DB_PASSWORD", "otp_auth")
-
-	// Get base database name and add _test suffix
-	baseDBName := getEnvOrDefault("POSTGRES_DB", "otp_auth")
-	dbName := getEnvOrDefault("TEST_DB_NAME", baseDBName+"_test")
-
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbName)
-
-	db, err := sqlx.Connect("postgres", connStr)
+	db, err := sqlx.Connect("postgres", testDBConnString())
 	require.NoError(t, err, "Failed to connect to test database")
 
 	// Run migrations - check multiple possible paths
@@ -52,6 +39,35 @@ func SetupTestDB(t *testing.T) *TestDB {
 	return &TestDB{DB: db}
 }
 
+// SkipWithoutTestDB skips integration tests in short mode or when the test database is unreachable
+func SkipWithoutTestDB(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	db, err := sqlx.Connect("postgres", testDBConnString())
+	if err != nil {
+		t.Skipf("Skipping integration test, test database unavailable: %v", err)
+	}
+	db.Close()
+}
+
+// testDBConnString builds the test database connection string from the environment
+func testDBConnString() string {
+	// Use environment variables or defaults for test database
+	host := getEnvOrDefault("TEST_DB_HOST", "localhost")
+	port := getEnvOrDefault("TEST_DB_PORT", "5432")
+	user := getEnvOrDefault("TEST_DB_USER", "otp_auth")
+	password := getEnvOrDefault("TEST_DB_PASSWORD", "otp_auth")
+
+	// Get base database name and add _test suffix
+	baseDBName := getEnvOrDefault("POSTGRES_DB", "otp_auth")
+	dbName := getEnvOrDefault("TEST_DB_NAME", baseDBName+"_test")
+
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		host, port, user, password, dbName)
+}
+
 // Close closes the test database connection
 func (tdb *TestDB) Close() {
 	if tdb.DB != nil {
@@ -61,7 +77,7 @@ func (tdb *TestDB) Close() {
 
 // CleanTables removes all data from tables (for test isolation)
 func (tdb *TestDB) CleanTables(t *testing.T) {
-	_, err := tdb.DB.Exec("TRUNCATE TABLE otp_rate_limits, otps, users RESTART IDENTITY CASCADE")
+	_, err := tdb.DB.Exec("TRUNCATE TABLE otp_conversion_stats, rate_limit_audit_log, otp_rate_limit_overrides, otp_rate_limits, otp_lockouts, otp_delivery_receipts, otp_outbox, otps, users RESTART IDENTITY CASCADE")
 	require.NoError(t, err, "Failed to clean test tables")
 }
 
@@ -106,21 +122,6 @@ func (tdb *TestDB) CreateValidOTP(t *testing.T, phoneNumber, code string) *entit
 	return tdb.CreateTestOTP(t, phoneNumber, code, time.Now().Add(2*time.Minute))
 }
 
-// CreateTestRateLimit creates a rate limit record for testing
-func (tdb *TestDB) CreateTestRateLimit(t *testing.T, phoneNumber string, requestCount int, windowStart time.Time) *entity.RateLimitInfo {
-	rateLimitInfo := &entity.RateLimitInfo{
-		PhoneNumber:   phoneNumber,
-		RequestCount:  requestCount,
-		LastRequestAt: time.Now(),
-		WindowStartAt: windowStart,
-	}
-
-	// Note: Rate limiting is now handled by Redis, so this is just a mock for tests
-	t.Logf("Mock rate limit created: phone=%s, count=%d", phoneNumber, requestCount)
-
-	return rateLimitInfo
-}
-
 // GetTestLogger creates a test logger
 func GetTestLogger() *logger.Logger {
 	log, err := logger.New("debug", "development")
@@ -165,10 +166,10 @@ func (tdb *TestDB) AssertOTPNotUsed(t *testing.T, otpID int) {
 	require.False(t, isUsed, "OTP should not be marked as used")
 }
 
-// AssertRateLimitExists asserts that a rate limit record exists for a phone number
+// AssertRateLimitExists asserts that a Postgres rate limit record exists for a phone number
 func (tdb *TestDB) AssertRateLimitExists(t *testing.T, phoneNumber string, expectedCount int) {
 	var requestCount int
-	err := tdb.DB.Get(&requestCount, "SELECT request_count FROM otp_rate_limits WHERE phone_number = $1", phoneNumber)
+	err := tdb.DB.Get(&requestCount, "SELECT request_count FROM otp_rate_limits WHERE key = $1", phoneNumber)
 	require.NoError(t, err, "Failed to get rate limit")
 	require.Equal(t, expectedCount, requestCount, "Rate limit count mismatch")
 }
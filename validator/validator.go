@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -64,6 +65,10 @@ func (v *Validator) formatFieldError(err validator.FieldError) string {
 	switch tag {
 	case "required":
 		return fmt.Sprintf("%s is required", field)
+	case "required_without":
+		return fmt.Sprintf("%s is required when %s is not provided", field, toSnakeCase(param))
+	case "excluded_with":
+		return fmt.Sprintf("%s cannot be combined with %s", field, toSnakeCase(param))
 	case "min":
 		if err.Kind() == reflect.String {
 			return fmt.Sprintf("%s must be at least %s characters long", field, param)
@@ -78,6 +83,8 @@ func (v *Validator) formatFieldError(err validator.FieldError) string {
 		return fmt.Sprintf("%s must be exactly %s characters long", field, param)
 	case "email":
 		return fmt.Sprintf("%s must be a valid email address", field)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, param)
 	case "phone":
 		return fmt.Sprintf("%s must be a valid phone number", field)
 	case "phone_number":
@@ -87,6 +94,21 @@ func (v *Validator) formatFieldError(err validator.FieldError) string {
 	}
 }
 
+// toSnakeCase turns a struct field name referenced by a tag parameter into its JSON name
+func toSnakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 // validatePhoneNumber validates phone number format
 // Accepts international format starting with + followed by country code and number
 // Examples: +1234567890, +12345678901, +123456789012
@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"strings"
 	"testing"
 
 	"otp-auth/entity"
@@ -149,6 +150,72 @@ func TestValidator_ValidateVerifyOTPRequest_MissingCode(t *testing.T) {
 	assert.Contains(t, err.Error(), "code")
 }
 
+func TestValidator_ValidateVerifyOTPRequest_PhoneNumberMode(t *testing.T) {
+	v := New()
+
+	req := entity.VerifyOTPRequest{
+		PhoneNumber: "+447700900123",
+		ClientID:    "kiosk",
+		Code:        "123456",
+	}
+
+	err := v.ValidateStruct(&req)
+	assert.NoError(t, err)
+}
+
+func TestValidator_ValidateVerifyOTPRequest_TokenOrPhoneNumber(t *testing.T) {
+	v := New()
+
+	testCases := []struct {
+		name      string
+		req       entity.VerifyOTPRequest
+		errorText string
+	}{
+		{
+			name:      "Neither token nor phone number",
+			req:       entity.VerifyOTPRequest{ClientID: "kiosk", Code: "123456"},
+			errorText: "token is required when phone_number is not provided",
+		},
+		{
+			name:      "Both token and phone number",
+			req:       entity.VerifyOTPRequest{Token: "valid-session-token", PhoneNumber: "+447700900123", ClientID: "kiosk", Code: "123456"},
+			errorText: "token cannot be combined with phone_number",
+		},
+		{
+			name:      "Invalid phone number",
+			req:       entity.VerifyOTPRequest{PhoneNumber: "447700900123", ClientID: "kiosk", Code: "123456"},
+			errorText: "must be a valid phone number",
+		},
+		{
+			name:      "Client ID too long",
+			req:       entity.VerifyOTPRequest{PhoneNumber: "+447700900123", ClientID: strings.Repeat("k", 65), Code: "123456"},
+			errorText: "client_id",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.ValidateStruct(&tc.req)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tc.errorText)
+		})
+	}
+}
+
+func TestValidator_ValidateVerifyOTPRequest_ClientIDCheckedAtRuntime(t *testing.T) {
+	v := New()
+
+	// Whether a client app may verify by phone number depends on its configuration,
+	// so a missing client_id passes validation and is refused by the service
+	req := entity.VerifyOTPRequest{
+		PhoneNumber: "+447700900123",
+		Code:        "123456",
+	}
+
+	err := v.ValidateStruct(&req)
+	assert.NoError(t, err)
+}
+
 func TestValidator_FormatFieldError_PhoneNumberError(t *testing.T) {
 	v := New()
 